@@ -0,0 +1,80 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Address normalization rules, applied per recipient domain.
+const (
+	normalizePlusTag = "plus" // drop "+tag" from the local part
+	normalizeDots    = "dots" // drop "." from the local part
+)
+
+// gmailAddressNormalization is used when address_normalization is true.
+var gmailAddressNormalization = map[string][]string{
+	"gmail.com":      {normalizePlusTag, normalizeDots},
+	"googlemail.com": {normalizePlusTag, normalizeDots},
+}
+
+func validateAddressNormalization(rules map[string][]string) error {
+	for domain, list := range rules {
+		for _, rule := range list {
+			switch rule {
+			case normalizePlusTag, normalizeDots:
+			default:
+				return fmt.Errorf("address_normalization: unknown rule %q for %q (expected plus or dots)", rule, domain)
+			}
+		}
+	}
+	return nil
+}
+
+// recipientKey identifies addr for dedup store and denylist checks:
+// lowercased, then rewritten by cfg.AddressNormalization for its domain ("*"
+// covers domains without an entry). It is never used as a delivery address.
+func recipientKey(cfg *EmailConfig, addr string) string {
+	addr = strings.ToLower(strings.TrimSpace(addr))
+	at := strings.LastIndex(addr, "@")
+	if at <= 0 || len(cfg.AddressNormalization) == 0 {
+		return addr
+	}
+	local, domain := addr[:at], addr[at+1:]
+	rules, ok := cfg.AddressNormalization[domain]
+	if !ok {
+		rules = cfg.AddressNormalization["*"]
+	}
+	for _, rule := range rules {
+		switch rule {
+		case normalizePlusTag:
+			if i := strings.Index(local, "+"); i > 0 {
+				local = local[:i]
+			}
+		case normalizeDots:
+			local = strings.ReplaceAll(local, ".", "")
+		}
+	}
+	return local + "@" + domain
+}
+
+func parseAddressNormalization(val any) map[string][]string {
+	switch v := val.(type) {
+	case bool, string:
+		if normalizeBool(v) {
+			return gmailAddressNormalization
+		}
+	default:
+		rules := map[string][]string{}
+		for domain, list := range normalizeObject(v) {
+			var normalized []string
+			for _, rule := range normalizeStringSlice(list) {
+				normalized = append(normalized, strings.ToLower(rule))
+			}
+			rules[strings.ToLower(strings.TrimSpace(domain))] = normalized
+		}
+		if len(rules) > 0 {
+			return rules
+		}
+	}
+	return nil
+}
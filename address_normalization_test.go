@@ -0,0 +1,64 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestAddressNormalization_DedupsButDeliversAsEntered(t *testing.T) {
+	defer withTempSendLog(t)()
+	withTempDedupStore(t, nil)
+	srv := newStubSMTPServer(t)
+
+	parsed, err := parseConfig(map[string]any{
+		"host": "smtp.example.com", "from": "sender@example.com", "to": "x@example.com",
+		"normalize_addresses": true,
+	})
+	if err != nil {
+		t.Fatalf("parseConfig: %v", err)
+	}
+	if strings.Join(parsed.AddressNormalization["gmail.com"], ",") != "plus,dots" {
+		t.Fatalf("expected the gmail rules, got %v", parsed.AddressNormalization)
+	}
+	if recipientKey(parsed, "A.B+promo@Gmail.com") != "ab@gmail.com" || recipientKey(parsed, "a.b+promo@example.com") != "a.b+promo@example.com" {
+		t.Fatalf("unexpected keys %q %q", recipientKey(parsed, "A.B+promo@Gmail.com"), recipientKey(parsed, "a.b+promo@example.com"))
+	}
+
+	tagged := srv.config()
+	tagged.To = []string{"a.b+promo@gmail.com"}
+	tagged.AddressNormalization = parsed.AddressNormalization
+	plain := *tagged
+	plain.To = []string{"ab@gmail.com"}
+	tagged.ScheduleMode, plain.ScheduleMode = "once", "once"
+	if dedupKeyFromConfig(tagged, nil) != dedupKeyFromConfig(&plain, nil) {
+		t.Fatalf("expected both addresses to share a dedup key")
+	}
+	both := &EmailConfig{To: []string{"a.b+promo@gmail.com", "ab@gmail.com"}, DuplicateRecipients: duplicateRecipientsPreferVisible, AddressNormalization: parsed.AddressNormalization}
+	applyDuplicateRecipientPolicy(both)
+	if recipients, _ := gatherRecipients(both); strings.Join(recipients, ",") != "a.b+promo@gmail.com,ab@gmail.com" {
+		t.Fatalf("expected both addresses in the envelope, got %q", recipients)
+	}
+
+	tagged.ScheduleMode, plain.ScheduleMode = "", ""
+	combined := *tagged
+	combined.To = []string{"a.b+promo@gmail.com", "ab@gmail.com"}
+	for _, cfg := range []*EmailConfig{tagged, &plain, &combined} {
+		if err := sendEmail(cfg, nil); err != nil {
+			t.Fatalf("send: %v", err)
+		}
+	}
+	var rcpts []string
+	for _, c := range srv.Commands() {
+		if strings.HasPrefix(c, "RCPT TO:") {
+			rcpts = append(rcpts, strings.TrimPrefix(c, "RCPT TO:"))
+		}
+	}
+	if strings.Join(rcpts, ",") != "<a.b+promo@gmail.com>,<ab@gmail.com>,<a.b+promo@gmail.com>,<ab@gmail.com>" {
+		t.Fatalf("expected delivery to the addresses as entered, got %q", rcpts)
+	}
+
+	parsed.AddressNormalization = map[string][]string{"*": {"lowercase"}}
+	if err := finalizeConfig(parsed); err == nil {
+		t.Fatalf("expected an unknown rule to be rejected")
+	}
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// Validation verdicts reported in ValidationResult.Verdict.
+const (
+	verdictValid   = "valid"
+	verdictRisky   = "risky"
+	verdictInvalid = "invalid"
+	verdictUnknown = "unknown"
+)
+
+// ValidationResult is a provider's assessment of one recipient address.
+type ValidationResult struct {
+	Address string
+	// Verdict is "valid", "risky", "invalid" or "unknown".
+	Verdict string
+	// Deliverable is true only for a "valid" verdict.
+	Deliverable bool
+	// Risk is the provider's risk level ("low", "medium", "high") when given.
+	Risk string
+	// Score is the provider's confidence, 0 to 1, when given.
+	Score float64
+	// Suggestion is a corrected address the provider proposes, if any.
+	Suggestion string
+	// Reasons lists the provider's explanations, if any.
+	Reasons []string
+}
+
+// addressValidator builds the validation request for one provider and reads
+// its response.
+type addressValidator struct {
+	request func(base *url.URL, address string) (*http.Request, error)
+	parse   func(address string, body []byte) (ValidationResult, error)
+}
+
+var addressValidators = map[string]addressValidator{
+	"sendgrid": {request: sendgridValidationRequest, parse: parseSendgridValidation},
+	"mailgun":  {request: mailgunValidationRequest, parse: parseMailgunValidation},
+}
+
+// ValidateAddress asks cfg's provider to assess address through its email
+// validation API, using the configured credentials, so recipients can be
+// screened before sending. Providers without such an API return an error;
+// request failures are classified like VerifyCredentials.
+func ValidateAddress(cfg *EmailConfig, address string) (ValidationResult, error) {
+	validator, ok := addressValidators[canonicalProviderName(cfg.Provider)]
+	if !ok {
+		return ValidationResult{}, fmt.Errorf("no address validation available for provider %q", cfg.Provider)
+	}
+	base, err := url.Parse(cfg.Endpoint)
+	if err != nil || base.Host == "" {
+		return ValidationResult{}, fmt.Errorf("invalid endpoint %q", cfg.Endpoint)
+	}
+	req, err := validator.request(&url.URL{Scheme: base.Scheme, Host: base.Host}, strings.TrimSpace(address))
+	if err != nil {
+		return ValidationResult{}, err
+	}
+	req.Header.Set("Accept", "application/json")
+	applyAuthHeaders(req, cfg, nil)
+
+	resp, err := getHTTPClient(cfg).Do(req)
+	if err != nil {
+		return ValidationResult{}, &ConnectionError{Err: err}
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 500 {
+		return ValidationResult{}, &ConnectionError{Err: fmt.Errorf("address validation failed: %s", resp.Status)}
+	}
+	if resp.StatusCode >= 300 {
+		return ValidationResult{}, classifyHTTPStatus(resp, fmt.Errorf("address validation failed: %s", resp.Status))
+	}
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return ValidationResult{}, &ConnectionError{Err: err}
+	}
+	result, err := validator.parse(address, body)
+	if err != nil {
+		return ValidationResult{}, fmt.Errorf("address validation response: %w", err)
+	}
+	result.Deliverable = result.Verdict == verdictValid
+	return result, nil
+}
+
+func sendgridValidationRequest(base *url.URL, address string) (*http.Request, error) {
+	body, err := json.Marshal(map[string]string{"email": address})
+	if err != nil {
+		return nil, err
+	}
+	base.Path = "/v3/validations/email"
+	req, err := http.NewRequest(http.MethodPost, base.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	return req, nil
+}
+
+func parseSendgridValidation(address string, body []byte) (ValidationResult, error) {
+	var resp struct {
+		Result struct {
+			Email      string  `json:"email"`
+			Verdict    string  `json:"verdict"`
+			Score      float64 `json:"score"`
+			Suggestion string  `json:"suggestion"`
+		} `json:"result"`
+	}
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return ValidationResult{}, err
+	}
+	result := ValidationResult{Address: address, Score: resp.Result.Score, Suggestion: resp.Result.Suggestion}
+	switch strings.ToLower(resp.Result.Verdict) {
+	case "valid":
+		result.Verdict, result.Risk = verdictValid, "low"
+	case "risky":
+		result.Verdict, result.Risk = verdictRisky, "medium"
+	case "invalid":
+		result.Verdict, result.Risk = verdictInvalid, "high"
+	default:
+		result.Verdict = verdictUnknown
+	}
+	return result, nil
+}
+
+func mailgunValidationRequest(base *url.URL, address string) (*http.Request, error) {
+	base.Path = "/v4/address/validate"
+	base.RawQuery = url.Values{"address": {address}}.Encode()
+	return http.NewRequest(http.MethodGet, base.String(), nil)
+}
+
+func parseMailgunValidation(address string, body []byte) (ValidationResult, error) {
+	var resp struct {
+		Result     string   `json:"result"`
+		Risk       string   `json:"risk"`
+		Reason     []string `json:"reason"`
+		DidYouMean string   `json:"did_you_mean"`
+	}
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return ValidationResult{}, err
+	}
+	result := ValidationResult{Address: address, Risk: strings.ToLower(resp.Risk), Reasons: resp.Reason, Suggestion: resp.DidYouMean}
+	switch strings.ToLower(resp.Result) {
+	case "deliverable":
+		result.Verdict = verdictValid
+	case "undeliverable", "do_not_send":
+		result.Verdict = verdictInvalid
+	case "catch_all":
+		result.Verdict = verdictRisky
+	default:
+		result.Verdict = verdictUnknown
+	}
+	return result, nil
+}
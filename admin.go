@@ -0,0 +1,258 @@
+package main
+
+import (
+	"bufio"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/mail"
+	"os"
+	"strings"
+	"time"
+)
+
+// adminJob is the /jobs view of a scheduled job. It omits the full config so
+// credentials never leave the worker.
+type adminJob struct {
+	ID       string         `json:"id"`
+	RunAt    time.Time      `json:"run_at"`
+	Attempts int            `json:"attempts"`
+	Priority int            `json:"priority,omitempty"`
+	Provider string         `json:"provider,omitempty"`
+	Subject  string         `json:"subject,omitempty"`
+	To       []string       `json:"to,omitempty"`
+	Meta     map[string]any `json:"meta,omitempty"`
+	Result   JobResult      `json:"result,omitempty"`
+	// LeasedUntil is set while the job is sending.
+	LeasedUntil time.Time `json:"leased_until,omitzero"`
+}
+
+// adminStats is the /stats payload.
+type adminStats struct {
+	PendingJobs int               `json:"pending_jobs"`
+	DueJobs     int               `json:"due_jobs"`
+	Sends       sendLogStats      `json:"sends"`
+	JobResults  map[JobResult]int `json:"job_results"`
+}
+
+type sendLogStats struct {
+	Attempts   int                    `json:"attempts"`
+	Successes  int                    `json:"successes"`
+	Failures   int                    `json:"failures"`
+	ByProvider map[string]*sendCounts `json:"by_provider"`
+}
+
+type sendCounts struct {
+	Successes int `json:"successes"`
+	Failures  int `json:"failures"`
+}
+
+// adminPreview is the /preview payload: the message a config would send,
+// rendered but not sent. Sensitive header values are redacted.
+type adminPreview struct {
+	Provider string            `json:"provider,omitempty"`
+	From     string            `json:"from"`
+	To       []string          `json:"to"`
+	CC       []string          `json:"cc,omitempty"`
+	BCC      []string          `json:"bcc,omitempty"`
+	ReplyTo  []string          `json:"reply_to,omitempty"`
+	Subject  string            `json:"subject"`
+	Headers  map[string]string `json:"headers,omitempty"`
+	TextBody string            `json:"text_body,omitempty"`
+	HTMLBody string            `json:"html_body,omitempty"`
+}
+
+// maxPreviewBytes bounds the config accepted by /preview.
+const maxPreviewBytes = 1 << 20
+
+// newAdminHandler exposes /healthz, /jobs, /stats and /preview for a worker
+// backed by store. Every endpoint but /healthz requires token as a bearer
+// token.
+func newAdminHandler(store JobStore, token string) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		writeAdminJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+	})
+	handle := func(pattern string, h http.HandlerFunc) {
+		mux.Handle(pattern, requireAdminToken(token, h))
+	}
+	handle("/jobs", func(w http.ResponseWriter, r *http.Request) {
+		jobs, err := store.ListAll()
+		if err != nil {
+			writeAdminJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+			return
+		}
+		out := make([]adminJob, 0, len(jobs))
+		for _, j := range jobs {
+			view := adminJob{ID: j.ID, RunAt: j.RunAt, Attempts: j.Attempts, Priority: j.Priority, Meta: j.Meta, LeasedUntil: j.LeasedUntil}
+			if j.Config != nil {
+				view.Provider = j.Config.ProviderOrHost()
+				view.Subject = j.Config.Subject
+				view.To = j.Config.To
+			}
+			if res, ok := getJobResult(j.ID); ok {
+				view.Result = res
+			}
+			out = append(out, view)
+		}
+		writeAdminJSON(w, http.StatusOK, out)
+	})
+	handle("/stats", func(w http.ResponseWriter, r *http.Request) {
+		stats, err := collectAdminStats(store, time.Now())
+		if err != nil {
+			writeAdminJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+			return
+		}
+		writeAdminJSON(w, http.StatusOK, stats)
+	})
+	handle("/preview", servePreview)
+	return mux
+}
+
+// requireAdminToken rejects requests without "Authorization: Bearer token".
+// An empty token rejects everything.
+func requireAdminToken(token string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if token == "" || !ok || subtle.ConstantTimeCompare([]byte(got), []byte(token)) != 1 {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			writeAdminJSON(w, http.StatusUnauthorized, map[string]string{"error": "unauthorized"})
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// servePreview renders a POSTed config, with its sample data, the way a send
+// would, without sending. The config is parsed render-only, so it cannot make
+// the worker read files, run commands or fetch URLs. ?format=html returns
+// just the HTML body so it can be viewed directly in a browser.
+func servePreview(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		writeAdminJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "POST a config to preview"})
+		return
+	}
+	var raw map[string]any
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxPreviewBytes)).Decode(&raw); err != nil {
+		writeAdminJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid config: " + err.Error()})
+		return
+	}
+	cfg, err := parsePreviewConfig(raw)
+	if err == nil {
+		cfg, err = prepareSendConfig(cfg)
+	}
+	if err != nil {
+		writeAdminJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+	if r.URL.Query().Get("format") == "html" {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		io.WriteString(w, cfg.HTMLBody)
+		return
+	}
+	writeAdminJSON(w, http.StatusOK, adminPreview{
+		Provider: cfg.ProviderOrHost(),
+		From:     (&mail.Address{Name: cfg.FromName, Address: cfg.From}).String(),
+		To:       cfg.To,
+		CC:       cfg.CC,
+		BCC:      cfg.BCC,
+		ReplyTo:  cfg.ReplyTo,
+		Subject:  cfg.Subject,
+		Headers:  redactStringMap(cfg.Headers),
+		TextBody: cfg.TextBody,
+		HTMLBody: cfg.HTMLBody,
+	})
+}
+
+// startAdminServer serves the admin endpoints on addr in the background. addr
+// must name the interface to bind, and token must be set.
+func startAdminServer(addr, token string, store JobStore) (*http.Server, error) {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, fmt.Errorf("admin address %q: %w", addr, err)
+	}
+	if host == "" {
+		return nil, fmt.Errorf("admin address %q must name the interface to bind, e.g. 127.0.0.1", addr)
+	}
+	if token == "" {
+		return nil, errors.New("an admin token is required")
+	}
+	srv := &http.Server{Addr: addr, Handler: newAdminHandler(store, token), ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		logger().Info("admin server listening", "addr", addr)
+		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logger().Error("admin server stopped", "error", err)
+		}
+	}()
+	return srv, nil
+}
+
+func collectAdminStats(store JobStore, now time.Time) (*adminStats, error) {
+	jobs, err := store.ListAll()
+	if err != nil {
+		return nil, err
+	}
+	stats := &adminStats{PendingJobs: len(jobs), JobResults: jobResultCounts()}
+	for _, j := range jobs {
+		if !j.RunAt.After(now) {
+			stats.DueJobs++
+		}
+	}
+	if err := FlushSendLog(); err != nil {
+		return nil, err
+	}
+	f, err := os.Open(sendLogFile)
+	if err != nil {
+		if os.IsNotExist(err) {
+			stats.Sends.ByProvider = map[string]*sendCounts{}
+			return stats, nil
+		}
+		return nil, err
+	}
+	defer f.Close()
+	sends, err := sendLogStatsFromReader(f)
+	if err != nil {
+		return nil, err
+	}
+	stats.Sends = sends
+	return stats, nil
+}
+
+// sendLogStatsFromReader tallies attempts in a JSONL send log; malformed lines are skipped.
+func sendLogStatsFromReader(r io.Reader) (sendLogStats, error) {
+	stats := sendLogStats{ByProvider: map[string]*sendCounts{}}
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		var entry SendLogEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			continue
+		}
+		stats.Attempts++
+		counts := stats.ByProvider[entry.Provider]
+		if counts == nil {
+			counts = &sendCounts{}
+			stats.ByProvider[entry.Provider] = counts
+		}
+		if entry.Success {
+			stats.Successes++
+			counts.Successes++
+		} else {
+			stats.Failures++
+			counts.Failures++
+		}
+	}
+	return stats, scanner.Err()
+}
+
+func writeAdminJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		logger().Error("admin: cannot encode response", "error", err)
+	}
+}
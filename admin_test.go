@@ -0,0 +1,228 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func withTempJobResults(t *testing.T, results map[string]JobResult) func() {
+	path := filepath.Join(t.TempDir(), "send_results.json")
+	data, _ := json.Marshal(results)
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatalf("cannot write results: %v", err)
+	}
+	jobResultMu.Lock()
+	orig, origCache, origInit := jobResultDBFile, jobResultCache, jobResultsInit
+	jobResultDBFile, jobResultCache, jobResultsInit = path, nil, false
+	jobResultMu.Unlock()
+	return func() {
+		jobResultMu.Lock()
+		jobResultDBFile, jobResultCache, jobResultsInit = orig, origCache, origInit
+		jobResultMu.Unlock()
+	}
+}
+
+func seededAdminHandler(t *testing.T) http.Handler {
+	t.Helper()
+	store := NewFileJobStore(filepath.Join(t.TempDir(), "jobs.json"))
+	now := time.Now().UTC()
+	jobs := []*ScheduledEmail{
+		{ID: "job-due", Config: &EmailConfig{Provider: "sendgrid", Subject: "Due", To: []string{"a@example.com"}, Password: "secret"}, RunAt: now.Add(-time.Minute)},
+		{ID: "job-later", Config: &EmailConfig{Provider: "smtp", Subject: "Later"}, RunAt: now.Add(time.Hour), Priority: 3},
+	}
+	for _, j := range jobs {
+		if err := store.Add(j); err != nil {
+			t.Fatalf("add: %v", err)
+		}
+	}
+	log := strings.Join([]string{
+		`{"timestamp":"2026-01-01T00:00:00Z","attempt":1,"provider":"sendgrid","success":true}`,
+		`{"timestamp":"2026-01-01T00:00:01Z","attempt":1,"provider":"smtp","success":false,"error":"boom"}`,
+		`{"timestamp":"2026-01-01T00:00:02Z","attempt":2,"provider":"smtp","success":true}`,
+		`not json`,
+	}, "\n") + "\n"
+	if err := os.WriteFile(sendLogFile, []byte(log), 0o644); err != nil {
+		t.Fatalf("cannot write send log: %v", err)
+	}
+	return newAdminHandler(store, adminTestToken)
+}
+
+const adminTestToken = "admin-token"
+
+// adminRequest builds a request carrying the test admin token.
+func adminRequest(method, path string, body io.Reader) *http.Request {
+	req := httptest.NewRequest(method, path, body)
+	req.Header.Set("Authorization", "Bearer "+adminTestToken)
+	return req
+}
+
+func getAdmin(t *testing.T, h http.Handler, path string, v any) {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, adminRequest(http.MethodGet, path, nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("%s: expected 200, got %d: %s", path, rec.Code, rec.Body.String())
+	}
+	if strings.Contains(rec.Body.String(), "secret") {
+		t.Fatalf("%s leaked credentials: %s", path, rec.Body.String())
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), v); err != nil {
+		t.Fatalf("%s: cannot decode %q: %v", path, rec.Body.String(), err)
+	}
+}
+
+func TestAdminHandler_HealthzAndJobs(t *testing.T) {
+	defer withTempSendLog(t)()
+	defer withTempJobResults(t, map[string]JobResult{"job-due": JobResultFailed})()
+	h := seededAdminHandler(t)
+
+	var health map[string]string
+	getAdmin(t, h, "/healthz", &health)
+	if health["status"] != "ok" {
+		t.Fatalf("unexpected health response %v", health)
+	}
+
+	var jobs []adminJob
+	getAdmin(t, h, "/jobs", &jobs)
+	if len(jobs) != 2 || jobs[0].ID != "job-due" || jobs[1].ID != "job-later" {
+		t.Fatalf("unexpected jobs %+v", jobs)
+	}
+	if jobs[0].Provider != "sendgrid" || jobs[0].Subject != "Due" || jobs[0].Result != JobResultFailed {
+		t.Fatalf("unexpected job view %+v", jobs[0])
+	}
+	if jobs[1].Priority != 3 {
+		t.Fatalf("expected priority 3, got %d", jobs[1].Priority)
+	}
+}
+
+func TestAdminHandler_Stats(t *testing.T) {
+	defer withTempSendLog(t)()
+	defer withTempJobResults(t, map[string]JobResult{"a": JobResultSuccess, "b": JobResultSuccess, "c": JobResultBlocked})()
+	h := seededAdminHandler(t)
+
+	var stats adminStats
+	getAdmin(t, h, "/stats", &stats)
+	if stats.PendingJobs != 2 || stats.DueJobs != 1 {
+		t.Fatalf("unexpected job counts %+v", stats)
+	}
+	if stats.Sends.Attempts != 3 || stats.Sends.Successes != 2 || stats.Sends.Failures != 1 {
+		t.Fatalf("unexpected send counts %+v", stats.Sends)
+	}
+	if smtp := stats.Sends.ByProvider["smtp"]; smtp == nil || smtp.Successes != 1 || smtp.Failures != 1 {
+		t.Fatalf("unexpected smtp counts %+v", smtp)
+	}
+	if stats.JobResults[JobResultSuccess] != 2 || stats.JobResults[JobResultBlocked] != 1 {
+		t.Fatalf("unexpected job results %v", stats.JobResults)
+	}
+}
+
+func TestAdminHandler_Preview(t *testing.T) {
+	h := newAdminHandler(NewFileJobStore(filepath.Join(t.TempDir(), "jobs.json")), adminTestToken)
+	body := `{
+		"host": "smtp.example.com", "from": "news@example.com", "to": "ann@example.com",
+		"subject": "Hi {{name}}", "html_body": "<h1>Welcome, {{name}}!</h1>",
+		"headers": {"X-Api-Key": "secret"},
+		"data": {"name": "Ann"}
+	}`
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, adminRequest(http.MethodPost, "/preview", strings.NewReader(body)))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var preview adminPreview
+	if err := json.Unmarshal(rec.Body.Bytes(), &preview); err != nil {
+		t.Fatal(err)
+	}
+	if preview.HTMLBody != "<h1>Welcome, Ann!</h1>" || preview.Subject != "Hi Ann" {
+		t.Fatalf("expected the rendered template, got %+v", preview)
+	}
+	if len(preview.To) != 1 || preview.To[0] != "ann@example.com" {
+		t.Fatalf("unexpected recipients %v", preview.To)
+	}
+	if strings.Contains(rec.Body.String(), "secret") {
+		t.Fatalf("preview leaked a header credential: %s", rec.Body.String())
+	}
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, adminRequest(http.MethodPost, "/preview?format=html", strings.NewReader(body)))
+	if rec.Body.String() != "<h1>Welcome, Ann!</h1>" || !strings.HasPrefix(rec.Header().Get("Content-Type"), "text/html") {
+		t.Fatalf("expected the raw HTML body, got %q (%s)", rec.Body.String(), rec.Header().Get("Content-Type"))
+	}
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, adminRequest(http.MethodGet, "/preview", nil))
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Fatalf("expected 405 for GET, got %d", rec.Code)
+	}
+}
+
+func TestAdminHandler_RequiresToken(t *testing.T) {
+	h := newAdminHandler(NewFileJobStore(filepath.Join(t.TempDir(), "jobs.json")), adminTestToken)
+	for _, auth := range []string{"", "Bearer wrong", "Basic " + adminTestToken} {
+		req := httptest.NewRequest(http.MethodGet, "/jobs", nil)
+		if auth != "" {
+			req.Header.Set("Authorization", auth)
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		if rec.Code != http.StatusUnauthorized {
+			t.Fatalf("Authorization %q: expected 401, got %d", auth, rec.Code)
+		}
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected /healthz to stay open, got %d", rec.Code)
+	}
+
+	for _, tc := range []struct{ addr, token string }{{":8090", adminTestToken}, {"127.0.0.1:8090", ""}} {
+		if srv, err := startAdminServer(tc.addr, tc.token, nil); err == nil {
+			srv.Close()
+			t.Fatalf("expected startAdminServer(%q, %q) to fail", tc.addr, tc.token)
+		}
+	}
+}
+
+func TestAdminHandler_PreviewIsRenderOnly(t *testing.T) {
+	h := newAdminHandler(NewFileJobStore(filepath.Join(t.TempDir(), "jobs.json")), adminTestToken)
+	marker := filepath.Join(t.TempDir(), "ran")
+	template := filepath.Join(t.TempDir(), "body.html")
+	if err := os.WriteFile(template, []byte("host secret"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PREVIEW_TEST_SECRET", "env secret")
+	base := `"host": "smtp.example.com", "from": "news@example.com", "subject": "Hi"`
+	for name, extra := range map[string]string{
+		"cmd secret":      `"to": "a@example.com", "password": "cmd://touch ` + marker + `"`,
+		"file secret":     `"to": "a@example.com", "api_key": "file://` + template + `"`,
+		"template path":   `"to": "a@example.com", "html_template": "` + template + `"`,
+		"file recipients": `"to": "file://` + template + `"`,
+		"url recipients":  `"to": "http://127.0.0.1:1/list.csv"`,
+	} {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, adminRequest(http.MethodPost, "/preview", strings.NewReader("{"+base+", "+extra+"}")))
+		if rec.Code != http.StatusBadRequest {
+			t.Fatalf("%s: expected 400, got %d: %s", name, rec.Code, rec.Body.String())
+		}
+		if strings.Contains(rec.Body.String(), "host secret") {
+			t.Fatalf("%s: preview leaked host data: %s", name, rec.Body.String())
+		}
+	}
+	if _, err := os.Stat(marker); !os.IsNotExist(err) {
+		t.Fatalf("the cmd:// secret ran during preview")
+	}
+
+	rec := httptest.NewRecorder()
+	body := `{` + base + `, "to": "a@example.com", "text_body": "[{{env.PREVIEW_TEST_SECRET}}]"}`
+	h.ServeHTTP(rec, adminRequest(http.MethodPost, "/preview", strings.NewReader(body)))
+	if strings.Contains(rec.Body.String(), "env secret") {
+		t.Fatalf("preview resolved an environment placeholder: %s", rec.Body.String())
+	}
+}
@@ -4,13 +4,15 @@ import (
 	"encoding/base64"
 	"errors"
 	"fmt"
-	"io"
 	"mime"
 	"net/http"
 	"net/url"
 	"os"
 	"path/filepath"
 	"strings"
+	"unicode"
+
+	"golang.org/x/text/unicode/norm"
 )
 
 func loadAttachment(att Attachment) ([]byte, string, string, error) {
@@ -136,28 +138,6 @@ func detectMIMEType(filename string, data []byte) string {
 	return http.DetectContentType(data)
 }
 
-func downloadFile(link string) ([]byte, string, error) {
-	resp, err := http.Get(link)
-	if err != nil {
-		return nil, "", err
-	}
-	defer resp.Body.Close()
-	if resp.StatusCode != http.StatusOK {
-		return nil, "", fmt.Errorf("failed to download %s: %s", link, resp.Status)
-	}
-	data, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return nil, "", err
-	}
-	filename := filenameFromURL(link)
-	if disp := resp.Header.Get("Content-Disposition"); disp != "" {
-		if name := parseFilenameFromDisposition(disp); name != "" {
-			filename = name
-		}
-	}
-	return data, filename, nil
-}
-
 func filenameFromURL(link string) string {
 	parsed, err := url.Parse(link)
 	if err != nil {
@@ -174,6 +154,10 @@ func filenameFromURL(link string) string {
 }
 
 func parseFilenameFromDisposition(header string) string {
+	// ParseMediaType also decodes RFC 2231 filename* parameters.
+	if _, params, err := mime.ParseMediaType(header); err == nil && params["filename"] != "" {
+		return params["filename"]
+	}
 	parts := strings.Split(header, ";")
 	for _, part := range parts {
 		part = strings.TrimSpace(part)
@@ -252,6 +236,57 @@ func normalizeAttachmentItem(item any) (Attachment, error) {
 	}
 }
 
+// contentDisposition formats a Content-Disposition value for filename. A
+// non-ASCII name is sent as an RFC 2231 filename* parameter, after an ASCII
+// filename fallback for clients that do not read it.
+func contentDisposition(disposition, filename string) string {
+	quote := strings.NewReplacer(`\`, `\\`, `"`, `\"`)
+	if isPrintableASCII(filename) {
+		return fmt.Sprintf(`%s; filename="%s"`, disposition, quote.Replace(filename))
+	}
+	return fmt.Sprintf(`%s; filename="%s"; filename*=UTF-8''%s`, disposition, quote.Replace(asciiFilename(filename)), rfc2231Escape(filename))
+}
+
+func isPrintableASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] < 0x20 || s[i] > 0x7e {
+			return false
+		}
+	}
+	return true
+}
+
+// asciiFilename approximates name in ASCII: accents are dropped and other
+// non-ASCII characters become "_".
+func asciiFilename(name string) string {
+	var b strings.Builder
+	for _, r := range norm.NFD.String(name) {
+		switch {
+		case unicode.Is(unicode.Mn, r):
+		case r >= 0x20 && r <= 0x7e:
+			b.WriteRune(r)
+		default:
+			b.WriteByte('_')
+		}
+	}
+	return b.String()
+}
+
+// rfc2231Escape percent-encodes s, leaving only RFC 2231 attribute
+// characters as they are.
+func rfc2231Escape(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' || strings.IndexByte("!#$&+-.^_`|~", c) >= 0 {
+			b.WriteByte(c)
+			continue
+		}
+		fmt.Fprintf(&b, "%%%02X", c)
+	}
+	return b.String()
+}
+
 func writeAttachmentPart(msg *strings.Builder, att Attachment, boundary string, inline bool) error {
 	data, filename, mimeType, err := loadAttachment(att)
 	if err != nil {
@@ -263,7 +298,7 @@ func writeAttachmentPart(msg *strings.Builder, att Attachment, boundary string,
 	if inline {
 		disposition = "inline"
 	}
-	msg.WriteString(fmt.Sprintf("Content-Disposition: %s; filename=\"%s\"\r\n", disposition, filename))
+	msg.WriteString("Content-Disposition: " + contentDisposition(disposition, filename) + "\r\n")
 	if inline {
 		cid := att.ContentID
 		if cid == "" {
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// URL attachments are cached in memory so a batch referencing the same
+// source downloads it once. An entry is reused without a request for
+// attachmentCacheTTL, then revalidated with its ETag when it has one. The
+// cache holds at most attachmentCacheMaxBytes, evicting the oldest entries.
+var (
+	attachmentCacheTTL      = time.Minute
+	attachmentCacheMaxBytes = 64 << 20
+)
+
+// attachmentDownload is one cached download; ready closes once it finishes.
+type attachmentDownload struct {
+	ready    chan struct{}
+	data     []byte
+	filename string
+	etag     string
+	fetched  time.Time
+	err      error
+}
+
+var (
+	attachmentCacheMu    sync.Mutex
+	attachmentCache      = map[string]*attachmentDownload{}
+	attachmentCacheBytes int
+)
+
+// downloadFile returns the content and filename at link, from the cache when
+// it holds a fresh copy. Concurrent calls for the same link share one request.
+func downloadFile(link string) ([]byte, string, error) {
+	attachmentCacheMu.Lock()
+	entry := attachmentCache[link]
+	if entry != nil {
+		attachmentCacheMu.Unlock()
+		<-entry.ready
+		if entry.err == nil && time.Since(entry.fetched) < attachmentCacheTTL {
+			return entry.data, entry.filename, nil
+		}
+		attachmentCacheMu.Lock()
+		if current := attachmentCache[link]; current != entry {
+			// Another caller already started a refresh; wait for it instead.
+			attachmentCacheMu.Unlock()
+			return downloadFile(link)
+		}
+		removeCachedDownload(link)
+	}
+	next := &attachmentDownload{ready: make(chan struct{})}
+	attachmentCache[link] = next
+	attachmentCacheMu.Unlock()
+
+	var prev *attachmentDownload
+	if entry != nil && entry.err == nil {
+		prev = entry
+	}
+	next.data, next.filename, next.etag, next.err = fetchAttachment(link, prev)
+	next.fetched = time.Now()
+	close(next.ready)
+
+	attachmentCacheMu.Lock()
+	defer attachmentCacheMu.Unlock()
+	if attachmentCache[link] == next {
+		if next.err != nil || len(next.data) > attachmentCacheMaxBytes {
+			delete(attachmentCache, link)
+		} else {
+			attachmentCacheBytes += len(next.data)
+			evictCachedDownloads()
+		}
+	}
+	return next.data, next.filename, next.err
+}
+
+// fetchAttachment downloads link. With prev, the request is conditional on
+// its ETag and a 304 reply reuses its content.
+func fetchAttachment(link string, prev *attachmentDownload) ([]byte, string, string, error) {
+	req, err := http.NewRequest(http.MethodGet, link, nil)
+	if err != nil {
+		return nil, "", "", err
+	}
+	if prev != nil && prev.etag != "" {
+		req.Header.Set("If-None-Match", prev.etag)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, "", "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotModified && prev != nil {
+		return prev.data, prev.filename, prev.etag, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, "", "", fmt.Errorf("failed to download %s: %s", link, resp.Status)
+	}
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, "", "", err
+	}
+	filename := filenameFromURL(link)
+	if disp := resp.Header.Get("Content-Disposition"); disp != "" {
+		if name := parseFilenameFromDisposition(disp); name != "" {
+			filename = name
+		}
+	}
+	return data, filename, resp.Header.Get("ETag"), nil
+}
+
+// removeCachedDownload drops link's entry; the caller holds attachmentCacheMu.
+func removeCachedDownload(link string) {
+	if entry, ok := attachmentCache[link]; ok {
+		attachmentCacheBytes -= len(entry.data)
+		delete(attachmentCache, link)
+	}
+}
+
+// evictCachedDownloads removes the oldest finished entries until the cache
+// fits attachmentCacheMaxBytes; the caller holds attachmentCacheMu.
+func evictCachedDownloads() {
+	for attachmentCacheBytes > attachmentCacheMaxBytes {
+		oldest := ""
+		var oldestAt time.Time
+		for link, entry := range attachmentCache {
+			select {
+			case <-entry.ready:
+			default:
+				continue
+			}
+			if oldest == "" || entry.fetched.Before(oldestAt) {
+				oldest, oldestAt = link, entry.fetched
+			}
+		}
+		if oldest == "" {
+			return
+		}
+		removeCachedDownload(oldest)
+	}
+}
@@ -0,0 +1,202 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/mail"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestScheduledJob_ResolvesAttachmentPathAtRunTime(t *testing.T) {
+	dir := t.TempDir()
+	cfg, err := parseConfig(map[string]any{
+		"from":        "reports@example.com",
+		"to":          "user@example.com",
+		"host":        "smtp.example.com",
+		"subject":     "Weekly report",
+		"body_text":   "Attached.",
+		"attachments": []any{"{{env.EMAIL_TEST_REPORT_PATH}}", map[string]any{"path": "{{summary_path}}", "name": "summary.txt"}},
+	})
+	if err != nil {
+		t.Fatalf("parseConfig with unresolved attachment paths: %v", err)
+	}
+
+	store := NewFileJobStore(filepath.Join(dir, "jobs.json"))
+	if _, err := NewScheduler(store, time.Minute).Schedule(cfg, time.Now().Add(-time.Second), nil); err != nil {
+		t.Fatalf("schedule: %v", err)
+	}
+
+	// Data and environment only become available when the job runs.
+	report := filepath.Join(dir, "report.csv")
+	summary := filepath.Join(dir, "summary-data.txt")
+	for _, p := range []string{report, summary} {
+		if err := os.WriteFile(p, []byte("content of "+filepath.Base(p)), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Setenv("EMAIL_TEST_REPORT_PATH", report)
+
+	due, err := store.ListDue(time.Now())
+	if err != nil || len(due) != 1 {
+		t.Fatalf("ListDue: %v (%d jobs)", err, len(due))
+	}
+	job := due[0]
+	if job.Config.AdditionalData == nil {
+		job.Config.AdditionalData = map[string]any{}
+	}
+	job.Config.AdditionalData["summary_path"] = summary
+
+	prepared, err := prepareSendConfig(job.Config)
+	if err != nil {
+		t.Fatalf("prepareSendConfig: %v", err)
+	}
+	if len(prepared.Attachments) != 2 || prepared.Attachments[0].Source != report || prepared.Attachments[1].Source != summary {
+		t.Fatalf("expected run-time attachment paths, got %+v", prepared.Attachments)
+	}
+	encoded, err := encodeAllAttachments(prepared)
+	if err != nil || len(encoded) != 2 {
+		t.Fatalf("encodeAllAttachments: %v (%d)", err, len(encoded))
+	}
+}
+
+func TestPrepareSendConfig_UnresolvedAttachmentFails(t *testing.T) {
+	cfg := &EmailConfig{Attachments: []Attachment{{Source: "{{missing_report}}"}}}
+	if _, err := prepareSendConfig(cfg); err == nil {
+		t.Fatalf("expected unresolved attachment placeholder to fail at send time")
+	}
+}
+
+func TestBuildMessage_NonASCIIAttachmentFilename(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cv.pdf")
+	if err := os.WriteFile(path, []byte("%PDF-1.4"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	cfg := &EmailConfig{
+		From: "a@example.com", To: []string{"b@example.com"}, Subject: "CV", TextBody: "attached",
+		Attachments: []Attachment{{Source: path, Name: "résumé.pdf"}},
+	}
+	msg, err := buildMessage(cfg)
+	if err != nil {
+		t.Fatalf("buildMessage: %v", err)
+	}
+	if !strings.Contains(msg, `filename="resume.pdf"; filename*=UTF-8''r%C3%A9sum%C3%A9.pdf`) {
+		t.Fatalf("expected an RFC 2231 filename with an ASCII fallback: %q", msg)
+	}
+	parsed, err := mail.ReadMessage(strings.NewReader(msg))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, params, err := mime.ParseMediaType(parsed.Header.Get("Content-Type"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	reader := multipart.NewReader(parsed.Body, params["boundary"])
+	var names []string
+	for {
+		part, err := reader.NextPart()
+		if err != nil {
+			break
+		}
+		if name := part.FileName(); name != "" {
+			names = append(names, name)
+		}
+	}
+	if len(names) != 1 || names[0] != "résumé.pdf" {
+		t.Fatalf("expected the filename to decode back, got %q", names)
+	}
+	if got := contentDisposition("attachment", `say "hi".txt`); got != `attachment; filename="say \"hi\".txt"` {
+		t.Fatalf("unexpected quoting %q", got)
+	}
+}
+
+func TestBuildMessage_SharedURLAttachmentDownloadsOnce(t *testing.T) {
+	var gets atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gets.Add(1)
+		w.Header().Set("ETag", `"v1"`)
+		w.Write([]byte("%PDF-1.4 report"))
+	}))
+	defer srv.Close()
+	for _, to := range []string{"a@example.com", "b@example.com"} {
+		cfg := &EmailConfig{
+			From: "reports@example.com", To: []string{to}, Subject: "Report", TextBody: "attached",
+			Attachments: []Attachment{{Source: srv.URL + "/report.pdf"}},
+		}
+		msg, err := buildMessage(cfg)
+		if err != nil {
+			t.Fatalf("buildMessage: %v", err)
+		}
+		if !strings.Contains(msg, `filename="report.pdf"`) {
+			t.Fatalf("expected the downloaded attachment in %q", msg)
+		}
+	}
+	if n := gets.Load(); n != 1 {
+		t.Fatalf("expected one download for the shared URL, got %d", n)
+	}
+}
+
+func TestPrepareSendConfig_ZipsAttachments(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{"a.txt": "alpha", "b.csv": "x,y\n1,2\n", "c.json": `{"ok":true}`}
+	cfg := &EmailConfig{
+		From: "a@example.com", To: []string{"b@example.com"}, Subject: "files", HTMLBody: `<img src="cid:logo">`,
+		ZipAttachments: true, ZipAttachmentsName: "bundle.zip",
+		Attachments: []Attachment{{Source: "data:image/png;base64,iVBORw0KGgo=", Name: "logo.png", Inline: true, ContentID: "logo"}},
+	}
+	for _, name := range []string{"a.txt", "b.csv", "c.json"} {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(files[name]), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		cfg.Attachments = append(cfg.Attachments, Attachment{Source: path})
+	}
+
+	prepared, err := prepareSendConfig(cfg)
+	if err != nil {
+		t.Fatalf("prepareSendConfig: %v", err)
+	}
+	if len(prepared.Attachments) != 2 || !prepared.Attachments[0].Inline || prepared.Attachments[0].ContentID != "logo" {
+		t.Fatalf("expected the inline image kept plus one zip, got %+v", prepared.Attachments)
+	}
+	data, name, mimeType, err := loadAttachment(prepared.Attachments[1])
+	if err != nil {
+		t.Fatalf("load zip: %v", err)
+	}
+	if name != "bundle.zip" || mimeType != "application/zip" {
+		t.Fatalf("unexpected zip attachment %q (%s)", name, mimeType)
+	}
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatalf("read zip: %v", err)
+	}
+	if len(zr.File) != len(files) {
+		t.Fatalf("expected %d entries, got %d", len(files), len(zr.File))
+	}
+	for _, f := range zr.File {
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := io.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want, ok := files[f.Name]; !ok || string(got) != want {
+			t.Fatalf("entry %q = %q, want %q", f.Name, got, want)
+		}
+	}
+	if len(cfg.Attachments) != 4 {
+		t.Fatalf("the caller's config must not change, got %d attachments", len(cfg.Attachments))
+	}
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const defaultZipAttachmentsName = "attachments.zip"
+
+// zipAttachments replaces cfg's non-inline attachments with a single zip
+// holding them when ZipAttachments is set. Inline attachments stay as they
+// are, since the HTML body refers to them by Content-ID.
+func zipAttachments(cfg *EmailConfig) error {
+	if !cfg.ZipAttachments {
+		return nil
+	}
+	inline, regular := partitionAttachments(cfg.Attachments)
+	if len(regular) == 0 {
+		return nil
+	}
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	used := map[string]int{}
+	for _, att := range regular {
+		data, filename, _, err := loadAttachment(att)
+		if err != nil {
+			return fmt.Errorf("zip attachments: %w", err)
+		}
+		w, err := zw.CreateHeader(&zip.FileHeader{
+			Name:     uniqueZipName(filepath.Base(filename), used),
+			Method:   zip.Deflate,
+			Modified: time.Now(),
+		})
+		if err != nil {
+			return fmt.Errorf("zip attachments: %w", err)
+		}
+		if _, err := w.Write(data); err != nil {
+			return fmt.Errorf("zip attachments: %w", err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		return fmt.Errorf("zip attachments: %w", err)
+	}
+	name := strings.TrimSpace(cfg.ZipAttachmentsName)
+	if name == "" {
+		name = defaultZipAttachmentsName
+	}
+	bundle := Attachment{
+		Source:   "data:application/zip;base64," + base64.StdEncoding.EncodeToString(buf.Bytes()),
+		Name:     name,
+		MIMEType: "application/zip",
+	}
+	cfg.Attachments = append(inline, bundle)
+	return nil
+}
+
+// uniqueZipName keeps entries from overwriting each other when attachments
+// share a filename: "a.pdf", "a (2).pdf", ...
+func uniqueZipName(name string, used map[string]int) string {
+	used[name]++
+	if n := used[name]; n > 1 {
+		ext := filepath.Ext(name)
+		return fmt.Sprintf("%s (%d)%s", strings.TrimSuffix(name, ext), n, ext)
+	}
+	return name
+}
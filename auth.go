@@ -3,15 +3,58 @@ package main
 import (
 	"crypto/tls"
 	"fmt"
-	"log"
 	"net"
 	"net/http"
 	"net/smtp"
 	"strings"
 )
 
-func dialPlainClient(cfg *EmailConfig, addr string) (*smtp.Client, error) {
+// newSMTPDialer returns the dialer used for SMTP connections, bound to
+// cfg.SourceIP when set so operators can pick the outgoing address.
+func newSMTPDialer(cfg *EmailConfig) (*net.Dialer, error) {
 	dialer := &net.Dialer{Timeout: cfg.Timeout}
+	if cfg.SourceIP == "" {
+		return dialer, nil
+	}
+	ip := net.ParseIP(cfg.SourceIP)
+	if ip == nil {
+		return nil, fmt.Errorf("invalid source ip %q", cfg.SourceIP)
+	}
+	if !isLocalIP(ip) {
+		return nil, fmt.Errorf("source ip %s is not assigned to a local interface", ip)
+	}
+	dialer.LocalAddr = &net.TCPAddr{IP: ip}
+	return dialer, nil
+}
+
+// localInterfaceAddrs is swapped in tests to simulate multi-IP hosts.
+var localInterfaceAddrs = net.InterfaceAddrs
+
+func isLocalIP(ip net.IP) bool {
+	addrs, err := localInterfaceAddrs()
+	if err != nil {
+		return false
+	}
+	for _, a := range addrs {
+		var candidate net.IP
+		switch v := a.(type) {
+		case *net.IPNet:
+			candidate = v.IP
+		case *net.IPAddr:
+			candidate = v.IP
+		}
+		if candidate != nil && candidate.Equal(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+func dialPlainClient(cfg *EmailConfig, addr string) (*smtp.Client, error) {
+	dialer, err := newSMTPDialer(cfg)
+	if err != nil {
+		return nil, err
+	}
 	conn, err := dialer.Dial("tcp", addr)
 	if err != nil {
 		return nil, err
@@ -25,8 +68,11 @@ func dialPlainClient(cfg *EmailConfig, addr string) (*smtp.Client, error) {
 }
 
 func dialTLSClient(cfg *EmailConfig, addr string) (*smtp.Client, error) {
-	dialer := &net.Dialer{Timeout: cfg.Timeout}
-	tlsConfig := &tls.Config{ServerName: cfg.Host, InsecureSkipVerify: cfg.SkipTLSVerify}
+	dialer, err := newSMTPDialer(cfg)
+	if err != nil {
+		return nil, err
+	}
+	tlsConfig := clientTLSConfig(cfg, cfg.Host)
 	conn, err := tls.DialWithDialer(dialer, "tcp", addr, tlsConfig)
 	if err != nil {
 		return nil, err
@@ -133,7 +179,7 @@ func applyAuthHeaders(req *http.Request, cfg *EmailConfig, body []byte) {
 		return
 	case "aws_sigv4":
 		if err := signAWSv4(req, body, cfg); err != nil {
-			log.Printf("sigv4 signing failed: %v", err)
+			logger().Error("sigv4 signing failed", "error", err)
 		}
 		return
 	}
@@ -178,9 +224,9 @@ func applyAuthHeaders(req *http.Request, cfg *EmailConfig, body []byte) {
 			req.Header.Set("Authorization", "Bearer "+token)
 		}
 		return
-	case "ses", "aws_ses", "amazon_ses":
+	case "ses", "aws_ses", "amazon_ses", "sesv1":
 		if err := signAWSv4(req, body, cfg); err != nil {
-			log.Printf("sigv4 signing failed: %v", err)
+			logger().Error("sigv4 signing failed", "error", err)
 		}
 		return
 	}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"net"
+	"testing"
+)
+
+func TestNewSMTPDialer_SourceIP(t *testing.T) {
+	orig := localInterfaceAddrs
+	defer func() { localInterfaceAddrs = orig }()
+	localInterfaceAddrs = func() ([]net.Addr, error) {
+		return []net.Addr{
+			&net.IPNet{IP: net.ParseIP("127.0.0.1"), Mask: net.CIDRMask(8, 32)},
+			&net.IPNet{IP: net.ParseIP("203.0.113.7"), Mask: net.CIDRMask(24, 32)},
+		}, nil
+	}
+
+	dialer, err := newSMTPDialer(&EmailConfig{SourceIP: "203.0.113.7"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	local, ok := dialer.LocalAddr.(*net.TCPAddr)
+	if !ok || !local.IP.Equal(net.ParseIP("203.0.113.7")) {
+		t.Fatalf("expected dialer bound to 203.0.113.7, got %v", dialer.LocalAddr)
+	}
+
+	if _, err := newSMTPDialer(&EmailConfig{SourceIP: "198.51.100.1"}); err == nil {
+		t.Fatalf("expected non-local source ip to be rejected")
+	}
+	if d, err := newSMTPDialer(&EmailConfig{}); err != nil || d.LocalAddr != nil {
+		t.Fatalf("expected unbound dialer without source ip, got %v / %v", d, err)
+	}
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// batchRequest is one native batch HTTP request and the messages it carries.
+type batchRequest struct {
+	cfg      *EmailConfig
+	messages []*EmailConfig
+}
+
+// batchProviderFor returns cfg's provider when it sends over HTTP with a
+// native batch endpoint and no explicit payload overrides the provider format.
+func batchProviderFor(cfg *EmailConfig) (BatchProvider, bool) {
+	if cfg.Transport != "http" || cfg.HTTPPayload != nil {
+		return nil, false
+	}
+	provider, ok := GetProvider(cfg.Provider)
+	if !ok {
+		return nil, false
+	}
+	bp, ok := provider.(BatchProvider)
+	return bp, ok
+}
+
+// buildBatchRequests groups cfgs into requests of at most bp.MaxBatchSize
+// messages. The first message's config carries the request settings.
+func buildBatchRequests(bp BatchProvider, cfgs []*EmailConfig) ([]batchRequest, error) {
+	size := bp.MaxBatchSize()
+	if size <= 0 {
+		size = len(cfgs)
+	}
+	var requests []batchRequest
+	for start := 0; start < len(cfgs); start += size {
+		chunk := cfgs[start:min(start+size, len(cfgs))]
+		built, contentType, err := bp.BuildBatchPayload(chunk)
+		if err != nil {
+			return nil, err
+		}
+		payload, ok := built.(map[string]any)
+		if !ok {
+			return nil, fmt.Errorf("%s batch payload is %T, not an object", bp.Name(), built)
+		}
+		reqCfg := *chunk[0]
+		reqCfg.To = nil
+		for _, msg := range chunk {
+			reqCfg.To = append(reqCfg.To, msg.To...)
+		}
+		reqCfg.HTTPPayload = payload
+		reqCfg.HTTPContentType = contentType
+		if endpoint := bp.BatchEndpoint(chunk[0]); endpoint != "" {
+			reqCfg.Endpoint = endpoint
+		}
+		requests = append(requests, batchRequest{cfg: &reqCfg, messages: chunk})
+	}
+	return requests, nil
+}
+
+// BulkSend sends many messages, using native batch requests for those whose
+// first routed provider supports them. Messages that cannot be batched (SMTP
+// or non-batch providers, dry runs, deduplicated or strictly linted sends)
+// and messages of a failed batch request go through SendEmailWithResult, with
+// its retries and provider fallback. Failures are joined into one error.
+func BulkSend(cfgs []*EmailConfig, ctx *SendContext) error {
+	errs := make([]error, len(cfgs))
+	type group struct {
+		bp       BatchProvider
+		cfgs     []*EmailConfig
+		original []int
+	}
+	groups := map[string]*group{}
+	var order []string
+	var single []int
+	for i, cfg := range cfgs {
+		sendCfg, bp, ok := batchableConfig(cfg, ctx)
+		if !ok {
+			single = append(single, i)
+			continue
+		}
+		key := strings.Join([]string{sendCfg.Provider, sendCfg.Endpoint, sendCfg.APIKey}, "\x00")
+		g, exists := groups[key]
+		if !exists {
+			g = &group{bp: bp}
+			groups[key] = g
+			order = append(order, key)
+		}
+		g.cfgs = append(g.cfgs, sendCfg)
+		g.original = append(g.original, i)
+	}
+
+	for _, key := range order {
+		g := groups[key]
+		requests, err := buildBatchRequests(g.bp, g.cfgs)
+		if err != nil {
+			logger().Debug("native batch unavailable, sending separately", "provider", g.bp.Name(), "error", err)
+			single = append(single, g.original...)
+			continue
+		}
+		next := 0
+		for _, req := range requests {
+			indexes := g.original[next : next+len(req.messages)]
+			next += len(req.messages)
+			timing := startAttemptTiming(req.cfg, 1)
+			req.cfg.timing = timing
+			err := sendHTTPRequest(req.cfg)
+			timing.End = time.Now()
+			for _, msg := range req.messages {
+				msg.timing = timing
+				recordSendAttempt(ctx, msg, 1, err)
+			}
+			if err != nil {
+				logger().Warn("batch send failed, sending separately", "provider", g.bp.Name(), "messages", len(req.messages), "error", err)
+				single = append(single, indexes...)
+				continue
+			}
+			logger().Info("batch send succeeded", "provider", g.bp.Name(), "messages", len(req.messages))
+		}
+	}
+
+	for _, i := range single {
+		errs[i] = sendEmail(cfgs[i], ctx)
+	}
+	var joined []error
+	for i, err := range errs {
+		if err != nil {
+			joined = append(joined, fmt.Errorf("message %d: %w", i, err))
+		}
+	}
+	return errors.Join(joined...)
+}
+
+// batchableConfig prepares cfg for its first routed provider and reports
+// whether it can join a native batch.
+func batchableConfig(cfg *EmailConfig, ctx *SendContext) (*EmailConfig, BatchProvider, bool) {
+	prepared, err := prepareSendConfig(cfg)
+	if err != nil || prepared.DryRun || prepared.LintStrict || dedupKeyFromConfig(prepared, ctx) != "" {
+		return nil, nil, false
+	}
+	providers := resolveProviders(prepared)
+	if len(providers) == 0 {
+		return nil, nil, false
+	}
+	sendCfg, err := configForProvider(prepared, providers[0])
+	if err != nil || sendCfg.MaxRecipientsPerMessage > 0 && len(sendCfg.To) > sendCfg.MaxRecipientsPerMessage {
+		return nil, nil, false
+	}
+	bp, ok := batchProviderFor(&sendCfg)
+	return &sendCfg, bp, ok
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"fmt"
+	"mime"
+	"strings"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/ianaindex"
+)
+
+const defaultCharset = "UTF-8"
+
+// resolveCharset returns the canonical MIME name and encoder for charset.
+// UTF-8 (the default) returns a nil encoding, meaning no transcoding.
+func resolveCharset(charset string) (string, encoding.Encoding, error) {
+	if charset == "" || strings.EqualFold(charset, defaultCharset) || strings.EqualFold(charset, "utf8") {
+		return defaultCharset, nil, nil
+	}
+	enc, err := ianaindex.MIME.Encoding(charset)
+	if err != nil || enc == nil {
+		return "", nil, fmt.Errorf("unsupported charset %q", charset)
+	}
+	name, err := ianaindex.MIME.Name(enc)
+	if err != nil {
+		return "", nil, fmt.Errorf("unsupported charset %q", charset)
+	}
+	return name, enc, nil
+}
+
+// encodeCharset transcodes a UTF-8 string into the configured charset.
+func encodeCharset(cfg *EmailConfig, s string) (string, string, error) {
+	name, enc, err := resolveCharset(cfg.Charset)
+	if err != nil || enc == nil {
+		return name, s, err
+	}
+	out, err := enc.NewEncoder().String(s)
+	if err != nil {
+		return "", "", fmt.Errorf("text cannot be encoded as %s: %w", name, err)
+	}
+	return name, out, nil
+}
+
+// encodeSubject applies RFC 2047 encoding to non-ASCII subjects using the
+// configured charset.
+func encodeSubject(cfg *EmailConfig) (string, error) {
+	if is7bit(cfg.Subject) {
+		return cfg.Subject, nil
+	}
+	name, subject, err := encodeCharset(cfg, cfg.Subject)
+	if err != nil {
+		return "", err
+	}
+	return mime.BEncoding.Encode(name, subject), nil
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Coalescer buffers messages to the same recipients and subject template over
+// a window and sends them as one digest. The collected items are exposed to
+// the template as AdditionalData["items"], with their count in "item_count".
+type Coalescer struct {
+	window time.Duration
+	send   func(*EmailConfig) error
+
+	mu      sync.Mutex
+	batches map[string]*coalesceBatch
+}
+
+type coalesceBatch struct {
+	cfg   *EmailConfig
+	items []any
+	timer *time.Timer
+}
+
+// NewCoalescer creates a coalescer that flushes each batch window after its
+// first item arrives. A nil send uses sendEmail.
+func NewCoalescer(window time.Duration, send func(*EmailConfig) error) *Coalescer {
+	if send == nil {
+		send = func(cfg *EmailConfig) error { return sendEmail(cfg, nil) }
+	}
+	return &Coalescer{window: window, send: send, batches: map[string]*coalesceBatch{}}
+}
+
+// Add queues item for cfg's recipients. The first config queued for a key is
+// the one sent; later configs only contribute their item.
+func (c *Coalescer) Add(cfg *EmailConfig, item any) {
+	key := coalesceKey(cfg)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if batch, ok := c.batches[key]; ok {
+		batch.items = append(batch.items, item)
+		return
+	}
+	batch := &coalesceBatch{cfg: cfg, items: []any{item}}
+	c.batches[key] = batch
+	batch.timer = time.AfterFunc(c.window, func() { c.flushKey(key) })
+}
+
+// Flush sends every pending batch immediately.
+func (c *Coalescer) Flush() {
+	c.mu.Lock()
+	keys := make([]string, 0, len(c.batches))
+	for key := range c.batches {
+		keys = append(keys, key)
+	}
+	c.mu.Unlock()
+	for _, key := range keys {
+		c.flushKey(key)
+	}
+}
+
+// Pending reports how many batches are waiting for their window to close.
+func (c *Coalescer) Pending() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.batches)
+}
+
+func (c *Coalescer) flushKey(key string) {
+	c.mu.Lock()
+	batch, ok := c.batches[key]
+	if ok {
+		delete(c.batches, key)
+		batch.timer.Stop()
+	}
+	c.mu.Unlock()
+	if !ok {
+		return
+	}
+	cfgCopy := *batch.cfg
+	cfgCopy.AdditionalData = cloneAdditionalData(batch.cfg.AdditionalData)
+	if cfgCopy.AdditionalData == nil {
+		cfgCopy.AdditionalData = map[string]any{}
+	}
+	cfgCopy.AdditionalData["items"] = batch.items
+	cfgCopy.AdditionalData["item_count"] = len(batch.items)
+	if err := c.send(&cfgCopy); err != nil {
+		logger().Error("coalescer: digest failed", "to", cfgCopy.To, "error", err)
+	}
+}
+
+// coalesceKey groups by recipients and the unrendered subject so digests stay
+// together even when per-item placeholders change the rendered subject.
+func coalesceKey(cfg *EmailConfig) string {
+	recipients := make([]string, 0, len(cfg.To))
+	for _, to := range cfg.To {
+		recipients = append(recipients, strings.ToLower(strings.TrimSpace(to)))
+	}
+	sort.Strings(recipients)
+	subject := cfg.RawSubject
+	if subject == "" {
+		subject = cfg.Subject
+	}
+	return strings.Join(recipients, ",") + "|" + strings.TrimSpace(subject)
+}
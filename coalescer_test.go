@@ -0,0 +1,81 @@
+package main
+
+import (
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestCoalescer_QueuedItemsSendOneDigest(t *testing.T) {
+	var mu sync.Mutex
+	var sent []*EmailConfig
+	sendFn := func(cfg *EmailConfig) error {
+		prepared, err := prepareSendConfig(cfg)
+		if err != nil {
+			return err
+		}
+		mu.Lock()
+		sent = append(sent, prepared)
+		mu.Unlock()
+		return nil
+	}
+	c := NewCoalescer(50*time.Millisecond, sendFn)
+	for _, item := range []string{"Alice commented", "Bob liked your post", "Carol followed you"} {
+		c.Add(&EmailConfig{
+			To:          []string{"user@example.com"},
+			Subject:     "{{item_count}} new notifications",
+			RawSubject:  "{{item_count}} new notifications",
+			TextBody:    "{{#each items}}- {{.}}\n{{/each}}",
+			RawTextBody: "{{#each items}}- {{.}}\n{{/each}}",
+		}, item)
+	}
+	c.Add(&EmailConfig{To: []string{"other@example.com"}, Subject: "{{item_count}} new notifications", TextBody: "{{items}}"}, "Dave replied")
+
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		mu.Lock()
+		n := len(sent)
+		mu.Unlock()
+		if n >= 2 {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(sent) != 2 {
+		t.Fatalf("expected one digest per recipient, got %d", len(sent))
+	}
+	var digest *EmailConfig
+	for _, cfg := range sent {
+		if cfg.To[0] == "user@example.com" {
+			digest = cfg
+		}
+	}
+	if digest == nil {
+		t.Fatalf("no digest sent to user@example.com")
+	}
+	if digest.Subject != "3 new notifications" {
+		t.Fatalf("unexpected subject %q", digest.Subject)
+	}
+	for _, want := range []string{"Alice commented", "Bob liked your post", "Carol followed you"} {
+		if !strings.Contains(digest.TextBody, "- "+want) {
+			t.Fatalf("digest body %q missing %q", digest.TextBody, want)
+		}
+	}
+}
+
+func TestCoalescer_FlushSendsImmediately(t *testing.T) {
+	count := 0
+	c := NewCoalescer(time.Hour, func(cfg *EmailConfig) error {
+		count++
+		return nil
+	})
+	c.Add(&EmailConfig{To: []string{"a@example.com"}, Subject: "Digest"}, "one")
+	c.Add(&EmailConfig{To: []string{"A@example.com "}, Subject: "Digest"}, "two")
+	c.Flush()
+	if count != 1 || c.Pending() != 0 {
+		t.Fatalf("expected a single flushed digest, got %d sends and %d pending", count, c.Pending())
+	}
+}
@@ -1,6 +1,11 @@
 package main
 
-import "strings"
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
 
 type configEntry struct {
 	original  string
@@ -11,8 +16,21 @@ type configEntry struct {
 
 type normalizedConfig struct {
 	entries map[string][]*configEntry
+	// fuzzy enables substring matching of unknown keys to fields; minOverlap
+	// is the shortest/longest length ratio a fuzzy match needs.
+	fuzzy      bool
+	minOverlap float64
+	// fields records every canonical field looked up, so typo detection
+	// also knows fields without aliases.
+	fields map[string]bool
+	// errs collects values that could not be parsed for their field.
+	errs []error
 }
 
+// defaultFuzzyMinOverlap keeps fuzzy matching to near-identical keys such as
+// "attachment" for "attachments", so "from_name_override" is not read as "from".
+const defaultFuzzyMinOverlap = 0.75
+
 func newNormalizedConfig(raw map[string]any) *normalizedConfig {
 	entries := make(map[string][]*configEntry)
 	for key, value := range raw {
@@ -20,7 +38,29 @@ func newNormalizedConfig(raw map[string]any) *normalizedConfig {
 		e := &configEntry{original: key, sanitized: sanitized, value: value}
 		entries[sanitized] = append(entries[sanitized], e)
 	}
-	return &normalizedConfig{entries: entries}
+	n := &normalizedConfig{entries: entries, fuzzy: true, minOverlap: defaultFuzzyMinOverlap, fields: map[string]bool{}}
+	if val, ok := n.consumeAliases(fieldAliases["fuzzy_keys"]); ok && val != nil {
+		n.fuzzy = normalizeBool(val)
+	}
+	if val, ok := n.consumeAliases(fieldAliases["fuzzy_key_overlap"]); ok {
+		switch v := val.(type) {
+		case float64:
+			n.minOverlap = v
+		case int:
+			n.minOverlap = float64(v)
+		}
+	}
+	return n
+}
+
+// invalid records that the value given for canonical could not be parsed.
+func (n *normalizedConfig) invalid(canonical string, err error) {
+	n.errs = append(n.errs, fmt.Errorf("%s: %w", canonical, err))
+}
+
+// err reports every invalid value recorded while reading the config.
+func (n *normalizedConfig) err() error {
+	return errors.Join(n.errs...)
 }
 
 func (n *normalizedConfig) leftOverEntries() []*configEntry {
@@ -47,6 +87,7 @@ func (n *normalizedConfig) pullValue(canonical string) (any, bool) {
 	if canonical == "" {
 		return nil, false
 	}
+	n.fields[canonical] = true
 	if aliases, ok := fieldAliases[canonical]; ok {
 		if val, ok := n.consumeAliases(aliases); ok {
 			return val, true
@@ -81,25 +122,125 @@ func (n *normalizedConfig) consumeExact(key string) (any, bool) {
 	return nil, false
 }
 
+// aliasOwners maps every sanitized alias to its canonical field so fuzzy
+// matching never steals a key that belongs to another known field.
+var aliasOwners = map[string]string{}
+
+// consumeFuzzy takes the unused key that contains, or is contained in,
+// target with the highest length overlap of at least minOverlap. Keys are
+// compared in sorted order so ties resolve the same way on every run.
 func (n *normalizedConfig) consumeFuzzy(target string) (any, bool) {
+	if !n.fuzzy {
+		return nil, false
+	}
 	token := sanitizeKey(target)
 	if len(token) < 4 {
 		return nil, false
 	}
-	for key, entries := range n.entries {
+	keys := make([]string, 0, len(n.entries))
+	for key := range n.entries {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	var best *configEntry
+	bestOverlap := 0.0
+	for _, key := range keys {
 		if len(key) < 4 {
 			continue
 		}
+		if owner, ok := aliasOwners[key]; ok && owner != target {
+			continue
+		}
 		if !strings.Contains(key, token) && !strings.Contains(token, key) {
 			continue
 		}
-		for _, entry := range entries {
-			if entry.used {
-				continue
+		overlap := float64(min(len(key), len(token))) / float64(max(len(key), len(token)))
+		if overlap < n.minOverlap || overlap <= bestOverlap {
+			continue
+		}
+		for _, entry := range n.entries[key] {
+			if !entry.used {
+				best, bestOverlap = entry, overlap
+				break
 			}
-			entry.used = true
-			return entry.value, true
 		}
 	}
-	return nil, false
+	if best == nil {
+		return nil, false
+	}
+	best.used = true
+	return best.value, true
+}
+
+// dataWrapperKeys hold custom data by design and are never reported as
+// unknown keys.
+var dataWrapperKeys = map[string]bool{"data": true, "additionaldata": true}
+
+// keyTypo is an unused config key that looks like a misspelled field.
+type keyTypo struct {
+	key   string
+	field string
+}
+
+// suspectedTypos returns the unused top-level keys within a couple of edits
+// of a known field name or alias. Other unused keys are treated as custom
+// template data.
+func (n *normalizedConfig) suspectedTypos() []keyTypo {
+	known := make(map[string]string, len(aliasOwners)+len(n.fields))
+	for alias, owner := range aliasOwners {
+		known[alias] = owner
+	}
+	for field := range n.fields {
+		if _, ok := known[sanitizeKey(field)]; !ok {
+			known[sanitizeKey(field)] = field
+		}
+	}
+	var typos []keyTypo
+	for _, entry := range n.leftOverEntries() {
+		key := entry.sanitized
+		if len(key) < 3 || dataWrapperKeys[key] {
+			continue
+		}
+		limit := 2
+		if len(key) <= 4 {
+			limit = 1
+		}
+		bestField, bestDist := "", limit+1
+		for name, field := range known {
+			if d := editDistance(key, name); d < bestDist || (d == bestDist && field < bestField) {
+				bestField, bestDist = field, d
+			}
+		}
+		if bestField != "" {
+			typos = append(typos, keyTypo{key: entry.original, field: bestField})
+		}
+	}
+	sort.Slice(typos, func(i, j int) bool { return typos[i].key < typos[j].key })
+	return typos
+}
+
+// editDistance is the optimal string alignment distance between a and b:
+// insertions, deletions, substitutions and adjacent transpositions.
+func editDistance(a, b string) int {
+	prev2 := make([]int, len(b)+1)
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+			if i > 1 && j > 1 && a[i-1] == b[j-2] && a[i-2] == b[j-1] {
+				cur[j] = min(cur[j], prev2[j-2]+1)
+			}
+		}
+		prev2, prev, cur = prev, cur, prev2
+	}
+	return prev[len(b)]
 }
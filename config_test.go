@@ -0,0 +1,183 @@
+package main
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseConfig_FuzzyKeysNeedCloseOverlap(t *testing.T) {
+	cfg, err := parseConfig(map[string]any{
+		"sender":             "noreply@example.com",
+		"to":                 "user@example.com",
+		"host":               "localhost",
+		"subjects":           "Hello",
+		"from_name_override": "Campaign Bot",
+	})
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	if cfg.Subject != "Hello" {
+		t.Fatalf("expected near-identical key to resolve subject, got %q", cfg.Subject)
+	}
+	if cfg.FromName != "" {
+		t.Fatalf("from_name_override must not be read as from_name, got %q", cfg.FromName)
+	}
+	if cfg.AdditionalData["from_name_override"] != "Campaign Bot" {
+		t.Fatalf("expected unrelated key kept as data, got %v", cfg.AdditionalData)
+	}
+}
+
+func TestParseConfig_FuzzyKeysDisabled(t *testing.T) {
+	cfg, err := parseConfig(map[string]any{
+		"from":       "noreply@example.com",
+		"to":         "user@example.com",
+		"host":       "localhost",
+		"subjects":   "Hello",
+		"fuzzy_keys": false,
+	})
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	if cfg.Subject == "Hello" || cfg.AdditionalData["subjects"] != "Hello" {
+		t.Fatalf("expected subjects left as data with fuzzy matching off, got subject %q data %v", cfg.Subject, cfg.AdditionalData)
+	}
+	if _, ok := cfg.AdditionalData["fuzzy_keys"]; ok {
+		t.Fatalf("fuzzy_keys should be consumed as a setting")
+	}
+}
+
+func TestParseConfig_UnknownKeysFlagsTypos(t *testing.T) {
+	raw := map[string]any{
+		"from":         "noreply@example.com",
+		"to":           "user@example.com",
+		"host":         "localhost",
+		"subjetc":      "Hello",
+		"first_name":   "Ada",
+		"data":         map[string]any{"plan": "pro"},
+		"unknown_keys": "error",
+	}
+	_, err := parseConfig(raw)
+	if err == nil || !strings.Contains(err.Error(), `"subjetc" (did you mean "subject"?)`) {
+		t.Fatalf("expected misspelled subject to be rejected, got %v", err)
+	}
+	if strings.Contains(err.Error(), "first_name") || strings.Contains(err.Error(), "data") {
+		t.Fatalf("custom data must not be reported: %v", err)
+	}
+
+	delete(raw, "subjetc")
+	raw["subject"] = "Hello"
+	cfg, err := parseConfig(raw)
+	if err != nil {
+		t.Fatalf("expected custom data to pass strict mode, got %v", err)
+	}
+	if cfg.AdditionalData["first_name"] != "Ada" || cfg.AdditionalData["plan"] != "pro" {
+		t.Fatalf("expected custom data kept, got %v", cfg.AdditionalData)
+	}
+}
+
+func TestParseConfig_BodyFromStdin(t *testing.T) {
+	defer func(prev io.Reader) { stdin = prev }(stdin)
+	stdin = strings.NewReader("Hello {{first_name}}, your report is ready.\n")
+	cfg, err := parseConfig(map[string]any{
+		"host": "localhost", "from": "a@example.com", "to": "b@example.com",
+		"body_template": "stdin://", "first_name": "Ada",
+	})
+	if err != nil {
+		t.Fatalf("parseConfig: %v", err)
+	}
+	prepared, err := prepareSendConfig(cfg)
+	if err != nil {
+		t.Fatalf("prepareSendConfig: %v", err)
+	}
+	if prepared.TextBody != "Hello Ada, your report is ready." {
+		t.Fatalf("expected the stdin body with placeholders expanded, got %q", prepared.TextBody)
+	}
+
+	_, err = parseConfig(map[string]any{
+		"host": "localhost", "from": "a@example.com", "to": "b@example.com",
+		"body_template": "stdin://", "html_template": "stdin://",
+	})
+	if err == nil || !strings.Contains(err.Error(), "stdin") {
+		t.Fatalf("expected an error for two stdin sources, got %v", err)
+	}
+}
+
+func TestParseConfig_MaxRecipients(t *testing.T) {
+	raw := func(limit int) map[string]any {
+		return map[string]any{
+			"host":           "smtp.example.com",
+			"from":           "a@example.com",
+			"to":             []any{"one@example.com", "two@example.com"},
+			"cc":             "One@Example.com",
+			"bcc":            "three@example.com",
+			"max_recipients": limit,
+		}
+	}
+	if _, err := parseConfig(raw(3)); err != nil {
+		t.Fatalf("expected 3 distinct recipients to fit a cap of 3, got %v", err)
+	}
+	_, err := parseConfig(raw(2))
+	if err == nil || !strings.Contains(err.Error(), "max_recipients") {
+		t.Fatalf("expected a send over the cap to be rejected, got %v", err)
+	}
+	if _, err := parseConfig(raw(0)); err != nil {
+		t.Fatalf("expected no cap by default, got %v", err)
+	}
+
+	list := filepath.Join(t.TempDir(), "recipients.txt")
+	if err := os.WriteFile(list, []byte("one@example.com\ntwo@example.com\nthree@example.com\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	_, err = parseConfig(map[string]any{
+		"host": "smtp.example.com", "from": "a@example.com", "to": "file://" + list, "max_recipients": 2,
+	})
+	if err == nil || !strings.Contains(err.Error(), "3 recipients") {
+		t.Fatalf("expected a file-sourced list over the cap to be rejected at parse time, got %v", err)
+	}
+}
+
+func TestParseConfig_NumericForms(t *testing.T) {
+	base := func() map[string]any {
+		return map[string]any{"host": "smtp.example.com", "from": "a@example.com", "to": "b@example.com"}
+	}
+	cases := []struct {
+		port, timeout, retryDelay any
+		wantPort                  int
+		wantTimeout, wantDelay    time.Duration
+	}{
+		{587, 30, 2, 587, 30 * time.Second, 2 * time.Second},
+		{float64(587), float64(30), 1.5, 587, 30 * time.Second, 1500 * time.Millisecond},
+		{"587", "30", "2", 587, 30 * time.Second, 2 * time.Second},
+		{" 587 ", "30s", "2m", 587, 30 * time.Second, 2 * time.Minute},
+		{"465.0", "1m30s", "500ms", 465, 90 * time.Second, 500 * time.Millisecond},
+	}
+	for _, tc := range cases {
+		raw := base()
+		raw["port"], raw["timeout"], raw["retry_delay"] = tc.port, tc.timeout, tc.retryDelay
+		cfg, err := parseConfig(raw)
+		if err != nil {
+			t.Fatalf("%v/%v/%v: %v", tc.port, tc.timeout, tc.retryDelay, err)
+		}
+		if cfg.Port != tc.wantPort || cfg.Timeout != tc.wantTimeout || cfg.RetryDelay != tc.wantDelay {
+			t.Fatalf("%v/%v/%v: got port %d, timeout %v, retry_delay %v", tc.port, tc.timeout, tc.retryDelay, cfg.Port, cfg.Timeout, cfg.RetryDelay)
+		}
+	}
+
+	for field, garbage := range map[string]any{"port": "smtp", "timeout": "soon", "retry_delay": true} {
+		raw := base()
+		raw[field] = garbage
+		_, err := parseConfig(raw)
+		if err == nil || !strings.Contains(err.Error(), field+":") {
+			t.Fatalf("expected an error naming %s for %v, got %v", field, garbage, err)
+		}
+	}
+	raw := base()
+	raw["port"] = 587.5
+	if _, err := parseConfig(raw); err == nil {
+		t.Fatal("expected a fractional port to be rejected")
+	}
+}
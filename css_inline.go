@@ -0,0 +1,328 @@
+package main
+
+import (
+	"bytes"
+	"sort"
+	"strings"
+
+	"github.com/aymerick/douceur/css"
+	"github.com/aymerick/douceur/parser"
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// inlineCSSBody moves <style> rules in cfg.HTMLBody onto the style attributes
+// of matching elements when InlineCSS is set. Errors are logged and leave the
+// body unchanged.
+func inlineCSSBody(cfg *EmailConfig) {
+	if !cfg.InlineCSS || cfg.HTMLBody == "" {
+		return
+	}
+	out, err := inlineCSS(cfg.HTMLBody)
+	if err != nil {
+		logger().Warn("inline_css: leaving HTML body unchanged", "error", err)
+		return
+	}
+	cfg.HTMLBody = out
+}
+
+// inlineCSS applies simple selectors (type, .class, #id, *, and descendant or
+// child combinations of them) as inline styles. Media queries, other at-rules
+// and selectors that cannot be inlined (pseudo-classes, attributes, sibling
+// combinators) are kept in a single <style> block for clients that support it.
+func inlineCSS(body string) (string, error) {
+	if !strings.Contains(strings.ToLower(body), "<style") {
+		return body, nil
+	}
+	doc, err := html.Parse(strings.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+
+	var styles []*html.Node
+	walkHTML(doc, func(n *html.Node) {
+		if n.DataAtom == atom.Style {
+			styles = append(styles, n)
+		}
+	})
+	var rules []inlineRule
+	var leftover []string
+	for _, styleNode := range styles {
+		sheet, err := parser.Parse(htmlText(styleNode))
+		if err != nil {
+			return "", err
+		}
+		for _, rule := range sheet.Rules {
+			if rule.Kind != css.QualifiedRule {
+				leftover = append(leftover, rule.String())
+				continue
+			}
+			var kept []string
+			for _, sel := range rule.Selectors {
+				compiled, ok := compileSelector(sel)
+				if !ok {
+					kept = append(kept, sel)
+					continue
+				}
+				rules = append(rules, inlineRule{selector: compiled, specificity: compiled.specificity(), decls: rule.Declarations})
+			}
+			if len(kept) > 0 {
+				keptRule := *rule
+				keptRule.Selectors = kept
+				leftover = append(leftover, keptRule.String())
+			}
+		}
+	}
+	sort.SliceStable(rules, func(i, j int) bool { return rules[i].specificity < rules[j].specificity })
+
+	walkHTML(doc, func(n *html.Node) {
+		if n.Type != html.ElementNode || n.DataAtom == atom.Style {
+			return
+		}
+		var decls, important []*css.Declaration
+		for _, r := range rules {
+			if !r.selector.matches(n) {
+				continue
+			}
+			for _, d := range r.decls {
+				if d.Important {
+					important = append(important, d)
+				} else {
+					decls = append(decls, d)
+				}
+			}
+		}
+		if len(decls) == 0 && len(important) == 0 {
+			return
+		}
+		if existing := htmlAttr(n, "style"); existing != "" {
+			// The parser drops the last value unless it is terminated.
+			inline, err := parser.ParseDeclarations(strings.TrimSuffix(strings.TrimSpace(existing), ";") + ";")
+			if err == nil {
+				decls = append(decls, inline...)
+			}
+		}
+		setHTMLAttr(n, "style", mergeDeclarations(append(decls, important...)))
+	})
+
+	for i, styleNode := range styles {
+		if i == 0 && len(leftover) > 0 {
+			for c := styleNode.FirstChild; c != nil; c = styleNode.FirstChild {
+				styleNode.RemoveChild(c)
+			}
+			styleNode.AppendChild(&html.Node{Type: html.TextNode, Data: "\n" + strings.Join(leftover, "\n") + "\n"})
+			continue
+		}
+		styleNode.Parent.RemoveChild(styleNode)
+	}
+
+	var buf bytes.Buffer
+	if err := html.Render(&buf, doc); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+type inlineRule struct {
+	selector    cssSelector
+	specificity int
+	decls       []*css.Declaration
+}
+
+// mergeDeclarations renders decls as a style attribute; later declarations of
+// a property replace earlier ones but keep the first position.
+func mergeDeclarations(decls []*css.Declaration) string {
+	values := map[string]string{}
+	var props []string
+	for _, d := range decls {
+		prop := strings.ToLower(strings.TrimSpace(d.Property))
+		if _, seen := values[prop]; !seen {
+			props = append(props, prop)
+		}
+		values[prop] = strings.TrimSpace(d.Value)
+	}
+	parts := make([]string, 0, len(props))
+	for _, prop := range props {
+		parts = append(parts, prop+": "+values[prop])
+	}
+	return strings.Join(parts, "; ")
+}
+
+// cssSelector is a chain of compound selectors; combinators[i] joins parts[i]
+// to parts[i+1] and is either ' ' (descendant) or '>' (child).
+type cssSelector struct {
+	parts       []cssCompound
+	combinators []byte
+}
+
+type cssCompound struct {
+	tag     string
+	id      string
+	classes []string
+}
+
+func compileSelector(sel string) (cssSelector, bool) {
+	sel = strings.TrimSpace(sel)
+	if sel == "" || strings.ContainsAny(sel, ":[+~") {
+		return cssSelector{}, false
+	}
+	var out cssSelector
+	fields := strings.Fields(strings.ReplaceAll(sel, ">", " > "))
+	pendingChild := false
+	for _, field := range fields {
+		if field == ">" {
+			if len(out.parts) == 0 || pendingChild {
+				return cssSelector{}, false
+			}
+			pendingChild = true
+			continue
+		}
+		compound, ok := compileCompound(field)
+		if !ok {
+			return cssSelector{}, false
+		}
+		if len(out.parts) > 0 {
+			comb := byte(' ')
+			if pendingChild {
+				comb = '>'
+			}
+			out.combinators = append(out.combinators, comb)
+		}
+		pendingChild = false
+		out.parts = append(out.parts, compound)
+	}
+	if pendingChild || len(out.parts) == 0 {
+		return cssSelector{}, false
+	}
+	return out, true
+}
+
+func compileCompound(s string) (cssCompound, bool) {
+	var c cssCompound
+	i := 0
+	for i < len(s) && s[i] != '.' && s[i] != '#' {
+		i++
+	}
+	c.tag = strings.ToLower(s[:i])
+	if c.tag == "*" {
+		c.tag = ""
+	} else if strings.Contains(c.tag, "*") {
+		return c, false
+	}
+	for i < len(s) {
+		kind := s[i]
+		j := i + 1
+		for j < len(s) && s[j] != '.' && s[j] != '#' {
+			j++
+		}
+		name := s[i+1 : j]
+		if name == "" {
+			return c, false
+		}
+		if kind == '#' {
+			c.id = name
+		} else {
+			c.classes = append(c.classes, name)
+		}
+		i = j
+	}
+	return c, true
+}
+
+// specificity packs CSS specificity (ids, classes, types) into one comparable int.
+func (s cssSelector) specificity() int {
+	ids, classes, types := 0, 0, 0
+	for _, p := range s.parts {
+		if p.id != "" {
+			ids++
+		}
+		classes += len(p.classes)
+		if p.tag != "" {
+			types++
+		}
+	}
+	return ids<<16 | classes<<8 | types
+}
+
+func (s cssSelector) matches(n *html.Node) bool {
+	return s.matchFrom(len(s.parts)-1, n)
+}
+
+func (s cssSelector) matchFrom(i int, n *html.Node) bool {
+	if !s.parts[i].matches(n) {
+		return false
+	}
+	if i == 0 {
+		return true
+	}
+	for p := n.Parent; p != nil && p.Type == html.ElementNode; p = p.Parent {
+		if s.matchFrom(i-1, p) {
+			return true
+		}
+		if s.combinators[i-1] == '>' {
+			return false
+		}
+	}
+	return false
+}
+
+func (c cssCompound) matches(n *html.Node) bool {
+	if c.tag != "" && n.Data != c.tag {
+		return false
+	}
+	if c.id != "" && htmlAttr(n, "id") != c.id {
+		return false
+	}
+	if len(c.classes) > 0 {
+		have := strings.Fields(htmlAttr(n, "class"))
+		for _, want := range c.classes {
+			found := false
+			for _, h := range have {
+				if h == want {
+					found = true
+					break
+				}
+			}
+			if !found {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func walkHTML(n *html.Node, fn func(*html.Node)) {
+	fn(n)
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		walkHTML(c, fn)
+	}
+}
+
+func htmlText(n *html.Node) string {
+	var sb strings.Builder
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if c.Type == html.TextNode {
+			sb.WriteString(c.Data)
+		}
+	}
+	return sb.String()
+}
+
+func htmlAttr(n *html.Node, key string) string {
+	for _, a := range n.Attr {
+		if a.Key == key {
+			return a.Val
+		}
+	}
+	return ""
+}
+
+func setHTMLAttr(n *html.Node, key, val string) {
+	for i, a := range n.Attr {
+		if a.Key == key {
+			n.Attr[i].Val = val
+			return
+		}
+	}
+	n.Attr = append(n.Attr, html.Attribute{Key: key, Val: val})
+}
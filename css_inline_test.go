@@ -0,0 +1,50 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestPrepareSendConfig_InlineCSS(t *testing.T) {
+	body := `<html><head><style>
+p { margin: 0 }
+.note { color: red; font-size: 14px }
+#intro.note { color: blue }
+td > a { text-decoration: none }
+a:hover { color: green }
+@media (max-width: 600px) { .note { font-size: 12px } }
+</style></head><body>
+<p class="note" id="intro" style="font-weight: bold">Hi</p>
+<p class="note">Second</p>
+<table><tr><td><a href="https://example.com">link</a></td></tr></table>
+</body></html>`
+	cfg := &EmailConfig{HTMLBody: body, TextBody: "Hi", InlineCSS: true}
+	prepared, err := prepareSendConfig(cfg)
+	if err != nil {
+		t.Fatalf("prepareSendConfig: %v", err)
+	}
+	out := prepared.HTMLBody
+	for _, want := range []string{
+		`style="margin: 0; color: blue; font-size: 14px; font-weight: bold"`,
+		`<p class="note" style="margin: 0; color: red; font-size: 14px">Second</p>`,
+		`<a href="https://example.com" style="text-decoration: none">`,
+	} {
+		if !strings.Contains(out, want) {
+			t.Fatalf("expected %q in %s", want, out)
+		}
+	}
+	if !strings.Contains(out, "@media (max-width: 600px)") || !strings.Contains(out, "a:hover") {
+		t.Fatalf("expected media query and pseudo-class rules kept in <style>: %s", out)
+	}
+	if strings.Contains(out, "td > a") || strings.Count(out, "<style>") != 1 {
+		t.Fatalf("expected only non-inlinable rules in a single <style>: %s", out)
+	}
+}
+
+func TestInlineCSS_NoStyleBlockUnchanged(t *testing.T) {
+	body := `<p class="note">Hi</p>`
+	out, err := inlineCSS(body)
+	if err != nil || out != body {
+		t.Fatalf("expected body unchanged, got %q, %v", out, err)
+	}
+}
@@ -2,21 +2,65 @@ package main
 
 import (
 	"encoding/json"
-	"log"
 	"os"
+	"strings"
 	"sync"
 	"time"
 )
 
-const dedupStoreFile = "send_dedup.json"
+var dedupStoreFile = "send_dedup.json"
+
+// defaultDedupTTLs bounds how long a send blocks its duplicates for schedule
+// modes with a natural period. Modes not listed (e.g. "once") never expire
+// unless a dedup_ttl is configured.
+var defaultDedupTTLs = map[string]time.Duration{
+	"hourly":  time.Hour,
+	"daily":   24 * time.Hour,
+	"weekly":  7 * 24 * time.Hour,
+	"monthly": 30 * 24 * time.Hour,
+}
+
+// dedupEntry records when a key was sent and how long it blocks duplicates;
+// a zero TTL never expires.
+type dedupEntry struct {
+	MarkedAt time.Time     `json:"marked_at"`
+	TTL      time.Duration `json:"ttl,omitempty"`
+}
+
+// UnmarshalJSON also accepts the legacy format, which stored only the time.
+func (e *dedupEntry) UnmarshalJSON(data []byte) error {
+	if len(data) > 0 && data[0] == '"' {
+		return json.Unmarshal(data, &e.MarkedAt)
+	}
+	type plain dedupEntry
+	return json.Unmarshal(data, (*plain)(e))
+}
+
+func (e dedupEntry) expired(now time.Time) bool {
+	return e.TTL > 0 && now.Sub(e.MarkedAt) >= e.TTL
+}
 
 var (
 	dedupMu     sync.Mutex
-	dedupCache  map[string]time.Time
+	dedupCache  map[string]dedupEntry
 	dedupLoaded bool
 )
 
-func dedupKeyExists(key string) bool {
+// dedupTTLForConfig returns the dedup TTL for cfg's schedule mode: a per-mode
+// dedup_ttl entry, then dedup_ttl, then the mode's default.
+func dedupTTLForConfig(cfg *EmailConfig) time.Duration {
+	mode := strings.ToLower(strings.TrimSpace(cfg.ScheduleMode))
+	if ttl, ok := cfg.DedupTTLByMode[mode]; ok {
+		return ttl
+	}
+	if cfg.DedupTTL > 0 {
+		return cfg.DedupTTL
+	}
+	return defaultDedupTTLs[mode]
+}
+
+// dedupKeyExists reports whether key was sent within ttl (ever, if ttl is 0).
+func dedupKeyExists(key string, ttl time.Duration) bool {
 	if key == "" {
 		return false
 	}
@@ -28,11 +72,14 @@ func dedupKeyExists(key string) bool {
 	if dedupCache == nil {
 		return false
 	}
-	_, ok := dedupCache[key]
-	return ok
+	entry, ok := dedupCache[key]
+	if !ok {
+		return false
+	}
+	return ttl <= 0 || time.Since(entry.MarkedAt) < ttl
 }
 
-func markDedupKey(key string) {
+func markDedupKey(key string, ttl time.Duration) {
 	if key == "" {
 		return
 	}
@@ -42,26 +89,54 @@ func markDedupKey(key string) {
 		loadDedupLocked()
 	}
 	if dedupCache == nil {
-		dedupCache = map[string]time.Time{}
+		dedupCache = map[string]dedupEntry{}
 	}
-	dedupCache[key] = time.Now().UTC()
+	now := time.Now().UTC()
+	pruneDedupLocked(now)
+	dedupCache[key] = dedupEntry{MarkedAt: now, TTL: ttl}
 	writeDedupLocked()
 }
 
+// pruneDedupStore removes expired keys from the store and returns how many
+// were removed.
+func pruneDedupStore() int {
+	dedupMu.Lock()
+	defer dedupMu.Unlock()
+	if !dedupLoaded {
+		loadDedupLocked()
+	}
+	removed := pruneDedupLocked(time.Now())
+	if removed > 0 {
+		writeDedupLocked()
+	}
+	return removed
+}
+
+func pruneDedupLocked(now time.Time) int {
+	removed := 0
+	for key, entry := range dedupCache {
+		if entry.expired(now) {
+			delete(dedupCache, key)
+			removed++
+		}
+	}
+	return removed
+}
+
 func loadDedupLocked() {
 	data, err := os.ReadFile(dedupStoreFile)
 	if err != nil {
 		if os.IsNotExist(err) {
-			dedupCache = map[string]time.Time{}
+			dedupCache = map[string]dedupEntry{}
 			dedupLoaded = true
 			return
 		}
-		log.Printf("dedup: cannot read store: %v", err)
+		logger().Error("dedup: cannot read store", "error", err)
 		return
 	}
-	var raw map[string]time.Time
+	var raw map[string]dedupEntry
 	if err := json.Unmarshal(data, &raw); err != nil {
-		log.Printf("dedup: cannot decode store: %v", err)
+		logger().Error("dedup: cannot decode store", "error", err)
 		return
 	}
 	dedupCache = raw
@@ -71,10 +146,10 @@ func loadDedupLocked() {
 func writeDedupLocked() {
 	data, err := json.MarshalIndent(dedupCache, "", "  ")
 	if err != nil {
-		log.Printf("dedup: cannot encode store: %v", err)
+		logger().Error("dedup: cannot encode store", "error", err)
 		return
 	}
 	if err := os.WriteFile(dedupStoreFile, data, 0o644); err != nil {
-		log.Printf("dedup: cannot write store: %v", err)
+		logger().Error("dedup: cannot write store", "error", err)
 	}
 }
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func withTempDedupStore(t *testing.T, entries map[string]dedupEntry) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "send_dedup.json")
+	if entries != nil {
+		data, _ := json.Marshal(entries)
+		if err := os.WriteFile(path, data, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	dedupMu.Lock()
+	origFile, origCache, origLoaded := dedupStoreFile, dedupCache, dedupLoaded
+	dedupStoreFile, dedupCache, dedupLoaded = path, nil, false
+	dedupMu.Unlock()
+	t.Cleanup(func() {
+		dedupMu.Lock()
+		dedupStoreFile, dedupCache, dedupLoaded = origFile, origCache, origLoaded
+		dedupMu.Unlock()
+	})
+}
+
+func TestDedup_ExpiredKeyNoLongerBlocksAndIsPruned(t *testing.T) {
+	old := time.Now().UTC().Add(-48 * time.Hour)
+	withTempDedupStore(t, map[string]dedupEntry{
+		"expired": {MarkedAt: old, TTL: 24 * time.Hour},
+		"forever": {MarkedAt: old},
+	})
+	if dedupKeyExists("expired", 24*time.Hour) {
+		t.Fatalf("expected key older than the TTL not to block")
+	}
+	if !dedupKeyExists("expired", 0) || !dedupKeyExists("forever", 0) {
+		t.Fatalf("expected keys without a TTL to block forever")
+	}
+	if n := pruneDedupStore(); n != 1 {
+		t.Fatalf("expected 1 pruned key, got %d", n)
+	}
+	data, err := os.ReadFile(dedupStoreFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var stored map[string]dedupEntry
+	if err := json.Unmarshal(data, &stored); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := stored["expired"]; ok || len(stored) != 1 {
+		t.Fatalf("expected only the unexpired key to remain, got %v", stored)
+	}
+}
+
+func TestDedup_LegacyStoreFormat(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "legacy.json")
+	if err := os.WriteFile(path, []byte(`{"k":"2020-01-01T00:00:00Z"}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	withTempDedupStore(t, nil)
+	dedupStoreFile = path
+	if !dedupKeyExists("k", 0) || dedupKeyExists("k", 24*time.Hour) {
+		t.Fatalf("expected legacy entry to load with its mark time")
+	}
+}
+
+func TestDedupTTLForConfig(t *testing.T) {
+	cases := []struct {
+		cfg  EmailConfig
+		want time.Duration
+	}{
+		{EmailConfig{ScheduleMode: "once"}, 0},
+		{EmailConfig{ScheduleMode: "daily"}, 24 * time.Hour},
+		{EmailConfig{ScheduleMode: "once", DedupTTL: time.Hour}, time.Hour},
+		{EmailConfig{ScheduleMode: "daily", DedupTTL: time.Hour, DedupTTLByMode: map[string]time.Duration{"daily": 2 * time.Hour}}, 2 * time.Hour},
+	}
+	for _, tc := range cases {
+		if got := dedupTTLForConfig(&tc.cfg); got != tc.want {
+			t.Fatalf("mode %q: expected %v, got %v", tc.cfg.ScheduleMode, tc.want, got)
+		}
+	}
+	cfg, err := parseConfig(map[string]any{
+		"from": "a@example.com", "to": "b@example.com", "host": "smtp.example.com",
+		"schedule_mode": "once", "dedup_ttl": map[string]any{"once": "8760h", "daily": 3600.0},
+	})
+	if err != nil {
+		t.Fatalf("parseConfig: %v", err)
+	}
+	if cfg.DedupTTLByMode["once"] != 8760*time.Hour || cfg.DedupTTLByMode["daily"] != time.Hour {
+		t.Fatalf("unexpected per-mode TTLs %v", cfg.DedupTTLByMode)
+	}
+}
+
+func TestSendEmail_OnceBlocksUntilTTL(t *testing.T) {
+	defer withTempSendLog(t)()
+	withTempDedupStore(t, nil)
+	srv := newStubSMTPServer(t)
+	cfg := srv.config()
+	cfg.ScheduleMode = "once"
+	cfg.DedupTTL = time.Hour
+	if err := sendEmail(cfg, nil); err != nil {
+		t.Fatalf("first send: %v", err)
+	}
+	if err := sendEmail(cfg, nil); err != errDeduplicated {
+		t.Fatalf("expected duplicate within TTL, got %v", err)
+	}
+	dedupMu.Lock()
+	for k, e := range dedupCache {
+		e.MarkedAt = e.MarkedAt.Add(-2 * time.Hour)
+		dedupCache[k] = e
+	}
+	dedupMu.Unlock()
+	if err := sendEmail(cfg, nil); err != nil {
+		t.Fatalf("expected send after TTL expired, got %v", err)
+	}
+}
+
+func TestDedupKeyFromConfig_CampaignNamespace(t *testing.T) {
+	base := EmailConfig{ScheduleMode: "once", To: []string{"user@example.com"}, Subject: "Sale", TextBody: "50% off"}
+	plain := dedupKeyFromConfig(&base, nil)
+	if plain != "user@example.com||"+sha256Hex([]byte("sale"))+"|"+sha256Hex([]byte("50% off")) {
+		t.Fatalf("key without campaign changed: %q", plain)
+	}
+
+	spring, autumn, tagged := base, base, base
+	spring.CampaignID = "spring"
+	autumn.CampaignID = "autumn"
+	tagged.Tags = map[string]string{"campaign": "spring"}
+	if dedupKeyFromConfig(&spring, nil) == dedupKeyFromConfig(&autumn, nil) || dedupKeyFromConfig(&spring, nil) == plain {
+		t.Fatalf("expected distinct campaigns to have distinct keys")
+	}
+	if dedupKeyFromConfig(&spring, nil) != dedupKeyFromConfig(&tagged, nil) {
+		t.Fatalf("expected campaign tag to match campaign_id")
+	}
+}
+
+func TestSendEmail_DifferentCampaignsDoNotDedup(t *testing.T) {
+	defer withTempSendLog(t)()
+	withTempDedupStore(t, nil)
+	srv := newStubSMTPServer(t)
+	cfg := srv.config()
+	cfg.ScheduleMode = "once"
+	cfg.CampaignID = "spring"
+	if err := sendEmail(cfg, nil); err != nil {
+		t.Fatalf("first send: %v", err)
+	}
+	other := *cfg
+	other.CampaignID = "autumn"
+	if err := sendEmail(&other, nil); err != nil {
+		t.Fatalf("expected a different campaign to send, got %v", err)
+	}
+	if err := sendEmail(cfg, nil); err != errDeduplicated {
+		t.Fatalf("expected repeat within the same campaign to dedup, got %v", err)
+	}
+}
@@ -1,8 +1,13 @@
 package main
 
 import (
+	"encoding/json"
+	"fmt"
 	"net/http"
+	"net/url"
+	"strings"
 	"sync"
+	"time"
 )
 
 // ProviderSetting holds transport and selection metadata used by defaults and tests.
@@ -15,18 +20,54 @@ type ProviderSetting struct {
 	Endpoint  string
 	Capacity  int
 	Cost      float64
+	// DefaultReplyTo and DefaultFromName apply when a send leaves them empty,
+	// e.g. for a shared provider account.
+	DefaultReplyTo  string
+	DefaultFromName string
+	// Headers are added to messages sent through this provider unless the
+	// message already sets them (e.g. X-SMTPAPI for SendGrid).
+	Headers map[string]string
+	// Timeout, when set, replaces cfg.Timeout for sends through this provider
+	// so a fast primary and a slow fallback can use different limits.
+	Timeout time.Duration
+	// SuccessCodes are the HTTP statuses that mean delivered for this provider
+	// when the send does not set its own.
+	SuccessCodes []int
+	// ResponseCheck inspects a successful HTTP response and returns an error
+	// when the body reports a failure the status does not, e.g. JSONErrorsCheck.
+	ResponseCheck func(status int, body []byte) error
+}
+
+// JSONErrorsCheck is a ResponseCheck for APIs that answer 200 with a JSON
+// "errors" field listing failures. An empty or null field is success.
+func JSONErrorsCheck(status int, body []byte) error {
+	var parsed struct {
+		Errors json.RawMessage `json:"errors"`
+	}
+	if err := json.Unmarshal(body, &parsed); err != nil {
+		return nil
+	}
+	switch strings.TrimSpace(string(parsed.Errors)) {
+	case "", "null", "[]", "{}", `""`, "false":
+		return nil
+	}
+	return fmt.Errorf("errors=%s", parsed.Errors)
 }
 
 // providerDefaults contains a small set of sensible defaults for known providers.
 var providerDefaults = map[string]ProviderSetting{
-	"sendgrid": {Host: "smtp.sendgrid.net", Port: 587, UseTLS: true, Transport: "smtp", Endpoint: "https://api.sendgrid.com/v3/mail/send", Capacity: 1000, Cost: 0.5},
-	"resend":   {Host: "smtp.resend.com", Port: 587, UseTLS: true, Transport: "smtp", Endpoint: "https://api.resend.com/emails", Capacity: 1000, Cost: 0.3},
-	"postmark": {Host: "smtp.postmarkapp.com", Port: 587, UseTLS: true, Transport: "smtp", Endpoint: "https://api.postmarkapp.com/email", Capacity: 1000, Cost: 0.4},
-	"mailgun":  {Host: "smtp.mailgun.org", Port: 587, UseTLS: true, Transport: "smtp", Endpoint: "https://api.mailgun.net/v3", Capacity: 1000, Cost: 0.4},
-	"aws_ses":  {Host: "email-smtp.us-east-1.amazonaws.com", Port: 465, UseTLS: true, Transport: "smtp", Endpoint: "https://email.us-east-1.amazonaws.com", Capacity: 5000, Cost: 0.1},
-	"smtp":     {Host: "localhost", Port: 1025, UseTLS: false, Transport: "smtp", Capacity: 0, Cost: 0.0},
-	"gmail":    {Host: "smtp.gmail.com", Port: 587, UseTLS: true, Transport: "smtp", Capacity: 500, Cost: 0.0},
-	"outlook":  {Host: "smtp-mail.outlook.com", Port: 587, UseTLS: true, Transport: "smtp", Capacity: 500, Cost: 0.0},
+	"sendgrid":  {Host: "smtp.sendgrid.net", Port: 587, UseTLS: true, Transport: "smtp", Endpoint: "https://api.sendgrid.com/v3/mail/send", Capacity: 1000, Cost: 0.5},
+	"resend":    {Host: "smtp.resend.com", Port: 587, UseTLS: true, Transport: "smtp", Endpoint: "https://api.resend.com/emails", Capacity: 1000, Cost: 0.3},
+	"postmark":  {Host: "smtp.postmarkapp.com", Port: 587, UseTLS: true, Transport: "smtp", Endpoint: "https://api.postmarkapp.com/email", Capacity: 1000, Cost: 0.4},
+	"mailgun":   {Host: "smtp.mailgun.org", Port: 587, UseTLS: true, Transport: "smtp", Endpoint: "https://api.mailgun.net/v3", Capacity: 1000, Cost: 0.4},
+	"aws_ses":   {Host: "email-smtp.us-east-1.amazonaws.com", Port: 465, UseTLS: true, Transport: "smtp", Endpoint: "https://email.us-east-1.amazonaws.com", Capacity: 5000, Cost: 0.1},
+	"smtp":      {Host: "localhost", Port: 1025, UseTLS: false, Transport: "smtp", Capacity: 0, Cost: 0.0},
+	"gmail":     {Host: "smtp.gmail.com", Port: 587, UseTLS: true, Transport: "smtp", Capacity: 500, Cost: 0.0},
+	"outlook":   {Host: "smtp-mail.outlook.com", Port: 587, UseTLS: true, Transport: "smtp", Capacity: 500, Cost: 0.0},
+	"office365": {Host: "smtp.office365.com", Port: 587, UseTLS: true, Transport: "smtp", Capacity: 10000, Cost: 0.0},
+	"yahoo":     {Host: "smtp.mail.yahoo.com", Port: 465, UseSSL: true, Transport: "smtp", Capacity: 500, Cost: 0.0},
+	"icloud":    {Host: "smtp.mail.me.com", Port: 587, UseTLS: true, Transport: "smtp", Capacity: 1000, Cost: 0.0},
+	"zoho":      {Host: "smtp.zoho.com", Port: 587, UseTLS: true, Transport: "smtp", Capacity: 500, Cost: 0.0},
 }
 
 // RegisterProviderDefault allows tests or runtime code to override/add provider defaults.
@@ -34,6 +75,17 @@ func RegisterProviderDefault(name string, s ProviderSetting) {
 	providerDefaults[name] = s
 }
 
+// lookupProviderDefaults returns the defaults for a provider, resolving
+// registry aliases when the name itself has no entry.
+func lookupProviderDefaults(name string) (ProviderSetting, bool) {
+	key := strings.ToLower(strings.TrimSpace(name))
+	if s, ok := providerDefaults[key]; ok {
+		return s, true
+	}
+	s, ok := providerDefaults[canonicalProviderName(key)]
+	return s, ok
+}
+
 // HTTPProviderProfile contains lightweight HTTP hints used to populate configs.
 type HTTPProviderProfile struct {
 	Endpoint      string
@@ -46,7 +98,8 @@ type HTTPProviderProfile struct {
 var httpProviderProfiles = map[string]HTTPProviderProfile{
 	"sendgrid": {Endpoint: "https://api.sendgrid.com/v3/mail/send", Method: "POST", PayloadFormat: "json", ContentType: "application/json", Headers: map[string]string{"Authorization": "Bearer ${API_KEY}"}},
 	"resend":   {Endpoint: "https://api.resend.com/emails", Method: "POST", PayloadFormat: "json", ContentType: "application/json", Headers: map[string]string{"Authorization": "Bearer ${API_KEY}"}},
-	"postmark": {Endpoint: "https://api.postmarkapp.com/email", Method: "POST", PayloadFormat: "json", ContentType: "application/json", Headers: map[string]string{"X-Postmark-Server-Token": "${API_KEY}"}},
+	"postmark": {Endpoint: "https://api.postmarkapp.com/email", Method: "POST", PayloadFormat: "postmark", ContentType: "application/json", Headers: map[string]string{"X-Postmark-Server-Token": "${API_KEY}"}},
+	"sesv1":    {Endpoint: "https://email.us-east-1.amazonaws.com/", Method: "POST", PayloadFormat: "sesv1", ContentType: "application/x-www-form-urlencoded"},
 	"mailgun":  {Endpoint: "https://api.mailgun.net/v3", Method: "POST", PayloadFormat: "form", ContentType: "application/x-www-form-urlencoded", Headers: map[string]string{"Authorization": "Basic ${API_KEY}"}},
 }
 
@@ -54,7 +107,17 @@ var httpProviderProfiles = map[string]HTTPProviderProfile{
 var emailDomainMap = map[string]string{
 	"gmail.com":      "gmail",
 	"googlemail.com": "gmail",
-	"yahoo.com":      "smtp",
+	"outlook.com":    "outlook",
+	"hotmail.com":    "outlook",
+	"live.com":       "outlook",
+	"msn.com":        "outlook",
+	"yahoo.com":      "yahoo",
+	"ymail.com":      "yahoo",
+	"rocketmail.com": "yahoo",
+	"icloud.com":     "icloud",
+	"me.com":         "icloud",
+	"mac.com":        "icloud",
+	"zoho.com":       "zoho",
 }
 
 // RegisterEmailDomainMap lets runtime code add domain->provider mappings.
@@ -90,7 +153,29 @@ func init() {
 		return payload, "application/json", nil
 	}
 
+	// form encodes the generic fields for form APIs such as Mailgun's; list
+	// fields repeat their key once per address.
+	httpPayloadBuilders["form"] = func(cfg *EmailConfig) (any, string, error) {
+		form := url.Values{}
+		form.Set("from", cfg.From)
+		form.Set("subject", cfg.Subject)
+		for key, list := range map[string][]string{"to": cfg.To, "cc": cfg.CC, "bcc": cfg.BCC} {
+			for _, addr := range list {
+				form.Add(key, addr)
+			}
+		}
+		if cfg.HTMLBody != "" {
+			form.Set("html", cfg.HTMLBody)
+		}
+		if cfg.TextBody != "" {
+			form.Set("text", cfg.TextBody)
+		}
+		return form, "application/x-www-form-urlencoded", nil
+	}
+
 	// provider-specific builders can be registered into httpPayloadBuilders if needed
+	httpPayloadBuilders["postmark"] = NewPostmarkProvider().BuildPayload
+	httpPayloadBuilders["sesv1"] = buildSESv1Payload
 }
 
 // buildHTTPPayload builds a generic HTTP payload from the email config when
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Partial retry policies control what happens when an SMTP attempt fails after
+// some recipients may already have received the message.
+const (
+	// partialRetryRemaining retries only the recipients not yet committed.
+	partialRetryRemaining = "remaining"
+	// partialRetryFail stops retrying and surfaces the error.
+	partialRetryFail = "fail"
+)
+
+func validatePartialRetry(policy string) error {
+	switch policy {
+	case "", partialRetryRemaining, partialRetryFail:
+		return nil
+	default:
+		return fmt.Errorf("invalid partial retry policy %q (expected remaining or fail)", policy)
+	}
+}
+
+// PartialDeliveryError reports an SMTP attempt where some recipients were
+// committed (accepted at RCPT and sent the message body) while others were not.
+// Committed recipients must not be retried to avoid duplicate delivery.
+type PartialDeliveryError struct {
+	Committed []string
+	Remaining []string
+	// RemainingFields splits Remaining by the field each address came from.
+	// HTTP sends set it so a retry keeps Bcc recipients out of To; SMTP
+	// reports envelope recipients only and leaves it nil.
+	RemainingFields *RecipientLists
+	Err             error
+}
+
+// RecipientLists holds recipients by the header field they belong to.
+type RecipientLists struct {
+	To  []string
+	CC  []string
+	BCC []string
+}
+
+func (e *PartialDeliveryError) Error() string {
+	return fmt.Sprintf("partial delivery: %d committed, %d remaining (%s): %v",
+		len(e.Committed), len(e.Remaining), strings.Join(e.Remaining, ", "), e.Err)
+}
+
+func (e *PartialDeliveryError) Unwrap() error {
+	return e.Err
+}
+
+// restrictToRemaining narrows cfg to the recipients partial still owes the
+// message. HTTP transports have no envelope, so the visible recipient lists
+// are narrowed instead, each recipient staying in its own field: a Bcc
+// recipient must never be resent in To.
+func restrictToRemaining(cfg *EmailConfig, partial *PartialDeliveryError) {
+	cfg.EnvelopeRecipients = partial.Remaining
+	if cfg.Transport != "http" {
+		return
+	}
+	if fields := partial.RemainingFields; fields != nil {
+		cfg.To, cfg.CC, cfg.BCC = fields.To, fields.CC, fields.BCC
+		return
+	}
+	owed := make(map[string]bool, len(partial.Remaining))
+	for _, addr := range partial.Remaining {
+		_, bare := splitAddress(addr)
+		owed[strings.ToLower(bare)] = true
+	}
+	keep := func(list []string) []string {
+		var out []string
+		for _, entry := range list {
+			if _, bare := splitAddress(entry); owed[strings.ToLower(bare)] {
+				out = append(out, entry)
+			}
+		}
+		return out
+	}
+	cfg.To, cfg.CC, cfg.BCC = keep(cfg.To), keep(cfg.CC), keep(cfg.BCC)
+}
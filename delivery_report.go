@@ -0,0 +1,221 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// DeliveryReport makes the message a delivery status notification (RFC 3464):
+// a multipart/report with the text/HTML body as the human-readable part, a
+// message/delivery-status part built from these fields and, when
+// OriginalHeaders is set, a text/rfc822-headers part. It applies to the raw
+// MIME message, so SMTP and raw-message providers such as SES.
+type DeliveryReport struct {
+	// ReportingMTA defaults to "dns; " plus the configured host.
+	ReportingMTA       string            `json:"reporting_mta,omitempty"`
+	OriginalEnvelopeID string            `json:"original_envelope_id,omitempty"`
+	ArrivalDate        time.Time         `json:"arrival_date,omitzero"`
+	Recipients         []ReportRecipient `json:"recipients"`
+	OriginalHeaders    string            `json:"original_headers,omitempty"`
+}
+
+// ReportRecipient is one per-recipient block of a delivery status report.
+// Address-type fields without a "type;" prefix get "rfc822;" (or "dns;" for
+// RemoteMTA, "smtp;" for DiagnosticCode).
+type ReportRecipient struct {
+	FinalRecipient    string `json:"final_recipient"`
+	OriginalRecipient string `json:"original_recipient,omitempty"`
+	// Action is failed, delayed, delivered, relayed or expanded.
+	Action string `json:"action"`
+	// Status is the enhanced status code, e.g. 5.1.1.
+	Status          string    `json:"status"`
+	RemoteMTA       string    `json:"remote_mta,omitempty"`
+	DiagnosticCode  string    `json:"diagnostic_code,omitempty"`
+	LastAttemptDate time.Time `json:"last_attempt_date,omitzero"`
+}
+
+var (
+	reportActions       = map[string]bool{"failed": true, "delayed": true, "delivered": true, "relayed": true, "expanded": true}
+	reportStatusPattern = regexp.MustCompile(`^[245]\.\d{1,3}\.\d{1,3}$`)
+)
+
+func (r *DeliveryReport) validate() error {
+	if len(r.Recipients) == 0 {
+		return errors.New("delivery_report: at least one recipient is required")
+	}
+	for i, rcpt := range r.Recipients {
+		if strings.TrimSpace(rcpt.FinalRecipient) == "" {
+			return fmt.Errorf("delivery_report: recipient %d: final_recipient is required", i)
+		}
+		if !reportActions[rcpt.Action] {
+			return fmt.Errorf("delivery_report: recipient %d: unsupported action %q", i, rcpt.Action)
+		}
+		if !reportStatusPattern.MatchString(rcpt.Status) {
+			return fmt.Errorf("delivery_report: recipient %d: status %q is not an enhanced status code", i, rcpt.Status)
+		}
+	}
+	return nil
+}
+
+// parseDeliveryReportValue reads the delivery_report config: an object with
+// the report fields and a recipients list. The recipient fields may also be
+// given at the top level for a single-recipient report.
+func parseDeliveryReportValue(val any) (*DeliveryReport, error) {
+	v, ok := val.(map[string]any)
+	if !ok {
+		if val == nil {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("delivery_report: expected an object, got %T", val)
+	}
+	r := &DeliveryReport{
+		ReportingMTA:       firstString(v, "reporting_mta"),
+		OriginalEnvelopeID: firstString(v, "original_envelope_id", "envelope_id"),
+		OriginalHeaders:    firstString(v, "original_headers"),
+	}
+	var err error
+	if r.ArrivalDate, err = reportDate(v, "arrival_date"); err != nil {
+		return nil, err
+	}
+	entries, _ := v["recipients"].([]any)
+	if len(entries) == 0 && firstString(v, "final_recipient") != "" {
+		entries = []any{v}
+	}
+	for _, entry := range entries {
+		m, ok := entry.(map[string]any)
+		if !ok {
+			return nil, fmt.Errorf("delivery_report: recipient must be an object, got %T", entry)
+		}
+		rcpt := ReportRecipient{
+			FinalRecipient:    firstString(m, "final_recipient", "recipient"),
+			OriginalRecipient: firstString(m, "original_recipient"),
+			Action:            strings.ToLower(firstString(m, "action")),
+			Status:            firstString(m, "status"),
+			RemoteMTA:         firstString(m, "remote_mta"),
+			DiagnosticCode:    firstString(m, "diagnostic_code"),
+		}
+		if rcpt.LastAttemptDate, err = reportDate(m, "last_attempt_date"); err != nil {
+			return nil, err
+		}
+		r.Recipients = append(r.Recipients, rcpt)
+	}
+	if err := r.validate(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func reportDate(m map[string]any, key string) (time.Time, error) {
+	raw := firstString(m, key)
+	if raw == "" {
+		return time.Time{}, nil
+	}
+	t, err := parseMessageDate(raw)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("delivery_report: %s: %w", key, err)
+	}
+	return t, nil
+}
+
+// writeDeliveryReport writes the multipart/report body of a message whose
+// headers are already written.
+func writeDeliveryReport(msg *strings.Builder, cfg *EmailConfig, inline []Attachment) error {
+	report := cfg.DeliveryReport
+	if err := report.validate(); err != nil {
+		return err
+	}
+	boundary := randomBoundary("report")
+	msg.WriteString(fmt.Sprintf("Content-Type: multipart/report; report-type=delivery-status; boundary=%s\r\n\r\n", boundary))
+
+	msg.WriteString(fmt.Sprintf("--%s\r\n", boundary))
+	readable := cfg
+	if cfg.TextBody == "" && cfg.HTMLBody == "" {
+		withText := *cfg
+		withText.TextBody = report.summary()
+		readable = &withText
+	}
+	if err := writeAlternativeBody(msg, readable, inline, false); err != nil {
+		return err
+	}
+	msg.WriteString("\r\n")
+
+	msg.WriteString(fmt.Sprintf("--%s\r\n", boundary))
+	msg.WriteString("Content-Type: message/delivery-status\r\n\r\n")
+	msg.WriteString(report.status(cfg))
+	msg.WriteString("\r\n")
+
+	if report.OriginalHeaders != "" {
+		msg.WriteString(fmt.Sprintf("--%s\r\n", boundary))
+		msg.WriteString("Content-Type: text/rfc822-headers\r\n\r\n")
+		headers := strings.ReplaceAll(strings.TrimRight(report.OriginalHeaders, "\r\n"), "\r\n", "\n")
+		msg.WriteString(strings.ReplaceAll(headers, "\n", "\r\n"))
+		msg.WriteString("\r\n\r\n")
+	}
+	msg.WriteString(fmt.Sprintf("--%s--\r\n", boundary))
+	return nil
+}
+
+// status renders the message/delivery-status content: the per-message fields,
+// then one block per recipient, each separated by a blank line.
+func (r *DeliveryReport) status(cfg *EmailConfig) string {
+	var sb strings.Builder
+	mta := r.ReportingMTA
+	if mta == "" {
+		mta = cfg.Host
+		if mta == "" {
+			mta, _ = os.Hostname()
+		}
+	}
+	sb.WriteString(fmt.Sprintf("Reporting-MTA: %s\r\n", typedField("dns", mta)))
+	if r.OriginalEnvelopeID != "" {
+		sb.WriteString(fmt.Sprintf("Original-Envelope-Id: %s\r\n", r.OriginalEnvelopeID))
+	}
+	if !r.ArrivalDate.IsZero() {
+		sb.WriteString(fmt.Sprintf("Arrival-Date: %s\r\n", r.ArrivalDate.Format(time.RFC1123Z)))
+	}
+	for _, rcpt := range r.Recipients {
+		sb.WriteString("\r\n")
+		if rcpt.OriginalRecipient != "" {
+			sb.WriteString(fmt.Sprintf("Original-Recipient: %s\r\n", typedField("rfc822", rcpt.OriginalRecipient)))
+		}
+		sb.WriteString(fmt.Sprintf("Final-Recipient: %s\r\n", typedField("rfc822", rcpt.FinalRecipient)))
+		sb.WriteString(fmt.Sprintf("Action: %s\r\n", rcpt.Action))
+		sb.WriteString(fmt.Sprintf("Status: %s\r\n", rcpt.Status))
+		if rcpt.RemoteMTA != "" {
+			sb.WriteString(fmt.Sprintf("Remote-MTA: %s\r\n", typedField("dns", rcpt.RemoteMTA)))
+		}
+		if rcpt.DiagnosticCode != "" {
+			sb.WriteString(fmt.Sprintf("Diagnostic-Code: %s\r\n", typedField("smtp", rcpt.DiagnosticCode)))
+		}
+		if !rcpt.LastAttemptDate.IsZero() {
+			sb.WriteString(fmt.Sprintf("Last-Attempt-Date: %s\r\n", rcpt.LastAttemptDate.Format(time.RFC1123Z)))
+		}
+	}
+	return sb.String()
+}
+
+// summary is the human-readable part used when the config has no body.
+func (r *DeliveryReport) summary() string {
+	var sb strings.Builder
+	sb.WriteString("This is an automatically generated delivery status notification.\r\n")
+	for _, rcpt := range r.Recipients {
+		sb.WriteString(fmt.Sprintf("\r\n%s: %s (%s)", rcpt.FinalRecipient, rcpt.Action, rcpt.Status))
+		if rcpt.DiagnosticCode != "" {
+			sb.WriteString(": " + rcpt.DiagnosticCode)
+		}
+	}
+	return sb.String()
+}
+
+// typedField prefixes value with its type ("rfc822; user@example.com") unless
+// it already carries one.
+func typedField(kind, value string) string {
+	if strings.Contains(value, ";") {
+		return value
+	}
+	return kind + "; " + value
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestBuildMessage_DeliveryReport(t *testing.T) {
+	cfg, err := parseConfig(map[string]any{
+		"host": "mx.example.com",
+		"from": "mailer-daemon@example.com",
+		"to":   "sender@example.org",
+		"delivery_report": map[string]any{
+			"original_envelope_id": "env-42",
+			"recipients": []any{map[string]any{
+				"final_recipient": "missing@example.net",
+				"action":          "Failed",
+				"status":          "5.1.1",
+				"diagnostic_code": "550 5.1.1 user unknown",
+			}},
+			"original_headers": "Subject: hello\nMessage-ID: <orig@example.org>",
+		},
+	})
+	if err != nil {
+		t.Fatalf("parseConfig: %v", err)
+	}
+	msg, err := buildMessage(cfg)
+	if err != nil {
+		t.Fatalf("buildMessage: %v", err)
+	}
+	for _, want := range []string{
+		"Content-Type: multipart/report; report-type=delivery-status; boundary=",
+		"Content-Type: message/delivery-status\r\n\r\nReporting-MTA: dns; mx.example.com\r\nOriginal-Envelope-Id: env-42\r\n\r\n",
+		"Final-Recipient: rfc822; missing@example.net\r\n",
+		"Action: failed\r\n",
+		"Status: 5.1.1\r\n",
+		"Diagnostic-Code: smtp; 550 5.1.1 user unknown\r\n",
+		"Content-Type: text/rfc822-headers\r\n\r\nSubject: hello\r\nMessage-ID: <orig@example.org>\r\n",
+		"missing@example.net: failed (5.1.1)",
+	} {
+		if !strings.Contains(msg, want) {
+			t.Errorf("expected %q in message:\n%s", want, msg)
+		}
+	}
+}
+
+func TestParseDeliveryReportValue_Validation(t *testing.T) {
+	cases := map[string]map[string]any{
+		"no recipients":   {"reporting_mta": "mx.example.com"},
+		"bad action":      {"final_recipient": "a@example.com", "action": "bounced", "status": "5.0.0"},
+		"bad status":      {"final_recipient": "a@example.com", "action": "failed", "status": "550"},
+		"bad date":        {"final_recipient": "a@example.com", "action": "failed", "status": "5.0.0", "last_attempt_date": "soon"},
+		"non-object rcpt": {"recipients": []any{"a@example.com"}},
+	}
+	for name, raw := range cases {
+		if _, err := parseDeliveryReportValue(raw); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+	r, err := parseDeliveryReportValue(map[string]any{"final_recipient": "a@example.com", "action": "delayed", "status": "4.4.1"})
+	if err != nil || len(r.Recipients) != 1 || r.Recipients[0].Action != "delayed" {
+		t.Fatalf("single-recipient form: %+v, %v", r, err)
+	}
+}
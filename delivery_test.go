@@ -0,0 +1,214 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func partialDeliveryServer(t *testing.T) *stubSMTPServer {
+	srv := newStubSMTPServer(t)
+	srv.reply("RCPT TO:<c@example.com>", "450 mailbox busy")
+	srv.reply("DATA", "554 transaction failed")
+	return srv
+}
+
+func rcptCommands(srv *stubSMTPServer) []string {
+	var rcpts []string
+	for _, c := range srv.Commands() {
+		if strings.HasPrefix(c, "RCPT TO:") {
+			rcpts = append(rcpts, strings.TrimPrefix(c, "RCPT TO:"))
+		}
+	}
+	return rcpts
+}
+
+func TestSendEmail_PartialDeliveryRetriesRemaining(t *testing.T) {
+	defer withTempSendLog(t)()
+	srv := partialDeliveryServer(t)
+	cfg := srv.config()
+	cfg.To = []string{"a@example.com", "b@example.com", "c@example.com"}
+	cfg.RetryCount = 2
+	cfg.RetryDelay = time.Millisecond
+
+	if err := sendEmail(cfg, nil); err == nil {
+		t.Fatalf("expected send to fail")
+	}
+	got := strings.Join(rcptCommands(srv), " ")
+	want := "<a@example.com> <b@example.com> <c@example.com> <c@example.com>"
+	if got != want {
+		t.Fatalf("expected retry to target only uncommitted recipients\nwant %s\ngot  %s", want, got)
+	}
+}
+
+func TestSendEmail_PartialDeliveryFailPolicy(t *testing.T) {
+	defer withTempSendLog(t)()
+	srv := partialDeliveryServer(t)
+	cfg := srv.config()
+	cfg.To = []string{"a@example.com", "b@example.com", "c@example.com"}
+	cfg.RetryCount = 3
+	cfg.RetryDelay = time.Millisecond
+	cfg.PartialRetry = partialRetryFail
+
+	err := sendEmail(cfg, nil)
+	var partial *PartialDeliveryError
+	if !errors.As(err, &partial) {
+		t.Fatalf("expected PartialDeliveryError, got %v", err)
+	}
+	if len(partial.Committed) != 2 || len(partial.Remaining) != 1 || partial.Remaining[0] != "c@example.com" {
+		t.Fatalf("unexpected partial state: %+v", partial)
+	}
+	if n := len(rcptCommands(srv)); n != 3 {
+		t.Fatalf("expected no retry under fail policy, got %d RCPT commands", n)
+	}
+}
+
+func TestRestrictToRemaining_KeepsRecipientFields(t *testing.T) {
+	cfg := &EmailConfig{
+		Transport: "http",
+		To:        []string{"Ann <a@example.com>", "b@example.com"},
+		CC:        []string{"c@example.com"},
+		BCC:       []string{"secret@example.com"},
+	}
+	// An SMTP partial delivery reports bare envelope addresses only.
+	restrictToRemaining(cfg, &PartialDeliveryError{Remaining: []string{"a@example.com", "secret@example.com"}})
+	if strings.Join(cfg.To, ",") != "Ann <a@example.com>" || len(cfg.CC) != 0 || strings.Join(cfg.BCC, ",") != "secret@example.com" {
+		t.Fatalf("expected each remaining recipient in its original field, got to=%v cc=%v bcc=%v", cfg.To, cfg.CC, cfg.BCC)
+	}
+}
+
+func TestSendEmailWithResult_RecipientPolicies(t *testing.T) {
+	defer withTempSendLog(t)()
+
+	srv := newStubSMTPServer(t)
+	srv.reply("RCPT TO:<c@example.com>", "550 no such user")
+	cfg := srv.config()
+	cfg.To = []string{"a@example.com", "b@example.com", "c@example.com"}
+	cfg.RetryCount = 2
+	result, err := SendEmailWithResult(cfg, nil)
+	if err != nil {
+		t.Fatalf("best effort send should succeed for accepted recipients, got %v", err)
+	}
+	if got := strings.Join(result.Accepted(), ","); got != "a@example.com,b@example.com" {
+		t.Fatalf("unexpected accepted recipients %q", got)
+	}
+	rejected := result.Rejected()
+	var rcptErr *RecipientError
+	if len(rejected) != 1 || rejected[0].Address != "c@example.com" || !errors.As(rejected[0].Err, &rcptErr) {
+		t.Fatalf("expected c@example.com reported as rejected, got %+v", rejected)
+	}
+	if len(srv.Messages()) != 1 {
+		t.Fatalf("expected a single delivery without retrying a permanent rejection, got %d", len(srv.Messages()))
+	}
+
+	strict := newStubSMTPServer(t)
+	strict.reply("RCPT TO:<c@example.com>", "550 no such user")
+	cfg = strict.config()
+	cfg.To = []string{"a@example.com", "b@example.com", "c@example.com"}
+	cfg.RetryCount = 1
+	cfg.RecipientPolicy = recipientPolicyAllOrNothing
+	result, err = SendEmailWithResult(cfg, nil)
+	if !errors.As(err, &rcptErr) || rcptErr.Address != "c@example.com" {
+		t.Fatalf("expected RecipientError for c@example.com, got %v", err)
+	}
+	if len(result.Accepted()) != 0 {
+		t.Fatalf("all-or-nothing must not report accepted recipients, got %v", result.Accepted())
+	}
+	for _, c := range strict.Commands() {
+		if c == "DATA" {
+			t.Fatalf("all-or-nothing must not send DATA after a rejection")
+		}
+	}
+}
+
+func TestJitterBackoff_LargeAttemptsStayBounded(t *testing.T) {
+	for _, attempt := range []int{0, 1, 31, 63, 64, 65, 1000} {
+		for i := 0; i < 20; i++ {
+			d := jitterBackoff(attempt, 2*time.Second, 0)
+			if d < 0 {
+				t.Fatalf("attempt %d produced negative delay %v", attempt, d)
+			}
+			if capped := jitterBackoff(attempt, 2*time.Second, 30*time.Second); capped < 0 || capped > 30*time.Second {
+				t.Fatalf("attempt %d produced delay %v outside [0, 30s]", attempt, capped)
+			}
+		}
+	}
+	// 10s << 30 overflows int64; without a cap the bound must still be valid.
+	for _, attempt := range []int{31, 40, 1000} {
+		if d := jitterBackoff(attempt, 10*time.Second, 0); d < 0 {
+			t.Fatalf("attempt %d with a 10s base produced negative delay %v", attempt, d)
+		}
+	}
+	if d := jitterBackoff(1, time.Second, time.Minute); d > time.Second {
+		t.Fatalf("first attempt should wait at most the base delay, got %v", d)
+	}
+}
+
+func TestFinalizeConfig_DefaultMaxRetryDelay(t *testing.T) {
+	cfg := &EmailConfig{From: "sender@example.com", To: []string{"user@example.com"}, Host: "localhost", Port: 25}
+	if err := finalizeConfig(cfg); err != nil {
+		t.Fatalf("finalizeConfig: %v", err)
+	}
+	if cfg.MaxRetryDelay != 30*time.Second {
+		t.Fatalf("expected default max retry delay of 30s, got %v", cfg.MaxRetryDelay)
+	}
+	slow := &EmailConfig{From: "sender@example.com", To: []string{"user@example.com"}, Host: "localhost", Port: 25, RetryDelay: time.Minute}
+	if err := finalizeConfig(slow); err != nil {
+		t.Fatalf("finalizeConfig: %v", err)
+	}
+	if slow.MaxRetryDelay != time.Minute {
+		t.Fatalf("expected the cap to be at least retry_delay, got %v", slow.MaxRetryDelay)
+	}
+}
+
+func TestSendEmail_MaxTotalAttemptsAcrossProviders(t *testing.T) {
+	defer withTempSendLog(t)()
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+	names := []string{"budget_a", "budget_b", "budget_c"}
+	for _, name := range names {
+		RegisterProviderDefault(name, ProviderSetting{Transport: "http", Endpoint: srv.URL + "/" + name})
+		defer delete(providerDefaults, name)
+	}
+
+	cfg := &EmailConfig{
+		ProviderPriority: names,
+		HTTPMethod:       http.MethodPost,
+		From:             "sender@example.com",
+		To:               []string{"user@example.com"},
+		Subject:          "hi",
+		TextBody:         "body",
+		RetryCount:       5,
+		RetryDelay:       time.Millisecond,
+		MaxTotalAttempts: 4,
+	}
+	err := sendEmail(cfg, nil)
+	if err == nil || !strings.Contains(err.Error(), "send budget exhausted after 4 attempts") {
+		t.Fatalf("expected the budget error, got %v", err)
+	}
+	if n := calls.Load(); n != 4 {
+		t.Fatalf("expected 4 transport calls, got %d", n)
+	}
+}
+
+func TestSendBudget_DeadlineStopsBeforeBackoff(t *testing.T) {
+	start := time.Now()
+	b := newSendBudget(&EmailConfig{SendDeadline: time.Second}, start)
+	if b.exhausted(start, 500*time.Millisecond) {
+		t.Fatalf("a retry within the deadline should be allowed")
+	}
+	if !b.exhausted(start, 2*time.Second) {
+		t.Fatalf("a backoff past the deadline should exhaust the budget")
+	}
+	if !b.exhausted(start.Add(time.Second), 0) {
+		t.Fatalf("no attempt may start at the deadline")
+	}
+}
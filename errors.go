@@ -0,0 +1,278 @@
+package main
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Sentinels matched by the structured send errors below, so callers can use
+// errors.Is without knowing the concrete type.
+var (
+	ErrRateLimited       = errors.New("rate limited")
+	ErrRecipientRejected = errors.New("recipient rejected")
+	ErrPermanent         = errors.New("permanent failure")
+)
+
+// AuthError reports rejected credentials. It matches ErrAuthFailed.
+type AuthError struct{ Err error }
+
+func (e *AuthError) Error() string {
+	return "authentication failed: " + e.Err.Error()
+}
+
+func (e *AuthError) Unwrap() error {
+	return e.Err
+}
+
+func (e *AuthError) Is(target error) bool {
+	return target == ErrAuthFailed
+}
+
+// ConnectionError reports a network or protocol-level connectivity failure.
+// It matches ErrUnreachable.
+type ConnectionError struct{ Err error }
+
+func (e *ConnectionError) Error() string {
+	return "connection failed: " + e.Err.Error()
+}
+
+func (e *ConnectionError) Unwrap() error {
+	return e.Err
+}
+
+func (e *ConnectionError) Is(target error) bool {
+	return target == ErrUnreachable
+}
+
+// RateLimitError reports throttling by the server or provider. RetryAfter is
+// zero when no hint was given.
+type RateLimitError struct {
+	RetryAfter time.Duration
+	Err        error
+}
+
+func (e *RateLimitError) Error() string {
+	if e.RetryAfter > 0 {
+		return fmt.Sprintf("rate limited (retry after %s): %v", e.RetryAfter, e.Err)
+	}
+	return "rate limited: " + e.Err.Error()
+}
+
+func (e *RateLimitError) Unwrap() error {
+	return e.Err
+}
+
+func (e *RateLimitError) Is(target error) bool {
+	return target == ErrRateLimited
+}
+
+// RecipientError reports a recipient address the server refused.
+type RecipientError struct {
+	Address string
+	Err     error
+}
+
+func (e *RecipientError) Error() string {
+	return fmt.Sprintf("recipient %s rejected: %v", e.Address, e.Err)
+}
+
+func (e *RecipientError) Unwrap() error {
+	return e.Err
+}
+
+func (e *RecipientError) Is(target error) bool {
+	return target == ErrRecipientRejected
+}
+
+// PermanentError reports a failure that will not succeed on retry.
+type PermanentError struct{ Err error }
+
+func (e *PermanentError) Error() string {
+	return "permanent failure: " + e.Err.Error()
+}
+
+func (e *PermanentError) Unwrap() error {
+	return e.Err
+}
+
+func (e *PermanentError) Is(target error) bool {
+	return target == ErrPermanent
+}
+
+// classifySMTPError wraps an error from an SMTP exchange in the matching
+// structured type. Reply codes drive the mapping; transport errors become
+// ConnectionError.
+func classifySMTPError(err error) error {
+	if err == nil {
+		return nil
+	}
+	var protoErr *textproto.Error
+	if errors.As(err, &protoErr) {
+		msg := strings.ToLower(protoErr.Msg)
+		switch {
+		case protoErr.Code == 530 || protoErr.Code == 534 || protoErr.Code == 535 || protoErr.Code == 538:
+			return &AuthError{Err: err}
+		case protoErr.Code >= 400 && protoErr.Code < 500 && (strings.Contains(msg, "rate") || strings.Contains(msg, "too many")):
+			return &RateLimitError{Err: err}
+		case protoErr.Code == 421:
+			return &ConnectionError{Err: err}
+		case protoErr.Code >= 500:
+			return &PermanentError{Err: err}
+		}
+		return err
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) || errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return &ConnectionError{Err: err}
+	}
+	return err
+}
+
+// classifyHTTPStatus wraps a failed HTTP response in the matching structured type.
+func classifyHTTPStatus(resp *http.Response, err error) error {
+	switch {
+	case resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden:
+		return &AuthError{Err: err}
+	case resp.StatusCode == http.StatusTooManyRequests:
+		return &RateLimitError{RetryAfter: parseRetryAfter(resp.Header.Get("Retry-After")), Err: err}
+	case resp.StatusCode >= 400 && resp.StatusCode < 500 && resp.StatusCode != http.StatusRequestTimeout:
+		return &PermanentError{Err: err}
+	}
+	return err
+}
+
+// parseRetryAfter reads a Retry-After header given in seconds or as an HTTP date.
+func parseRetryAfter(value string) time.Duration {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0
+	}
+	if secs, err := strconv.Atoi(value); err == nil && secs > 0 {
+		return time.Duration(secs) * time.Second
+	}
+	if t, err := http.ParseTime(value); err == nil {
+		if d := time.Until(t); d > 0 {
+			return d
+		}
+	}
+	return 0
+}
+
+// providerErrorParsers extract the human-readable message from a provider's
+// error response body, keyed by canonical provider name or payload format.
+var providerErrorParsers = map[string]func(body []byte) string{
+	"sendgrid": parseSendGridError,
+	"mailgun":  parseMailgunError,
+	"postmark": parsePostmarkError,
+	"aws_ses":  parseSESError,
+	"sesv1":    parseSESError,
+}
+
+// httpErrorMessage returns the provider's message from an error response
+// body, or "" when cfg's provider has no parser or the body does not parse.
+func httpErrorMessage(cfg *EmailConfig, body []byte) string {
+	for _, key := range []string{canonicalProviderName(cfg.Provider), cfg.PayloadFormat} {
+		if parse, ok := providerErrorParsers[key]; ok {
+			if msg := parse(body); msg != "" {
+				return msg
+			}
+		}
+	}
+	return ""
+}
+
+func parseSendGridError(body []byte) string {
+	var parsed struct {
+		Errors []struct {
+			Message string `json:"message"`
+			Field   string `json:"field"`
+		} `json:"errors"`
+	}
+	if json.Unmarshal(body, &parsed) != nil {
+		return ""
+	}
+	var msgs []string
+	for _, e := range parsed.Errors {
+		if e.Message == "" {
+			continue
+		}
+		if e.Field != "" {
+			msgs = append(msgs, e.Field+": "+e.Message)
+		} else {
+			msgs = append(msgs, e.Message)
+		}
+	}
+	return strings.Join(msgs, "; ")
+}
+
+func parseMailgunError(body []byte) string {
+	var parsed struct {
+		Message string `json:"message"`
+	}
+	if json.Unmarshal(body, &parsed) != nil {
+		return ""
+	}
+	return parsed.Message
+}
+
+func parsePostmarkError(body []byte) string {
+	var parsed struct {
+		ErrorCode int    `json:"ErrorCode"`
+		Message   string `json:"Message"`
+	}
+	if json.Unmarshal(body, &parsed) != nil || parsed.Message == "" {
+		return ""
+	}
+	if parsed.ErrorCode != 0 {
+		return fmt.Sprintf("%s (ErrorCode %d)", parsed.Message, parsed.ErrorCode)
+	}
+	return parsed.Message
+}
+
+// parseSESError reads the SES v2 JSON error ({"__type", "message"}) or the v1
+// query API XML ErrorResponse.
+func parseSESError(body []byte) string {
+	var code, msg string
+	var parsed struct {
+		Type       string `json:"__type"`
+		Message    string `json:"message"`
+		MessageAlt string `json:"Message"`
+	}
+	if json.Unmarshal(body, &parsed) == nil {
+		code, msg = parsed.Type, parsed.Message
+		if msg == "" {
+			msg = parsed.MessageAlt
+		}
+		// __type may be namespaced, e.g. "com.amazon.coral.service#MessageRejected".
+		if i := strings.LastIndex(code, "#"); i >= 0 {
+			code = code[i+1:]
+		}
+	} else {
+		var xmlErr struct {
+			Error struct {
+				Code    string `xml:"Code"`
+				Message string `xml:"Message"`
+			} `xml:"Error"`
+		}
+		if xml.Unmarshal(body, &xmlErr) != nil {
+			return ""
+		}
+		code, msg = xmlErr.Error.Code, xmlErr.Error.Message
+	}
+	switch {
+	case msg == "":
+		return code
+	case code == "":
+		return msg
+	}
+	return code + ": " + msg
+}
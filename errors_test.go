@@ -0,0 +1,122 @@
+package main
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSendViaSMTP_TypedErrors(t *testing.T) {
+	authSrv := newStubSMTPServer(t, "AUTH PLAIN")
+	authSrv.reply("AUTH", "535 bad credentials")
+	cfg := authSrv.config()
+	cfg.Username, cfg.Password = "user", "wrong"
+	err := sendViaSMTP(cfg)
+	var authErr *AuthError
+	if !errors.As(err, &authErr) || !errors.Is(err, ErrAuthFailed) {
+		t.Fatalf("expected AuthError, got %T %v", err, err)
+	}
+
+	rcptSrv := newStubSMTPServer(t)
+	rcptSrv.reply("RCPT TO:<user@example.com>", "550 mailbox unavailable")
+	err = sendViaSMTP(rcptSrv.config())
+	var rcptErr *RecipientError
+	if !errors.As(err, &rcptErr) || rcptErr.Address != "user@example.com" {
+		t.Fatalf("expected RecipientError for user@example.com, got %T %v", err, err)
+	}
+	if !errors.Is(err, ErrRecipientRejected) || !errors.Is(err, ErrPermanent) {
+		t.Fatalf("expected recipient rejection to match ErrRecipientRejected and ErrPermanent: %v", err)
+	}
+
+	rateSrv := newStubSMTPServer(t)
+	rateSrv.reply("MAIL FROM:", "451 4.7.1 rate limit exceeded")
+	err = sendViaSMTP(rateSrv.config())
+	var rateErr *RateLimitError
+	if !errors.As(err, &rateErr) {
+		t.Fatalf("expected RateLimitError, got %T %v", err, err)
+	}
+
+	ln, _ := net.Listen("tcp", "127.0.0.1:0")
+	addr := ln.Addr().(*net.TCPAddr)
+	ln.Close()
+	down := &EmailConfig{From: "sender@example.com", To: []string{"user@example.com"}, Host: "127.0.0.1", Port: addr.Port, Timeout: time.Second}
+	err = sendViaSMTP(down)
+	var connErr *ConnectionError
+	if !errors.As(err, &connErr) || !errors.Is(err, ErrUnreachable) {
+		t.Fatalf("expected ConnectionError, got %T %v", err, err)
+	}
+}
+
+func TestSendHTTPRequest_TypedErrors(t *testing.T) {
+	status := http.StatusTooManyRequests
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if status == http.StatusTooManyRequests {
+			w.Header().Set("Retry-After", "7")
+		}
+		w.WriteHeader(status)
+	}))
+	defer srv.Close()
+	cfg := &EmailConfig{Transport: "http", Endpoint: srv.URL, HTTPMethod: http.MethodPost, From: "sender@example.com", To: []string{"user@example.com"}, Timeout: 2 * time.Second}
+
+	var rateErr *RateLimitError
+	if err := sendHTTPRequest(cfg); !errors.As(err, &rateErr) || rateErr.RetryAfter != 7*time.Second {
+		t.Fatalf("expected RateLimitError with 7s retry-after, got %T %v", err, err)
+	}
+	status = http.StatusUnauthorized
+	if err := sendHTTPRequest(cfg); !errors.Is(err, ErrAuthFailed) {
+		t.Fatalf("expected AuthError, got %T %v", err, err)
+	}
+	status = http.StatusBadRequest
+	var permErr *PermanentError
+	if err := sendHTTPRequest(cfg); !errors.As(err, &permErr) {
+		t.Fatalf("expected PermanentError, got %T %v", err, err)
+	}
+	status = http.StatusBadGateway
+	if err := sendHTTPRequest(cfg); err == nil || errors.Is(err, ErrPermanent) {
+		t.Fatalf("expected retryable untyped error for 502, got %v", err)
+	}
+}
+
+func TestHTTPErrorMessage_ProviderBodies(t *testing.T) {
+	cases := []struct {
+		provider string
+		body     string
+		want     string
+	}{
+		{"sendgrid", `{"errors":[{"message":"The from address does not match a verified Sender Identity.","field":"from","help":null}]}`, "from: The from address does not match a verified Sender Identity."},
+		{"mailgun", `{"message":"'from' parameter is not a valid address. please check documentation"}`, "'from' parameter is not a valid address. please check documentation"},
+		{"postmark", `{"ErrorCode":300,"Message":"Invalid email request"}`, "Invalid email request (ErrorCode 300)"},
+		{"ses", `{"__type":"com.amazon.coral.service#MessageRejected","message":"Email address is not verified."}`, "MessageRejected: Email address is not verified."},
+		{"sesv1", `<ErrorResponse><Error><Type>Sender</Type><Code>MessageRejected</Code><Message>Email address is not verified.</Message></Error></ErrorResponse>`, "MessageRejected: Email address is not verified."},
+		{"sendgrid", `<html>Bad Gateway</html>`, ""},
+		{"custom", `{"message":"nope"}`, ""},
+	}
+	for _, tc := range cases {
+		if got := httpErrorMessage(&EmailConfig{Provider: tc.provider}, []byte(tc.body)); got != tc.want {
+			t.Fatalf("%s: got %q, want %q", tc.provider, got, tc.want)
+		}
+	}
+}
+
+func TestSendHTTPRequest_ParsedErrorMessage(t *testing.T) {
+	body := `{"ErrorCode":406,"Message":"You tried to send to a recipient that has been marked as inactive."}`
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		_, _ = w.Write([]byte(body))
+	}))
+	defer srv.Close()
+	cfg := &EmailConfig{Provider: "postmark", Transport: "http", Endpoint: srv.URL, HTTPMethod: http.MethodPost, From: "sender@example.com", To: []string{"user@example.com"}, Timeout: 2 * time.Second}
+	err := sendHTTPRequest(cfg)
+	if err == nil || !strings.Contains(err.Error(), "message=You tried to send to a recipient that has been marked as inactive. (ErrorCode 406)") {
+		t.Fatalf("expected parsed Postmark message, got %v", err)
+	}
+
+	body = "upstream exploded"
+	if err := sendHTTPRequest(cfg); err == nil || !strings.Contains(err.Error(), "body=upstream exploded") {
+		t.Fatalf("expected raw body fallback, got %v", err)
+	}
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"fmt"
+	mrand "math/rand"
+	"strings"
+	"sync"
+)
+
+var (
+	fromPoolMu       sync.Mutex
+	fromPoolCounters = map[string]int{}
+)
+
+func validateFromRotation(strategy string) error {
+	switch strategy {
+	case "", "round_robin", "random":
+		return nil
+	default:
+		return fmt.Errorf("invalid from rotation %q (expected round_robin or random)", strategy)
+	}
+}
+
+// nextFromPoolEntry picks the next pool entry. Round-robin state is shared by
+// every config using the same pool so consecutive sends rotate.
+func nextFromPoolEntry(cfg *EmailConfig) string {
+	if cfg.FromRotation == "random" {
+		return cfg.FromPool[mrand.Intn(len(cfg.FromPool))]
+	}
+	key := strings.Join(cfg.FromPool, "\x00")
+	fromPoolMu.Lock()
+	idx := fromPoolCounters[key] % len(cfg.FromPool)
+	fromPoolCounters[key] = idx + 1
+	fromPoolMu.Unlock()
+	return cfg.FromPool[idx]
+}
+
+// applyFromRotation replaces From with the next FromPool entry. The envelope
+// sender and username follow the new address when they were derived from the
+// previous From; a display name on the pool entry overrides FromName.
+func applyFromRotation(cfg *EmailConfig) {
+	if len(cfg.FromPool) == 0 {
+		return
+	}
+	name, addr := splitAddress(nextFromPoolEntry(cfg))
+	if addr == "" {
+		return
+	}
+	prev := cfg.From
+	if cfg.EnvelopeFrom == "" || strings.EqualFold(cfg.EnvelopeFrom, prev) {
+		cfg.EnvelopeFrom = addr
+	}
+	if cfg.Password == "" && strings.EqualFold(cfg.Username, prev) {
+		cfg.Username = addr
+	}
+	if cfg.ReplyToFrom && len(cfg.ReplyTo) == 1 && strings.EqualFold(cfg.ReplyTo[0], prev) {
+		cfg.ReplyTo = []string{addr}
+	}
+	if name != "" {
+		cfg.FromName = name
+	}
+	cfg.From = addr
+}
+
+// checkFromDomain returns an error unless from's domain is one of allowed.
+// An empty list allows any domain. Matching is case-insensitive and exact, so
+// subdomains must be listed themselves.
+func checkFromDomain(from string, allowed []string) error {
+	if len(allowed) == 0 {
+		return nil
+	}
+	_, domain, _ := strings.Cut(from, "@")
+	for _, d := range allowed {
+		if strings.EqualFold(strings.TrimSpace(d), domain) {
+			return nil
+		}
+	}
+	return fmt.Errorf("sender domain %q is not in allowed_from_domains %v", domain, allowed)
+}
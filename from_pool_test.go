@@ -0,0 +1,83 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestPrepareSendConfig_RotatesFromPool(t *testing.T) {
+	cfg, err := parseConfig(map[string]any{
+		"from_pool": []any{"Alice <a@example.com>", "b@example.com", "c@example.com"},
+		"to":        "user@example.com",
+		"host":      "smtp.example.com",
+		"subject":   "hi",
+		"body_text": "hello",
+	})
+	if err != nil {
+		t.Fatalf("parseConfig returned error: %v", err)
+	}
+	var got []string
+	for i := 0; i < 4; i++ {
+		prepared, err := prepareSendConfig(cfg)
+		if err != nil {
+			t.Fatalf("prepareSendConfig returned error: %v", err)
+		}
+		if prepared.EnvelopeFrom != prepared.From {
+			t.Fatalf("expected envelope sender to follow rotated From, got %q vs %q", prepared.EnvelopeFrom, prepared.From)
+		}
+		got = append(got, prepared.From)
+	}
+	want := []string{"a@example.com", "b@example.com", "c@example.com", "a@example.com"}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("expected rotation %v, got %v", want, got)
+		}
+	}
+}
+
+func TestApplyFromRotation_KeepsExplicitIdentity(t *testing.T) {
+	cfg := &EmailConfig{
+		From:         "a@example.com",
+		FromName:     "Team",
+		FromPool:     []string{"Support <s@example.com>"},
+		EnvelopeFrom: "bounce@example.net",
+		Username:     "relay@example.net",
+		Password:     "secret",
+	}
+	applyFromRotation(cfg)
+	if cfg.From != "s@example.com" || cfg.FromName != "Support" {
+		t.Fatalf("unexpected sender %q <%s>", cfg.FromName, cfg.From)
+	}
+	if cfg.EnvelopeFrom != "bounce@example.net" || cfg.Username != "relay@example.net" {
+		t.Fatalf("explicit envelope/username must be kept, got %q / %q", cfg.EnvelopeFrom, cfg.Username)
+	}
+	if got := senderAddress(cfg); got != "relay@example.net" {
+		t.Fatalf("expected Sender to compare against rotated From, got %q", got)
+	}
+}
+
+func TestParseConfig_FromDoesNotFillPool(t *testing.T) {
+	cfg, err := parseConfig(map[string]any{"from": "a@example.com", "to": "user@example.com", "host": "smtp.example.com"})
+	if err != nil {
+		t.Fatalf("parseConfig returned error: %v", err)
+	}
+	if cfg.From != "a@example.com" || len(cfg.FromPool) != 0 {
+		t.Fatalf("expected from without pool, got %q / %v", cfg.From, cfg.FromPool)
+	}
+}
+
+func TestParseConfig_AllowedFromDomains(t *testing.T) {
+	raw := func(from string) map[string]any {
+		return map[string]any{
+			"from": from, "to": "user@example.com", "host": "smtp.example.com",
+			"allowed_from_domains": []any{"tenant-a.com", "Mail.Tenant-A.com"},
+		}
+	}
+	if _, err := parseConfig(raw("Billing <billing@mail.tenant-a.com>")); err != nil {
+		t.Fatalf("allowed domain rejected: %v", err)
+	}
+	_, err := parseConfig(raw("ceo@tenant-b.com"))
+	if err == nil || !strings.Contains(err.Error(), `"tenant-b.com"`) {
+		t.Fatalf("expected the disallowed domain to be rejected, got %v", err)
+	}
+}
@@ -1,3 +1,12 @@
 module github.com/oarkflow/email
 
 go 1.25.5
+
+require (
+	github.com/aymerick/douceur v0.2.0
+	github.com/microcosm-cc/bluemonday v1.0.27
+	golang.org/x/net v0.26.0
+	golang.org/x/text v0.30.0
+)
+
+require github.com/gorilla/css v1.0.1 // indirect
@@ -0,0 +1,328 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestSendViaHTTP_SplitsRecipients(t *testing.T) {
+	var mu sync.Mutex
+	var sizes []int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			To []string `json:"to"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Errorf("decode body: %v", err)
+		}
+		mu.Lock()
+		sizes = append(sizes, len(body.To))
+		failed := len(sizes) == 2
+		mu.Unlock()
+		if failed {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer srv.Close()
+
+	cfg := &EmailConfig{
+		Transport:               "http",
+		Endpoint:                srv.URL,
+		HTTPMethod:              http.MethodPost,
+		From:                    "sender@example.com",
+		Subject:                 "hi",
+		TextBody:                "body",
+		Timeout:                 2 * time.Second,
+		MaxRecipientsPerMessage: 1000,
+	}
+	for i := 0; i < 2500; i++ {
+		cfg.To = append(cfg.To, fmt.Sprintf("user%d@example.com", i))
+	}
+	err := sendViaHTTP(cfg)
+	if err == nil {
+		t.Fatalf("expected failing batch to surface an error")
+	}
+	if len(sizes) != 3 || sizes[0] != 1000 || sizes[1] != 1000 || sizes[2] != 500 {
+		t.Fatalf("expected batches of 1000/1000/500, got %v", sizes)
+	}
+}
+
+func TestSplitRecipientBatches_CcOnFirstBatch(t *testing.T) {
+	cfg := &EmailConfig{
+		To:                      []string{"a@x.com", "b@x.com", "c@x.com"},
+		CC:                      []string{"cc@x.com"},
+		BCC:                     []string{"bcc@x.com"},
+		MaxRecipientsPerMessage: 3,
+	}
+	batches := splitRecipientBatches(cfg)
+	if len(batches) != 2 {
+		t.Fatalf("expected 2 batches, got %d", len(batches))
+	}
+	if len(batches[0].CC) != 1 || len(batches[0].BCC) != 1 || len(batches[0].To) != 1 {
+		t.Fatalf("expected cc/bcc to count against the first batch: %+v", batches[0])
+	}
+	if batches[1].CC != nil || batches[1].BCC != nil || len(batches[1].To) != 2 {
+		t.Fatalf("unexpected second batch: %+v", batches[1])
+	}
+}
+
+func TestSendEmailWithResult_RetriesOnlyFailedHTTPBatch(t *testing.T) {
+	defer withTempSendLog(t)()
+	var mu sync.Mutex
+	var requests []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			To []string `json:"to"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Errorf("decode body: %v", err)
+		}
+		mu.Lock()
+		requests = append(requests, strings.Join(body.To, ","))
+		failed := len(requests) == 2
+		mu.Unlock()
+		if failed {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer srv.Close()
+
+	cfg := &EmailConfig{
+		Transport:               "http",
+		Endpoint:                srv.URL,
+		HTTPMethod:              http.MethodPost,
+		From:                    "sender@example.com",
+		To:                      []string{"a@example.com", "b@example.com", "c@example.com", "d@example.com"},
+		Subject:                 "hi",
+		TextBody:                "body",
+		Timeout:                 2 * time.Second,
+		RetryCount:              2,
+		RetryDelay:              time.Millisecond,
+		MaxRecipientsPerMessage: 2,
+	}
+	result, err := SendEmailWithResult(cfg, nil)
+	if err != nil {
+		t.Fatalf("expected the retry to deliver the failed batch, got %v", err)
+	}
+	want := []string{"a@example.com,b@example.com", "c@example.com,d@example.com", "c@example.com,d@example.com"}
+	if strings.Join(requests, "|") != strings.Join(want, "|") {
+		t.Fatalf("expected only batch 2 to be resent, got %q", requests)
+	}
+	if got := strings.Join(result.Accepted(), ","); got != "a@example.com,b@example.com,c@example.com,d@example.com" {
+		t.Fatalf("unexpected accepted recipients %q", got)
+	}
+}
+
+func TestSendViaHTTPResult_ReportsRemainingByField(t *testing.T) {
+	var mu sync.Mutex
+	calls := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		calls++
+		first := calls == 1
+		mu.Unlock()
+		if first {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer srv.Close()
+
+	cfg := &EmailConfig{
+		Transport:               "http",
+		Endpoint:                srv.URL,
+		HTTPMethod:              http.MethodPost,
+		From:                    "sender@example.com",
+		To:                      []string{"a@example.com", "b@example.com", "c@example.com"},
+		CC:                      []string{"cc@example.com"},
+		BCC:                     []string{"secret@example.com"},
+		Subject:                 "hi",
+		TextBody:                "body",
+		Timeout:                 2 * time.Second,
+		MaxRecipientsPerMessage: 3,
+	}
+	_, err := sendViaHTTPResult(cfg)
+	var partial *PartialDeliveryError
+	if !errors.As(err, &partial) {
+		t.Fatalf("expected a partial delivery, got %v", err)
+	}
+	fields := partial.RemainingFields
+	if fields == nil || strings.Join(fields.To, ",") != "a@example.com" ||
+		strings.Join(fields.CC, ",") != "cc@example.com" || strings.Join(fields.BCC, ",") != "secret@example.com" {
+		t.Fatalf("expected the failed batch's recipients by field, got %+v", fields)
+	}
+	if len(partial.Remaining) != 3 {
+		t.Fatalf("expected 3 remaining recipients, got %v", partial.Remaining)
+	}
+}
+
+func TestEncodePayload_ContentTypeMatchesBody(t *testing.T) {
+	form := url.Values{"to": {"user@example.com"}}
+	for _, hint := range []string{"", "application/json", "text/plain", "application/x-www-form-urlencoded; charset=utf-8"} {
+		_, ct, err := encodePayload(form, hint)
+		if err != nil {
+			t.Fatalf("encode form: %v", err)
+		}
+		if !strings.HasPrefix(ct, "application/x-www-form-urlencoded") {
+			t.Fatalf("form body with hint %q reported %q", hint, ct)
+		}
+	}
+	if _, ct, _ := encodePayload(form, "application/x-www-form-urlencoded; charset=utf-8"); ct != "application/x-www-form-urlencoded; charset=utf-8" {
+		t.Fatalf("matching hint should keep its parameters, got %q", ct)
+	}
+	if _, ct, _ := encodePayload(map[string]any{"a": 1}, "application/x-www-form-urlencoded"); ct != "application/json" {
+		t.Fatalf("JSON body should report application/json, got %q", ct)
+	}
+	if _, ct, _ := encodePayload(map[string]any{"a": 1}, "application/vnd.api+json"); ct != "application/vnd.api+json" {
+		t.Fatalf("JSON-suffixed hint should be kept, got %q", ct)
+	}
+}
+
+func TestSendViaHTTP_FormProviderIgnoresStrayContentType(t *testing.T) {
+	var gotType, gotTo string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotType = r.Header.Get("Content-Type")
+		if err := r.ParseForm(); err != nil {
+			t.Errorf("parse form: %v", err)
+		}
+		gotTo = r.PostForm.Get("to")
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+
+	cfg := &EmailConfig{
+		Transport:       "http",
+		Endpoint:        srv.URL,
+		HTTPMethod:      http.MethodPost,
+		PayloadFormat:   "form",
+		HTTPContentType: "application/json",
+		From:            "sender@example.com",
+		To:              []string{"user@example.com"},
+		Subject:         "hi",
+		TextBody:        "body",
+		Timeout:         2 * time.Second,
+	}
+	if err := sendViaHTTP(cfg); err != nil {
+		t.Fatalf("send: %v", err)
+	}
+	if gotType != "application/x-www-form-urlencoded" || gotTo != "user@example.com" {
+		t.Fatalf("expected a form request, got type %q to %q", gotType, gotTo)
+	}
+}
+
+func TestSendViaHTTP_NativeBatchProvider(t *testing.T) {
+	var requests []int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Personalizations []map[string]any `json:"personalizations"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Errorf("decode body: %v", err)
+		}
+		requests = append(requests, len(body.Personalizations))
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer srv.Close()
+
+	cfg := &EmailConfig{
+		Provider:                "sendgrid",
+		Transport:               "http",
+		Endpoint:                srv.URL,
+		HTTPMethod:              http.MethodPost,
+		From:                    "sender@example.com",
+		To:                      []string{"a@example.com", "b@example.com", "c@example.com"},
+		Subject:                 "hi",
+		TextBody:                "body",
+		Timeout:                 2 * time.Second,
+		MaxRecipientsPerMessage: 1,
+	}
+	if err := sendViaHTTP(cfg); err != nil {
+		t.Fatalf("sendViaHTTP: %v", err)
+	}
+	if len(requests) != 1 || requests[0] != 3 {
+		t.Fatalf("expected one request with 3 personalizations, got %v", requests)
+	}
+}
+
+func TestBulkSend_UsesNativeBatch(t *testing.T) {
+	defer withTempSendLog(t)()
+	var mu sync.Mutex
+	var batches []int
+	var singles int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Personalizations []map[string]any `json:"personalizations"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Errorf("decode body: %v", err)
+		}
+		mu.Lock()
+		if r.URL.Path == "/sendgrid" {
+			batches = append(batches, len(body.Personalizations))
+		} else {
+			singles++
+		}
+		mu.Unlock()
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+
+	message := func(provider, path, to string) *EmailConfig {
+		return &EmailConfig{
+			Provider:   provider,
+			Transport:  "http",
+			Endpoint:   srv.URL + path,
+			HTTPMethod: http.MethodPost,
+			APIKey:     "key",
+			From:       "sender@example.com",
+			To:         []string{to},
+			Subject:    "Hello " + to,
+			TextBody:   "body",
+			Timeout:    2 * time.Second,
+			RetryCount: 1,
+		}
+	}
+	cfgs := []*EmailConfig{
+		message("sendgrid", "/sendgrid", "a@example.com"),
+		message("sendgrid", "/sendgrid", "b@example.com"),
+		message("custom_api", "/custom", "c@example.com"),
+		message("sendgrid", "/sendgrid", "d@example.com"),
+	}
+	if err := BulkSend(cfgs, nil); err != nil {
+		t.Fatalf("BulkSend: %v", err)
+	}
+	if len(batches) != 1 || batches[0] != 3 {
+		t.Fatalf("expected one SendGrid request with 3 personalizations, got %v", batches)
+	}
+	if singles != 1 {
+		t.Fatalf("expected the non-batch provider to send separately, got %d requests", singles)
+	}
+}
+
+func TestMailjetBuildBatchPayload(t *testing.T) {
+	cfgs := []*EmailConfig{
+		{From: "a@example.com", To: []string{"x@example.com"}, Subject: "one", TextBody: "1"},
+		{From: "b@example.com", To: []string{"y@example.com"}, Subject: "two", TextBody: "2", SandboxMode: true},
+	}
+	payload, _, err := NewMailjetProvider().BuildBatchPayload(cfgs)
+	if err != nil {
+		t.Fatalf("BuildBatchPayload: %v", err)
+	}
+	messages := payload.(map[string]interface{})["Messages"].([]interface{})
+	if len(messages) != 2 || messages[1].(map[string]interface{})["Subject"] != "two" {
+		t.Fatalf("expected one Messages entry per message, got %v", messages)
+	}
+}
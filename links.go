@@ -0,0 +1,65 @@
+package main
+
+import (
+	"html"
+	"net/mail"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// LinkRewriter maps a link in the HTML body to the URL sent to recipient,
+// typically a tracking redirect.
+type LinkRewriter func(originalURL, recipient string) string
+
+var (
+	hrefPattern = regexp.MustCompile(`(?i)(\bhref\s*=\s*)(?:"([^"]*)"|'([^']*)')`)
+
+	defaultLinkRewriterMu sync.RWMutex
+	defaultLinkRewriter   LinkRewriter
+)
+
+// SetDefaultLinkRewriter installs a rewriter for sends whose config has none,
+// including scheduled jobs, whose LinkRewriter is not persisted. Pass nil to
+// remove it.
+func SetDefaultLinkRewriter(fn LinkRewriter) {
+	defaultLinkRewriterMu.Lock()
+	defaultLinkRewriter = fn
+	defaultLinkRewriterMu.Unlock()
+}
+
+// rewriteLinks passes every http(s) href in cfg.HTMLBody through the
+// configured LinkRewriter for the message's first To recipient. mailto:,
+// tel:, anchors and relative links are left alone.
+func rewriteLinks(cfg *EmailConfig) {
+	rewriter := cfg.LinkRewriter
+	if rewriter == nil {
+		defaultLinkRewriterMu.RLock()
+		rewriter = defaultLinkRewriter
+		defaultLinkRewriterMu.RUnlock()
+	}
+	if rewriter == nil || cfg.HTMLBody == "" {
+		return
+	}
+	recipient := ""
+	if len(cfg.To) > 0 {
+		if addr, err := mail.ParseAddress(cfg.To[0]); err == nil {
+			recipient = addr.Address
+		} else {
+			recipient = strings.TrimSpace(cfg.To[0])
+		}
+	}
+	cfg.HTMLBody = hrefPattern.ReplaceAllStringFunc(cfg.HTMLBody, func(attr string) string {
+		m := hrefPattern.FindStringSubmatch(attr)
+		raw := m[2] + m[3]
+		link := html.UnescapeString(strings.TrimSpace(raw))
+		if !looksLikeURL(link) {
+			return attr
+		}
+		rewritten := rewriter(link, recipient)
+		if rewritten == "" || rewritten == link {
+			return attr
+		}
+		return m[1] + `"` + html.EscapeString(rewritten) + `"`
+	})
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"encoding/json"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestPrepareSendConfig_RewritesLinksPerRecipient(t *testing.T) {
+	tracker := func(original, recipient string) string {
+		return "https://track.example.com/r?u=" + url.QueryEscape(original) + "&to=" + url.QueryEscape(recipient)
+	}
+	html := `<a href="https://example.com/offer?a=1&amp;b=2">Offer</a> ` +
+		`<a href='http://example.com/blog'>Blog</a> ` +
+		`<a href="mailto:help@example.com">Mail</a> <a href="#top">Top</a> <a href="/relative">Rel</a>`
+
+	render := func(to string) string {
+		cfg := &EmailConfig{To: []string{to}, HTMLBody: html, TextBody: "t", LinkRewriter: tracker}
+		prepared, err := prepareSendConfig(cfg)
+		if err != nil {
+			t.Fatalf("prepareSendConfig: %v", err)
+		}
+		return prepared.HTMLBody
+	}
+	ada := render("Ada <ada@example.com>")
+	bob := render("bob@example.com")
+
+	wantOffer := `href="https://track.example.com/r?u=https%3A%2F%2Fexample.com%2Foffer%3Fa%3D1%26b%3D2&amp;to=ada%40example.com"`
+	if !strings.Contains(ada, wantOffer) {
+		t.Fatalf("expected rewritten offer link %s in %s", wantOffer, ada)
+	}
+	if !strings.Contains(ada, "u=http%3A%2F%2Fexample.com%2Fblog") || !strings.Contains(bob, "to=bob%40example.com") {
+		t.Fatalf("expected every http link rewritten per recipient:\n%s\n%s", ada, bob)
+	}
+	for _, kept := range []string{`href="mailto:help@example.com"`, `href="#top"`, `href="/relative"`} {
+		if !strings.Contains(ada, kept) {
+			t.Fatalf("expected %s untouched in %s", kept, ada)
+		}
+	}
+}
+
+func TestDefaultLinkRewriter(t *testing.T) {
+	SetDefaultLinkRewriter(func(original, recipient string) string { return "https://t.example.com/?r=" + recipient })
+	defer SetDefaultLinkRewriter(nil)
+
+	cfg := &EmailConfig{To: []string{"ada@example.com"}, HTMLBody: `<a href="https://example.com">x</a>`}
+	if _, err := json.Marshal(&EmailConfig{LinkRewriter: func(u, _ string) string { return u }}); err != nil {
+		t.Fatalf("config with a link rewriter must stay serializable for scheduled jobs: %v", err)
+	}
+	rewriteLinks(cfg)
+	if cfg.HTMLBody != `<a href="https://t.example.com/?r=ada@example.com">x</a>` {
+		t.Fatalf("unexpected body %s", cfg.HTMLBody)
+	}
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+// LintWarning describes a non-fatal deliverability problem found before sending.
+type LintWarning struct {
+	Rule    string
+	Message string
+}
+
+func (w LintWarning) String() string {
+	return fmt.Sprintf("%s: %s", w.Rule, w.Message)
+}
+
+var (
+	lintImagePattern = regexp.MustCompile(`(?i)<img\b`)
+	lintTagPattern   = regexp.MustCompile(`(?s)<[^>]*>`)
+
+	// lintSpamPhrases are phrases commonly penalised by content filters.
+	lintSpamPhrases = []string{
+		"100% free", "act now", "buy now", "click here", "free money",
+		"guaranteed", "no credit check", "risk-free", "winner", "you have been selected",
+	}
+)
+
+// lintMinTextPerImage is the minimum visible HTML text, in characters, expected
+// per embedded image before the message is flagged as image-heavy.
+const lintMinTextPerImage = 200
+
+// LintMessage checks cfg for common deliverability problems. The result is
+// advisory; sendEmail only fails on warnings when LintStrict is set.
+func LintMessage(cfg *EmailConfig) []LintWarning {
+	var warnings []LintWarning
+	add := func(rule, format string, args ...any) {
+		warnings = append(warnings, LintWarning{Rule: rule, Message: fmt.Sprintf(format, args...)})
+	}
+
+	if strings.TrimSpace(cfg.HTMLBody) != "" && strings.TrimSpace(cfg.TextBody) == "" {
+		add("missing_text_part", "html message has no plain-text alternative")
+	}
+	if isShouting(cfg.Subject) {
+		add("all_caps_subject", "subject is written in capital letters")
+	}
+	content := strings.ToLower(cfg.Subject + "\n" + cfg.TextBody + "\n" + cfg.HTMLBody)
+	for _, phrase := range lintSpamPhrases {
+		if strings.Contains(content, phrase) {
+			add("spam_phrase", "content contains %q", phrase)
+		}
+	}
+	if isBulkMessage(cfg) && len(cfg.ListUnsubscribe) == 0 {
+		add("missing_list_unsubscribe", "bulk message has no List-Unsubscribe header")
+	}
+	for _, dup := range duplicateRecipients(cfg) {
+		add("duplicate_recipient", "%s is listed in %s", dup.Address, strings.Join(dup.Fields, " and "))
+	}
+	if images := len(lintImagePattern.FindAllStringIndex(cfg.HTMLBody, -1)); images > 0 {
+		text := strings.Join(strings.Fields(lintTagPattern.ReplaceAllString(cfg.HTMLBody, " ")), " ")
+		if len(text) < images*lintMinTextPerImage {
+			add("image_heavy", "%d image(s) with only %d characters of text", images, len(text))
+		}
+	}
+	return warnings
+}
+
+// lintError joins warnings into a single error for strict mode.
+func lintError(warnings []LintWarning) error {
+	parts := make([]string, len(warnings))
+	for i, w := range warnings {
+		parts[i] = w.String()
+	}
+	return fmt.Errorf("message lint failed: %s", strings.Join(parts, "; "))
+}
+
+func isShouting(subject string) bool {
+	letters := 0
+	for _, r := range subject {
+		if !unicode.IsLetter(r) {
+			continue
+		}
+		if unicode.IsLower(r) {
+			return false
+		}
+		letters++
+	}
+	return letters >= 5
+}
+
+// isBulkMessage reports whether cfg is tagged or marked as bulk/marketing mail.
+func isBulkMessage(cfg *EmailConfig) bool {
+	for k, v := range cfg.Tags {
+		for _, s := range []string{k, v} {
+			switch strings.ToLower(s) {
+			case "bulk", "marketing", "newsletter":
+				return true
+			}
+		}
+	}
+	for k, v := range cfg.Headers {
+		if strings.EqualFold(k, "Precedence") && (strings.EqualFold(v, "bulk") || strings.EqualFold(v, "list")) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func lintRules(warnings []LintWarning) map[string]bool {
+	rules := map[string]bool{}
+	for _, w := range warnings {
+		rules[w.Rule] = true
+	}
+	return rules
+}
+
+func TestLintMessage_Rules(t *testing.T) {
+	cfg := &EmailConfig{
+		Subject:  "HUGE SALE TODAY",
+		HTMLBody: `<p>Click here</p><img src="a.png">`,
+		Tags:     map[string]string{"category": "bulk"},
+	}
+	rules := lintRules(LintMessage(cfg))
+	for _, rule := range []string{"missing_text_part", "all_caps_subject", "spam_phrase", "missing_list_unsubscribe", "image_heavy"} {
+		if !rules[rule] {
+			t.Fatalf("expected %s warning, got %v", rule, rules)
+		}
+	}
+
+	clean := &EmailConfig{
+		Subject:         "Your weekly summary",
+		TextBody:        "Hello there",
+		HTMLBody:        "<p>Hello there</p>",
+		Tags:            map[string]string{"category": "bulk"},
+		ListUnsubscribe: []string{"<mailto:unsubscribe@example.com>"},
+	}
+	if warnings := LintMessage(clean); len(warnings) != 0 {
+		t.Fatalf("expected no warnings, got %v", warnings)
+	}
+}
+
+func TestSendEmail_LintStrict(t *testing.T) {
+	cfg := &EmailConfig{
+		From:       "sender@example.com",
+		To:         []string{"user@example.com"},
+		Subject:    "hello",
+		HTMLBody:   "<p>only html</p>",
+		Transport:  "smtp",
+		Host:       "127.0.0.1",
+		DryRun:     true,
+		LintStrict: true,
+	}
+	err := sendEmail(cfg, nil)
+	if err == nil || !strings.Contains(err.Error(), "missing_text_part") {
+		t.Fatalf("expected strict lint failure, got %v", err)
+	}
+	cfg.LintStrict = false
+	if err := sendEmail(cfg, nil); err != nil {
+		t.Fatalf("expected warnings to be non-fatal, got %v", err)
+	}
+}
+
+func TestSendViaSMTP_DuplicateRecipientWarnsAndDeliversOnce(t *testing.T) {
+	defer withTempSendLog(t)()
+	srv := newStubSMTPServer(t)
+	cfg := srv.config()
+	cfg.To = []string{"Ada <ada@example.com>"}
+	cfg.BCC = []string{"ADA@example.com", "archive@example.com"}
+
+	warnings := LintMessage(cfg)
+	if len(warnings) != 1 || warnings[0].Rule != "duplicate_recipient" || warnings[0].Message != "ada@example.com is listed in to and bcc" {
+		t.Fatalf("unexpected warnings %v", warnings)
+	}
+	if err := sendEmail(cfg, nil); err != nil {
+		t.Fatalf("sendEmail: %v", err)
+	}
+	var rcpts []string
+	for _, c := range srv.Commands() {
+		if strings.HasPrefix(c, "RCPT TO:") {
+			rcpts = append(rcpts, c)
+		}
+	}
+	if strings.Join(rcpts, " ") != "RCPT TO:<ada@example.com> RCPT TO:<archive@example.com>" {
+		t.Fatalf("expected a single delivery per address, got %v", rcpts)
+	}
+
+	cfg.LintStrict = true
+	if err := sendEmail(cfg, nil); err == nil || !strings.Contains(err.Error(), "duplicate_recipient") {
+		t.Fatalf("expected strict lint to reject duplicate recipients, got %v", err)
+	}
+}
+
+func TestApplyDuplicateRecipientPolicy_PreferVisible(t *testing.T) {
+	cfg := &EmailConfig{
+		To:                  []string{"a@example.com"},
+		CC:                  []string{"A@example.com", "b@example.com"},
+		BCC:                 []string{"b@example.com", "c@example.com"},
+		DuplicateRecipients: duplicateRecipientsPreferVisible,
+	}
+	applyDuplicateRecipientPolicy(cfg)
+	if strings.Join(cfg.CC, ",") != "b@example.com" || strings.Join(cfg.BCC, ",") != "c@example.com" {
+		t.Fatalf("unexpected fields after prefer_visible: cc=%v bcc=%v", cfg.CC, cfg.BCC)
+	}
+	if len(LintMessage(cfg)) != 0 {
+		t.Fatalf("expected no duplicate warnings after applying the policy")
+	}
+}
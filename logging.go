@@ -0,0 +1,132 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"regexp"
+	"sync/atomic"
+)
+
+var pkgLogger atomic.Pointer[slog.Logger]
+
+// SetLogger routes the package's send, routing and scheduler logs to l, so
+// callers control level, format and destination. nil restores the default,
+// slog.Default(), which writes Info and above through the standard logger.
+// Secrets are redacted before records reach l.
+func SetLogger(l *slog.Logger) {
+	pkgLogger.Store(l)
+}
+
+// logger returns the logger set with SetLogger, or slog.Default().
+func logger() *slog.Logger {
+	l := pkgLogger.Load()
+	if l == nil {
+		l = slog.Default()
+	}
+	return redactingLogger(l)
+}
+
+func redactingLogger(l *slog.Logger) *slog.Logger {
+	if _, ok := l.Handler().(*redactHandler); ok {
+		return l
+	}
+	return slog.New(&redactHandler{h: l.Handler()})
+}
+
+// redactHandler masks secrets in every record: attributes whose key looks
+// sensitive, credential-bearing headers in maps, and key=value pairs or
+// Bearer/Basic tokens inside strings and errors (e.g. a request URL carrying
+// an api_key query parameter).
+type redactHandler struct {
+	h slog.Handler
+}
+
+func (r *redactHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return r.h.Enabled(ctx, level)
+}
+
+func (r *redactHandler) Handle(ctx context.Context, rec slog.Record) error {
+	out := slog.NewRecord(rec.Time, rec.Level, redactSecrets(rec.Message), rec.PC)
+	rec.Attrs(func(a slog.Attr) bool {
+		out.AddAttrs(redactAttr(a))
+		return true
+	})
+	return r.h.Handle(ctx, out)
+}
+
+func (r *redactHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	masked := make([]slog.Attr, len(attrs))
+	for i, a := range attrs {
+		masked[i] = redactAttr(a)
+	}
+	return &redactHandler{h: r.h.WithAttrs(masked)}
+}
+
+func (r *redactHandler) WithGroup(name string) slog.Handler {
+	return &redactHandler{h: r.h.WithGroup(name)}
+}
+
+func redactAttr(a slog.Attr) slog.Attr {
+	v := a.Value.Resolve()
+	if isSensitiveKey(a.Key) && v.Kind() != slog.KindGroup {
+		return slog.String(a.Key, maskPlaceholderValue(a.Key, v.String()))
+	}
+	switch v.Kind() {
+	case slog.KindString:
+		return slog.String(a.Key, redactSecrets(v.String()))
+	case slog.KindGroup:
+		group := v.Group()
+		masked := make([]any, len(group))
+		for i, g := range group {
+			masked[i] = redactAttr(g)
+		}
+		return slog.Group(a.Key, masked...)
+	case slog.KindAny:
+		switch val := v.Any().(type) {
+		case error:
+			return slog.String(a.Key, redactSecrets(val.Error()))
+		case map[string]string:
+			return slog.Any(a.Key, redactStringMap(val))
+		case map[string]any:
+			out := make(map[string]any, len(val))
+			for k, item := range val {
+				if isSensitiveKey(k) {
+					item = maskPlaceholderValue(k, fmt.Sprint(item))
+				} else if s, ok := item.(string); ok {
+					item = redactSecrets(s)
+				}
+				out[k] = item
+			}
+			return slog.Any(a.Key, out)
+		}
+	}
+	return slog.Attr{Key: a.Key, Value: v}
+}
+
+// redactStringMap masks the values of sensitive entries, such as
+// Authorization or api-key headers, in a copy of m.
+func redactStringMap(m map[string]string) map[string]string {
+	out := make(map[string]string, len(m))
+	for k, v := range m {
+		if isSensitiveKey(k) {
+			v = maskPlaceholderValue(k, v)
+		} else {
+			v = redactSecrets(v)
+		}
+		out[k] = v
+	}
+	return out
+}
+
+var (
+	secretPairPattern  = regexp.MustCompile(`(?i)([a-z0-9_-]*(?:pass|pwd|secret|token|key|auth|signature|credential)[a-z0-9_-]*=)[^&\s"',;]+`)
+	secretTokenPattern = regexp.MustCompile(`(?i)\b(Bearer|Basic)\s+[A-Za-z0-9._~+/=-]+`)
+)
+
+// redactSecrets masks credential values embedded in free text: key=value
+// pairs with a sensitive name and Bearer/Basic authorization tokens.
+func redactSecrets(s string) string {
+	s = secretPairPattern.ReplaceAllString(s, "${1}[redacted]")
+	return secretTokenPattern.ReplaceAllString(s, "$1 [redacted]")
+}
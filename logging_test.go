@@ -0,0 +1,106 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSetLogger_SendAttemptFields(t *testing.T) {
+	defer withTempSendLog(t)()
+	var buf bytes.Buffer
+	SetLogger(slog.New(slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: slog.LevelInfo})))
+	defer SetLogger(nil)
+
+	srv := newStubSMTPServer(t)
+	cfg := srv.config()
+	cfg.CC = []string{"cc@example.com"}
+	if err := sendEmail(cfg, &SendContext{JobID: "job-42"}); err != nil {
+		t.Fatalf("send: %v", err)
+	}
+
+	var attempt, size map[string]any
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		var rec map[string]any
+		if err := json.Unmarshal([]byte(line), &rec); err != nil {
+			t.Fatalf("log line is not JSON: %q", line)
+		}
+		if rec["level"] == "DEBUG" {
+			t.Fatalf("debug record logged at info level: %v", rec)
+		}
+		if rec["msg"] == "send attempt succeeded" {
+			attempt = rec
+		}
+		if rec["msg"] == "message size" {
+			size = rec
+		}
+	}
+	if attempt == nil {
+		t.Fatalf("no send attempt record in %s", buf.String())
+	}
+	if attempt["attempt"] != float64(1) || attempt["recipients"] != float64(2) || attempt["job_id"] != "job-42" || attempt["transport"] != "smtp" {
+		t.Fatalf("unexpected send attempt fields: %v", attempt)
+	}
+	if attempt["provider"] == "" || attempt["provider"] == nil {
+		t.Fatalf("send attempt record has no provider: %v", attempt)
+	}
+	if size == nil || size["bytes"] == nil {
+		t.Fatalf("expected the message size to go through the configured logger: %s", buf.String())
+	}
+}
+
+func TestLogging_RedactsSecrets(t *testing.T) {
+	defer withTempSendLog(t)()
+	var buf bytes.Buffer
+	SetLogger(slog.New(slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug})))
+	defer SetLogger(nil)
+
+	// A closed endpoint makes the client error echo the request URL, which
+	// carries the key as a query parameter.
+	srv := httptest.NewServer(http.NotFoundHandler())
+	endpoint := srv.URL
+	srv.Close()
+	const secret = "sk-live-7f3a9c1e"
+	cfg := &EmailConfig{
+		Transport:     "http",
+		Endpoint:      endpoint,
+		HTTPMethod:    http.MethodPost,
+		HTTPAuth:      "api_key_query",
+		HTTPAuthQuery: "api_key",
+		APIKey:        secret,
+		From:          "sender@example.com",
+		To:            []string{"user@example.com"},
+		Subject:       "hi",
+		TextBody:      "body",
+		Timeout:       time.Second,
+	}
+	if err := sendEmail(cfg, nil); err == nil {
+		t.Fatalf("expected the send to a closed server to fail")
+	}
+	logger().Info("headers", "headers", map[string]string{"Authorization": "Bearer " + secret, "api-key": secret, "X-Trace": "ok"})
+	logger().Info("auth header", "detail", "Authorization: Bearer "+secret)
+
+	out := buf.String()
+	if strings.Contains(out, secret) {
+		t.Fatalf("raw key leaked into logs:\n%s", out)
+	}
+	if !strings.Contains(out, "api_key=[redacted]") {
+		t.Fatalf("expected the request URL key to be masked, got:\n%s", out)
+	}
+	if !strings.Contains(out, "send attempt failed") || !strings.Contains(out, "[redacted]") || !strings.Contains(out, `"X-Trace":"ok"`) {
+		t.Fatalf("expected redacted records, got:\n%s", out)
+	}
+	sendLog, err := os.ReadFile(sendLogFile)
+	if err != nil {
+		t.Fatalf("read send log: %v", err)
+	}
+	if strings.Contains(string(sendLog), secret) || !strings.Contains(string(sendLog), "api_key=[redacted]") {
+		t.Fatalf("expected the send log error to be redacted, got:\n%s", sendLog)
+	}
+}
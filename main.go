@@ -5,7 +5,6 @@ import (
 	"crypto/hmac"
 	cryptorand "crypto/rand"
 	"crypto/sha256"
-	"crypto/tls"
 	"encoding/hex"
 	"encoding/json"
 	"errors"
@@ -15,15 +14,20 @@ import (
 	"log"
 	"math"
 	mrand "math/rand"
+	"mime"
+	"net"
 	"net/http"
 	"net/mail"
 	"net/smtp"
+	"net/textproto"
 	"net/url"
 	"os"
+	"os/signal"
 	"regexp"
 	"sort"
 	"strconv"
 	"strings"
+	"syscall"
 	"time"
 )
 
@@ -31,18 +35,25 @@ import (
 type EmailConfig struct {
 	From                string
 	FromName            string
+	FromPool            []string
+	FromRotation        string
+	AllowedFromDomains  []string
 	EnvelopeFrom        string
 	ReturnPath          string
 	ReplyTo             []string
 	To                  []string
 	CC                  []string
 	BCC                 []string
+	EnvelopeRecipients  []string
+	HeaderTo            string
 	ListUnsubscribe     []string
 	ListUnsubscribePost bool
 	Subject             string
 	Body                string
 	TextBody            string
 	HTMLBody            string
+	BodyEncoding        string
+	Charset             string
 	Attachments         []Attachment
 	ConfigurationSet    string
 	Tags                map[string]string
@@ -69,17 +80,27 @@ type EmailConfig struct {
 	MaxIdleConns        int
 	MaxIdleConnsHost    int
 	DisableKeepAlives   bool
+	DisableSenderHeader bool
 	SMTPAuth            string
+	SMTPBodyType        string
+	DSN                 DSNConfig
+	SourceIP            string
 	HTMLTemplatePath    string
 	TextTemplatePath    string
 	BodyTemplatePath    string
 	AdditionalData      map[string]any
 	ScheduleMode        string
+	ScheduleJitter      time.Duration
+	DedupTTL            time.Duration
+	DedupTTLByMode      map[string]time.Duration
+	CampaignID          string
+	WorkflowID          string
 	RawSubject          string         `json:"-"`
 	RawBody             string         `json:"-"`
 	RawTextBody         string         `json:"-"`
 	RawHTMLBody         string         `json:"-"`
 	RawHTTPPayload      map[string]any `json:"-"`
+	RawAttachments      []Attachment   `json:"-"`
 	AWSRegion           string
 	AWSAccessKey        string
 	AWSSecretKey        string
@@ -87,17 +108,138 @@ type EmailConfig struct {
 	UseTLS              bool
 	UseSSL              bool
 	SkipTLSVerify       bool
+	PinnedSHA256        []string
 	Timeout             time.Duration
 	RetryCount          int
 	RetryDelay          time.Duration
 	// MaxRetryDelay caps exponential backoff delay (optional).
 	MaxRetryDelay time.Duration
+	// MaxTotalAttempts caps attempts across all providers; RetryCount still
+	// limits each provider. Zero means no overall cap.
+	MaxTotalAttempts int
+	// SendDeadline bounds the whole send, retries and fallbacks included.
+	// No attempt starts, and no backoff sleeps, past it.
+	SendDeadline time.Duration
+	// SuccessCodes lists the HTTP statuses that count as delivered; empty
+	// means any status below 300.
+	SuccessCodes []int
 	// ProviderPriority is an ordered list of provider names to attempt in case of failures.
 	ProviderPriority []string
+	// InferProviderMX lets provider inference look up the MX records of a
+	// sender domain it does not know, e.g. a Google Workspace custom domain.
+	InferProviderMX bool
 	// ProviderRoutes allows conditional routing rules that override provider selection.
 	ProviderRoutes []ProviderRoute `json:"routes"`
 	// DryRun when true prevents actual sends and logs what would be sent.
 	DryRun bool `json:"dry_run"`
+	// PartialRetry is the policy after a partial SMTP delivery: "remaining"
+	// (default) retries only uncommitted recipients, "fail" stops retrying.
+	PartialRetry string
+	// RecipientPolicy is "best_effort" (default) or "all_or_nothing" for SMTP
+	// sends where some RCPT TO commands are rejected.
+	RecipientPolicy string
+	// EnvelopeFromTemplate renders a per-recipient SMTP envelope sender
+	// (VERP), e.g. "bounces+{{recipient}}@example.com", sending one
+	// transaction per recipient.
+	EnvelopeFromTemplate string
+	// SMTPPoolSize keeps up to this many SMTP connections open per server for
+	// reuse across sends; zero closes the connection after every send.
+	SMTPPoolSize int
+	// LintStrict turns LintMessage warnings into send errors.
+	LintStrict bool
+	// UnknownKeys reports top-level keys that look like misspelled fields:
+	// "warn" logs them and "error" fails parsing. Empty ignores them.
+	UnknownKeys string
+	// Template sends with a template stored at the provider instead of the
+	// inline subject and bodies.
+	Template *Template
+	// DeliveryReport, when set, builds the message as a multipart/report
+	// delivery status notification.
+	DeliveryReport *DeliveryReport
+	// SMIME signs and/or encrypts the MIME message. Off when nil.
+	SMIME *SMIMEConfig
+	// SandboxMode asks providers that support it (Mailjet) to validate the
+	// request without delivering it.
+	SandboxMode bool
+	// InlineCSS moves <style> rules in HTMLBody onto matching elements' style
+	// attributes for clients that ignore <style> blocks.
+	InlineCSS bool
+	// SanitizeHTML strips scripts, event handlers and other unsafe markup from
+	// HTMLBody before sending; use it when the HTML includes untrusted input.
+	SanitizeHTML bool
+	// LinkRewriter, when set, rewrites http(s) links in HTMLBody per recipient
+	// (e.g. for click tracking). It is not persisted with scheduled jobs; use
+	// SetDefaultLinkRewriter for those.
+	LinkRewriter LinkRewriter `json:"-"`
+	// OpenPixelURL appends an open-tracking image to HTML bodies; its t query
+	// parameter is a token for the recipient signed with OpenPixelSecret.
+	OpenPixelURL    string
+	OpenPixelSecret string
+	// XMailer and UserAgent override the X-Mailer message header and the HTTP
+	// User-Agent (both default to "oarkflow/email"); "none" omits them.
+	XMailer   string
+	UserAgent string
+	// DateTimezone sets the zone of the Date header: "UTC", "Local" or an
+	// IANA name such as "Europe/Berlin". Empty uses the local zone.
+	DateTimezone string
+	// MessageDate, when set, is used for the Date header instead of the send
+	// time, e.g. for reproducible output or a scheduled "sent at" time.
+	MessageDate time.Time
+	// ReplyToFrom sets Reply-To to the From address when none is given.
+	ReplyToFrom bool
+	// DuplicateRecipients is "keep" (default) or "prefer_visible", which drops
+	// an address from Cc/Bcc when it also appears in a more visible field.
+	DuplicateRecipients string
+	// RedirectAllTo, for staging, replaces To/Cc/Bcc with these addresses and
+	// records the original recipients in X-Original-To/Cc/Bcc headers.
+	RedirectAllTo []string
+	// RecipientAllowlist and RecipientDenylist filter recipients by exact
+	// address or glob ("*@example.com"); a send left with none is blocked.
+	RecipientAllowlist []string
+	RecipientDenylist  []string
+	// MaxRecipientsPerMessage splits HTTP sends into several requests when To exceeds it.
+	MaxRecipientsPerMessage int
+	// MaxRecipients rejects a send whose distinct To, Cc and Bcc addresses
+	// exceed it, as a guard against accidental mass sends; 0 is unlimited.
+	MaxRecipients int
+	// VerifySender checks, before sending through a provider, that it accepts
+	// From as a verified identity. VerifiedSenders lists accepted addresses or
+	// domains per provider; providers without an entry ask their API.
+	VerifySender    bool
+	VerifiedSenders map[string][]string
+	// AlternativeOrder is "text_first" (default) or "html_first", the order of
+	// the parts in multipart/alternative.
+	AlternativeOrder string
+	// MIMEPreamble is written before the first part of the outermost
+	// multipart entity, for clients that do not understand MIME.
+	MIMEPreamble string
+	// ZipAttachments bundles the non-inline attachments into one zip named
+	// ZipAttachmentsName (default "attachments.zip") before sending.
+	ZipAttachments     bool
+	ZipAttachmentsName string
+	// AddressNormalization maps a recipient domain ("*" for any other) to
+	// rules ("plus", "dots") that make equivalent addresses share one key
+	// for the dedup store and the denylist. Delivery and envelope uniqueness
+	// use the address as entered.
+	AddressNormalization map[string][]string
+	// MaxMessageBytes rejects a built message (SMTP) or encoded request body
+	// (HTTP) larger than this, whatever the provider accepts; zero disables it.
+	MaxMessageBytes int
+	// MaxBodyBytes truncates TextBody and HTMLBody beyond this many bytes,
+	// appending a notice; attachments are untouched. Zero disables it.
+	MaxBodyBytes int
+
+	// timing collects the current attempt's timing while it is sent.
+	timing *AttemptTiming
+	// pinnedProviders, set by pinProvider, is used as the provider order
+	// as is, without routing or usage-based reordering.
+	pinnedProviders []string
+	// secretRefs maps credential fields resolved by resolveSecrets to the
+	// file:// or cmd:// references they came from.
+	secretRefs map[string]string
+	// renderOnly marks a config parsed by parsePreviewConfig: nothing is
+	// read from disk, the network, commands or the environment.
+	renderOnly bool
 }
 
 // ProviderRoute describes a routing rule to choose providers based on message properties.
@@ -127,6 +269,15 @@ type ProviderRoute struct {
 	ProviderCapacities map[string]int `json:"provider_capacities"`
 	// ProviderCostOverrides optionally override provider cost per-route.
 	ProviderCostOverrides map[string]float64 `json:"provider_costs"`
+	// Selection picks the ordering strategy for multiple providers: "usage" (default)
+	// or "cost_reliability" to rank by registry cost/reliability metadata.
+	Selection string `json:"selection"`
+	// ProviderHeaders adds headers, keyed by provider name, when this route
+	// matches and that provider is the one sending.
+	ProviderHeaders map[string]map[string]string `json:"provider_headers"`
+	// Warmup caps, per provider, the successful sends each day while that
+	// provider's IP or domain warms up; capped providers are skipped.
+	Warmup map[string]WarmupSchedule `json:"warmup"`
 }
 
 // Attachment describes a file to be included with the email.
@@ -149,17 +300,25 @@ type encodedAttachment struct {
 var fieldAliases = map[string][]string{
 	"from":                    {"from", "sender", "from_email", "fromaddress", "sender_email", "mailfrom"},
 	"from_name":               {"from_name", "sender_name", "fromname", "display_name", "name"},
+	"from_pool":               {"from_pool", "from_addresses", "sender_pool"},
+	"from_rotation":           {"from_rotation", "from_strategy", "sender_rotation"},
+	"allowed_from_domains":    {"allowed_from_domains", "from_domains", "sender_domains"},
 	"return_path":             {"return_path", "bounce", "envelope_from", "returnpath"},
 	"envelope_from":           {"envelope_from", "mail_from", "mfrom"},
+	"envelope_from_template":  {"envelope_from_template", "verp", "verp_template"},
 	"reply_to":                {"reply_to", "replyto", "respond_to", "response_to"},
 	"to":                      {"to", "recipient", "recipients", "send_to", "sending_to", "mail_to", "to_email", "sendto"},
 	"cc":                      {"cc", "carbon_copy", "copy_to"},
 	"bcc":                     {"bcc", "blind_carbon_copy", "blind_copy"},
+	"envelope_recipients":     {"envelope_recipients", "envelope_to", "rcpt_to"},
+	"header_to":               {"header_to", "display_to", "to_header"},
 	"list_unsubscribe":        {"list_unsubscribe", "unsubscribe", "listunsubscribe"},
 	"list_unsubscribe_post":   {"list_unsubscribe_post", "unsubscribe_post", "one_click"},
 	"subject":                 {"subject", "title", "email_subject"},
 	"body":                    {"body", "message", "msg", "content", "email_content", "text"},
 	"body_html":               {"body_html", "html_body", "html", "message_html"},
+	"transfer_encoding":       {"transfer_encoding", "body_encoding", "content_transfer_encoding"},
+	"charset":                 {"charset", "body_charset", "message_charset"},
 	"body_text":               {"body_text", "text_body", "plain_text", "message_text"},
 	"attachments":             {"attachments", "attachment", "files", "file", "attach"},
 	"configuration_set":       {"configuration_set", "config_set", "ses_configuration_set"},
@@ -184,20 +343,70 @@ var fieldAliases = map[string][]string{
 	"http_auth_query":         {"http_auth_query", "auth_query", "api_key_query", "auth_param"},
 	"http_auth_prefix":        {"http_auth_prefix", "auth_prefix", "bearer_prefix"},
 	"schedule_mode":           {"schedule_mode", "schedule"},
+	"campaign_id":             {"campaign_id", "campaign", "namespace"},
+	"workflow_id":             {"workflow_id", "workflow_key"},
+	"dedup_ttl":               {"dedup_ttl", "dedupe_ttl", "dedup_window"},
+	"schedule_jitter":         {"schedule_jitter", "jitter", "run_at_jitter"},
 	"max_conns_per_host":      {"max_conns_per_host", "max_connections", "max_conns"},
 	"max_idle_conns":          {"max_idle_conns", "idle_conns", "max_idle"},
 	"max_idle_conns_per_host": {"max_idle_conns_per_host", "max_idle_host", "idle_conns_host"},
+	"partial_retry":           {"partial_retry", "partial_retry_policy", "partial_delivery"},
+	"max_message_bytes":       {"max_message_bytes", "max_message_size", "message_size_limit"},
+	"max_body_bytes":          {"max_body_bytes", "max_body_size", "body_size_limit"},
+	"recipient_policy":        {"recipient_policy", "rcpt_policy"},
+	"template":                {"template", "provider_template"},
+	"delivery_report":         {"delivery_report", "dsn", "delivery_status"},
+	"smime":                   {"smime", "s_mime"},
+	"infer_provider_mx":       {"infer_provider_mx", "provider_mx_lookup", "mx_inference"},
+	"sandbox_mode":            {"sandbox_mode", "sandbox"},
+	"inline_css":              {"inline_css", "css_inline"},
+	"fuzzy_keys":              {"fuzzy_keys", "fuzzy_key_matching", "fuzzy_matching"},
+	"fuzzy_key_overlap":       {"fuzzy_key_overlap", "fuzzy_min_overlap"},
+	"sanitize_html":           {"sanitize_html", "html_sanitize"},
+	"open_pixel_url":          {"open_pixel_url", "open_tracking_url", "tracking_pixel_url"},
+	"open_pixel_secret":       {"open_pixel_secret", "open_tracking_secret", "tracking_secret"},
+	"x_mailer":                {"x_mailer", "mailer"},
+	"date_timezone":           {"date_timezone", "date_tz", "timezone"},
+	"message_date":            {"message_date", "date_header", "sent_at"},
+	"user_agent":              {"user_agent", "http_user_agent"},
+	"reply_to_from":           {"reply_to_from", "reply_to_sender"},
+	"duplicate_recipients":    {"duplicate_recipients", "duplicate_recipient_policy"},
+	"redirect_all_to":         {"redirect_all_to", "redirect_to", "test_recipients"},
+	"recipient_allowlist":     {"recipient_allowlist", "allowed_recipients", "recipient_whitelist"},
+	"recipient_denylist":      {"recipient_denylist", "denied_recipients", "blocked_recipients", "recipient_blacklist"},
+	"smtp_pool_size":          {"smtp_pool_size", "smtp_pool", "smtp_idle_conns"},
+	"lint_strict":             {"lint_strict", "strict_lint", "lint_as_errors"},
+	"unknown_keys":            {"unknown_keys", "strict_keys", "strict_config"},
+	"recipients_per_message":  {"recipients_per_message", "max_recipients_per_message", "recipients_per_request"},
+	"max_recipients":          {"max_recipients", "recipient_limit", "max_total_recipients"},
+	"verify_sender":           {"verify_sender", "verify_from", "sender_preflight"},
+	"verified_senders":        {"verified_senders", "verified_identities"},
+	"alternative_order":       {"alternative_order", "part_order", "mime_part_order"},
+	"mime_preamble":           {"mime_preamble", "multipart_preamble", "preamble"},
+	"zip_attachments":         {"zip_attachments", "bundle_attachments", "attachments_zip"},
+	"zip_attachments_name":    {"zip_attachments_name", "zip_name", "attachments_zip_name"},
+	"address_normalization":   {"address_normalization", "normalize_addresses", "recipient_normalization"},
 	"disable_keepalives":      {"disable_keepalives", "no_keepalive", "disable_keep_alive"},
+	"disable_sender_header":   {"disable_sender_header", "no_sender_header"},
 	"smtp_auth":               {"smtp_auth", "smtp_auth_type", "smtp_auth_mechanism"},
+	"smtp_body_type":          {"smtp_body_type", "smtp_body", "mail_body_type"},
+	"dsn_notify":              {"dsn_notify", "notify_on"},
+	"dsn_return":              {"dsn_return", "dsn_ret"},
+	"dsn_envid":               {"dsn_envid", "envid", "dsn_envelope_id"},
+	"source_ip":               {"source_ip", "local_addr", "bind_ip", "local_ip"},
 	"html_template":           {"html_template", "template_html", "html_file", "html_path"},
 	"text_template":           {"text_template", "template_text", "text_file", "text_path"},
 	"body_template":           {"body_template", "message_template", "msg_template", "message_file", "template_message"},
 	"timeout":                 {"timeout", "timeout_seconds", "request_timeout", "http_timeout"},
 	"retries":                 {"retries", "retry", "retry_count", "attempts"},
+	"max_total_attempts":      {"max_total_attempts", "total_attempts", "retry_budget"},
+	"send_deadline":           {"send_deadline", "retry_deadline", "total_timeout"},
+	"success_codes":           {"success_codes", "success_status", "success_statuses"},
 	"retry_delay":             {"retry_delay", "retry_wait", "retry_backoff", "retry_pause"},
 	"use_tls":                 {"use_tls", "tls", "starttls", "enable_tls"},
 	"use_ssl":                 {"use_ssl", "ssl", "enable_ssl"},
 	"skip_tls_verify":         {"skip_tls_verify", "insecure", "disable_tls_verify"},
+	"pinned_sha256":           {"pinned_sha256", "tls_pins", "cert_pins", "pin_sha256"},
 	"aws_region":              {"aws_region", "region"},
 	"aws_access_key":          {"aws_access_key", "access_key", "aws_access_key_id"},
 	"aws_secret_key":          {"aws_secret_key", "secret_key", "aws_secret_access_key"},
@@ -226,6 +435,9 @@ func init() {
 			normalized = append(normalized, canonical)
 		}
 		fieldAliases[canonical] = normalized
+		for _, alias := range normalized {
+			aliasOwners[sanitizeKey(alias)] = canonical
+		}
 	}
 }
 
@@ -235,29 +447,97 @@ func main() {
 	worker := flag.Bool("worker", false, "start scheduler worker")
 	storePath := flag.String("store", "scheduler_store.json", "path to scheduler store file")
 	schedule := flag.Bool("schedule", false, "schedule this email instead of sending now")
+	verify := flag.Bool("verify", false, "verify provider credentials without sending")
+	preview := flag.Bool("preview", false, "print each workflow step's rendered email without scheduling")
+	explainRouting := flag.Bool("explain-routing", false, "print how the email would be routed to providers without sending")
+	pollInterval := flag.Duration("poll-interval", 5*time.Second, "how often the worker polls the store for due jobs")
+	precise := flag.Bool("precise", false, "wake the worker exactly when the next job is due instead of at the next poll")
+	optimize := flag.Bool("optimize", false, "allocate providers across each due batch, honouring per-route provider capacities")
+	bodyStdin := flag.Bool("body-stdin", false, "read the message body from stdin")
+	adminAddr := flag.String("admin-addr", "", "serve worker /healthz, /jobs, /stats and /preview on this host:port; requires -admin-token")
+	adminToken := flag.String("admin-token", "", "bearer token the admin endpoints require; accepts file:// and cmd:// references")
 	flag.Parse()
 
 	// If the user only asked to run the worker, start it immediately (no template required).
 	if *worker {
 		store := NewFileJobStore(*storePath)
-		s := NewScheduler(store, 5*time.Second)
+		s := NewScheduler(store, *pollInterval)
+		s.Precise = *precise
+		if *optimize {
+			s.Optimizer = &GreedyBatchOptimizer{}
+		}
 		if err := s.Start(); err != nil {
 			log.Fatalf("cannot start scheduler: %v", err)
 		}
-		// block forever; in a real system you'd integrate graceful shutdown
-		select {}
+		var admin *http.Server
+		if *adminAddr != "" {
+			token, err := resolveSecretRef(strings.TrimSpace(*adminToken))
+			if err != nil {
+				log.Fatalf("admin-token: %v", err)
+			}
+			if admin, err = startAdminServer(*adminAddr, token, store); err != nil {
+				log.Fatalf("cannot start admin server: %v", err)
+			}
+		}
+		// Run until interrupted, then let in-flight jobs finish and close
+		// pooled SMTP connections.
+		sig := make(chan os.Signal, 1)
+		signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+		<-sig
+		if admin != nil {
+			admin.Close()
+		}
+		s.Stop()
+		return
 	}
 
 	raw, err := loadConfigFiles(*templatePath, *payloadPath, flag.Args())
 	if err != nil {
 		log.Fatalf("failed to load config: %v", err)
 	}
+	if *bodyStdin {
+		raw["body_template"] = stdinSource
+	}
 
 	config, err := parseConfig(raw)
 	if err != nil {
 		log.Fatalf("config error: %v", err)
 	}
 
+	if *verify {
+		if err := VerifyCredentials(config); err != nil {
+			log.Fatalf("credential check failed: %v", err)
+		}
+		log.Printf("credentials verified for %s", config.TransportDetails())
+		return
+	}
+
+	if *explainRouting {
+		out, _ := json.MarshalIndent(ExplainRouting(config), "", "  ")
+		fmt.Println(string(out))
+		return
+	}
+
+	if *preview {
+		def, ok := config.AdditionalData["workflow_steps"]
+		if !ok {
+			def, ok = config.AdditionalData["workflow_definition"]
+		}
+		if !ok {
+			def, ok = config.AdditionalData["workflow"].([]any)
+		}
+		if !ok {
+			log.Fatalf("preview requires workflow_steps, workflow_definition or an inline workflow array")
+		}
+		previews, err := PreviewWorkflow(config, def)
+		if err != nil {
+			log.Fatalf("preview failed: %v", err)
+		}
+		out, _ := json.MarshalIndent(previews, "", "  ")
+		fmt.Println(string(out))
+		return
+	}
+
 	// If user explicitly asked to schedule, do so
 	if *schedule {
 		store := NewFileJobStore(*storePath)
@@ -299,7 +579,11 @@ func main() {
 		} else if d, ok := config.AdditionalData["delay_seconds"].(float64); ok && d > 0 {
 			runAt = time.Now().Add(time.Duration(d) * time.Second)
 		}
-		job, err := s.Schedule(config, runAt, nil)
+		var meta map[string]any
+		if p, ok := config.AdditionalData["priority"]; ok {
+			meta = map[string]any{"priority": p}
+		}
+		job, err := s.Schedule(config, runAt, meta)
 		if err != nil {
 			log.Fatalf("schedule failed: %v", err)
 		}
@@ -342,11 +626,17 @@ func main() {
 	}
 
 	log.Printf("Sending email to %v via %s (%s)...", config.To, config.TransportDetails(), config.ProviderOrHost())
-	if err := sendEmail(config, nil); err != nil {
+	err = sendEmail(config, nil)
+	closeSMTPPool()
+	if err != nil {
 		if errors.Is(err, errDeduplicated) {
 			log.Println("Send skipped: duplicate detected (schedule=once)")
 			return
 		}
+		if errors.Is(err, errRecipientsBlocked) {
+			log.Println("Send blocked: no recipient passed the allow/deny lists")
+			return
+		}
 		log.Fatalf("send failed: %v", err)
 	}
 	log.Println("Email sent successfully!")
@@ -393,24 +683,78 @@ func printUsage() {
 }
 
 func parseConfig(raw map[string]any) (*EmailConfig, error) {
+	return parseConfigMode(raw, false)
+}
+
+// parsePreviewConfig parses raw for rendering only, as the admin /preview
+// endpoint does for configs it receives over the network. Secret references,
+// template paths and recipient sources are rejected instead of read, and
+// {{env.*}} placeholders are left unresolved.
+func parsePreviewConfig(raw map[string]any) (*EmailConfig, error) {
+	return parseConfigMode(raw, true)
+}
+
+func parseConfigMode(raw map[string]any, renderOnly bool) (*EmailConfig, error) {
 	norm := newNormalizedConfig(raw)
 	cfg := &EmailConfig{
 		Headers:     map[string]string{},
 		QueryParams: map[string]string{},
+		renderOnly:  renderOnly,
 	}
 
 	cfg.From = getStringField(norm, "from")
 	cfg.FromName = getStringField(norm, "from_name")
+	cfg.FromPool = getStringArrayField(norm, "from_pool")
+	cfg.FromRotation = strings.ToLower(getStringField(norm, "from_rotation"))
+	cfg.AllowedFromDomains = getStringArrayField(norm, "allowed_from_domains")
 	cfg.ReturnPath = getStringField(norm, "return_path")
 	if env := getStringField(norm, "envelope_from"); env != "" {
 		cfg.EnvelopeFrom = env
 	}
+	cfg.EnvelopeFromTemplate = getStringField(norm, "envelope_from_template")
 	cfg.ReplyTo = getStringArrayField(norm, "reply_to")
+	cfg.ReplyToFrom = getBoolField(norm, "reply_to_from")
+	cfg.InlineCSS = getBoolField(norm, "inline_css")
+	cfg.SandboxMode = getBoolField(norm, "sandbox_mode")
+	if val, ok := norm.pullValue("template"); ok {
+		cfg.Template = parseTemplateValue(val)
+	}
+	if val, ok := norm.pullValue("delivery_report"); ok {
+		report, err := parseDeliveryReportValue(val)
+		if err != nil {
+			return nil, err
+		}
+		cfg.DeliveryReport = report
+	}
+	if val, ok := norm.pullValue("smime"); ok {
+		sc, err := parseSMIMEValue(val)
+		if err != nil {
+			return nil, err
+		}
+		cfg.SMIME = sc
+	}
+	cfg.SanitizeHTML = getBoolField(norm, "sanitize_html")
+	cfg.XMailer = getStringField(norm, "x_mailer")
+	cfg.UserAgent = getStringField(norm, "user_agent")
+	cfg.DateTimezone = getStringField(norm, "date_timezone")
+	if raw := getStringField(norm, "message_date"); raw != "" {
+		date, err := parseMessageDate(raw)
+		if err != nil {
+			return nil, err
+		}
+		cfg.MessageDate = date
+	}
+	cfg.OpenPixelURL = getStringField(norm, "open_pixel_url")
+	cfg.OpenPixelSecret = getStringField(norm, "open_pixel_secret")
 	cfg.To = getStringArrayField(norm, "to")
 	cfg.CC = getStringArrayField(norm, "cc")
 	cfg.BCC = getStringArrayField(norm, "bcc")
+	cfg.EnvelopeRecipients = getStringArrayField(norm, "envelope_recipients")
+	cfg.HeaderTo = getStringField(norm, "header_to")
 	cfg.ListUnsubscribe = getStringArrayField(norm, "list_unsubscribe")
 	cfg.ListUnsubscribePost = getBoolField(norm, "list_unsubscribe_post")
+	cfg.BodyEncoding = strings.ToLower(getStringField(norm, "transfer_encoding"))
+	cfg.Charset = getStringField(norm, "charset")
 	cfg.Subject = getStringField(norm, "subject")
 	cfg.Body = getStringField(norm, "body")
 	cfg.TextBody = getStringField(norm, "body_text")
@@ -452,8 +796,60 @@ func parseConfig(raw map[string]any) (*EmailConfig, error) {
 	cfg.MaxConnsPerHost = getIntField(norm, "max_conns_per_host")
 	cfg.MaxIdleConns = getIntField(norm, "max_idle_conns")
 	cfg.MaxIdleConnsHost = getIntField(norm, "max_idle_conns_per_host")
+	cfg.MaxRecipientsPerMessage = getIntField(norm, "recipients_per_message")
+	cfg.MaxRecipients = getIntField(norm, "max_recipients")
+	cfg.VerifySender = getBoolField(norm, "verify_sender")
+	cfg.AlternativeOrder = strings.ToLower(getStringField(norm, "alternative_order"))
+	if val, ok := norm.pullValue("mime_preamble"); ok {
+		switch v := val.(type) {
+		case bool:
+			if v {
+				cfg.MIMEPreamble = defaultMIMEPreamble
+			}
+		case string:
+			switch strings.ToLower(strings.TrimSpace(v)) {
+			case "true", "yes", "1":
+				cfg.MIMEPreamble = defaultMIMEPreamble
+			case "", "false", "no", "0":
+			default:
+				cfg.MIMEPreamble = strings.TrimSpace(v)
+			}
+		}
+	}
+	cfg.ZipAttachments = getBoolField(norm, "zip_attachments")
+	cfg.ZipAttachmentsName = getStringField(norm, "zip_attachments_name")
+	if val, ok := norm.pullValue("address_normalization"); ok {
+		cfg.AddressNormalization = parseAddressNormalization(val)
+	}
+	for provider, senders := range getObjectField(norm, "verified_senders") {
+		if cfg.VerifiedSenders == nil {
+			cfg.VerifiedSenders = map[string][]string{}
+		}
+		cfg.VerifiedSenders[provider] = normalizeStringSlice(senders)
+	}
+	cfg.LintStrict = getBoolField(norm, "lint_strict")
+	if val, ok := norm.pullValue("unknown_keys"); ok && val != nil {
+		cfg.UnknownKeys = parseUnknownKeysMode(val)
+	}
+	cfg.PartialRetry = strings.ToLower(getStringField(norm, "partial_retry"))
+	cfg.RecipientPolicy = strings.ToLower(getStringField(norm, "recipient_policy"))
+	cfg.MaxMessageBytes = getIntField(norm, "max_message_bytes")
+	cfg.MaxBodyBytes = getIntField(norm, "max_body_bytes")
+	cfg.DuplicateRecipients = strings.ToLower(getStringField(norm, "duplicate_recipients"))
+	cfg.RedirectAllTo = getStringArrayField(norm, "redirect_all_to")
+	cfg.RecipientAllowlist = getStringArrayField(norm, "recipient_allowlist")
+	cfg.RecipientDenylist = getStringArrayField(norm, "recipient_denylist")
+	cfg.SMTPPoolSize = getIntField(norm, "smtp_pool_size")
 	cfg.DisableKeepAlives = getBoolField(norm, "disable_keepalives")
+	cfg.DisableSenderHeader = getBoolField(norm, "disable_sender_header")
 	cfg.SMTPAuth = strings.ToLower(getStringField(norm, "smtp_auth"))
+	cfg.SMTPBodyType = strings.ToLower(getStringField(norm, "smtp_body_type"))
+	cfg.DSN = DSNConfig{
+		Notify: normalizeDSNNotify(getStringArrayField(norm, "dsn_notify")),
+		Return: strings.ToUpper(getStringField(norm, "dsn_return")),
+		EnvID:  getStringField(norm, "dsn_envid"),
+	}
+	cfg.SourceIP = getStringField(norm, "source_ip")
 	cfg.AWSRegion = getStringField(norm, "aws_region")
 	cfg.AWSAccessKey = getStringField(norm, "aws_access_key")
 	cfg.AWSSecretKey = getStringField(norm, "aws_secret_key")
@@ -462,140 +858,66 @@ func parseConfig(raw map[string]any) (*EmailConfig, error) {
 	cfg.RetryCount = getIntField(norm, "retries")
 	cfg.RetryDelay = getDurationField(norm, "retry_delay")
 	cfg.MaxRetryDelay = getDurationField(norm, "max_retry_delay")
+	cfg.MaxTotalAttempts = getIntField(norm, "max_total_attempts")
+	cfg.SendDeadline = getDurationField(norm, "send_deadline")
+	for _, code := range getStringArrayField(norm, "success_codes") {
+		n, err := strconv.Atoi(code)
+		if err != nil || n < 100 || n > 599 {
+			return nil, fmt.Errorf("invalid success code %q", code)
+		}
+		cfg.SuccessCodes = append(cfg.SuccessCodes, n)
+	}
 	cfg.ProviderPriority = getStringArrayField(norm, "provider_priority")
 	cfg.DryRun = getBoolField(norm, "dry_run")
+	cfg.InferProviderMX = getBoolField(norm, "infer_provider_mx")
 	// Parse routes: an array of route objects or a single object
 	if val, ok := norm.pullValue("routes"); ok && val != nil {
+		var items []any
 		switch v := val.(type) {
 		case []any:
-			for _, item := range v {
-				if m := normalizeObject(item); m != nil {
-					r := ProviderRoute{}
-					// support both to_domain and to_domains
-					if td, ok := m["to_domain"]; ok {
-						r.ToDomains = normalizeStringSlice(td)
-					} else if td, ok := m["to_domains"]; ok {
-						r.ToDomains = normalizeStringSlice(td)
-					}
-					if fd, ok := m["from_domain"]; ok {
-						r.FromDomains = normalizeStringSlice(fd)
-					} else if fd, ok := m["from_domains"]; ok {
-						r.FromDomains = normalizeStringSlice(fd)
-					}
-					if s, ok := m["subject_regex"]; ok {
-						r.SubjectRegex = strings.TrimSpace(fmt.Sprint(s))
-					}
-					if p, ok := m["provider_priority"]; ok {
-						r.ProviderPriority = normalizeStringSlice(p)
-					}
-					if p, ok := m["provider"]; ok {
-						r.Provider = strings.ToLower(strings.TrimSpace(fmt.Sprint(p)))
-					}
-					if v, ok := m["hourly_limit"]; ok {
-						r.HourlyLimit = toInt(v)
-					}
-					if v, ok := m["daily_limit"]; ok {
-						r.DailyLimit = toInt(v)
-					}
-					if v, ok := m["weekly_limit"]; ok {
-						r.WeeklyLimit = toInt(v)
-					}
-					if v, ok := m["monthly_limit"]; ok {
-						r.MonthlyLimit = toInt(v)
-					}
-					if v, ok := m["selection_window"]; ok {
-						if s, ok := v.(string); ok {
-							if d, err := time.ParseDuration(s); err == nil {
-								r.SelectionWindow = d
-							}
-						}
-					}
-					if v, ok := m["provider_weights"]; ok {
-						if m2 := normalizeObject(v); m2 != nil {
-							r.ProviderWeights = toFloatMap(m2)
-						}
-					}
-					cfg.ProviderRoutes = append(cfg.ProviderRoutes, r)
-				}
-			}
+			items = v
 		case map[string]any:
-			if m := normalizeObject(v); m != nil {
-				r := ProviderRoute{}
-				if td, ok := m["to_domain"]; ok {
-					r.ToDomains = normalizeStringSlice(td)
-				} else if td, ok := m["to_domains"]; ok {
-					r.ToDomains = normalizeStringSlice(td)
-				}
-				if fd, ok := m["from_domain"]; ok {
-					r.FromDomains = normalizeStringSlice(fd)
-				} else if fd, ok := m["from_domains"]; ok {
-					r.FromDomains = normalizeStringSlice(fd)
-				}
-				if s, ok := m["subject_regex"]; ok {
-					r.SubjectRegex = strings.TrimSpace(fmt.Sprint(s))
-				}
-				if p, ok := m["provider_priority"]; ok {
-					r.ProviderPriority = normalizeStringSlice(p)
-				}
-				if p, ok := m["provider"]; ok {
-					r.Provider = strings.ToLower(strings.TrimSpace(fmt.Sprint(p)))
-				}
-				if v, ok := m["hourly_limit"]; ok {
-					r.HourlyLimit = toInt(v)
-				}
-				if v, ok := m["daily_limit"]; ok {
-					r.DailyLimit = toInt(v)
-				}
-				if v, ok := m["weekly_limit"]; ok {
-					r.WeeklyLimit = toInt(v)
-				}
-				if v, ok := m["monthly_limit"]; ok {
-					r.MonthlyLimit = toInt(v)
-				}
-				if v, ok := m["selection_window"]; ok {
-					if s, ok := v.(string); ok {
-						if d, err := time.ParseDuration(s); err == nil {
-							r.SelectionWindow = d
-						}
-					}
-				}
-				if v, ok := m["recency_half_life"]; ok {
-					if s, ok := v.(string); ok {
-						if d, err := time.ParseDuration(s); err == nil {
-							r.RecencyHalfLife = d
-						}
-					}
-				}
-				if v, ok := m["provider_weights"]; ok {
-					if m2 := normalizeObject(v); m2 != nil {
-						r.ProviderWeights = toFloatMap(m2)
-					}
-				}
-				if v, ok := m["provider_capacities"]; ok {
-					if m2 := normalizeObject(v); m2 != nil {
-						r.ProviderCapacities = toIntMap(m2)
-					}
-				}
-				if v, ok := m["provider_costs"]; ok {
-					if m2 := normalizeObject(v); m2 != nil {
-						r.ProviderCostOverrides = toFloatMap(m2)
-					}
+			items = []any{v}
+		}
+		for _, item := range items {
+			if m := normalizeObject(item); m != nil {
+				route, err := parseProviderRoute(m)
+				if err != nil {
+					norm.invalid("routes", err)
+					continue
 				}
-				cfg.ProviderRoutes = append(cfg.ProviderRoutes, r)
+				cfg.ProviderRoutes = append(cfg.ProviderRoutes, route)
 			}
 		}
 	}
 	cfg.UseTLS = getBoolField(norm, "use_tls")
 	cfg.UseSSL = getBoolField(norm, "use_ssl")
 	cfg.SkipTLSVerify = getBoolField(norm, "skip_tls_verify")
+	cfg.PinnedSHA256 = getStringArrayField(norm, "pinned_sha256")
 	cfg.AdditionalData = norm.leftovers()
 	if cfg.AdditionalData == nil {
 		cfg.AdditionalData = map[string]any{}
 	}
+	cfg.ScheduleJitter = getDurationField(norm, "schedule_jitter")
+	cfg.CampaignID = getStringField(norm, "campaign_id")
+	cfg.WorkflowID = getStringField(norm, "workflow_id")
+	if val, ok := norm.pullValue("dedup_ttl"); ok && val != nil {
+		if byMode, ok := val.(map[string]any); ok {
+			cfg.DedupTTLByMode = map[string]time.Duration{}
+			for mode, ttl := range byMode {
+				cfg.DedupTTLByMode[strings.ToLower(strings.TrimSpace(mode))] = parseDurationValue(ttl)
+			}
+		} else {
+			cfg.DedupTTL = parseDurationValue(val)
+		}
+	}
 	cfg.ScheduleMode = strings.ToLower(getStringField(norm, "schedule_mode"))
 	if cfg.ScheduleMode == "" {
 		cfg.ScheduleMode = "repeat"
 	}
+	if err := reportUnknownKeys(cfg.UnknownKeys, norm); err != nil {
+		return nil, err
+	}
 	// Support nested wrapper keys often used by payloads such as "additional_data": {...} or "data": {...}
 	// Merge their contents up to the top-level AdditionalData map so placeholders like {{data.key}} and {{key}} work.
 	if inner, ok := cfg.AdditionalData["additional_data"]; ok {
@@ -615,17 +937,23 @@ func parseConfig(raw map[string]any) (*EmailConfig, error) {
 		}
 	}
 
-	if err := applyPlaceholders(cfg, placeholderModeInitial); err != nil {
+	if err := norm.err(); err != nil {
 		return nil, err
 	}
 
-	if err := finalizeConfig(cfg); err != nil {
+	cfg.RawAttachments = append([]Attachment(nil), cfg.Attachments...)
+	if err := applyPlaceholders(cfg, placeholderModeInitial); err != nil {
 		return nil, err
 	}
 
+	// Bodies from files (or stdin) must be in place before finalizeConfig
+	// resolves them, or they would lose to the empty-message default.
 	if err := loadTemplateBodies(cfg); err != nil {
 		return nil, err
 	}
+	if err := finalizeConfig(cfg); err != nil {
+		return nil, err
+	}
 	cfg.captureRawContent()
 
 	if err := applyPlaceholders(cfg, placeholderModePostFinalize); err != nil {
@@ -637,6 +965,135 @@ func parseConfig(raw map[string]any) (*EmailConfig, error) {
 	return cfg, nil
 }
 
+// parseUnknownKeysMode reads unknown_keys: "warn", "error", or a boolean where
+// true means "error".
+func parseUnknownKeysMode(val any) string {
+	if s, ok := val.(string); ok {
+		switch mode := strings.ToLower(strings.TrimSpace(s)); mode {
+		case "warn", "error":
+			return mode
+		case "ignore", "off", "":
+			return ""
+		}
+	}
+	if normalizeBool(val) {
+		return "error"
+	}
+	return ""
+}
+
+// reportUnknownKeys logs or rejects keys that look like misspelled fields,
+// depending on mode.
+func reportUnknownKeys(mode string, norm *normalizedConfig) error {
+	if mode == "" {
+		return nil
+	}
+	typos := norm.suspectedTypos()
+	if len(typos) == 0 {
+		return nil
+	}
+	parts := make([]string, len(typos))
+	for i, typo := range typos {
+		parts[i] = fmt.Sprintf("%q (did you mean %q?)", typo.key, typo.field)
+	}
+	if mode == "error" {
+		return fmt.Errorf("unknown config keys: %s", strings.Join(parts, ", "))
+	}
+	for _, part := range parts {
+		logger().Warn("config warning: unknown key", "key", part)
+	}
+	return nil
+}
+
+// parseProviderRoute builds a ProviderRoute from a decoded route object.
+func parseProviderRoute(m map[string]any) (ProviderRoute, error) {
+	r := ProviderRoute{}
+	// support both to_domain and to_domains
+	if td, ok := m["to_domain"]; ok {
+		r.ToDomains = normalizeStringSlice(td)
+	} else if td, ok := m["to_domains"]; ok {
+		r.ToDomains = normalizeStringSlice(td)
+	}
+	if fd, ok := m["from_domain"]; ok {
+		r.FromDomains = normalizeStringSlice(fd)
+	} else if fd, ok := m["from_domains"]; ok {
+		r.FromDomains = normalizeStringSlice(fd)
+	}
+	if s, ok := m["subject_regex"]; ok {
+		r.SubjectRegex = strings.TrimSpace(fmt.Sprint(s))
+	}
+	if p, ok := m["provider_priority"]; ok {
+		r.ProviderPriority = normalizeStringSlice(p)
+	}
+	if p, ok := m["provider"]; ok {
+		r.Provider = strings.ToLower(strings.TrimSpace(fmt.Sprint(p)))
+	}
+	if v, ok := m["hourly_limit"]; ok {
+		r.HourlyLimit = toInt(v)
+	}
+	if v, ok := m["daily_limit"]; ok {
+		r.DailyLimit = toInt(v)
+	}
+	if v, ok := m["weekly_limit"]; ok {
+		r.WeeklyLimit = toInt(v)
+	}
+	if v, ok := m["monthly_limit"]; ok {
+		r.MonthlyLimit = toInt(v)
+	}
+	if v, ok := m["selection_window"]; ok {
+		if s, ok := v.(string); ok {
+			if d, err := time.ParseDuration(s); err == nil {
+				r.SelectionWindow = d
+			}
+		}
+	}
+	if v, ok := m["recency_half_life"]; ok {
+		if s, ok := v.(string); ok {
+			if d, err := time.ParseDuration(s); err == nil {
+				r.RecencyHalfLife = d
+			}
+		}
+	}
+	if v, ok := m["selection"]; ok {
+		r.Selection = strings.ToLower(strings.TrimSpace(fmt.Sprint(v)))
+	}
+	if v, ok := m["provider_weights"]; ok {
+		if m2 := normalizeObject(v); m2 != nil {
+			r.ProviderWeights = toFloatMap(m2)
+		}
+	}
+	if v, ok := m["provider_capacities"]; ok {
+		if m2 := normalizeObject(v); m2 != nil {
+			r.ProviderCapacities = toIntMap(m2)
+		}
+	}
+	if v, ok := m["provider_costs"]; ok {
+		if m2 := normalizeObject(v); m2 != nil {
+			r.ProviderCostOverrides = toFloatMap(m2)
+		}
+	}
+	if v, ok := m["warmup"]; ok {
+		warmup, err := parseWarmupSchedules(v)
+		if err != nil {
+			return r, err
+		}
+		r.Warmup = warmup
+	}
+	if v, ok := m["provider_headers"]; ok {
+		if m2 := normalizeObject(v); m2 != nil {
+			r.ProviderHeaders = map[string]map[string]string{}
+			for prov, hv := range m2 {
+				headers := map[string]string{}
+				for k, hval := range normalizeObject(hv) {
+					headers[k] = fmt.Sprint(hval)
+				}
+				r.ProviderHeaders[strings.ToLower(strings.TrimSpace(prov))] = headers
+			}
+		}
+	}
+	return r, nil
+}
+
 func readJSONFile(path string) (map[string]any, error) {
 	data, err := os.ReadFile(path)
 	if err != nil {
@@ -683,13 +1140,28 @@ func asMap(value any) (map[string]any, bool) {
 }
 
 func finalizeConfig(cfg *EmailConfig) error {
+	if cfg.renderOnly {
+		if err := rejectSecretRefs(cfg); err != nil {
+			return err
+		}
+	} else if err := resolveSecrets(cfg); err != nil {
+		return err
+	}
 	cfg.Provider = strings.ToLower(cfg.Provider)
 	if cfg.Provider == "" {
-		cfg.Provider = inferProvider(cfg.From, cfg.Username)
+		cfg.Provider = inferProvider(cfg.InferProviderMX, cfg.From, cfg.Username)
 	}
 	if cfg.Tags == nil {
 		cfg.Tags = map[string]string{}
 	}
+	if _, err := dateLocation(cfg.DateTimezone); err != nil {
+		return fmt.Errorf("invalid date_timezone %q: %w", cfg.DateTimezone, err)
+	}
+	if cfg.SMIME != nil {
+		if err := cfg.SMIME.validate(); err != nil {
+			return err
+		}
+	}
 	if cfg.HTTPAuthPrefix == "" {
 		cfg.HTTPAuthPrefix = "Bearer"
 	}
@@ -717,7 +1189,49 @@ func finalizeConfig(cfg *EmailConfig) error {
 	if cfg.Transport == "http" && cfg.Endpoint != "" && !looksLikeURL(cfg.Endpoint) {
 		cfg.Endpoint = "https://" + strings.TrimLeft(cfg.Endpoint, ":/")
 	}
+	if cfg.SMIME != nil && !carriesRawMIME(cfg) {
+		return fmt.Errorf("smime requires smtp or a raw MIME payload; %s over http sends the body unprotected", cfg.ProviderOrHost())
+	}
 
+	if cfg.From == "" && len(cfg.FromPool) > 0 {
+		cfg.From = cfg.FromPool[0]
+	}
+	if err := validateFromRotation(cfg.FromRotation); err != nil {
+		return err
+	}
+	if err := validatePartialRetry(cfg.PartialRetry); err != nil {
+		return err
+	}
+	if err := validateEnvelopeFromTemplate(cfg); err != nil {
+		return err
+	}
+	if err := validateRecipientPolicy(cfg.RecipientPolicy); err != nil {
+		return err
+	}
+	if err := validatePins(cfg.PinnedSHA256); err != nil {
+		return err
+	}
+	if err := validateAlternativeOrder(cfg.AlternativeOrder); err != nil {
+		return err
+	}
+	if err := validateHeaderFields(cfg); err != nil {
+		return err
+	}
+	if err := validateAddressNormalization(cfg.AddressNormalization); err != nil {
+		return err
+	}
+	if err := validateRecipientPatterns("recipient_allowlist", cfg.RecipientAllowlist); err != nil {
+		return err
+	}
+	if err := validateRecipientPatterns("recipient_denylist", cfg.RecipientDenylist); err != nil {
+		return err
+	}
+	if err := validateDuplicateRecipients(cfg.DuplicateRecipients); err != nil {
+		return err
+	}
+	if cfg.OpenPixelURL != "" && cfg.OpenPixelSecret == "" {
+		return errors.New("open_pixel_url requires open_pixel_secret to sign recipient tokens")
+	}
 	if cfg.From == "" && cfg.Username != "" {
 		cfg.From = cfg.Username
 	}
@@ -729,6 +1243,9 @@ func finalizeConfig(cfg *EmailConfig) error {
 		return errors.New("sender address is required")
 	}
 	cfg.From = addr
+	if err := checkFromDomain(addr, cfg.AllowedFromDomains); err != nil {
+		return err
+	}
 	if cfg.EnvelopeFrom == "" {
 		cfg.EnvelopeFrom = addr
 	}
@@ -738,19 +1255,50 @@ func finalizeConfig(cfg *EmailConfig) error {
 	if cfg.Username == "" {
 		cfg.Username = addr
 	}
+	if cfg.ReplyToFrom && len(cfg.ReplyTo) == 0 {
+		cfg.ReplyTo = []string{addr}
+	}
 	if cfg.AWSRegion == "" {
 		cfg.AWSRegion = inferAWSRegion(cfg.Endpoint)
 	}
 
+	if cfg.Subject == "" && cfg.DeliveryReport != nil {
+		cfg.Subject = "Delivery Status Notification"
+	}
 	if cfg.Subject == "" {
 		cfg.Subject = "(no subject)"
 	}
 	resolveBodies(cfg)
 
-	if len(cfg.To) == 0 {
-		return errors.New("at least one recipient (to) is required")
+	for _, field := range []struct {
+		name string
+		list *[]string
+	}{{"to", &cfg.To}, {"cc", &cfg.CC}, {"bcc", &cfg.BCC}} {
+		if cfg.renderOnly && isRecipientSource(*field.list) {
+			return fmt.Errorf("%s: recipient sources are not loaded in a preview; list the addresses", field.name)
+		}
+		expanded, err := expandRecipientSource(*field.list)
+		if err != nil {
+			return fmt.Errorf("%s: %w", field.name, err)
+		}
+		*field.list = expanded
+	}
+	if !cfg.hasRecipients() {
+		return errors.New("at least one recipient (to, cc or bcc) is required")
+	}
+	// HTTP APIs deliver to the message's own recipients; there is no
+	// envelope to override.
+	if cfg.Transport == "http" && len(cfg.EnvelopeRecipients) > 0 {
+		return errors.New("envelope_recipients is only supported over smtp; http providers deliver to to, cc and bcc")
+	}
+	// max_recipients applies to the expanded lists, not the file or URL.
+	if _, err := gatherRecipients(cfg); err != nil {
+		return err
 	}
 
+	if err := checkPinsNeedTLS(cfg); err != nil {
+		return err
+	}
 	if cfg.Transport == "smtp" {
 		if cfg.Host == "" {
 			return errors.New("smtp host is required")
@@ -769,6 +1317,25 @@ func finalizeConfig(cfg *EmailConfig) error {
 			return errors.New("http endpoint is required when type=http")
 		}
 	}
+	if err := cfg.DSN.validate(); err != nil {
+		return err
+	}
+	switch cfg.SMTPBodyType {
+	case "", "auto", "7bit", "8bitmime":
+	default:
+		return fmt.Errorf("invalid smtp_body_type %q: use auto, 7bit or 8bitmime", cfg.SMTPBodyType)
+	}
+	if cfg.SourceIP != "" && net.ParseIP(cfg.SourceIP) == nil {
+		return fmt.Errorf("invalid source ip %q", cfg.SourceIP)
+	}
+	if _, _, err := resolveCharset(cfg.Charset); err != nil {
+		return err
+	}
+	switch cfg.BodyEncoding {
+	case "", "auto", "7bit", "8bit", "base64", "quoted-printable":
+	default:
+		return fmt.Errorf("invalid body encoding %q", cfg.BodyEncoding)
+	}
 
 	if cfg.Timeout == 0 {
 		cfg.Timeout = 30 * time.Second
@@ -779,6 +1346,9 @@ func finalizeConfig(cfg *EmailConfig) error {
 	if cfg.RetryDelay <= 0 {
 		cfg.RetryDelay = 2 * time.Second
 	}
+	if cfg.MaxRetryDelay <= 0 {
+		cfg.MaxRetryDelay = max(defaultMaxRetryDelay, cfg.RetryDelay)
+	}
 	applyHTTPScalingDefaults(cfg)
 
 	return nil
@@ -831,7 +1401,7 @@ func applyHTTPProfile(cfg *EmailConfig) {
 	if cfg.MaxIdleConnsHost == 0 && profile.Endpoint != "" {
 		cfg.MaxIdleConnsHost = 32
 	}
-	if cfg.Provider == "ses" || cfg.Provider == "aws_ses" || cfg.Provider == "amazon_ses" {
+	if cfg.Provider == "ses" || cfg.Provider == "aws_ses" || cfg.Provider == "amazon_ses" || cfg.Provider == "sesv1" || cfg.PayloadFormat == "sesv1" {
 		if cfg.HTTPAuth == "" {
 			cfg.HTTPAuth = "aws_sigv4"
 		}
@@ -843,6 +1413,9 @@ func applyHTTPProfile(cfg *EmailConfig) {
 		cfg.HTTPAuth = "api_key_header"
 		cfg.HTTPAuthHeader = "X-Postmark-Server-Token"
 	}
+	if cfg.Provider == "postmark" {
+		cfg.Endpoint = postmarkEndpoint(cfg, cfg.Endpoint)
+	}
 	if cfg.Provider == "resend" && cfg.HTTPAuth == "" {
 		cfg.HTTPAuth = "bearer"
 	}
@@ -886,7 +1459,7 @@ func applyProviderDefaults(cfg *EmailConfig) {
 	if cfg.Provider == "" {
 		return
 	}
-	if defaults, ok := providerDefaults[cfg.Provider]; ok {
+	if defaults, ok := lookupProviderDefaults(cfg.Provider); ok {
 		if cfg.Host == "" {
 			cfg.Host = defaults.Host
 		}
@@ -906,7 +1479,84 @@ func applyProviderDefaults(cfg *EmailConfig) {
 	}
 }
 
-func inferProvider(addresses ...string) string {
+// applyProviderSendDefaults fills the Reply-To, From name and success codes
+// from the provider's setting where the user left them unset. Like
+// applyProviderTimeout it only runs on the per-provider copy: filled in on
+// the prepared config, the primary's values would look user-set to every
+// fallback.
+func applyProviderSendDefaults(cfg *EmailConfig) {
+	defaults, ok := lookupProviderDefaults(cfg.Provider)
+	if !ok {
+		return
+	}
+	if len(cfg.ReplyTo) == 0 && !cfg.ReplyToFrom && defaults.DefaultReplyTo != "" {
+		cfg.ReplyTo = []string{defaults.DefaultReplyTo}
+	}
+	if cfg.FromName == "" && defaults.DefaultFromName != "" {
+		cfg.FromName = defaults.DefaultFromName
+	}
+	if len(cfg.SuccessCodes) == 0 && len(defaults.SuccessCodes) > 0 {
+		cfg.SuccessCodes = defaults.SuccessCodes
+	}
+}
+
+// applyProviderTimeout replaces cfg.Timeout with the provider's own timeout.
+// It only runs on the per-provider copy, so the prepared config keeps the
+// user's or global timeout for the other providers.
+func applyProviderTimeout(cfg *EmailConfig) {
+	if defaults, ok := lookupProviderDefaults(cfg.Provider); ok && defaults.Timeout > 0 {
+		cfg.Timeout = defaults.Timeout
+	}
+}
+
+// applyProviderHeaders merges headers configured for cfg.Provider, first from
+// matching routes and then from its ProviderSetting, into a copy of
+// cfg.Headers. Headers the user already set are never overridden.
+func applyProviderHeaders(cfg *EmailConfig) {
+	provider := strings.ToLower(strings.TrimSpace(cfg.Provider))
+	if provider == "" {
+		return
+	}
+	var sources []map[string]string
+	for i := range cfg.ProviderRoutes {
+		r := &cfg.ProviderRoutes[i]
+		if len(r.ProviderHeaders) == 0 || !routeMatches(cfg, r) {
+			continue
+		}
+		if h, ok := r.ProviderHeaders[provider]; ok {
+			sources = append(sources, h)
+		} else if h, ok := r.ProviderHeaders[canonicalProviderName(provider)]; ok {
+			sources = append(sources, h)
+		}
+	}
+	if defaults, ok := lookupProviderDefaults(provider); ok && len(defaults.Headers) > 0 {
+		sources = append(sources, defaults.Headers)
+	}
+	if len(sources) == 0 {
+		return
+	}
+	headers := make(map[string]string, len(cfg.Headers))
+	present := map[string]bool{}
+	for k, v := range cfg.Headers {
+		headers[k] = v
+		present[strings.ToLower(k)] = true
+	}
+	for _, src := range sources {
+		for k, v := range src {
+			if present[strings.ToLower(k)] {
+				continue
+			}
+			headers[k] = v
+			present[strings.ToLower(k)] = true
+		}
+	}
+	cfg.Headers = headers
+}
+
+// inferProvider picks a provider from the sender's domain: the static
+// emailDomainMap first, then, when useMX is set, the domain's mail hosts.
+func inferProvider(useMX bool, addresses ...string) string {
+	var domains []string
 	for _, addr := range addresses {
 		_, email := splitAddress(addr)
 		if email == "" {
@@ -920,6 +1570,14 @@ func inferProvider(addresses ...string) string {
 		if provider, ok := emailDomainMap[domain]; ok {
 			return provider
 		}
+		domains = append(domains, domain)
+	}
+	if useMX {
+		for _, domain := range domains {
+			if provider := inferProviderFromMX(domain); provider != "" {
+				return provider
+			}
+		}
 	}
 	return ""
 }
@@ -939,38 +1597,72 @@ func resolveBodies(cfg *EmailConfig) {
 			text = base
 		}
 	}
+	if text == "" && html == "" && cfg.DeliveryReport != nil {
+		text = cfg.DeliveryReport.summary()
+	}
 	if text == "" && html == "" {
 		text = "(empty message)"
 	}
 
 	cfg.TextBody = text
 	cfg.HTMLBody = html
+	truncateBodies(cfg)
+}
+
+// stdinSource as a body or template path reads it from standard input.
+const stdinSource = "stdin://"
+
+// stdin is read by stdinSource paths; tests replace it.
+var stdin io.Reader = os.Stdin
+
+// readTemplateSource reads a body or template path, or stdin for stdinSource.
+func readTemplateSource(path string) ([]byte, error) {
+	if path == stdinSource {
+		return io.ReadAll(stdin)
+	}
+	return os.ReadFile(path)
 }
 
 func loadTemplateBodies(cfg *EmailConfig) error {
+	fromStdin := 0
+	for _, path := range []string{cfg.HTMLTemplatePath, cfg.TextTemplatePath, cfg.BodyTemplatePath} {
+		if strings.TrimSpace(path) == stdinSource {
+			fromStdin++
+		}
+	}
+	if fromStdin > 1 {
+		return errors.New("only one of html_template, text_template and body_template can read stdin")
+	}
+	if cfg.renderOnly {
+		for _, path := range []string{cfg.HTMLTemplatePath, cfg.TextTemplatePath, cfg.BodyTemplatePath} {
+			if strings.TrimSpace(path) != "" {
+				return errors.New("template paths are not read in a preview; send the body inline")
+			}
+		}
+	}
 	if path := strings.TrimSpace(cfg.HTMLTemplatePath); path != "" {
-		content, err := os.ReadFile(path)
+		content, err := readTemplateSource(path)
 		if err != nil {
 			return fmt.Errorf("read html template %s: %w", path, err)
 		}
 		cfg.HTMLBody = string(content)
-		log.Printf("Loaded HTML template: %s", path)
+		logger().Info("loaded template", "kind", "html", "path", path)
 	}
 	if path := strings.TrimSpace(cfg.TextTemplatePath); path != "" {
-		content, err := os.ReadFile(path)
+		content, err := readTemplateSource(path)
 		if err != nil {
 			return fmt.Errorf("read text template %s: %w", path, err)
 		}
 		cfg.TextBody = string(content)
-		log.Printf("Loaded text template: %s", path)
+		logger().Info("loaded template", "kind", "text", "path", path)
 	}
 	if path := strings.TrimSpace(cfg.BodyTemplatePath); path != "" {
-		content, err := os.ReadFile(path)
+		content, err := readTemplateSource(path)
 		if err != nil {
 			return fmt.Errorf("read body template %s: %w", path, err)
 		}
 		cfg.Body = string(content)
-		log.Printf("Loaded message template: %s", path)
+		logger().Info("loaded template", "kind", "body", "path", path)
 	}
 	return nil
 }
@@ -982,6 +1674,10 @@ type SendContext struct {
 	PrevJobID          string
 	RequireLastSuccess bool
 	SkipAhead          bool
+	// Provider is the provider of the latest send attempt and Attempts the
+	// timing of every attempt, filled in as the send runs.
+	Provider string
+	Attempts []AttemptTiming
 }
 
 var errDeduplicated = errors.New("duplicate email skipped")
@@ -990,10 +1686,26 @@ func prepareSendConfig(cfg *EmailConfig) (*EmailConfig, error) {
 	cfgCopy := *cfg
 	cfgCopy.AdditionalData = cloneAdditionalData(cfg.AdditionalData)
 	cfgCopy.restoreRawContent()
-	if err := applyPlaceholders(&cfgCopy, placeholderModePostFinalize); err != nil {
+	applyFromRotation(&cfgCopy)
+	applyDuplicateRecipientPolicy(&cfgCopy)
+	if err := applyRecipientFilter(&cfgCopy); err != nil {
 		return nil, err
 	}
+	if err := applyPlaceholders(&cfgCopy, placeholderModeSend); err != nil {
+		return nil, err
+	}
+	// Previews never read attachment sources.
+	if !cfgCopy.renderOnly {
+		if err := zipAttachments(&cfgCopy); err != nil {
+			return nil, err
+		}
+	}
 	resolveBodies(&cfgCopy)
+	inlineCSSBody(&cfgCopy)
+	sanitizeHTMLBody(&cfgCopy)
+	rewriteLinks(&cfgCopy)
+	injectOpenPixel(&cfgCopy)
+	applyRecipientRedirect(&cfgCopy)
 	return &cfgCopy, nil
 }
 
@@ -1009,69 +1721,231 @@ func dedupKeyFromConfig(cfg *EmailConfig, ctx *SendContext) string {
 		step = strings.TrimSpace(s)
 	}
 	recipients := strings.ToLower(strings.Join(cfg.To, ","))
+	if len(cfg.AddressNormalization) > 0 {
+		keys := make([]string, 0, len(cfg.To))
+		for _, candidate := range cfg.To {
+			_, addr := splitAddress(candidate)
+			keys = append(keys, recipientKey(cfg, addr))
+		}
+		recipients = strings.Join(keys, ",")
+	}
 	subjectHash := sha256Hex([]byte(strings.ToLower(strings.TrimSpace(cfg.Subject))))
 	bodyHash := sha256Hex([]byte(strings.ToLower(strings.TrimSpace(cfg.Body + cfg.TextBody + cfg.HTMLBody))))
-	return fmt.Sprintf("%s|%s|%s|%s", recipients, strings.ToLower(step), subjectHash, bodyHash)
+	key := fmt.Sprintf("%s|%s|%s|%s", recipients, strings.ToLower(step), subjectHash, bodyHash)
+	if campaign := dedupCampaign(cfg); campaign != "" {
+		key = "campaign=" + strings.ToLower(campaign) + "|" + key
+	}
+	return key
+}
+
+// dedupCampaign returns the namespace that keeps campaigns from deduplicating
+// against each other: campaign_id, or a "campaign"/"campaign_id" tag.
+func dedupCampaign(cfg *EmailConfig) string {
+	if id := strings.TrimSpace(cfg.CampaignID); id != "" {
+		return id
+	}
+	for _, tag := range []string{"campaign_id", "campaign"} {
+		if id := strings.TrimSpace(cfg.Tags[tag]); id != "" {
+			return id
+		}
+	}
+	return ""
 }
 
 func sendEmail(cfg *EmailConfig, ctx *SendContext) error {
+	_, err := SendEmailWithResult(cfg, ctx)
+	return err
+}
+
+// SendEmailWithResult sends like sendEmail and also returns the per-recipient
+// outcome accumulated across retries and provider fallbacks.
+func SendEmailWithResult(cfg *EmailConfig, ctx *SendContext) (*SendResult, error) {
+	result := &SendResult{}
 	preparedCfg, err := prepareSendConfig(cfg)
 	if err != nil {
-		return err
+		return result, err
 	}
 	dedupKey := dedupKeyFromConfig(preparedCfg, ctx)
-	if dedupKey != "" && dedupKeyExists(dedupKey) {
+	dedupTTL := dedupTTLForConfig(preparedCfg)
+	if dedupKey != "" && dedupKeyExists(dedupKey, dedupTTL) {
 		if ctx != nil {
-			log.Printf("sendEmail: duplicate detected job=%s step=%s, skipping", ctx.JobID, ctx.Step)
+			logger().Info("send skipped: duplicate", "job_id", ctx.JobID, "step", ctx.Step)
 		} else {
-			log.Printf("sendEmail: duplicate detected, skipping immediate send")
+			logger().Info("send skipped: duplicate")
+		}
+		return result, errDeduplicated
+	}
+	if warnings := LintMessage(preparedCfg); len(warnings) > 0 {
+		if preparedCfg.LintStrict {
+			return result, lintError(warnings)
+		}
+		for _, w := range warnings {
+			logger().Warn("lint warning", "warning", w.String())
 		}
-		return errDeduplicated
 	}
 	// Resolve providers using routing rules and fallbacks.
 	providers := resolveProviders(preparedCfg)
 	if preparedCfg.DryRun {
-		log.Printf("dry-run: would send to %v; providers=%v; subject=%q", preparedCfg.To, providers, preparedCfg.Subject)
-		return nil
+		logger().Info("dry-run: send skipped", "to", preparedCfg.To, "providers", providers, "subject", preparedCfg.Subject)
+		return result, nil
 	}
 
-	var lastErr error
+	budget := newSendBudget(preparedCfg, time.Now())
+	// failures collects each provider's last error, reported together once
+	// the send gives up.
+	var failures []ProviderFailure
+	giveUp := func(prov string, provErr error, budgetSpent bool) error {
+		if provErr != nil {
+			failures = append(failures, ProviderFailure{Provider: prov, Err: provErr})
+		}
+		notifyAllProvidersFailed(preparedCfg, failures)
+		err := providerFailuresError(failures)
+		if budgetSpent {
+			return budget.err(err)
+		}
+		return err
+	}
+	// owed is set once a partial delivery committed some recipients.
+	var owed *PartialDeliveryError
 	for _, prov := range providers {
 		// Try each provider in order; create a shallow copy to avoid mutating original cfg.
-		cfgCopy := *preparedCfg
-		cfgCopy.Provider = prov
-		applyProviderDefaults(&cfgCopy)
-		applyHTTPProfile(&cfgCopy)
-		if err := finalizeConfig(&cfgCopy); err != nil {
-			lastErr = err
-			log.Printf("skipping provider %s due to config error: %v", prov, err)
+		cfgCopy, err := configForProvider(preparedCfg, prov)
+		if err != nil {
+			failures = append(failures, ProviderFailure{Provider: prov, Err: err})
+			logger().Warn("skipping provider: config error", "provider", prov, "error", err)
 			continue
 		}
+		var provErr error
+		if owed != nil {
+			restrictToRemaining(&cfgCopy, owed)
+		}
 
 		for attempt := 1; attempt <= cfgCopy.RetryCount; attempt++ {
+			if budget.exhausted(time.Now(), 0) {
+				return result, giveUp(prov, provErr, true)
+			}
+			budget.attempts++
+			timing := startAttemptTiming(&cfgCopy, attempt)
+			cfgCopy.timing = timing
 			var err error
 			if cfgCopy.Transport == "http" {
-				err = sendViaHTTP(&cfgCopy)
+				var attemptResult *SendResult
+				attemptResult, err = sendViaHTTPResult(&cfgCopy)
+				result.merge(attemptResult)
 			} else {
-				err = sendViaSMTP(&cfgCopy)
+				var attemptResult *SendResult
+				attemptResult, err = sendViaSMTPResult(&cfgCopy)
+				result.merge(attemptResult)
 			}
+			timing.End = time.Now()
+			ctx.recordTiming(timing)
 			recordSendAttempt(ctx, &cfgCopy, attempt, err)
+			cfgCopy.timing = nil
+			attrs := sendAttemptAttrs(ctx, &cfgCopy, attempt)
 			if err == nil {
+				logger().Info("send attempt succeeded", attrs...)
 				if dedupKey != "" {
-					markDedupKey(dedupKey)
+					markDedupKey(dedupKey, dedupTTL)
 				}
-				return nil
+				return result, nil
+			}
+			provErr = err
+			logger().Warn("send attempt failed", append(attrs, "error", err)...)
+			var partial *PartialDeliveryError
+			if errors.As(err, &partial) {
+				if cfgCopy.PartialRetry == partialRetryFail || len(partial.Remaining) == 0 {
+					return result, err
+				}
+				owed = partial
+				restrictToRemaining(&cfgCopy, owed)
 			}
-			lastErr = err
 			if attempt < cfgCopy.RetryCount {
 				delay := jitterBackoff(attempt, cfgCopy.RetryDelay, cfgCopy.MaxRetryDelay)
-				log.Printf("provider=%s attempt %d/%d failed: %v (retrying in %s)", prov, attempt, cfgCopy.RetryCount, err, delay)
+				if budget.exhausted(time.Now(), delay) {
+					return result, giveUp(prov, provErr, true)
+				}
+				logger().Info("retrying send", "provider", prov, "attempt", attempt+1, "delay", delay)
 				time.Sleep(delay)
 			}
 		}
-		log.Printf("provider %s exhausted, trying next provider if any", prov)
+		logger().Info("provider exhausted", "provider", prov)
+		if provErr != nil {
+			failures = append(failures, ProviderFailure{Provider: prov, Err: provErr})
+		}
+	}
+	return result, giveUp("", nil, false)
+}
+
+// configForProvider returns a copy of a prepared config set up to send
+// through provider: its defaults, headers and HTTP profile applied and
+// finalized.
+func configForProvider(prepared *EmailConfig, provider string) (EmailConfig, error) {
+	cfgCopy := *prepared
+	cfgCopy.Provider = provider
+	applyProviderDefaults(&cfgCopy)
+	applyProviderHeaders(&cfgCopy)
+	applyHTTPProfile(&cfgCopy)
+	if err := finalizeConfig(&cfgCopy); err != nil {
+		return cfgCopy, err
+	}
+	applyProviderTimeout(&cfgCopy)
+	applyProviderSendDefaults(&cfgCopy)
+	if registered, ok := GetProvider(provider); ok {
+		if err := registered.ValidateConfig(&cfgCopy); err != nil {
+			return cfgCopy, &PermanentError{Err: err}
+		}
+	}
+	if err := preflightSender(&cfgCopy, provider); err != nil {
+		return cfgCopy, err
+	}
+	return cfgCopy, nil
+}
+
+// sendAttemptAttrs are the structured log fields describing one send attempt.
+func sendAttemptAttrs(ctx *SendContext, cfg *EmailConfig, attempt int) []any {
+	attrs := []any{
+		"provider", cfg.ProviderOrHost(),
+		"transport", cfg.Transport,
+		"attempt", attempt,
+		"max_attempts", cfg.RetryCount,
+		"recipients", len(cfg.To) + len(cfg.CC) + len(cfg.BCC),
+	}
+	if ctx != nil && ctx.JobID != "" {
+		attrs = append(attrs, "job_id", ctx.JobID)
+	}
+	return attrs
+}
+
+// sendBudget tracks the attempts made and the deadline across all providers
+// of one send.
+type sendBudget struct {
+	attempts    int
+	maxAttempts int
+	deadline    time.Time
+}
+
+func newSendBudget(cfg *EmailConfig, start time.Time) *sendBudget {
+	b := &sendBudget{maxAttempts: cfg.MaxTotalAttempts}
+	if cfg.SendDeadline > 0 {
+		b.deadline = start.Add(cfg.SendDeadline)
+	}
+	return b
+}
+
+// exhausted reports whether another attempt, made after waiting wait, would
+// exceed the attempt cap or start past the deadline.
+func (b *sendBudget) exhausted(now time.Time, wait time.Duration) bool {
+	if b.maxAttempts > 0 && b.attempts >= b.maxAttempts {
+		return true
+	}
+	return !b.deadline.IsZero() && !now.Add(wait).Before(b.deadline)
+}
+
+func (b *sendBudget) err(lastErr error) error {
+	if lastErr == nil {
+		return fmt.Errorf("send budget exhausted after %d attempts", b.attempts)
 	}
-	return lastErr
+	return fmt.Errorf("send budget exhausted after %d attempts: %w", b.attempts, lastErr)
 }
 
 // resolveProviders returns the ordered list of providers to try for a given config.
@@ -1080,32 +1954,49 @@ func sendEmail(cfg *EmailConfig, ctx *SendContext) error {
 // 2) first matching route in cfg.ProviderRoutes
 // 3) fallback to cfg.Provider
 func resolveProviders(cfg *EmailConfig) []string {
+	return routeProviders(cfg, nil)
+}
+
+// routeProviders implements resolveProviders, recording each decision in trace
+// when it is non-nil.
+func routeProviders(cfg *EmailConfig, trace *RoutingExplanation) []string {
+	if len(cfg.pinnedProviders) > 0 {
+		trace.candidates("pinned", cfg.pinnedProviders)
+		return trace.order(append([]string(nil), cfg.pinnedProviders...))
+	}
 	// explicit priority wins, but if multiple providers are listed, allow reordering by usage
 	if len(cfg.ProviderPriority) > 0 {
+		list := append([]string{}, cfg.ProviderPriority...)
+		trace.candidates("provider_priority", list)
 		// If there is a matching route that provides selection metadata, prefer route-based ordered selection
-		if r := findFirstMatchingRoute(cfg); r != nil && (len(r.ProviderWeights) > 0 || len(r.ProviderCapacities) > 0 || len(r.ProviderCostOverrides) > 0 || r.SelectionWindow > 0 || r.RecencyHalfLife > 0) {
-			list := append([]string{}, cfg.ProviderPriority...)
+		if r := findFirstMatchingRoute(cfg); r != nil && (len(r.ProviderWeights) > 0 || len(r.ProviderCapacities) > 0 || len(r.ProviderCostOverrides) > 0 || r.SelectionWindow > 0 || r.RecencyHalfLife > 0 || r.Selection != "") {
+			trace.route(cfg, r)
+			list = filterWarmup(r, list)
 			if len(list) > 1 {
-				ordered := sortProvidersByUsage(list, r.ToDomains, r.SelectionWindow, r.ProviderWeights, r.RecencyHalfLife, r.ProviderCapacities, r.ProviderCostOverrides)
-				return normalizeProviderList(ordered, cfg.Provider)
+				trace.score(r, list)
+				ordered := orderRouteProviders(r, list)
+				return trace.order(normalizeProviderList(ordered, cfg.Provider))
 			}
-			return normalizeProviderList(list, cfg.Provider)
+			return trace.order(normalizeProviderList(list, cfg.Provider))
 		}
-		list := append([]string{}, cfg.ProviderPriority...)
 		if len(list) > 1 {
+			trace.score(nil, list)
 			ordered := sortProvidersByUsage(list, nil, 0, nil, 0, nil, nil)
-			return normalizeProviderList(ordered, cfg.Provider)
+			return trace.order(normalizeProviderList(ordered, cfg.Provider))
 		}
-		return normalizeProviderList(list, cfg.Provider)
+		return trace.order(normalizeProviderList(list, cfg.Provider))
 	}
 	// evaluate routes in order
-	for _, r := range cfg.ProviderRoutes {
+	for i := range cfg.ProviderRoutes {
+		r := cfg.ProviderRoutes[i]
 		if routeMatches(cfg, &r) {
 			// check limits; skip route if exhausted
-			if !routeWithinLimits(&r) {
-				log.Printf("route skipped due to limits: %+v", r)
+			if reason := routeLimitReason(&r); reason != "" {
+				logger().Info("route skipped: limit reached", "route", i, "reason", reason)
+				trace.skip(i, reason)
 				continue
 			}
+			trace.route(cfg, &cfg.ProviderRoutes[i])
 			// build list from route.ProviderPriority or route.Provider
 			var list []string
 			if len(r.ProviderPriority) > 0 {
@@ -1113,16 +2004,20 @@ func resolveProviders(cfg *EmailConfig) []string {
 			} else if r.Provider != "" {
 				list = append(list, r.Provider)
 			}
+			list = filterWarmup(&r, list)
+			trace.candidates("route", list)
 			// If multiple providers, reorder to prefer least-used providers first (24h window)
 			if len(list) > 1 {
-				ordered := sortProvidersByUsage(list, r.ToDomains, r.SelectionWindow, r.ProviderWeights, r.RecencyHalfLife, r.ProviderCapacities, r.ProviderCostOverrides)
-				return normalizeProviderList(ordered, cfg.Provider)
+				trace.score(&r, list)
+				ordered := orderRouteProviders(&r, list)
+				return trace.order(normalizeProviderList(ordered, cfg.Provider))
 			}
-			return normalizeProviderList(list, cfg.Provider)
+			return trace.order(normalizeProviderList(list, cfg.Provider))
 		}
 	}
 	// default fall back
-	return normalizeProviderList(nil, cfg.Provider)
+	trace.candidates("default", nil)
+	return trace.order(normalizeProviderList(nil, cfg.Provider))
 }
 
 func routeMatches(cfg *EmailConfig, r *ProviderRoute) bool {
@@ -1175,41 +2070,50 @@ func findFirstMatchingRoute(cfg *EmailConfig) *ProviderRoute {
 // routeWithinLimits checks whether a route still has capacity according to configured limits.
 // Uses recent successful send counts (filtered by recipient domains when present).
 func routeWithinLimits(r *ProviderRoute) bool {
+	return routeLimitReason(r) == ""
+}
+
+// routeLimitReason describes the first exhausted limit of r, or returns "" when
+// the route is within all of them.
+func routeLimitReason(r *ProviderRoute) string {
 	// build provider list for counting; empty means match any provider
 	providers := r.ProviderPriority
 	if len(providers) == 0 && r.Provider != "" {
 		providers = []string{r.Provider}
 	}
 	now := time.Now().UTC()
-	if r.HourlyLimit > 0 {
-		since := now.Add(-1 * time.Hour)
-		cnt, err := countSuccessesSince(providers, since, r.ToDomains)
-		if err == nil && cnt >= r.HourlyLimit {
-			return false
+	limits := []struct {
+		name   string
+		limit  int
+		window time.Duration
+	}{
+		{"hourly", r.HourlyLimit, time.Hour},
+		{"daily", r.DailyLimit, 24 * time.Hour},
+		{"weekly", r.WeeklyLimit, 7 * 24 * time.Hour},
+		{"monthly", r.MonthlyLimit, 30 * 24 * time.Hour},
+	}
+	for _, l := range limits {
+		if l.limit <= 0 {
+			continue
 		}
-	}
-	if r.DailyLimit > 0 {
-		since := now.Add(-24 * time.Hour)
-		cnt, err := countSuccessesSince(providers, since, r.ToDomains)
-		if err == nil && cnt >= r.DailyLimit {
-			return false
+		cnt, err := countSuccessesSince(providers, now.Add(-l.window), r.ToDomains)
+		if err == nil && cnt >= l.limit {
+			return fmt.Sprintf("%s limit %d reached (%d sent)", l.name, l.limit, cnt)
 		}
 	}
-	if r.WeeklyLimit > 0 {
-		since := now.Add(-7 * 24 * time.Hour)
-		cnt, err := countSuccessesSince(providers, since, r.ToDomains)
-		if err == nil && cnt >= r.WeeklyLimit {
-			return false
+	// a route whose every provider is capped by its warmup is exhausted too
+	if len(r.Warmup) > 0 && len(providers) > 0 {
+		var capped []string
+		for _, p := range providers {
+			if reason := warmupLimitReason(r, p); reason != "" {
+				capped = append(capped, reason)
+			}
 		}
-	}
-	if r.MonthlyLimit > 0 {
-		since := now.Add(-30 * 24 * time.Hour)
-		cnt, err := countSuccessesSince(providers, since, r.ToDomains)
-		if err == nil && cnt >= r.MonthlyLimit {
-			return false
+		if len(capped) == len(providers) {
+			return strings.Join(capped, "; ")
 		}
 	}
-	return true
+	return ""
 }
 
 func extractDomain(addr string) string {
@@ -1220,12 +2124,13 @@ func extractDomain(addr string) string {
 	return ""
 }
 
-// normalizeProviderList normalizes provider names, removes duplicates and appends fallback provider if needed.
+// normalizeProviderList normalizes provider names, resolves aliases to their canonical
+// provider, removes duplicates and appends fallback provider if needed.
 func normalizeProviderList(list []string, fallback string) []string {
 	out := make([]string, 0)
 	seen := map[string]bool{}
 	for _, p := range list {
-		s := strings.ToLower(strings.TrimSpace(p))
+		s := canonicalProviderName(p)
 		if s == "" || seen[s] {
 			continue
 		}
@@ -1233,7 +2138,7 @@ func normalizeProviderList(list []string, fallback string) []string {
 		seen[s] = true
 	}
 	if fallback != "" {
-		s := strings.ToLower(strings.TrimSpace(fallback))
+		s := canonicalProviderName(fallback)
 		if s != "" && !seen[s] {
 			out = append(out, s)
 			seen[s] = true
@@ -1242,17 +2147,85 @@ func normalizeProviderList(list []string, fallback string) []string {
 	// If still empty, return the fallback as possibly empty string (preserve previous behavior)
 	if len(out) == 0 {
 		if fallback != "" {
-			return []string{strings.ToLower(strings.TrimSpace(fallback))}
+			return []string{canonicalProviderName(fallback)}
 		}
 		return []string{fallback}
 	}
 	return out
 }
 
+// ProviderScore is one provider's usage score as computed by
+// sortProvidersByUsage; lower Score is preferred.
+type ProviderScore struct {
+	Provider      string  `json:"provider"`
+	WeightedCount float64 `json:"weighted_count"`
+	Weight        float64 `json:"weight"`
+	Cost          float64 `json:"cost"`
+	Capacity      int     `json:"capacity"`
+	Score         float64 `json:"score"`
+}
+
 // sortProvidersByUsage sorts providers by ascending score computed from usage counts in a lookback window.
 // Lower score is preferred. Score = count_in_window * weight (weight defaults to 1.0).
 // toDomains filters recipient domains for counting. If window == 0, defaults to 24h.
 func sortProvidersByUsage(providers []string, toDomains []string, window time.Duration, weights map[string]float64, recencyHalfLife time.Duration, overrideCapacities map[string]int, overrideCosts map[string]float64) []string {
+	scored := usageScores(providers, toDomains, window, weights, recencyHalfLife, overrideCapacities, overrideCosts)
+	scores := make([]float64, len(scored))
+	for i, ps := range scored {
+		scores[i] = ps.Score
+	}
+	type pair struct {
+		idx   int
+		score float64
+	}
+	pairs := make([]pair, 0, len(providers))
+	for i := range providers {
+		pairs = append(pairs, pair{i, scores[i]})
+	}
+	// stable sort: prefer lower score, tie-break by cost (lower), then capacity (higher), then original index
+	sort.Slice(pairs, func(i, j int) bool {
+		if math.Abs(pairs[i].score-pairs[j].score) < 1e-12 {
+			pi := pairs[i].idx
+			pj := pairs[j].idx
+			piName := strings.ToLower(strings.TrimSpace(providers[pi]))
+			pjName := strings.ToLower(strings.TrimSpace(providers[pj]))
+			// get cost and cap
+			ci := 1.0
+			cj := 1.0
+			capI := 0
+			capJ := 0
+			if ds, ok := lookupProviderDefaults(piName); ok {
+				if ds.Cost > 0 {
+					ci = ds.Cost
+				}
+				capI = ds.Capacity
+				// route overrides handled earlier when computing scores; consider overrides here too
+			}
+			if ds, ok := lookupProviderDefaults(pjName); ok {
+				if ds.Cost > 0 {
+					cj = ds.Cost
+				}
+				capJ = ds.Capacity
+			}
+			if math.Abs(ci-cj) > 1e-9 {
+				return ci < cj
+			}
+			if capI != capJ {
+				return capI > capJ // prefer larger capacity
+			}
+			return pairs[i].idx < pairs[j].idx
+		}
+		return pairs[i].score < pairs[j].score
+	})
+	out := make([]string, 0, len(providers))
+	for _, p := range pairs {
+		out = append(out, providers[p.idx])
+	}
+	return out
+}
+
+// usageScores computes the per-provider scores sortProvidersByUsage orders by.
+func usageScores(providers []string, toDomains []string, window time.Duration, weights map[string]float64, recencyHalfLife time.Duration, overrideCapacities map[string]int, overrideCosts map[string]float64) []ProviderScore {
 	if window <= 0 {
 		window = 24 * time.Hour
 	}
@@ -1268,12 +2241,12 @@ func sortProvidersByUsage(providers []string, toDomains []string, window time.Du
 	since := now.Add(-window)
 	// get weighted scores per provider
 	scoresMap, _ := weightedUsageSince(providers, since, toDomains, half)
-	scores := make([]float64, len(providers))
+	out := make([]ProviderScore, len(providers))
 	for i, p := range providers {
-		s := scoresMap[strings.ToLower(strings.TrimSpace(p))]
+		s := scoresMap[canonicalProviderName(p)]
 		w := 1.0
 		if weights != nil {
-			if v, ok := weights[strings.ToLower(strings.TrimSpace(p))]; ok && v > 0 {
+			if v, ok := providerMapValue(weights, p); ok && v > 0 {
 				w = v
 			}
 		}
@@ -1282,17 +2255,17 @@ func sortProvidersByUsage(providers []string, toDomains []string, window time.Du
 		cap := 0
 		// route-level overrides take precedence
 		if overrideCosts != nil {
-			if v, ok := overrideCosts[strings.ToLower(strings.TrimSpace(p))]; ok && v > 0 {
+			if v, ok := providerMapValue(overrideCosts, p); ok && v > 0 {
 				cost = v
 			}
 		}
 		if overrideCapacities != nil {
-			if v, ok := overrideCapacities[strings.ToLower(strings.TrimSpace(p))]; ok && v > 0 {
+			if v, ok := providerMapValue(overrideCapacities, p); ok && v > 0 {
 				cap = v
 			}
 		}
 		// fall back to provider defaults
-		if ds, ok := providerDefaults[strings.ToLower(strings.TrimSpace(p))]; ok {
+		if ds, ok := lookupProviderDefaults(p); ok {
 			if ds.Cost > 0 && cost == 1.0 {
 				cost = ds.Cost
 			}
@@ -1307,66 +2280,82 @@ func sortProvidersByUsage(providers []string, toDomains []string, window time.Du
 		// final score: lower is better. Adjusted score = (weightedCount * weight * cost) / cap
 		// add small epsilon based on cost to prefer lower cost when counts are equal
 		epsilon := 1e-6 * cost
-		scores[i] = (s*w*cost)/capFloat + epsilon
-		log.Printf("scoring provider=%s weightedCount=%.6f weight=%.3f cost=%.3f cap=%d score=%f", p, s, w, cost, cap, scores[i])
-	}
-	type pair struct {
-		idx   int
-		score float64
+		out[i] = ProviderScore{Provider: p, WeightedCount: s, Weight: w, Cost: cost, Capacity: cap, Score: (s*w*cost)/capFloat + epsilon}
+		logger().Debug("scoring provider", "provider", p, "weighted_count", s, "weight", w, "cost", cost, "capacity", cap, "score", out[i].Score)
 	}
-	pairs := make([]pair, 0, len(providers))
-	for i := range providers {
-		pairs = append(pairs, pair{i, scores[i]})
+	return out
+}
+
+// orderRouteProviders orders a route's candidate providers using the route's
+// selection strategy.
+func orderRouteProviders(r *ProviderRoute, list []string) []string {
+	switch r.Selection {
+	case "cost_reliability":
+		return sortProvidersByCostReliability(list)
+	default:
+		return sortProvidersByUsage(list, r.ToDomains, r.SelectionWindow, r.ProviderWeights, r.RecencyHalfLife, r.ProviderCapacities, r.ProviderCostOverrides)
 	}
-	// stable sort: prefer lower score, tie-break by cost (lower), then capacity (higher), then original index
-	sort.Slice(pairs, func(i, j int) bool {
-		if math.Abs(pairs[i].score-pairs[j].score) < 1e-12 {
-			pi := pairs[i].idx
-			pj := pairs[j].idx
-			piName := strings.ToLower(strings.TrimSpace(providers[pi]))
-			pjName := strings.ToLower(strings.TrimSpace(providers[pj]))
-			// get cost and cap
-			ci := 1.0
-			cj := 1.0
-			capI := 0
-			capJ := 0
-			if ds, ok := providerDefaults[piName]; ok {
-				if ds.Cost > 0 {
-					ci = ds.Cost
-				}
-				capI = ds.Capacity
-				// route overrides handled earlier when computing scores; consider overrides here too
-			}
-			if ds, ok := providerDefaults[pjName]; ok {
-				if ds.Cost > 0 {
-					cj = ds.Cost
-				}
-				capJ = ds.Capacity
-			}
-			if math.Abs(ci-cj) > 1e-9 {
-				return ci < cj
-			}
-			if capI != capJ {
-				return capI > capJ // prefer larger capacity
-			}
-			return pairs[i].idx < pairs[j].idx
+}
+
+// sortProvidersByCostReliability orders providers by Cost/Reliability from the
+// provider registry metadata (lower is better), the same score CostBasedSelector
+// uses. Providers without metadata keep their relative order after the ranked ones.
+func sortProvidersByCostReliability(providers []string) []string {
+	out := append([]string(nil), providers...)
+	score := func(name string) float64 {
+		meta, ok := ProviderInfo(name)
+		if !ok {
+			return math.Inf(1)
 		}
-		return pairs[i].score < pairs[j].score
-	})
-	out := make([]string, 0, len(providers))
-	for _, p := range pairs {
-		out = append(out, providers[p.idx])
+		return costReliabilityScore(meta)
 	}
+	sort.SliceStable(out, func(i, j int) bool {
+		return score(out[i]) < score(out[j])
+	})
 	return out
 }
 
+// providerMapValue looks up a per-provider route setting, matching entries keyed
+// by any alias of the same provider.
+func providerMapValue[V any](m map[string]V, name string) (V, bool) {
+	key := canonicalProviderName(name)
+	if v, ok := m[key]; ok {
+		return v, true
+	}
+	for k, v := range m {
+		if canonicalProviderName(k) == key {
+			return v, true
+		}
+	}
+	var zero V
+	return zero, false
+}
+
+// maxBackoffShift bounds the exponential factor so large attempt numbers
+// cannot overflow the shift or the resulting duration.
+const maxBackoffShift = 30
+
+// defaultMaxRetryDelay caps backoff when max_retry_delay is not configured.
+const defaultMaxRetryDelay = 30 * time.Second
+
 // jitterBackoff uses full jitter strategy: random[0, min(maxDelay, base*2^(attempt-1))].
+// When the exponential overflows, the bound saturates one below MaxInt64 so
+// the random range stays valid.
 func jitterBackoff(attempt int, base time.Duration, maxDelay time.Duration) time.Duration {
 	if base <= 0 {
 		base = 2 * time.Second
 	}
-	factor := 1 << (attempt - 1)
-	upper := time.Duration(factor) * base
+	shift := attempt - 1
+	if shift < 0 {
+		shift = 0
+	}
+	if shift > maxBackoffShift {
+		shift = maxBackoffShift
+	}
+	upper := time.Duration(math.MaxInt64 - 1)
+	if base <= upper>>shift {
+		upper = base << shift
+	}
 	if maxDelay > 0 && upper > maxDelay {
 		upper = maxDelay
 	}
@@ -1378,73 +2367,253 @@ func jitterBackoff(attempt int, base time.Duration, maxDelay time.Duration) time
 }
 
 func sendViaSMTP(cfg *EmailConfig) error {
-	msg, err := buildMessage(cfg)
+	_, err := sendViaSMTPResult(cfg)
+	return err
+}
+
+// sendViaSMTPResult sends the message and reports the outcome per recipient.
+// Under the best_effort policy rejected recipients do not abort the send;
+// permanently rejected ones are only reported, temporarily rejected ones are
+// returned as a PartialDeliveryError so they can be retried.
+func sendViaSMTPResult(cfg *EmailConfig) (*SendResult, error) {
+	result := &SendResult{Provider: cfg.ProviderOrHost()}
+	msg, err := composeMessage(cfg)
 	if err != nil {
-		return err
+		return result, err
+	}
+	if err := checkMessageSize(cfg, len(msg)); err != nil {
+		return result, err
 	}
 	recipients, err := gatherRecipients(cfg)
 	if err != nil {
-		return err
+		return result, err
 	}
 	if len(recipients) == 0 {
-		return errors.New("no valid recipients found")
+		return result, errors.New("no valid recipients found")
 	}
 
-	addr := fmt.Sprintf("%s:%d", cfg.Host, cfg.Port)
-	var client *smtp.Client
-	if cfg.UseSSL {
-		client, err = dialTLSClient(cfg, addr)
-	} else {
-		client, err = dialPlainClient(cfg, addr)
+	pc, err := acquireSMTPConn(cfg)
+	if err != nil {
+		return result, &ConnectionError{Err: err}
 	}
+	client := pc.client
+	reusable := false
+	defer func() { releaseSMTPConn(cfg, pc, reusable) }()
+
+	mailParams, err := smtpSizeParams(client, len(msg))
 	if err != nil {
-		return err
+		return result, &PermanentError{Err: err}
 	}
-	defer client.Quit()
+	mailParams = append(smtpBodyParams(client, cfg.SMTPBodyType, msg), mailParams...)
 
-	if cfg.UseTLS && !cfg.UseSSL {
-		tlsConfig := &tls.Config{ServerName: cfg.Host, InsecureSkipVerify: cfg.SkipTLSVerify}
-		if err := client.StartTLS(tlsConfig); err != nil {
-			return err
+	if !pc.authed {
+		if err := authenticateSMTP(client, cfg); err != nil {
+			var protoErr *textproto.Error
+			if errors.As(err, &protoErr) {
+				return result, &AuthError{Err: err}
+			}
+			return result, classifySMTPError(err)
 		}
+		pc.authed = true
 	}
 
-	if cfg.Username != "" && cfg.Password != "" {
-		auth, err := buildSMTPAuth(cfg)
-		if err != nil {
-			return err
-		}
-		if auth != nil {
-			if err := client.Auth(auth); err != nil {
-				return err
-			}
+	var rcptParams []string
+	if cfg.DSN.enabled() {
+		if ok, _ := client.Extension("DSN"); ok {
+			mailParams = append(mailParams, cfg.DSN.mailParams()...)
+			rcptParams = append(rcptParams, cfg.DSN.rcptParams()...)
+		} else {
+			logger().Warn("smtp: DSN not advertised, sending without delivery notifications", "host", cfg.Host)
 		}
 	}
 
-	if err := client.Mail(cfg.EnvelopeFrom); err != nil {
-		return err
+	if cfg.EnvelopeFromTemplate != "" {
+		reusable, err = sendSMTPPerRecipient(client, cfg, msg, recipients, mailParams, rcptParams, result)
+		return result, err
+	}
+	// All-or-nothing must be able to abort before DATA, so it never pipelines.
+	pipelining, _ := client.Extension("PIPELINING")
+	pipelining = pipelining && cfg.RecipientPolicy != recipientPolicyAllOrNothing
+	reusable, err = smtpTransaction(client, cfg, cfg.EnvelopeFrom, recipients, msg, mailParams, rcptParams, pipelining, result)
+	return result, err
+}
+
+// smtpTransaction runs one MAIL/RCPT/DATA transaction for recipients and
+// records each recipient's outcome in result. It reports whether the
+// connection is left clean enough to reuse.
+func smtpTransaction(client *smtp.Client, cfg *EmailConfig, from string, recipients []string, msg string, mailParams, rcptParams []string, pipelining bool, result *SendResult) (bool, error) {
+	var rcptErrs map[string]error
+	var w io.WriteCloser
+	var dataErr error
+	if pipelining {
+		rcptErrs, w, dataErr = smtpPipelined(client, from, mailParams, recipients, rcptParams)
+		if rcptErrs == nil {
+			return false, classifySMTPError(dataErr)
+		}
+	} else {
+		if err := smtpMail(client, from, mailParams); err != nil {
+			return false, classifySMTPError(err)
+		}
+		rcptErrs = map[string]error{}
+		for _, recipient := range recipients {
+			if err := smtpRcpt(client, recipient, rcptParams); err != nil {
+				if cfg.RecipientPolicy == recipientPolicyAllOrNothing {
+					rejectErr := &RecipientError{Address: recipient, Err: classifySMTPError(err)}
+					client.Reset()
+					result.Recipients = []RecipientResult{{Address: recipient, Err: rejectErr}}
+					return false, rejectErr
+				}
+				rcptErrs[recipient] = err
+			}
+		}
 	}
+	var accepted, retryable []string
+	var rcptErr error
 	for _, recipient := range recipients {
-		if err := client.Rcpt(recipient); err != nil {
-			return err
+		if err, rejected := rcptErrs[recipient]; rejected {
+			rejectErr := &RecipientError{Address: recipient, Err: classifySMTPError(err)}
+			result.set(recipient, rejectErr)
+			if !errors.Is(rejectErr, ErrPermanent) {
+				retryable = append(retryable, recipient)
+			}
+			rcptErr = errors.Join(rcptErr, rejectErr)
+			continue
 		}
+		accepted = append(accepted, recipient)
+	}
+	if len(accepted) == 0 {
+		return false, rcptErr
 	}
 
-	w, err := client.Data()
-	if err != nil {
-		return err
+	if !pipelining {
+		w, dataErr = client.Data()
+	}
+	if dataErr != nil {
+		return false, classifySMTPError(dataErr)
+	}
+	// From here on the accepted recipients may have received the message.
+	partial := func(err error) error {
+		for _, recipient := range accepted {
+			result.set(recipient, err)
+		}
+		return &PartialDeliveryError{Committed: accepted, Remaining: retryable, Err: err}
 	}
 	if _, err := w.Write([]byte(msg)); err != nil {
-		return err
+		return false, partial(classifySMTPError(err))
 	}
 	if err := w.Close(); err != nil {
-		return err
+		return false, partial(classifySMTPError(err))
 	}
-
-	return nil
+	for _, recipient := range accepted {
+		result.set(recipient, nil)
+	}
+	if len(retryable) > 0 {
+		return true, &PartialDeliveryError{Committed: accepted, Remaining: retryable, Err: rcptErr}
+	}
+	return true, nil
 }
 
+// sendViaHTTP sends the message like sendViaHTTPResult, without the
+// per-recipient outcome.
 func sendViaHTTP(cfg *EmailConfig) error {
+	_, err := sendViaHTTPResult(cfg)
+	return err
+}
+
+// sendViaHTTPResult sends the message, splitting the recipients into several
+// requests when they exceed MaxRecipientsPerMessage. Providers with a native
+// batch endpoint get the chunks in as few requests as their batch size
+// allows. When some batches fail after others were accepted, it returns a
+// PartialDeliveryError whose Remaining lists only the failed batches'
+// recipients, by field, so a retry does not send to the accepted ones again.
+func sendViaHTTPResult(cfg *EmailConfig) (*SendResult, error) {
+	result := &SendResult{Provider: cfg.ProviderOrHost()}
+	var committed, remaining []string
+	var fields RecipientLists
+	record := func(batch *EmailConfig, err error) {
+		for _, field := range []struct {
+			list []string
+			owed *[]string
+		}{{batch.To, &fields.To}, {batch.CC, &fields.CC}, {batch.BCC, &fields.BCC}} {
+			for _, addr := range field.list {
+				result.set(addr, err)
+				if err == nil {
+					committed = append(committed, addr)
+				} else {
+					remaining = append(remaining, addr)
+					*field.owed = append(*field.owed, addr)
+				}
+			}
+		}
+	}
+	batches := splitRecipientBatches(cfg)
+	if len(batches) == 1 {
+		err := sendHTTPRequest(batches[0])
+		record(batches[0], err)
+		return result, err
+	}
+	var errs []error
+	sent := false
+	if bp, ok := batchProviderFor(cfg); ok {
+		requests, err := buildBatchRequests(bp, batches)
+		if err == nil {
+			for i, req := range requests {
+				err := sendHTTPRequest(req.cfg)
+				for _, msg := range req.messages {
+					record(msg, err)
+				}
+				if err != nil && len(requests) == 1 {
+					errs = append(errs, err)
+				} else if err != nil {
+					errs = append(errs, fmt.Errorf("batch %d/%d (%d messages): %w", i+1, len(requests), len(req.messages), err))
+				}
+			}
+			sent = true
+		} else {
+			logger().Debug("native batch unavailable, sending separately", "provider", cfg.Provider, "error", err)
+		}
+	}
+	if !sent {
+		for i, batch := range batches {
+			err := sendHTTPRequest(batch)
+			record(batch, err)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("batch %d/%d (%d recipients): %w", i+1, len(batches), len(batch.To), err))
+			}
+		}
+	}
+	err := errors.Join(errs...)
+	if err != nil && len(committed) > 0 {
+		return result, &PartialDeliveryError{Committed: committed, Remaining: remaining, RemainingFields: &fields, Err: err}
+	}
+	return result, err
+}
+
+// splitRecipientBatches splits the recipients into batches of at most
+// MaxRecipientsPerMessage. Cc and Bcc go on the first batch only, so they
+// receive a single copy, and count against its limit; the first batch still
+// carries at least one To recipient.
+func splitRecipientBatches(cfg *EmailConfig) []*EmailConfig {
+	limit := cfg.MaxRecipientsPerMessage
+	extra := len(cfg.CC) + len(cfg.BCC)
+	if limit <= 0 || len(cfg.To) == 0 || len(cfg.To)+extra <= limit {
+		return []*EmailConfig{cfg}
+	}
+	first := max(limit-extra, 1)
+	batches := []*EmailConfig{}
+	for start, end := 0, first; start < len(cfg.To); start, end = end, end+limit {
+		batch := *cfg
+		batch.To = cfg.To[start:min(end, len(cfg.To))]
+		if start > 0 {
+			batch.CC = nil
+			batch.BCC = nil
+		}
+		batches = append(batches, &batch)
+	}
+	return batches
+}
+
+func sendHTTPRequest(cfg *EmailConfig) error {
 	endpoint := cfg.Endpoint
 	if endpoint == "" {
 		return errors.New("http endpoint is required")
@@ -1468,6 +2637,9 @@ func sendViaHTTP(cfg *EmailConfig) error {
 	if err != nil {
 		return err
 	}
+	if err := checkMessageSize(cfg, len(bodyBytes)); err != nil {
+		return err
+	}
 
 	req, err := http.NewRequest(cfg.HTTPMethod, endpoint, bytes.NewReader(bodyBytes))
 	if err != nil {
@@ -1476,6 +2648,9 @@ func sendViaHTTP(cfg *EmailConfig) error {
 	if len(cfg.Headers) == 0 {
 		cfg.Headers = map[string]string{}
 	}
+	if ua := defaultableHeader(cfg.UserAgent); ua != "" {
+		req.Header.Set("User-Agent", ua)
+	}
 	contentTypeSet := false
 	if finalType != "" {
 		req.Header.Set("Content-Type", finalType)
@@ -1492,30 +2667,57 @@ func sendViaHTTP(cfg *EmailConfig) error {
 	}
 	applyAuthHeaders(req, cfg, bodyBytes)
 
+	if cfg.timing != nil {
+		req = traceRequest(req, cfg.timing)
+	}
 	client := getHTTPClient(cfg)
 
 	resp, err := client.Do(req)
 	if err != nil {
-		return err
+		return &ConnectionError{Err: err}
 	}
 	defer resp.Body.Close()
-	if resp.StatusCode >= 300 {
+	if !httpStatusSucceeded(cfg, resp.StatusCode) {
 		respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
 		reqID := resp.Header.Get("x-amzn-requestid")
 		if reqID == "" {
 			reqID = resp.Header.Get("x-request-id")
 		}
+		detail := "body=" + strings.TrimSpace(string(respBody))
+		if msg := httpErrorMessage(cfg, respBody); msg != "" {
+			detail = "message=" + msg
+		}
 		if reqID != "" {
-			return fmt.Errorf("http send failed: %s request_id=%s body=%s", resp.Status, reqID, strings.TrimSpace(string(respBody)))
+			return classifyHTTPStatus(resp, fmt.Errorf("http send failed: %s request_id=%s %s", resp.Status, reqID, detail))
+		}
+		return classifyHTTPStatus(resp, fmt.Errorf("http send failed: %s %s", resp.Status, detail))
+	}
+	if defaults, ok := lookupProviderDefaults(cfg.Provider); ok && defaults.ResponseCheck != nil {
+		respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		if err := defaults.ResponseCheck(resp.StatusCode, respBody); err != nil {
+			return fmt.Errorf("http send failed: %s reported an error: %w", resp.Status, err)
 		}
-		return fmt.Errorf("http send failed: %s body=%s", resp.Status, strings.TrimSpace(string(respBody)))
 	}
 	if id := resp.Header.Get("x-amzn-requestid"); id != "" {
-		log.Printf("http send ok (request_id=%s)", id)
+		logger().Debug("http send ok", "request_id", id)
 	}
 	return nil
 }
 
+// httpStatusSucceeded reports whether status means delivery for cfg: one of
+// SuccessCodes when set, otherwise any status below 300.
+func httpStatusSucceeded(cfg *EmailConfig, status int) bool {
+	if len(cfg.SuccessCodes) == 0 {
+		return status < 300
+	}
+	for _, code := range cfg.SuccessCodes {
+		if status == code {
+			return true
+		}
+	}
+	return false
+}
+
 func getHTTPClient(cfg *EmailConfig) *http.Client {
 	key := httpClientKey(cfg)
 	httpClientMu.Lock()
@@ -1525,7 +2727,7 @@ func getHTTPClient(cfg *EmailConfig) *http.Client {
 	}
 	transport := &http.Transport{
 		ForceAttemptHTTP2:   true,
-		TLSClientConfig:     &tls.Config{InsecureSkipVerify: cfg.SkipTLSVerify},
+		TLSClientConfig:     clientTLSConfig(cfg, ""),
 		IdleConnTimeout:     90 * time.Second,
 		MaxIdleConns:        choosePositive(cfg.MaxIdleConns, 200),
 		MaxIdleConnsPerHost: choosePositive(cfg.MaxIdleConnsHost, 32),
@@ -1545,7 +2747,7 @@ func httpClientKey(cfg *EmailConfig) string {
 			host = parsed.Host
 		}
 	}
-	return fmt.Sprintf("host-%s-tls-%t-maxc-%d-idle-%d-idlehost-%d-noka-%t-timeout-%d", host, cfg.SkipTLSVerify, cfg.MaxConnsPerHost, cfg.MaxIdleConns, cfg.MaxIdleConnsHost, cfg.DisableKeepAlives, cfg.Timeout)
+	return fmt.Sprintf("host-%s-tls-%t-pins-%s-maxc-%d-idle-%d-idlehost-%d-noka-%t-timeout-%d", host, cfg.SkipTLSVerify, strings.Join(cfg.PinnedSHA256, ","), cfg.MaxConnsPerHost, cfg.MaxIdleConns, cfg.MaxIdleConnsHost, cfg.DisableKeepAlives, cfg.Timeout)
 }
 
 func choosePositive(value, fallback int) int {
@@ -1573,6 +2775,10 @@ func (cfg *EmailConfig) resolveHTTPPayload() (any, string, error) {
 	return payload, pickContentType(cfg.HTTPContentType, ""), err
 }
 
+// encodePayload serializes payload and returns the Content-Type to send.
+// Form and JSON bodies always report their real encoding: a configured type
+// that contradicts it (e.g. a JSON type on a Mailgun form body) is replaced
+// with a warning, since the provider would otherwise misparse the request.
 func encodePayload(payload any, contentType string) ([]byte, string, error) {
 	switch v := payload.(type) {
 	case nil:
@@ -1588,22 +2794,36 @@ func encodePayload(payload any, contentType string) ([]byte, string, error) {
 		}
 		return []byte(v), contentType, nil
 	case url.Values:
-		if contentType == "" {
-			contentType = "application/x-www-form-urlencoded"
-		}
+		contentType = reconcileContentType(contentType, "application/x-www-form-urlencoded", func(mediaType string) bool {
+			return mediaType == "application/x-www-form-urlencoded"
+		})
 		return []byte(v.Encode()), contentType, nil
 	default:
 		data, err := json.Marshal(v)
 		if err != nil {
 			return nil, "", err
 		}
-		if contentType == "" {
-			contentType = "application/json"
-		}
+		contentType = reconcileContentType(contentType, "application/json", func(mediaType string) bool {
+			return mediaType == "application/json" || strings.HasSuffix(mediaType, "+json")
+		})
 		return data, contentType, nil
 	}
 }
 
+// reconcileContentType returns hint when its media type is one the body
+// encoding accepts (keeping parameters such as charset) and want otherwise.
+func reconcileContentType(hint, want string, accepts func(mediaType string) bool) string {
+	if strings.TrimSpace(hint) == "" {
+		return want
+	}
+	mediaType, _, err := mime.ParseMediaType(hint)
+	if err == nil && accepts(mediaType) {
+		return hint
+	}
+	logger().Warn("http: content type does not match the body", "content_type", hint, "sending", want)
+	return want
+}
+
 func pickContentType(primary, fallback string) string {
 	if strings.TrimSpace(primary) != "" {
 		return primary
@@ -1776,6 +2996,16 @@ func parseAddressList(values []string) []simpleAddress {
 	return result
 }
 
+// addressEmails returns the bare addresses in values, without display names.
+func addressEmails(values []string) []string {
+	list := parseAddressList(values)
+	emails := make([]string, len(list))
+	for i, addr := range list {
+		emails[i] = addr.Email
+	}
+	return emails
+}
+
 func firstAddressEntry(values []string) simpleAddress {
 	list := parseAddressList(values)
 	if len(list) == 0 {
@@ -1825,17 +3055,42 @@ func getIntField(norm *normalizedConfig, canonical string) int {
 	if !ok || val == nil {
 		return 0
 	}
+	i, err := parseIntValue(val)
+	if err != nil {
+		norm.invalid(canonical, err)
+	}
+	return i
+}
+
+// parseIntValue reads a whole number given as a JSON number or a string such
+// as "587". Empty strings are zero.
+func parseIntValue(val any) (int, error) {
 	switch v := val.(type) {
-	case float64:
-		return int(v)
 	case int:
-		return v
+		return v, nil
+	case int64:
+		return int(v), nil
+	case float64:
+		if v != math.Trunc(v) {
+			return 0, fmt.Errorf("%v is not a whole number", v)
+		}
+		return int(v), nil
+	case json.Number:
+		return parseIntValue(v.String())
 	case string:
-		if i, err := strconv.Atoi(strings.TrimSpace(v)); err == nil {
-			return i
+		trimmed := strings.TrimSpace(v)
+		if trimmed == "" {
+			return 0, nil
+		}
+		if i, err := strconv.Atoi(trimmed); err == nil {
+			return i, nil
+		}
+		if f, err := strconv.ParseFloat(trimmed, 64); err == nil {
+			return parseIntValue(f)
 		}
+		return 0, fmt.Errorf("%q is not a number", v)
 	}
-	return 0
+	return 0, fmt.Errorf("%v is not a number", val)
 }
 
 func getBoolField(norm *normalizedConfig, canonical string) bool {
@@ -1866,20 +3121,46 @@ func getDurationField(norm *normalizedConfig, canonical string) time.Duration {
 	if !ok || val == nil {
 		return 0
 	}
+	d, err := parseDuration(val)
+	if err != nil {
+		norm.invalid(canonical, err)
+	}
+	return d
+}
+
+// parseDurationValue reads a number of seconds or a duration string, treating
+// anything unparseable as zero.
+func parseDurationValue(val any) time.Duration {
+	d, _ := parseDuration(val)
+	return d
+}
+
+// parseDuration reads a duration given as seconds (30, 1.5, "30") or as a
+// Go duration string ("30s", "2m"). Empty strings are zero.
+func parseDuration(val any) (time.Duration, error) {
 	switch v := val.(type) {
-	case float64:
-		return time.Duration(v) * time.Second
 	case int:
-		return time.Duration(v) * time.Second
+		return time.Duration(v) * time.Second, nil
+	case int64:
+		return time.Duration(v) * time.Second, nil
+	case float64:
+		return time.Duration(v * float64(time.Second)), nil
+	case json.Number:
+		return parseDuration(v.String())
 	case string:
-		if d, err := time.ParseDuration(strings.TrimSpace(v)); err == nil {
-			return d
+		trimmed := strings.TrimSpace(v)
+		if trimmed == "" {
+			return 0, nil
 		}
-		if i, err := strconv.Atoi(strings.TrimSpace(v)); err == nil {
-			return time.Duration(i) * time.Second
+		if d, err := time.ParseDuration(trimmed); err == nil {
+			return d, nil
 		}
+		if f, err := strconv.ParseFloat(trimmed, 64); err == nil {
+			return parseDuration(f)
+		}
+		return 0, fmt.Errorf("%q is not a duration (use seconds or a value like \"30s\")", v)
 	}
-	return 0
+	return 0, fmt.Errorf("%v is not a duration", val)
 }
 
 func getStringMapField(norm *normalizedConfig, canonical string) map[string]string {
@@ -1952,6 +3233,12 @@ func mergeAdditional(base map[string]any, extras map[string]any, overwrite bool)
 	return base
 }
 
+// hasRecipients reports whether the message has anyone to go to. Cc- or
+// Bcc-only messages are valid; their To header shows undisclosed recipients.
+func (cfg *EmailConfig) hasRecipients() bool {
+	return len(cfg.To) > 0 || len(cfg.CC) > 0 || len(cfg.BCC) > 0 || len(cfg.EnvelopeRecipients) > 0
+}
+
 func (cfg *EmailConfig) captureRawContent() {
 	cfg.RawSubject = cfg.Subject
 	cfg.RawBody = cfg.Body
@@ -1988,6 +3275,9 @@ func (cfg *EmailConfig) restoreRawContent() {
 			cfg.HTTPPayload = nil
 		}
 	}
+	if cfg.RawAttachments != nil {
+		cfg.Attachments = append([]Attachment(nil), cfg.RawAttachments...)
+	}
 }
 
 func cloneAdditionalData(src map[string]any) map[string]any {
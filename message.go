@@ -1,31 +1,47 @@
 package main
 
 import (
+	"encoding/base64"
+	"errors"
 	"fmt"
+	"mime/quotedprintable"
 	"net/mail"
+	"os"
 	"sort"
 	"strings"
 	"time"
+	"unicode/utf8"
 )
 
 func buildMessage(cfg *EmailConfig) (string, error) {
+	cfg = headerSafeConfig(cfg)
 	var msg strings.Builder
 	fromAddr := mail.Address{Name: cfg.FromName, Address: cfg.From}
 	msg.WriteString(fmt.Sprintf("From: %s\r\n", fromAddr.String()))
-	msg.WriteString(fmt.Sprintf("To: %s\r\n", strings.Join(cfg.To, ", ")))
+	if sender := senderAddress(cfg); sender != "" {
+		msg.WriteString(fmt.Sprintf("Sender: %s\r\n", sender))
+	}
+	msg.WriteString(fmt.Sprintf("To: %s\r\n", headerTo(cfg)))
 	if len(cfg.CC) > 0 {
 		msg.WriteString(fmt.Sprintf("Cc: %s\r\n", strings.Join(cfg.CC, ", ")))
 	}
 	if len(cfg.ReplyTo) > 0 {
 		msg.WriteString(fmt.Sprintf("Reply-To: %s\r\n", strings.Join(cfg.ReplyTo, ", ")))
 	}
-	msg.WriteString(fmt.Sprintf("Subject: %s\r\n", cfg.Subject))
-	msg.WriteString(fmt.Sprintf("Date: %s\r\n", time.Now().Format(time.RFC1123Z)))
+	subject, err := encodeSubject(cfg)
+	if err != nil {
+		return "", err
+	}
+	msg.WriteString(fmt.Sprintf("Subject: %s\r\n", subject))
+	msg.WriteString(fmt.Sprintf("Date: %s\r\n", messageDate(cfg).Format(time.RFC1123Z)))
 	msg.WriteString(fmt.Sprintf("Message-ID: <%s@%s>\r\n", randomBoundary("msg"), cfg.Host))
 	msg.WriteString("MIME-Version: 1.0\r\n")
 	if cfg.ReturnPath != "" {
 		msg.WriteString(fmt.Sprintf("Return-Path: %s\r\n", cfg.EnvelopeFrom))
 	}
+	if mailer := defaultableHeader(cfg.XMailer); mailer != "" && !hasHeader(cfg.Headers, "X-Mailer") {
+		msg.WriteString(fmt.Sprintf("X-Mailer: %s\r\n", mailer))
+	}
 	for k, v := range cfg.Headers {
 		if strings.EqualFold(k, "Content-Type") {
 			continue
@@ -51,9 +67,18 @@ func buildMessage(cfg *EmailConfig) (string, error) {
 	}
 
 	inline, regular := partitionAttachments(cfg.Attachments)
+	if cfg.DeliveryReport != nil {
+		if len(regular) > 0 {
+			return "", errors.New("delivery_report messages cannot carry attachments")
+		}
+		if err := writeDeliveryReport(&msg, cfg, inline); err != nil {
+			return "", err
+		}
+		return msg.String(), nil
+	}
 	if len(regular) > 0 {
 		mixedBoundary := randomBoundary("mixed")
-		msg.WriteString(fmt.Sprintf("Content-Type: multipart/mixed; boundary=%s\r\n\r\n", mixedBoundary))
+		writeMultipartHeader(&msg, cfg, "mixed", mixedBoundary, true)
 		if err := writeBodySection(&msg, cfg, inline, mixedBoundary); err != nil {
 			return "", err
 		}
@@ -76,41 +101,89 @@ func writeBodySection(msg *strings.Builder, cfg *EmailConfig, inline []Attachmen
 	if boundary != "" {
 		msg.WriteString(fmt.Sprintf("--%s\r\n", boundary))
 	}
-	return writeAlternativeBody(msg, cfg, inline)
+	return writeAlternativeBody(msg, cfg, inline, boundary == "")
+}
+
+// Values for EmailConfig.AlternativeOrder.
+const (
+	alternativeOrderTextFirst = "text_first"
+	alternativeOrderHTMLFirst = "html_first"
+)
+
+// defaultMIMEPreamble is the preamble written when mime_preamble is true.
+const defaultMIMEPreamble = "This is a multi-part message in MIME format."
+
+func validateAlternativeOrder(order string) error {
+	switch order {
+	case "", alternativeOrderTextFirst, alternativeOrderHTMLFirst:
+		return nil
+	default:
+		return fmt.Errorf("invalid alternative_order %q (expected text_first or html_first)", order)
+	}
+}
+
+// writeMultipartHeader starts a multipart entity. The outermost one (top)
+// carries cfg.MIMEPreamble, which MIME-aware clients ignore.
+func writeMultipartHeader(msg *strings.Builder, cfg *EmailConfig, subtype, boundary string, top bool) {
+	msg.WriteString(fmt.Sprintf("Content-Type: multipart/%s; boundary=%s\r\n\r\n", subtype, boundary))
+	if top && cfg.MIMEPreamble != "" {
+		msg.WriteString(cfg.MIMEPreamble + "\r\n")
+	}
+}
+
+// writeAlternatives writes the text and HTML alternatives in cfg's order.
+func writeAlternatives(msg *strings.Builder, cfg *EmailConfig, boundary string, text, html func() error) error {
+	parts := []func() error{text, html}
+	if cfg.AlternativeOrder == alternativeOrderHTMLFirst {
+		parts[0], parts[1] = html, text
+	}
+	for _, part := range parts {
+		msg.WriteString(fmt.Sprintf("--%s\r\n", boundary))
+		if err := part(); err != nil {
+			return err
+		}
+	}
+	msg.WriteString(fmt.Sprintf("--%s--\r\n", boundary))
+	return nil
 }
 
-func writeAlternativeBody(msg *strings.Builder, cfg *EmailConfig, inline []Attachment) error {
+func writeAlternativeBody(msg *strings.Builder, cfg *EmailConfig, inline []Attachment, top bool) error {
 	hasInline := len(inline) > 0 && cfg.HTMLBody != ""
+	writeText := func() error {
+		if err := writeTextPart(msg, cfg, "text/plain", cfg.TextBody); err != nil {
+			return err
+		}
+		msg.WriteString("\r\n\r\n")
+		return nil
+	}
 	if hasInline && cfg.TextBody != "" {
 		altBoundary := randomBoundary("alt")
 		relatedBoundary := randomBoundary("rel")
-		msg.WriteString(fmt.Sprintf("Content-Type: multipart/alternative; boundary=%s\r\n\r\n", altBoundary))
-		msg.WriteString(fmt.Sprintf("--%s\r\n", altBoundary))
-		msg.WriteString("Content-Type: text/plain; charset=UTF-8\r\n\r\n")
-		msg.WriteString(cfg.TextBody)
-		msg.WriteString("\r\n\r\n")
-		msg.WriteString(fmt.Sprintf("--%s\r\n", altBoundary))
-		msg.WriteString(fmt.Sprintf("Content-Type: multipart/related; boundary=%s\r\n\r\n", relatedBoundary))
-		msg.WriteString(fmt.Sprintf("--%s\r\n", relatedBoundary))
-		msg.WriteString("Content-Type: text/html; charset=UTF-8\r\n\r\n")
-		msg.WriteString(cfg.HTMLBody)
-		msg.WriteString("\r\n\r\n")
-		for _, att := range inline {
-			if err := writeAttachmentPart(msg, att, relatedBoundary, true); err != nil {
+		writeMultipartHeader(msg, cfg, "alternative", altBoundary, top)
+		return writeAlternatives(msg, cfg, altBoundary, writeText, func() error {
+			writeMultipartHeader(msg, cfg, "related", relatedBoundary, false)
+			msg.WriteString(fmt.Sprintf("--%s\r\n", relatedBoundary))
+			if err := writeTextPart(msg, cfg, "text/html", cfg.HTMLBody); err != nil {
 				return err
 			}
-		}
-		msg.WriteString(fmt.Sprintf("--%s--\r\n", relatedBoundary))
-		msg.WriteString(fmt.Sprintf("--%s--\r\n", altBoundary))
-		return nil
+			msg.WriteString("\r\n\r\n")
+			for _, att := range inline {
+				if err := writeAttachmentPart(msg, att, relatedBoundary, true); err != nil {
+					return err
+				}
+			}
+			msg.WriteString(fmt.Sprintf("--%s--\r\n", relatedBoundary))
+			return nil
+		})
 	}
 
 	if hasInline {
 		relatedBoundary := randomBoundary("rel")
-		msg.WriteString(fmt.Sprintf("Content-Type: multipart/related; boundary=%s\r\n\r\n", relatedBoundary))
+		writeMultipartHeader(msg, cfg, "related", relatedBoundary, top)
 		msg.WriteString(fmt.Sprintf("--%s\r\n", relatedBoundary))
-		msg.WriteString("Content-Type: text/html; charset=UTF-8\r\n\r\n")
-		msg.WriteString(cfg.HTMLBody)
+		if err := writeTextPart(msg, cfg, "text/html", cfg.HTMLBody); err != nil {
+			return err
+		}
 		msg.WriteString("\r\n\r\n")
 		for _, att := range inline {
 			if err := writeAttachmentPart(msg, att, relatedBoundary, true); err != nil {
@@ -123,17 +196,14 @@ func writeAlternativeBody(msg *strings.Builder, cfg *EmailConfig, inline []Attac
 
 	if cfg.HTMLBody != "" && cfg.TextBody != "" {
 		altBoundary := randomBoundary("alt")
-		msg.WriteString(fmt.Sprintf("Content-Type: multipart/alternative; boundary=%s\r\n\r\n", altBoundary))
-		msg.WriteString(fmt.Sprintf("--%s\r\n", altBoundary))
-		msg.WriteString("Content-Type: text/plain; charset=UTF-8\r\n\r\n")
-		msg.WriteString(cfg.TextBody)
-		msg.WriteString("\r\n\r\n")
-		msg.WriteString(fmt.Sprintf("--%s\r\n", altBoundary))
-		msg.WriteString("Content-Type: text/html; charset=UTF-8\r\n\r\n")
-		msg.WriteString(cfg.HTMLBody)
-		msg.WriteString("\r\n\r\n")
-		msg.WriteString(fmt.Sprintf("--%s--\r\n", altBoundary))
-		return nil
+		writeMultipartHeader(msg, cfg, "alternative", altBoundary, top)
+		return writeAlternatives(msg, cfg, altBoundary, writeText, func() error {
+			if err := writeTextPart(msg, cfg, "text/html", cfg.HTMLBody); err != nil {
+				return err
+			}
+			msg.WriteString("\r\n\r\n")
+			return nil
+		})
 	}
 
 	contentType := "text/plain"
@@ -142,16 +212,367 @@ func writeAlternativeBody(msg *strings.Builder, cfg *EmailConfig, inline []Attac
 		contentType = "text/html"
 		body = cfg.HTMLBody
 	}
-	msg.WriteString(fmt.Sprintf("Content-Type: %s; charset=UTF-8\r\n\r\n", contentType))
-	msg.WriteString(body)
+	if err := writeTextPart(msg, cfg, contentType, body); err != nil {
+		return err
+	}
 	msg.WriteString("\r\n")
 	return nil
 }
 
+// writeTextPart writes a text body part's headers and content using the
+// configured Charset and BodyEncoding. Without an encoding the body is written as-is.
+func writeTextPart(msg *strings.Builder, cfg *EmailConfig, contentType, body string) error {
+	charset, body, err := encodeCharset(cfg, body)
+	if err != nil {
+		return err
+	}
+	msg.WriteString(fmt.Sprintf("Content-Type: %s; charset=%s\r\n", contentType, charset))
+	encoding := cfg.BodyEncoding
+	if encoding == "auto" {
+		encoding = autoBodyEncoding(body)
+	}
+	switch encoding {
+	case "":
+		msg.WriteString("\r\n")
+		msg.WriteString(body)
+	case "7bit", "8bit":
+		if encoding == "7bit" && !is7bit(body) {
+			return errors.New("body contains 8-bit data and cannot be sent as 7bit")
+		}
+		msg.WriteString(fmt.Sprintf("Content-Transfer-Encoding: %s\r\n\r\n", encoding))
+		msg.WriteString(body)
+	case "base64":
+		msg.WriteString("Content-Transfer-Encoding: base64\r\n\r\n")
+		encoded := base64.StdEncoding.EncodeToString([]byte(body))
+		for i := 0; i < len(encoded); i += 76 {
+			end := i + 76
+			if end > len(encoded) {
+				end = len(encoded)
+			}
+			msg.WriteString(encoded[i:end])
+			msg.WriteString("\r\n")
+		}
+	case "quoted-printable":
+		msg.WriteString("Content-Transfer-Encoding: quoted-printable\r\n\r\n")
+		w := quotedprintable.NewWriter(msg)
+		if _, err := w.Write([]byte(body)); err != nil {
+			return err
+		}
+		if err := w.Close(); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("invalid body encoding %q", cfg.BodyEncoding)
+	}
+	return nil
+}
+
+// autoBodyEncoding picks 7bit for short-lined ASCII bodies and
+// quoted-printable otherwise.
+func autoBodyEncoding(body string) string {
+	if is7bit(body) {
+		return "7bit"
+	}
+	return "quoted-printable"
+}
+
+// is7bit reports whether body is ASCII without NULs and with lines no longer
+// than the 998 characters allowed by RFC 5322.
+func is7bit(body string) bool {
+	lineLen := 0
+	for i := 0; i < len(body); i++ {
+		c := body[i]
+		if c == 0 || c > 127 {
+			return false
+		}
+		if c == '\n' {
+			lineLen = 0
+			continue
+		}
+		if lineLen++; lineLen > 998 {
+			return false
+		}
+	}
+	return true
+}
+
+// senderAddress returns the RFC 5322 Sender for messages whose authenticated
+// identity (the SMTP username, when it is an address) differs from From.
+// An explicit Sender header in cfg.Headers wins.
+func senderAddress(cfg *EmailConfig) string {
+	if cfg.DisableSenderHeader {
+		return ""
+	}
+	for k := range cfg.Headers {
+		if strings.EqualFold(k, "Sender") {
+			return ""
+		}
+	}
+	identity, err := mail.ParseAddress(cfg.Username)
+	if err != nil {
+		return ""
+	}
+	if _, from := splitAddress(cfg.From); strings.EqualFold(identity.Address, from) {
+		return ""
+	}
+	return identity.Address
+}
+
+// headerTo returns the visible To header value. HeaderTo overrides the To list,
+// and a message without To (Cc/Bcc or envelope recipients only) is shown as undisclosed.
+func headerTo(cfg *EmailConfig) string {
+	if cfg.HeaderTo != "" {
+		return cfg.HeaderTo
+	}
+	if len(cfg.To) == 0 {
+		return "undisclosed-recipients:;"
+	}
+	return strings.Join(cfg.To, ", ")
+}
+
+const (
+	duplicateRecipientsKeep          = "keep"
+	duplicateRecipientsPreferVisible = "prefer_visible"
+)
+
+func validateDuplicateRecipients(policy string) error {
+	switch policy {
+	case "", duplicateRecipientsKeep, duplicateRecipientsPreferVisible:
+		return nil
+	default:
+		return fmt.Errorf("invalid duplicate recipients policy %q (expected keep or prefer_visible)", policy)
+	}
+}
+
+// duplicateRecipient is an address found in more than one of To, Cc and Bcc.
+type duplicateRecipient struct {
+	Address string
+	Fields  []string
+}
+
+// duplicateRecipients lists addresses that appear in more than one recipient
+// field, in order of first appearance.
+func duplicateRecipients(cfg *EmailConfig) []duplicateRecipient {
+	fields := map[string][]string{}
+	var order []string
+	for _, set := range []struct {
+		name string
+		list []string
+	}{{"to", cfg.To}, {"cc", cfg.CC}, {"bcc", cfg.BCC}} {
+		seen := map[string]bool{}
+		for _, candidate := range set.list {
+			_, addr := splitAddress(candidate)
+			addr = strings.ToLower(strings.TrimSpace(addr))
+			if addr == "" || seen[addr] {
+				continue
+			}
+			seen[addr] = true
+			if _, ok := fields[addr]; !ok {
+				order = append(order, addr)
+			}
+			fields[addr] = append(fields[addr], set.name)
+		}
+	}
+	var dups []duplicateRecipient
+	for _, addr := range order {
+		if len(fields[addr]) > 1 {
+			dups = append(dups, duplicateRecipient{Address: addr, Fields: fields[addr]})
+		}
+	}
+	return dups
+}
+
+// applyDuplicateRecipientPolicy removes, under prefer_visible, addresses from
+// Cc and Bcc that already appear in a more visible field (To, then Cc).
+func applyDuplicateRecipientPolicy(cfg *EmailConfig) {
+	if cfg.DuplicateRecipients != duplicateRecipientsPreferVisible {
+		return
+	}
+	visible := map[string]bool{}
+	filter := func(list []string) []string {
+		var kept []string
+		for _, candidate := range list {
+			_, addr := splitAddress(candidate)
+			addr = strings.ToLower(strings.TrimSpace(addr))
+			if visible[addr] {
+				continue
+			}
+			kept = append(kept, candidate)
+		}
+		for _, candidate := range kept {
+			_, addr := splitAddress(candidate)
+			visible[strings.ToLower(strings.TrimSpace(addr))] = true
+		}
+		return kept
+	}
+	cfg.To = filter(cfg.To)
+	cfg.CC = filter(cfg.CC)
+	cfg.BCC = filter(cfg.BCC)
+}
+
+// applyRecipientRedirect sends to RedirectAllTo instead of the real
+// recipients, keeping the originals visible in X-Original-* headers. The
+// envelope recipients and To header override are dropped too, or they would
+// still reach the real addresses. The body is rendered for the original
+// recipients before the swap.
+func applyRecipientRedirect(cfg *EmailConfig) {
+	if len(cfg.RedirectAllTo) == 0 {
+		return
+	}
+	headers := make(map[string]string, len(cfg.Headers)+5)
+	for k, v := range cfg.Headers {
+		headers[k] = v
+	}
+	for name, list := range map[string][]string{
+		"X-Original-To":          cfg.To,
+		"X-Original-Cc":          cfg.CC,
+		"X-Original-Bcc":         cfg.BCC,
+		"X-Original-Envelope-To": cfg.EnvelopeRecipients,
+	} {
+		if len(list) > 0 {
+			headers[name] = strings.Join(list, ", ")
+		}
+	}
+	if cfg.HeaderTo != "" {
+		headers["X-Original-Header-To"] = cfg.HeaderTo
+	}
+	cfg.Headers = headers
+	cfg.To = append([]string(nil), cfg.RedirectAllTo...)
+	cfg.CC, cfg.BCC = nil, nil
+	cfg.EnvelopeRecipients, cfg.HeaderTo = nil, ""
+}
+
+// defaultMailerName identifies this library in X-Mailer and User-Agent.
+const defaultMailerName = "oarkflow/email"
+
+// defaultableHeader resolves a configurable identifying header: empty means
+// defaultMailerName and "none" (or "off", "false", "-") disables it.
+func defaultableHeader(value string) string {
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case "":
+		return defaultMailerName
+	case "none", "off", "false", "-":
+		return ""
+	}
+	return strings.TrimSpace(value)
+}
+
+func hasHeader(headers map[string]string, name string) bool {
+	for k := range headers {
+		if strings.EqualFold(k, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// Truncation notices appended to bodies cut at MaxBodyBytes.
+const (
+	textTruncationMarker = "\n\n[message truncated]"
+	htmlTruncationMarker = "<p>[message truncated]</p>"
+)
+
+// truncateBodies cuts TextBody and HTMLBody to MaxBodyBytes, marker included.
+// Bodies already within the limit, such as ones truncated earlier, are left
+// alone.
+func truncateBodies(cfg *EmailConfig) {
+	if cfg.MaxBodyBytes <= 0 {
+		return
+	}
+	if len(cfg.TextBody) > cfg.MaxBodyBytes {
+		logger().Warn("text body truncated", "bytes", len(cfg.TextBody), "max_body_bytes", cfg.MaxBodyBytes)
+		cfg.TextBody = truncateText(cfg.TextBody, cfg.MaxBodyBytes-len(textTruncationMarker)) + textTruncationMarker
+	}
+	if len(cfg.HTMLBody) > cfg.MaxBodyBytes {
+		logger().Warn("html body truncated", "bytes", len(cfg.HTMLBody), "max_body_bytes", cfg.MaxBodyBytes)
+		cfg.HTMLBody = truncateHTML(cfg.HTMLBody, cfg.MaxBodyBytes-len(htmlTruncationMarker)) + htmlTruncationMarker
+	}
+}
+
+// truncateText cuts body to at most limit bytes, at the last whitespace when
+// there is one in the second half, otherwise at a UTF-8 boundary.
+func truncateText(body string, limit int) string {
+	if limit <= 0 {
+		return ""
+	}
+	if len(body) <= limit {
+		return body
+	}
+	cut := limit
+	for cut > 0 && !utf8.RuneStart(body[cut]) {
+		cut--
+	}
+	if i := strings.LastIndexAny(body[:cut], " \t\r\n"); i > limit/2 {
+		cut = i
+	}
+	return strings.TrimRight(body[:cut], " \t\r\n")
+}
+
+// truncateHTML cuts body to at most limit bytes without splitting a tag or
+// character reference: a cut inside one moves back to its start.
+func truncateHTML(body string, limit int) string {
+	if limit <= 0 {
+		return ""
+	}
+	if len(body) <= limit {
+		return body
+	}
+	cut := limit
+	for cut > 0 && !utf8.RuneStart(body[cut]) {
+		cut--
+	}
+	head := body[:cut]
+	if open := strings.LastIndexByte(head, '<'); open > strings.LastIndexByte(head, '>') {
+		head = head[:open]
+	}
+	if amp := strings.LastIndexByte(head, '&'); amp > strings.LastIndexByte(head, ';') && !strings.ContainsAny(head[amp:], " \t\r\n<") {
+		head = head[:amp]
+	}
+	return head
+}
+
+// checkMessageSize logs the final message size and enforces MaxMessageBytes.
+func checkMessageSize(cfg *EmailConfig, size int) error {
+	attachments := attachmentBytes(cfg.Attachments)
+	logger().Info("message size", "bytes", size, "attachment_bytes", attachments, "provider", cfg.ProviderOrHost())
+	if cfg.MaxMessageBytes > 0 && size > cfg.MaxMessageBytes {
+		return &PermanentError{Err: fmt.Errorf("message is %d bytes (%d bytes of attachments), over max_message_bytes %d", size, attachments, cfg.MaxMessageBytes)}
+	}
+	return nil
+}
+
+// attachmentBytes totals the unencoded size of local and data: attachments.
+// Remote attachments are not downloaded just to be measured.
+func attachmentBytes(list []Attachment) int {
+	total := 0
+	for _, att := range list {
+		source := strings.TrimSpace(att.Source)
+		switch {
+		case source == "" || looksLikeURL(source):
+		case strings.HasPrefix(source, "data:"):
+			if data, _, _, err := decodeDataURI(source, att); err == nil {
+				total += len(data)
+			}
+		default:
+			if info, err := os.Stat(source); err == nil {
+				total += int(info.Size())
+			}
+		}
+	}
+	return total
+}
+
+// gatherRecipients returns the SMTP envelope recipients. EnvelopeRecipients,
+// when set, replaces the To/Cc/Bcc derived list. It fails when the list is
+// longer than MaxRecipients.
 func gatherRecipients(cfg *EmailConfig) ([]string, error) {
 	unique := make(map[string]struct{})
 	var recipients []string
-	for _, set := range [][]string{cfg.To, cfg.CC, cfg.BCC} {
+	sets := [][]string{cfg.To, cfg.CC, cfg.BCC}
+	if len(cfg.EnvelopeRecipients) > 0 {
+		sets = [][]string{cfg.EnvelopeRecipients}
+	}
+	for _, set := range sets {
 		for _, candidate := range set {
 			_, addr := splitAddress(candidate)
 			if addr == "" {
@@ -168,5 +589,47 @@ func gatherRecipients(cfg *EmailConfig) ([]string, error) {
 			recipients = append(recipients, addr)
 		}
 	}
+	if cfg.MaxRecipients > 0 && len(recipients) > cfg.MaxRecipients {
+		return nil, fmt.Errorf("send has %d recipients, more than max_recipients (%d)", len(recipients), cfg.MaxRecipients)
+	}
 	return recipients, nil
 }
+
+// messageDate is the Date header time: MessageDate or now, in DateTimezone
+// when one is set.
+func messageDate(cfg *EmailConfig) time.Time {
+	date := cfg.MessageDate
+	if date.IsZero() {
+		date = time.Now()
+	}
+	if loc, err := dateLocation(cfg.DateTimezone); err == nil && loc != nil {
+		date = date.In(loc)
+	}
+	return date
+}
+
+// dateLocation resolves a date_timezone setting; empty returns nil, meaning
+// the time keeps its own zone.
+func dateLocation(name string) (*time.Location, error) {
+	name = strings.TrimSpace(name)
+	switch {
+	case name == "":
+		return nil, nil
+	case strings.EqualFold(name, "utc"):
+		return time.UTC, nil
+	case strings.EqualFold(name, "local"):
+		return time.Local, nil
+	}
+	return time.LoadLocation(name)
+}
+
+// parseMessageDate reads a message_date given as RFC 3339 or as an RFC 1123
+// Date header value.
+func parseMessageDate(raw string) (time.Time, error) {
+	for _, layout := range []string{time.RFC3339, time.RFC1123Z, time.RFC1123} {
+		if t, err := time.Parse(layout, strings.TrimSpace(raw)); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid message_date %q: want RFC 3339 or RFC 1123", raw)
+}
@@ -0,0 +1,647 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/http"
+	"net/http/httptest"
+	"net/mail"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSendViaSMTP_EnvelopeRecipientsDifferFromHeader(t *testing.T) {
+	srv := newStubSMTPServer(t)
+	cfg := srv.config()
+	cfg.HeaderTo = "Subscribers <list@example.com>"
+	cfg.EnvelopeRecipients = []string{"a@example.com", "B@example.com", "a@example.com"}
+	if err := sendViaSMTP(cfg); err != nil {
+		t.Fatalf("sendViaSMTP returned error: %v", err)
+	}
+	var rcpts []string
+	for _, c := range srv.Commands() {
+		if strings.HasPrefix(c, "RCPT TO:") {
+			rcpts = append(rcpts, c)
+		}
+	}
+	if len(rcpts) != 2 || rcpts[0] != "RCPT TO:<a@example.com>" || rcpts[1] != "RCPT TO:<b@example.com>" {
+		t.Fatalf("unexpected envelope recipients: %v", rcpts)
+	}
+	msgs := srv.Messages()
+	if len(msgs) != 1 || !strings.Contains(msgs[0], "To: Subscribers <list@example.com>\r\n") {
+		t.Fatalf("expected display To header, got %q", msgs)
+	}
+	if strings.Contains(msgs[0], "a@example.com") {
+		t.Fatalf("envelope recipients leaked into headers")
+	}
+}
+
+func TestParseConfig_EnvelopeRecipientsRequireSMTP(t *testing.T) {
+	_, err := parseConfig(map[string]any{
+		"endpoint": "https://api.example.com/send", "from": "sender@example.com",
+		"envelope_recipients": []any{"a@example.com"},
+	})
+	if err == nil || !strings.Contains(err.Error(), "envelope_recipients") {
+		t.Fatalf("expected envelope_recipients to be rejected for an http provider, got %v", err)
+	}
+	if _, err := parseConfig(map[string]any{
+		"host": "smtp.example.com", "from": "sender@example.com", "envelope_recipients": []any{"a@example.com"},
+	}); err != nil {
+		t.Fatalf("expected envelope_recipients to be accepted over smtp, got %v", err)
+	}
+}
+
+func TestBuildMessage_UndisclosedRecipients(t *testing.T) {
+	cfg := &EmailConfig{From: "sender@example.com", EnvelopeRecipients: []string{"a@example.com"}, TextBody: "hi"}
+	msg, err := buildMessage(cfg)
+	if err != nil {
+		t.Fatalf("buildMessage returned error: %v", err)
+	}
+	if !strings.Contains(msg, "To: undisclosed-recipients:;\r\n") {
+		t.Fatalf("expected undisclosed recipients header, got %q", msg)
+	}
+}
+
+func TestBuildMessage_SenderHeader(t *testing.T) {
+	cases := []struct {
+		name     string
+		cfg      EmailConfig
+		expected string
+	}{
+		{"same identity", EmailConfig{From: "News <Team@example.com>", Username: "team@example.com"}, ""},
+		{"non-address username", EmailConfig{From: "team@example.com", Username: "apikey"}, ""},
+		{"different identity", EmailConfig{From: "team@example.com", Username: "relay@example.net"}, "Sender: relay@example.net\r\n"},
+		{"opt out", EmailConfig{From: "team@example.com", Username: "relay@example.net", DisableSenderHeader: true}, ""},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.cfg.To = []string{"user@example.com"}
+			tc.cfg.TextBody = "hi"
+			msg, err := buildMessage(&tc.cfg)
+			if err != nil {
+				t.Fatalf("buildMessage returned error: %v", err)
+			}
+			if tc.expected == "" {
+				if strings.Contains(msg, "Sender:") {
+					t.Fatalf("unexpected Sender header in %q", msg)
+				}
+				return
+			}
+			if !strings.Contains(msg, tc.expected) {
+				t.Fatalf("expected %q in %q", tc.expected, msg)
+			}
+		})
+	}
+}
+
+func TestBuildMessage_BodyEncodings(t *testing.T) {
+	unicodeBody := "Grüße aus Köln – " + strings.Repeat("long line ", 20)
+	cases := []struct {
+		encoding string
+		body     string
+		header   string
+	}{
+		{"7bit", "plain ascii body", "7bit"},
+		{"8bit", unicodeBody, "8bit"},
+		{"base64", unicodeBody, "base64"},
+		{"quoted-printable", unicodeBody, "quoted-printable"},
+		{"auto", "plain ascii body", "7bit"},
+		{"auto", unicodeBody, "quoted-printable"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.encoding+"/"+tc.header, func(t *testing.T) {
+			cfg := &EmailConfig{From: "sender@example.com", To: []string{"user@example.com"}, TextBody: tc.body, BodyEncoding: tc.encoding}
+			raw, err := buildMessage(cfg)
+			if err != nil {
+				t.Fatalf("buildMessage returned error: %v", err)
+			}
+			msg, err := mail.ReadMessage(strings.NewReader(raw))
+			if err != nil {
+				t.Fatalf("parse message: %v", err)
+			}
+			if got := msg.Header.Get("Content-Transfer-Encoding"); got != tc.header {
+				t.Fatalf("expected Content-Transfer-Encoding %q, got %q", tc.header, got)
+			}
+			var r io.Reader = msg.Body
+			switch tc.header {
+			case "base64":
+				r = base64.NewDecoder(base64.StdEncoding, msg.Body)
+			case "quoted-printable":
+				r = quotedprintable.NewReader(msg.Body)
+			}
+			decoded, err := io.ReadAll(r)
+			if err != nil {
+				t.Fatalf("decode body: %v", err)
+			}
+			if got := strings.TrimRight(string(decoded), "\r\n"); got != tc.body {
+				t.Fatalf("decoded body mismatch: %q", got)
+			}
+		})
+	}
+}
+
+func TestBodyEncodingValidation(t *testing.T) {
+	cfg := &EmailConfig{From: "sender@example.com", To: []string{"user@example.com"}, TextBody: "héllo", BodyEncoding: "7bit"}
+	if _, err := buildMessage(cfg); err == nil {
+		t.Fatalf("expected 8-bit body to be rejected for 7bit encoding")
+	}
+	_, err := parseConfig(map[string]any{
+		"from":          "sender@example.com",
+		"to":            "user@example.com",
+		"host":          "smtp.example.com",
+		"body_encoding": "uuencode",
+	})
+	if err == nil || !strings.Contains(err.Error(), "invalid body encoding") {
+		t.Fatalf("expected invalid body encoding error, got %v", err)
+	}
+}
+
+func TestBuildMessage_ISO88591Charset(t *testing.T) {
+	cfg := &EmailConfig{
+		From:     "sender@example.com",
+		To:       []string{"user@example.com"},
+		Subject:  "Grüße",
+		TextBody: "Grüße aus Köln",
+		Charset:  "iso-8859-1",
+	}
+	raw, err := buildMessage(cfg)
+	if err != nil {
+		t.Fatalf("buildMessage returned error: %v", err)
+	}
+	msg, err := mail.ReadMessage(strings.NewReader(raw))
+	if err != nil {
+		t.Fatalf("parse message: %v", err)
+	}
+	if got := msg.Header.Get("Content-Type"); got != "text/plain; charset=ISO-8859-1" {
+		t.Fatalf("unexpected Content-Type %q", got)
+	}
+	if got, want := msg.Header.Get("Subject"), mime.BEncoding.Encode("ISO-8859-1", "Gr\xfc\xdfe"); got != want {
+		t.Fatalf("expected subject %q, got %q", want, got)
+	}
+	body, _ := io.ReadAll(msg.Body)
+	if !strings.HasPrefix(string(body), "Gr\xfc\xdfe aus K\xf6ln") {
+		t.Fatalf("body not transcoded to ISO-8859-1: %q", body)
+	}
+
+	cfg.TextBody = "日本語"
+	if _, err := buildMessage(cfg); err == nil {
+		t.Fatalf("expected unencodable text to be rejected")
+	}
+}
+
+func TestSendViaSMTP_BccOnly(t *testing.T) {
+	srv := newStubSMTPServer(t)
+	cfg := srv.config()
+	cfg.To = nil
+	cfg.BCC = []string{"archive@example.com"}
+	if err := sendViaSMTP(cfg); err != nil {
+		t.Fatalf("sendViaSMTP returned error: %v", err)
+	}
+	var rcpts []string
+	for _, c := range srv.Commands() {
+		if strings.HasPrefix(c, "RCPT TO:") {
+			rcpts = append(rcpts, c)
+		}
+	}
+	if len(rcpts) != 1 || rcpts[0] != "RCPT TO:<archive@example.com>" {
+		t.Fatalf("unexpected envelope recipients: %v", rcpts)
+	}
+	msgs := srv.Messages()
+	if len(msgs) != 1 || !strings.Contains(msgs[0], "To: undisclosed-recipients:;\r\n") {
+		t.Fatalf("expected undisclosed To header, got %q", msgs)
+	}
+	if strings.Contains(msgs[0], "archive@example.com") {
+		t.Fatalf("bcc recipient leaked into headers")
+	}
+}
+
+func TestParseConfig_CcOnly(t *testing.T) {
+	cfg, err := parseConfig(map[string]any{
+		"from":      "sender@example.com",
+		"cc":        "team@example.com",
+		"host":      "smtp.example.com",
+		"subject":   "FYI",
+		"body_text": "hello",
+	})
+	if err != nil {
+		t.Fatalf("parseConfig returned error for cc-only message: %v", err)
+	}
+	msg, err := buildMessage(cfg)
+	if err != nil {
+		t.Fatalf("buildMessage: %v", err)
+	}
+	if !strings.Contains(msg, "To: undisclosed-recipients:;\r\n") || !strings.Contains(msg, "Cc: team@example.com\r\n") {
+		t.Fatalf("unexpected cc-only headers: %q", msg)
+	}
+	recipients, err := gatherRecipients(cfg)
+	if err != nil || len(recipients) != 1 || recipients[0] != "team@example.com" {
+		t.Fatalf("unexpected envelope recipients %v (%v)", recipients, err)
+	}
+
+	if _, err := parseConfig(map[string]any{"from": "sender@example.com", "host": "smtp.example.com"}); err == nil {
+		t.Fatalf("expected an error without any recipients")
+	}
+}
+
+func TestAWSProvider_BccOnlyDestination(t *testing.T) {
+	cfg := &EmailConfig{From: "sender@example.com", BCC: []string{"archive@example.com"}, Subject: "s", TextBody: "b"}
+	payload, _, err := NewAWSProvider().BuildPayload(cfg)
+	if err != nil {
+		t.Fatalf("BuildPayload: %v", err)
+	}
+	dest, ok := payload.(map[string]interface{})["Destination"].(map[string][]string)
+	if !ok {
+		t.Fatalf("missing destination in %v", payload)
+	}
+	if _, hasTo := dest["ToAddresses"]; hasTo || len(dest["BccAddresses"]) != 1 {
+		t.Fatalf("unexpected destination %v", dest)
+	}
+}
+
+func TestParseConfig_ReplyToFrom(t *testing.T) {
+	base := func() map[string]any {
+		return map[string]any{"from": "Support <support@example.com>", "to": "user@example.com", "host": "smtp.example.com"}
+	}
+
+	raw := base()
+	raw["reply_to_from"] = true
+	cfg, err := parseConfig(raw)
+	if err != nil {
+		t.Fatalf("parseConfig: %v", err)
+	}
+	if len(cfg.ReplyTo) != 1 || cfg.ReplyTo[0] != "support@example.com" {
+		t.Fatalf("expected Reply-To to fall back to From, got %v", cfg.ReplyTo)
+	}
+	msg, err := buildMessage(cfg)
+	if err != nil || !strings.Contains(msg, "Reply-To: support@example.com\r\n") {
+		t.Fatalf("expected Reply-To header, got %q (%v)", msg, err)
+	}
+	payload, _, err := NewSendGridProvider().BuildPayload(cfg)
+	if err != nil {
+		t.Fatalf("BuildPayload: %v", err)
+	}
+	if reply, ok := payload.(map[string]interface{})["reply_to"].(map[string]string); !ok || reply["email"] != "support@example.com" {
+		t.Fatalf("expected reply_to in HTTP payload, got %v", payload)
+	}
+
+	cfg, err = parseConfig(base())
+	if err != nil {
+		t.Fatalf("parseConfig: %v", err)
+	}
+	if len(cfg.ReplyTo) != 0 {
+		t.Fatalf("expected no Reply-To without the flag, got %v", cfg.ReplyTo)
+	}
+
+	raw = base()
+	raw["reply_to_from"] = true
+	raw["reply_to"] = "replies@example.com"
+	cfg, err = parseConfig(raw)
+	if err != nil {
+		t.Fatalf("parseConfig: %v", err)
+	}
+	if len(cfg.ReplyTo) != 1 || cfg.ReplyTo[0] != "replies@example.com" {
+		t.Fatalf("expected explicit Reply-To to win, got %v", cfg.ReplyTo)
+	}
+}
+
+func TestSendViaSMTP_MaxMessageBytes(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "report.bin")
+	if err := os.WriteFile(path, bytes.Repeat([]byte("x"), 4096), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	srv := newStubSMTPServer(t)
+	cfg := srv.config()
+	cfg.Attachments = []Attachment{{Source: path}}
+
+	cfg.MaxMessageBytes = 64 << 10
+	if err := sendViaSMTP(cfg); err != nil {
+		t.Fatalf("expected message under the cap to send, got %v", err)
+	}
+
+	cfg.MaxMessageBytes = 4096
+	err := sendViaSMTP(cfg)
+	if !errors.Is(err, ErrPermanent) || !strings.Contains(err.Error(), "4096 bytes of attachments") {
+		t.Fatalf("expected permanent size error mentioning attachments, got %v", err)
+	}
+	if len(srv.Messages()) != 1 {
+		t.Fatalf("oversized message should not reach the server")
+	}
+}
+
+func TestSendViaHTTP_MaxMessageBytes(t *testing.T) {
+	requests := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer srv.Close()
+	cfg := &EmailConfig{
+		Transport:  "http",
+		Endpoint:   srv.URL,
+		HTTPMethod: http.MethodPost,
+		From:       "sender@example.com",
+		To:         []string{"user@example.com"},
+		Subject:    "hi",
+		TextBody:   strings.Repeat("body ", 1000),
+		Timeout:    2 * time.Second,
+	}
+	cfg.MaxMessageBytes = 64 << 10
+	if err := sendViaHTTP(cfg); err != nil {
+		t.Fatalf("expected payload under the cap to send, got %v", err)
+	}
+	cfg.MaxMessageBytes = 1000
+	if err := sendViaHTTP(cfg); !errors.Is(err, ErrPermanent) || !strings.Contains(err.Error(), "over max_message_bytes 1000") {
+		t.Fatalf("expected permanent size error, got %v", err)
+	}
+	if requests != 1 {
+		t.Fatalf("expected only the under-cap request to be sent, got %d", requests)
+	}
+}
+
+func TestBuildMessage_XMailer(t *testing.T) {
+	cases := []struct {
+		name     string
+		cfg      EmailConfig
+		expected string
+	}{
+		{"default", EmailConfig{}, "X-Mailer: oarkflow/email\r\n"},
+		{"override", EmailConfig{XMailer: "Acme Notifier 2.1"}, "X-Mailer: Acme Notifier 2.1\r\n"},
+		{"disabled", EmailConfig{XMailer: "none"}, ""},
+		{"explicit header wins", EmailConfig{Headers: map[string]string{"x-mailer": "custom"}}, "x-mailer: custom\r\n"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.cfg.From = "sender@example.com"
+			tc.cfg.To = []string{"user@example.com"}
+			tc.cfg.TextBody = "hi"
+			msg, err := buildMessage(&tc.cfg)
+			if err != nil {
+				t.Fatalf("buildMessage returned error: %v", err)
+			}
+			if n := strings.Count(strings.ToLower(msg), "x-mailer:"); tc.expected == "" && n != 0 || tc.expected != "" && n != 1 {
+				t.Fatalf("expected %q exactly once in %q", tc.expected, msg)
+			}
+			if !strings.Contains(msg, tc.expected) {
+				t.Fatalf("expected %q in %q", tc.expected, msg)
+			}
+		})
+	}
+}
+
+func TestSendViaHTTP_UserAgent(t *testing.T) {
+	var got []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = append(got, r.Header.Get("User-Agent"))
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer srv.Close()
+	cfg := &EmailConfig{
+		Transport:  "http",
+		Endpoint:   srv.URL,
+		HTTPMethod: http.MethodPost,
+		From:       "sender@example.com",
+		To:         []string{"user@example.com"},
+		Subject:    "hi",
+		TextBody:   "body",
+		Timeout:    2 * time.Second,
+	}
+	for _, ua := range []string{"", "acme-mailer/1.0"} {
+		cfg.UserAgent = ua
+		if err := sendViaHTTP(cfg); err != nil {
+			t.Fatalf("send failed: %v", err)
+		}
+	}
+	if len(got) != 2 || got[0] != "oarkflow/email" || got[1] != "acme-mailer/1.0" {
+		t.Fatalf("unexpected User-Agent headers %q", got)
+	}
+}
+
+func TestBuildMessage_DateHeader(t *testing.T) {
+	fixed := time.Date(2024, 3, 1, 12, 30, 0, 0, time.UTC)
+	cases := []struct {
+		name     string
+		cfg      EmailConfig
+		expected string
+	}{
+		{"fixed date keeps its zone", EmailConfig{MessageDate: fixed}, "Date: Fri, 01 Mar 2024 12:30:00 +0000\r\n"},
+		{"timezone", EmailConfig{MessageDate: fixed, DateTimezone: "Asia/Kolkata"}, "Date: Fri, 01 Mar 2024 18:00:00 +0530\r\n"},
+		{"utc", EmailConfig{MessageDate: fixed.In(time.FixedZone("", -5*3600)), DateTimezone: "utc"}, "Date: Fri, 01 Mar 2024 12:30:00 +0000\r\n"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.cfg.From = "sender@example.com"
+			tc.cfg.To = []string{"user@example.com"}
+			tc.cfg.TextBody = "hi"
+			msg, err := buildMessage(&tc.cfg)
+			if err != nil {
+				t.Fatalf("buildMessage returned error: %v", err)
+			}
+			if !strings.Contains(msg, tc.expected) {
+				t.Fatalf("expected %q in %q", tc.expected, msg)
+			}
+		})
+	}
+}
+
+func TestParseConfig_DateSettings(t *testing.T) {
+	cfg, err := parseConfig(map[string]any{"host": "localhost", "from": "a@example.com", "to": "b@example.com", "timezone": "UTC", "message_date": "2024-03-01T12:30:00+02:00"})
+	if err != nil {
+		t.Fatalf("parseConfig: %v", err)
+	}
+	if cfg.DateTimezone != "UTC" || !cfg.MessageDate.Equal(time.Date(2024, 3, 1, 10, 30, 0, 0, time.UTC)) {
+		t.Fatalf("unexpected date settings: %q %v", cfg.DateTimezone, cfg.MessageDate)
+	}
+	if _, err := parseConfig(map[string]any{"host": "localhost", "from": "a@example.com", "to": "b@example.com", "message_date": "yesterday"}); err == nil {
+		t.Fatal("expected an error for an unparseable message_date")
+	}
+	if _, err := parseConfig(map[string]any{"host": "localhost", "from": "a@example.com", "to": "b@example.com", "date_timezone": "Mars/Olympus"}); err == nil {
+		t.Fatal("expected an error for an unknown date_timezone")
+	}
+}
+
+func TestResolveBodies_TruncatesTextWithMarker(t *testing.T) {
+	cfg := &EmailConfig{TextBody: strings.Repeat("lorem ipsum ", 50), MaxBodyBytes: 120}
+	resolveBodies(cfg)
+	if len(cfg.TextBody) > 120 || !strings.HasSuffix(cfg.TextBody, textTruncationMarker) {
+		t.Fatalf("expected a truncated body ending in the marker, got %d bytes %q", len(cfg.TextBody), cfg.TextBody)
+	}
+	if kept := strings.TrimSuffix(cfg.TextBody, textTruncationMarker); !strings.HasSuffix(kept, "ipsum") && !strings.HasSuffix(kept, "lorem") {
+		t.Fatalf("expected a cut at a word boundary, got %q", kept)
+	}
+	before := cfg.TextBody
+	resolveBodies(cfg)
+	if cfg.TextBody != before {
+		t.Fatal("truncation should be idempotent")
+	}
+}
+
+func TestResolveBodies_TruncatesHTMLBeforeOpenTag(t *testing.T) {
+	html := "<p>Hello &amp; welcome</p>" + strings.Repeat(`<a href="https://example.com/x">link</a>`, 20)
+	limit := 70 + len(htmlTruncationMarker)
+	cfg := &EmailConfig{HTMLBody: html, MaxBodyBytes: limit}
+	resolveBodies(cfg)
+	if len(cfg.HTMLBody) > limit || !strings.HasSuffix(cfg.HTMLBody, htmlTruncationMarker) {
+		t.Fatalf("unexpected truncated html %q", cfg.HTMLBody)
+	}
+	kept := strings.TrimSuffix(cfg.HTMLBody, htmlTruncationMarker)
+	if strings.LastIndex(kept, "<") > strings.LastIndex(kept, ">") {
+		t.Fatalf("html was cut inside a tag: %q", kept)
+	}
+	if !strings.HasPrefix(html, kept) || !strings.HasSuffix(kept, "</a>") {
+		t.Fatalf("expected the cut just before an open tag, got %q", kept)
+	}
+	if got := truncateHTML("a &amp; b", 4); got != "a " {
+		t.Fatalf("expected the cut before a character reference, got %q", got)
+	}
+}
+
+func TestSendEmail_RedirectAllTo(t *testing.T) {
+	defer withTempSendLog(t)()
+	srv := newStubSMTPServer(t)
+	cfg := srv.config()
+	cfg.To = []string{"alice@example.org", "bob@example.net"}
+	cfg.CC = []string{"carol@example.org"}
+	cfg.BCC = []string{"dave@example.org"}
+	cfg.RedirectAllTo = []string{"qa-inbox@example.com"}
+	if err := sendEmail(cfg, nil); err != nil {
+		t.Fatalf("sendEmail: %v", err)
+	}
+	var rcpts []string
+	for _, c := range srv.Commands() {
+		if strings.HasPrefix(c, "RCPT TO:") {
+			rcpts = append(rcpts, c)
+		}
+	}
+	if len(rcpts) != 1 || !strings.HasPrefix(rcpts[0], "RCPT TO:<qa-inbox@example.com>") {
+		t.Fatalf("expected only the test inbox as recipient, got %q", rcpts)
+	}
+	msgs := srv.Messages()
+	if len(msgs) != 1 {
+		t.Fatalf("expected 1 message, got %d", len(msgs))
+	}
+	parsed, err := mail.ReadMessage(strings.NewReader(msgs[0]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := parsed.Header.Get("To"); got != "qa-inbox@example.com" {
+		t.Fatalf("expected To to be redirected, got %q", got)
+	}
+	if got := parsed.Header.Get("Cc"); got != "" {
+		t.Fatalf("expected Cc to be dropped, got %q", got)
+	}
+	if got := parsed.Header.Get("X-Original-To"); got != "alice@example.org, bob@example.net" {
+		t.Fatalf("expected the original To list in X-Original-To, got %q", got)
+	}
+	if got := parsed.Header.Get("X-Original-Cc"); got != "carol@example.org" {
+		t.Fatalf("expected the original Cc list in X-Original-Cc, got %q", got)
+	}
+	if cfg.To[0] != "alice@example.org" || len(cfg.CC) != 1 {
+		t.Fatalf("redirect must not modify the caller's config: %+v", cfg.To)
+	}
+}
+
+func TestSendEmail_RedirectAllToOverridesEnvelope(t *testing.T) {
+	defer withTempSendLog(t)()
+	srv := newStubSMTPServer(t)
+	cfg := srv.config()
+	cfg.To = []string{"list@example.org"}
+	cfg.EnvelopeRecipients = []string{"alice@example.org", "bob@example.net"}
+	cfg.HeaderTo = "Customers <list@example.org>"
+	cfg.RedirectAllTo = []string{"qa-inbox@example.com"}
+	if err := sendEmail(cfg, nil); err != nil {
+		t.Fatalf("sendEmail: %v", err)
+	}
+	var rcpts []string
+	for _, c := range srv.Commands() {
+		if strings.HasPrefix(c, "RCPT TO:") {
+			rcpts = append(rcpts, c)
+		}
+	}
+	if len(rcpts) != 1 || !strings.HasPrefix(rcpts[0], "RCPT TO:<qa-inbox@example.com>") {
+		t.Fatalf("expected only the test inbox as recipient, got %q", rcpts)
+	}
+	parsed, err := mail.ReadMessage(strings.NewReader(srv.Messages()[0]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := parsed.Header.Get("To"); got != "qa-inbox@example.com" {
+		t.Fatalf("expected To to be redirected, got %q", got)
+	}
+	if got := parsed.Header.Get("X-Original-Envelope-To"); got != "alice@example.org, bob@example.net" {
+		t.Fatalf("expected the envelope recipients in X-Original-Envelope-To, got %q", got)
+	}
+	if got := parsed.Header.Get("X-Original-Header-To"); got != "Customers <list@example.org>" {
+		t.Fatalf("expected the To override in X-Original-Header-To, got %q", got)
+	}
+}
+
+func TestBuildMessage_AlternativeOrderAndPreamble(t *testing.T) {
+	partTypes := func(raw map[string]any) ([]string, string) {
+		t.Helper()
+		cfg, err := parseConfig(raw)
+		if err != nil {
+			t.Fatalf("parseConfig: %v", err)
+		}
+		msg, err := buildMessage(cfg)
+		if err != nil {
+			t.Fatalf("buildMessage: %v", err)
+		}
+		parsed, err := mail.ReadMessage(strings.NewReader(msg))
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, params, err := mime.ParseMediaType(parsed.Header.Get("Content-Type"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := io.ReadAll(parsed.Body)
+		preamble, _, _ := strings.Cut(string(body), "--"+params["boundary"])
+		reader := multipart.NewReader(bytes.NewReader(body), params["boundary"])
+		var types []string
+		for {
+			part, err := reader.NextPart()
+			if err != nil {
+				break
+			}
+			ct, _, _ := mime.ParseMediaType(part.Header.Get("Content-Type"))
+			types = append(types, ct)
+		}
+		return types, strings.TrimSpace(preamble)
+	}
+	base := func() map[string]any {
+		return map[string]any{
+			"host": "smtp.example.com", "from": "a@example.com", "to": "b@example.com",
+			"text_body": "plain", "html_body": "<p>rich</p>",
+		}
+	}
+
+	types, preamble := partTypes(base())
+	if strings.Join(types, ",") != "text/plain,text/html" || preamble != "" {
+		t.Fatalf("expected text then HTML and no preamble by default, got %v %q", types, preamble)
+	}
+
+	raw := base()
+	raw["alternative_order"] = "html_first"
+	raw["mime_preamble"] = true
+	types, preamble = partTypes(raw)
+	if strings.Join(types, ",") != "text/html,text/plain" {
+		t.Fatalf("expected HTML first, got %v", types)
+	}
+	if preamble != defaultMIMEPreamble {
+		t.Fatalf("expected the default preamble, got %q", preamble)
+	}
+
+	raw = base()
+	raw["alternative_order"] = "sideways"
+	if _, err := parseConfig(raw); err == nil {
+		t.Fatal("expected an invalid alternative_order to be rejected")
+	}
+}
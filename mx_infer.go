@@ -0,0 +1,118 @@
+package main
+
+import (
+	"context"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MXResolver looks up a domain's MX records; *net.Resolver implements it.
+type MXResolver interface {
+	LookupMX(ctx context.Context, name string) ([]*net.MX, error)
+}
+
+// mxResolver is used by provider inference; tests replace it with a stub.
+var mxResolver MXResolver = net.DefaultResolver
+
+// mxLookupTimeout bounds one MX lookup, and mxCacheTTL how long its answer
+// (or failure) is reused.
+var (
+	mxLookupTimeout = 3 * time.Second
+	mxCacheTTL      = time.Hour
+)
+
+// mxHostProviders maps mail host suffixes to providers. Order matters: more
+// specific suffixes come first. Filtering gateways such as Proofpoint and
+// Mimecast map to "", which stops inference because the mailbox provider
+// behind them is unknown.
+var mxHostProviders = []struct {
+	suffix   string
+	provider string
+}{
+	{"aspmx.l.google.com", "gmail"},
+	{"googlemail.com", "gmail"},
+	{"google.com", "gmail"},
+	{"mail.protection.outlook.com", "office365"},
+	{"olc.protection.outlook.com", "outlook"},
+	{"hotmail.com", "outlook"},
+	{"yahoodns.net", "yahoo"},
+	{"mail.icloud.com", "icloud"},
+	{"zoho.com", "zoho"},
+	{"zoho.eu", "zoho"},
+	{"mailgun.org", "mailgun"},
+	{"sendgrid.net", "sendgrid"},
+	{"amazonaws.com", "aws_ses"},
+	{"pphosted.com", ""},
+	{"ppe-hosted.com", ""},
+	{"mimecast.com", ""},
+}
+
+type mxCacheEntry struct {
+	provider string
+	expires  time.Time
+}
+
+var (
+	mxCacheMu sync.Mutex
+	mxCache   = map[string]mxCacheEntry{}
+)
+
+// RegisterMXHostProvider maps mail hosts ending in suffix to provider for
+// MX-based inference, ahead of the built-in entries.
+func RegisterMXHostProvider(suffix, provider string) {
+	mxCacheMu.Lock()
+	defer mxCacheMu.Unlock()
+	mxHostProviders = append([]struct {
+		suffix   string
+		provider string
+	}{{strings.ToLower(strings.Trim(suffix, ".")), provider}}, mxHostProviders...)
+	mxCache = map[string]mxCacheEntry{}
+}
+
+// inferProviderFromMX returns the provider hosting domain's mail, judged by
+// its most preferred recognised MX host, or "" when none is recognised or
+// the lookup fails.
+func inferProviderFromMX(domain string) string {
+	now := time.Now()
+	mxCacheMu.Lock()
+	if entry, ok := mxCache[domain]; ok && now.Before(entry.expires) {
+		mxCacheMu.Unlock()
+		return entry.provider
+	}
+	mxCacheMu.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), mxLookupTimeout)
+	defer cancel()
+	records, err := mxResolver.LookupMX(ctx, domain)
+	if err != nil {
+		logger().Debug("provider inference: MX lookup failed", "domain", domain, "error", err)
+	}
+	sort.SliceStable(records, func(i, j int) bool { return records[i].Pref < records[j].Pref })
+
+	mxCacheMu.Lock()
+	defer mxCacheMu.Unlock()
+	provider := ""
+	for _, mx := range records {
+		if p, ok := mxHostProvider(mx.Host); ok {
+			provider = p
+			break
+		}
+	}
+	mxCache[domain] = mxCacheEntry{provider: provider, expires: now.Add(mxCacheTTL)}
+	return provider
+}
+
+// mxHostProvider matches host against mxHostProviders; the caller holds
+// mxCacheMu.
+func mxHostProvider(host string) (string, bool) {
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	for _, entry := range mxHostProviders {
+		if host == entry.suffix || strings.HasSuffix(host, "."+entry.suffix) {
+			return entry.provider, true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+)
+
+type stubMXResolver struct {
+	records map[string][]*net.MX
+	lookups int
+}
+
+func (s *stubMXResolver) LookupMX(_ context.Context, name string) ([]*net.MX, error) {
+	s.lookups++
+	if mx, ok := s.records[name]; ok {
+		return mx, nil
+	}
+	return nil, errors.New("no such host")
+}
+
+func withStubMXResolver(t *testing.T, stub *stubMXResolver) {
+	t.Helper()
+	orig := mxResolver
+	mxResolver = stub
+	mxCacheMu.Lock()
+	mxCache = map[string]mxCacheEntry{}
+	mxCacheMu.Unlock()
+	t.Cleanup(func() {
+		mxResolver = orig
+		mxCacheMu.Lock()
+		mxCache = map[string]mxCacheEntry{}
+		mxCacheMu.Unlock()
+	})
+}
+
+func TestInferProvider_GoogleHostedCustomDomain(t *testing.T) {
+	stub := &stubMXResolver{records: map[string][]*net.MX{
+		"acme.example": {
+			{Host: "alt1.aspmx.l.google.com.", Pref: 5},
+			{Host: "aspmx.l.google.com.", Pref: 1},
+		},
+		"m365.example":    {{Host: "m365-example.mail.protection.outlook.com.", Pref: 0}},
+		"guarded.example": {{Host: "mx0a-001.pphosted.com.", Pref: 10}, {Host: "aspmx.l.google.com.", Pref: 20}},
+	}}
+	withStubMXResolver(t, stub)
+
+	if got := inferProvider(false, "ops@acme.example"); got != "" {
+		t.Fatalf("expected no MX lookup without the option, got %q", got)
+	}
+	if stub.lookups != 0 {
+		t.Fatalf("expected no lookups, got %d", stub.lookups)
+	}
+	cases := map[string]string{
+		"Ops <ops@acme.example>":  "gmail",
+		"it@m365.example":         "office365",
+		"sec@guarded.example":     "",
+		"someone@unknown.example": "",
+		"friend@hotmail.com":      "outlook",
+	}
+	for addr, want := range cases {
+		if got := inferProvider(true, addr); got != want {
+			t.Errorf("inferProvider(%q) = %q, want %q", addr, got, want)
+		}
+	}
+	before := stub.lookups
+	inferProvider(true, "ops@acme.example")
+	if stub.lookups != before {
+		t.Fatalf("expected the MX answer to be cached")
+	}
+}
+
+func TestFinalizeConfig_InfersProviderFromMX(t *testing.T) {
+	withStubMXResolver(t, &stubMXResolver{records: map[string][]*net.MX{
+		"acme.example": {{Host: "aspmx.l.google.com.", Pref: 1}},
+	}})
+	cfg, err := parseConfig(map[string]any{
+		"from": "ops@acme.example", "to": "user@example.com", "infer_provider_mx": true,
+	})
+	if err != nil {
+		t.Fatalf("parseConfig: %v", err)
+	}
+	if cfg.Provider != "gmail" || cfg.Host != "smtp.gmail.com" {
+		t.Fatalf("expected the gmail provider and host, got %q %q", cfg.Provider, cfg.Host)
+	}
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"html"
+	"net/url"
+	"strings"
+)
+
+// openPixelToken encodes recipient with an HMAC so the tracking endpoint can
+// trust it: base64url(recipient) "." base64url(HMAC-SHA256(secret, recipient)).
+func openPixelToken(recipient, secret string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(recipient))
+	return base64.RawURLEncoding.EncodeToString([]byte(recipient)) + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// VerifyOpenToken checks a token produced for the open pixel and returns the
+// recipient it encodes.
+func VerifyOpenToken(token, secret string) (string, bool) {
+	payload, sig, ok := strings.Cut(token, ".")
+	if !ok {
+		return "", false
+	}
+	recipient, err := base64.RawURLEncoding.DecodeString(payload)
+	if err != nil {
+		return "", false
+	}
+	if !hmac.Equal([]byte(openPixelToken(string(recipient), secret)), []byte(payload+"."+sig)) {
+		return "", false
+	}
+	return string(recipient), true
+}
+
+// injectOpenPixel appends a 1x1 tracking image for the message's recipient
+// to a non-empty HTMLBody, before </body> when present. Every recipient of a
+// message sees the same body, so a token could only name one of them; a
+// message with several recipients (To, Cc and Bcc together) gets no pixel
+// rather than crediting everyone's opens to one address.
+func injectOpenPixel(cfg *EmailConfig) {
+	if cfg.OpenPixelURL == "" || strings.TrimSpace(cfg.HTMLBody) == "" {
+		return
+	}
+	recipients, _ := gatherRecipients(cfg)
+	if len(recipients) != 1 {
+		logger().Info("open pixel skipped: message does not have exactly one recipient", "recipients", len(recipients))
+		return
+	}
+	recipient := recipients[0]
+	src := cfg.OpenPixelURL
+	sep := "?"
+	if strings.Contains(src, "?") {
+		sep = "&"
+	}
+	src += sep + "t=" + url.QueryEscape(openPixelToken(recipient, cfg.OpenPixelSecret))
+	pixel := `<img src="` + html.EscapeString(src) + `" width="1" height="1" alt="" style="display:none">`
+	if idx := strings.LastIndex(strings.ToLower(cfg.HTMLBody), "</body>"); idx >= 0 {
+		cfg.HTMLBody = cfg.HTMLBody[:idx] + pixel + cfg.HTMLBody[idx:]
+		return
+	}
+	cfg.HTMLBody += pixel
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"net/url"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestPrepareSendConfig_InjectsOpenPixelOnce(t *testing.T) {
+	cfg, err := parseConfig(map[string]any{
+		"from":              "news@example.com",
+		"to":                "Ada <Ada@example.com>",
+		"host":              "smtp.example.com",
+		"html_body":         "<html><body><p>Hi</p></body></html>",
+		"open_pixel_url":    "https://track.example.com/open?c=spring",
+		"open_pixel_secret": "s3cret",
+	})
+	if err != nil {
+		t.Fatalf("parseConfig: %v", err)
+	}
+	prepared, err := prepareSendConfig(cfg)
+	if err != nil {
+		t.Fatalf("prepareSendConfig: %v", err)
+	}
+	body := prepared.HTMLBody
+	if n := strings.Count(body, "<img "); n != 1 {
+		t.Fatalf("expected exactly one pixel, got %d in %s", n, body)
+	}
+	if !strings.Contains(body, `style="display:none"></body>`) {
+		t.Fatalf("expected pixel before </body>, got %s", body)
+	}
+	src := regexp.MustCompile(`<img src="([^"]+)"`).FindStringSubmatch(body)[1]
+	parsed, err := url.Parse(strings.ReplaceAll(src, "&amp;", "&"))
+	if err != nil || parsed.Query().Get("c") != "spring" {
+		t.Fatalf("expected pixel URL to keep its query, got %s", src)
+	}
+	recipient, ok := VerifyOpenToken(parsed.Query().Get("t"), "s3cret")
+	if !ok || recipient != "ada@example.com" {
+		t.Fatalf("expected token for ada@example.com, got %q (%v)", recipient, ok)
+	}
+	if _, ok := VerifyOpenToken(parsed.Query().Get("t"), "other"); ok {
+		t.Fatalf("token verified with the wrong secret")
+	}
+
+	text := &EmailConfig{To: []string{"a@example.com"}, TextBody: "plain", OpenPixelURL: "https://t.example.com/o", OpenPixelSecret: "k"}
+	prepared, err = prepareSendConfig(text)
+	if err != nil {
+		t.Fatalf("prepareSendConfig: %v", err)
+	}
+	if prepared.HTMLBody != "" {
+		t.Fatalf("expected no pixel without an HTML body, got %q", prepared.HTMLBody)
+	}
+}
+
+func TestPrepareSendConfig_OpenPixelNeedsSingleRecipient(t *testing.T) {
+	for name, cfg := range map[string]*EmailConfig{
+		"to and cc": {To: []string{"a@example.com"}, CC: []string{"b@example.com"}},
+		"bcc only":  {BCC: []string{"a@example.com", "b@example.com"}},
+	} {
+		cfg.HTMLBody = "<p>Hi</p>"
+		cfg.OpenPixelURL, cfg.OpenPixelSecret = "https://t.example.com/o", "k"
+		prepared, err := prepareSendConfig(cfg)
+		if err != nil {
+			t.Fatalf("%s: prepareSendConfig: %v", name, err)
+		}
+		if strings.Contains(prepared.HTMLBody, "<img ") {
+			t.Fatalf("%s: expected no pixel for several recipients, got %s", name, prepared.HTMLBody)
+		}
+	}
+
+	single := &EmailConfig{BCC: []string{"Solo@example.com"}, HTMLBody: "<p>Hi</p>", OpenPixelURL: "https://t.example.com/o", OpenPixelSecret: "k"}
+	prepared, err := prepareSendConfig(single)
+	if err != nil {
+		t.Fatalf("prepareSendConfig: %v", err)
+	}
+	src := regexp.MustCompile(`<img src="([^"]+)"`).FindStringSubmatch(prepared.HTMLBody)
+	if src == nil {
+		t.Fatalf("expected a pixel for a single Bcc recipient, got %s", prepared.HTMLBody)
+	}
+	parsed, _ := url.Parse(strings.ReplaceAll(src[1], "&amp;", "&"))
+	if recipient, ok := VerifyOpenToken(parsed.Query().Get("t"), "k"); !ok || recipient != "solo@example.com" {
+		t.Fatalf("expected a token for solo@example.com, got %q (%v)", recipient, ok)
+	}
+}
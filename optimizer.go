@@ -1,9 +1,6 @@
 package main
 
-import (
-	"log"
-	"sort"
-)
+import "sort"
 
 // SchedulerOptimizer is pluggable interface for allocating providers for a batch of jobs.
 type SchedulerOptimizer interface {
@@ -54,9 +51,9 @@ func (o *GreedyBatchOptimizer) AllocateJobs(jobs []*ScheduledEmail) map[string]s
 			if r := findFirstMatchingRoute(j.Config); r != nil {
 				// If the route provides strong hints (weights or costs), reorder by usage/cost/capacity
 				if len(r.ProviderWeights) > 0 || len(r.ProviderCostOverrides) > 0 {
-					log.Printf("optimizer: job=%s initial candidates=%v route=%+v", j.ID, c, r)
+					logger().Debug("optimizer: initial candidates", "job_id", j.ID, "candidates", c)
 					c = sortProvidersByUsage(c, r.ToDomains, r.SelectionWindow, r.ProviderWeights, r.RecencyHalfLife, r.ProviderCapacities, r.ProviderCostOverrides)
-					log.Printf("optimizer: job=%s ordered candidates=%v", j.ID, c)
+					logger().Debug("optimizer: ordered candidates", "job_id", j.ID, "candidates", c)
 					// If ProviderPriority is not set on the config, we already reordered; otherwise we respect the explicit list unless costs/weights are present
 				} else if len(j.Config.ProviderPriority) == 0 {
 					// no explicit provider priority - use route priority if present
@@ -142,12 +139,12 @@ func (o *GreedyBatchOptimizer) AllocateJobs(jobs []*ScheduledEmail) map[string]s
 		for _, prov := range w.cands {
 			cap := -1 // -1 means unlimited
 			if route != nil {
-				if v, ok := route.ProviderCapacities[prov]; ok && v > 0 {
+				if v, ok := providerMapValue(route.ProviderCapacities, prov); ok && v > 0 {
 					cap = v
 				}
 			}
 			if cap < 0 {
-				if ds, ok := providerDefaults[prov]; ok && ds.Capacity > 0 {
+				if ds, ok := lookupProviderDefaults(prov); ok && ds.Capacity > 0 {
 					cap = ds.Capacity
 				}
 			}
@@ -178,13 +175,13 @@ func (o *GreedyBatchOptimizer) AllocateJobs(jobs []*ScheduledEmail) map[string]s
 				best := eligible[0]
 				bestRem := remCap[best]
 				bestCost := 1.0
-				if ds, ok := providerDefaults[best]; ok && ds.Cost > 0 {
+				if ds, ok := lookupProviderDefaults(best); ok && ds.Cost > 0 {
 					bestCost = ds.Cost
 				}
 				for _, prov := range eligible[1:] {
 					rem := remCap[prov]
 					cost := 1.0
-					if ds, ok := providerDefaults[prov]; ok && ds.Cost > 0 {
+					if ds, ok := lookupProviderDefaults(prov); ok && ds.Cost > 0 {
 						cost = ds.Cost
 					}
 					if rem > bestRem || (rem == bestRem && cost < bestCost) {
@@ -200,7 +197,7 @@ func (o *GreedyBatchOptimizer) AllocateJobs(jobs []*ScheduledEmail) map[string]s
 			if len(w.cands) > 0 {
 				chosen = w.cands[0]
 			} else {
-				log.Printf("optimizer: no candidates for job %s", w.job.ID)
+				logger().Warn("optimizer: no candidates", "job_id", w.job.ID)
 				continue
 			}
 		}
@@ -209,13 +206,13 @@ func (o *GreedyBatchOptimizer) AllocateJobs(jobs []*ScheduledEmail) map[string]s
 			if len(w.cands) > 0 {
 				chosen = w.cands[0]
 			} else {
-				log.Printf("optimizer: no candidates for job %s", w.job.ID)
+				logger().Warn("optimizer: no candidates", "job_id", w.job.ID)
 				continue
 			}
 		}
 		assign[w.job.ID] = chosen
 		counts[chosen]++
-		log.Printf("optimizer: assigned job=%s provider=%s counts=%v", w.job.ID, chosen, counts)
+		logger().Debug("optimizer: assigned provider", "job_id", w.job.ID, "provider", chosen, "counts", counts)
 	}
 	return assign
 }
@@ -14,6 +14,9 @@ type placeholderMode int
 const (
 	placeholderModeInitial placeholderMode = iota
 	placeholderModePostFinalize
+	// placeholderModeSend is used right before sending; only then must
+	// attachment sources resolve, since they may reference run-time data.
+	placeholderModeSend
 )
 
 func normalizePlaceholderKey(key string) string {
@@ -82,6 +85,7 @@ func applyPlaceholders(cfg *EmailConfig, mode placeholderMode) error {
 			cfg.HTTPAuthQuery = strings.TrimSpace(resolver.expandString(cfg.HTTPAuthQuery))
 			cfg.HTTPAuthPrefix = strings.TrimSpace(resolver.expandString(cfg.HTTPAuthPrefix))
 			cfg.SMTPAuth = strings.ToLower(strings.TrimSpace(resolver.expandString(cfg.SMTPAuth)))
+			cfg.DSN.EnvID = strings.TrimSpace(resolver.expandString(cfg.DSN.EnvID))
 			cfg.AWSRegion = strings.TrimSpace(resolver.expandString(cfg.AWSRegion))
 			cfg.AWSAccessKey = strings.TrimSpace(resolver.expandString(cfg.AWSAccessKey))
 			cfg.AWSSecretKey = strings.TrimSpace(resolver.expandString(cfg.AWSSecretKey))
@@ -106,7 +110,13 @@ func applyPlaceholders(cfg *EmailConfig, mode placeholderMode) error {
 		cfg.QueryParams = resolver.expandMap(cfg.QueryParams)
 		cfg.HTTPPayload = resolver.expandObjectMap(cfg.HTTPPayload)
 		cfg.Tags = resolver.expandMap(cfg.Tags)
-		cfg.Attachments = resolver.expandAttachments(cfg.Attachments)
+		if mode == placeholderModeSend {
+			cfg.Attachments = resolver.expandAttachments(cfg.Attachments)
+		} else {
+			// Unresolved sources are not an error yet; parseConfig keeps the raw
+			// attachments and they are resolved again at send time.
+			cfg.Attachments = newPlaceholderResolver(cfg).expandAttachments(cfg.Attachments)
+		}
 
 		if err := resolver.Err(); err != nil {
 			// Allow missing {{step}} if a workflow is present; individual steps will provide it
@@ -138,16 +148,37 @@ func applyPlaceholders(cfg *EmailConfig, mode placeholderMode) error {
 
 type placeholderResolver struct {
 	values  map[string]string
+	data    map[string]any
 	missing map[string]struct{}
+	// noEnv leaves {{env.*}} unresolved for render-only configs.
+	noEnv bool
 }
 
 func newPlaceholderResolver(cfg *EmailConfig) *placeholderResolver {
 	return &placeholderResolver{
 		values:  buildPlaceholderValues(cfg),
+		data:    placeholderData(cfg),
 		missing: map[string]struct{}{},
+		noEnv:   cfg.renderOnly,
 	}
 }
 
+// placeholderData is the data blocks iterate over: template data overlaid
+// with AdditionalData.
+func placeholderData(cfg *EmailConfig) map[string]any {
+	if cfg.Template == nil || len(cfg.Template.Data) == 0 {
+		return cfg.AdditionalData
+	}
+	data := make(map[string]any, len(cfg.Template.Data)+len(cfg.AdditionalData))
+	for k, v := range cfg.Template.Data {
+		data[k] = v
+	}
+	for k, v := range cfg.AdditionalData {
+		data[k] = v
+	}
+	return data
+}
+
 func buildPlaceholderValues(cfg *EmailConfig) map[string]string {
 	values := map[string]string{}
 	now := time.Now()
@@ -189,6 +220,9 @@ func buildPlaceholderValues(cfg *EmailConfig) map[string]string {
 		sort.Strings(tagParts)
 		registerValue(values, strings.Join(tagParts, ";"), true, "tags", "ses_tags")
 	}
+	if cfg.Template != nil && cfg.Template.Data != nil {
+		flattenAdditionalData(values, cfg.Template.Data)
+	}
 	if cfg.AdditionalData != nil {
 		flattenAdditionalData(values, cfg.AdditionalData)
 	}
@@ -225,6 +259,9 @@ func (r *placeholderResolver) expandString(input string) string {
 		return input
 	}
 	result := input
+	if blockOpenPattern.MatchString(result) {
+		result = r.expandBlocks(result, nil, false)
+	}
 	for depth := 0; depth < placeholderMaxDepth; depth++ {
 		changed := false
 		result = placeholderPattern.ReplaceAllStringFunc(result, func(match string) string {
@@ -334,7 +371,7 @@ func (r *placeholderResolver) lookup(raw string) (string, bool) {
 	lower := strings.ToLower(key)
 	if strings.HasPrefix(lower, "env.") {
 		name := strings.TrimSpace(raw[len("env."):])
-		if name == "" {
+		if name == "" || r.noEnv {
 			return "", false
 		}
 		if value, ok := os.LookupEnv(name); ok {
@@ -363,6 +400,7 @@ func (r *placeholderResolver) logMissing(key string) {
 	if key == "" {
 		return
 	}
+	logger().Debug("placeholder missing", "placeholder", key)
 }
 
 func logPlaceholderResolved(key, value string) {
@@ -370,15 +408,21 @@ func logPlaceholderResolved(key, value string) {
 	if key == "" {
 		return
 	}
+	logger().Debug("placeholder resolved", "placeholder", key, "value", maskPlaceholderValue(key, value))
 }
 
-func maskPlaceholderValue(key, value string) string {
+// isSensitiveKey reports whether a setting, header or placeholder name
+// suggests a credential whose value must not be logged.
+func isSensitiveKey(key string) bool {
 	lower := strings.ToLower(key)
-	if lower == "" {
+	return strings.Contains(lower, "pass") || strings.Contains(lower, "pwd") || strings.Contains(lower, "secret") || strings.Contains(lower, "token") || strings.Contains(lower, "key") || strings.Contains(lower, "auth")
+}
+
+func maskPlaceholderValue(key, value string) string {
+	if key == "" {
 		return value
 	}
-	sensitive := strings.Contains(lower, "pass") || strings.Contains(lower, "pwd") || strings.Contains(lower, "secret") || strings.Contains(lower, "token") || strings.Contains(lower, "key") || strings.Contains(lower, "auth")
-	if sensitive {
+	if isSensitiveKey(key) {
 		if value == "" {
 			return "(empty)"
 		}
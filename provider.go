@@ -6,9 +6,11 @@ import (
 	"fmt"
 	"net/http"
 	"net/url"
+	"slices"
 	"sort"
 	"strings"
 	"sync"
+	"time"
 )
 
 // Provider defines the interface that all email providers must implement
@@ -37,6 +39,36 @@ type Provider interface {
 	ValidateConfig(cfg *EmailConfig) error
 }
 
+// BatchProvider is implemented by providers with a native batch endpoint that
+// accepts several messages, each with its own recipients, in one request.
+// Senders detect it with a type assertion and otherwise send one request per
+// message.
+type BatchProvider interface {
+	Provider
+
+	// BuildBatchPayload builds one request carrying every message in cfgs. It
+	// returns an error when the messages cannot share a request, e.g. because
+	// they differ in content the batch format cannot vary per message.
+	BuildBatchPayload(cfgs []*EmailConfig) (payload interface{}, contentType string, err error)
+
+	// BatchEndpoint returns the API endpoint for batch requests
+	BatchEndpoint(cfg *EmailConfig) string
+
+	// MaxBatchSize returns the most messages one batch request may carry
+	MaxBatchSize() int
+}
+
+// sameBatchContent reports whether a and b share the sender and content, so
+// they can go out as personalizations of one message.
+func sameBatchContent(a, b *EmailConfig) bool {
+	if a.From != b.From || a.TextBody != b.TextBody || a.HTMLBody != b.HTMLBody ||
+		!slices.Equal(a.ReplyTo, b.ReplyTo) || !slices.Equal(a.Attachments, b.Attachments) {
+		return false
+	}
+	ta, tb := providerTemplate(a), providerTemplate(b)
+	return (ta == nil) == (tb == nil) && (ta == nil || ta.Name() == tb.Name())
+}
+
 // SMTPConfig holds SMTP connection details
 type SMTPConfig struct {
 	Host   string
@@ -51,6 +83,7 @@ type ProviderMetadata struct {
 	Cost        float64 // Relative cost metric
 	Reliability float64 // Reliability score (0-1)
 	Priority    int     // Selection priority
+	Override    bool    // Replace a provider already registered under the same name
 }
 
 // ProviderRegistry manages all registered email providers
@@ -88,12 +121,45 @@ func (r *ProviderRegistry) Register(provider Provider, metadata ProviderMetadata
 	r.mu.Lock()
 	defer r.mu.Unlock()
 
+	if _, exists := r.providers[name]; exists && !metadata.Override {
+		return fmt.Errorf("provider %s already registered", name)
+	}
 	r.providers[name] = provider
 	r.metadata[name] = metadata
 
 	return nil
 }
 
+// swap unregisters the providers named in remove and registers providers in
+// one step, so lookups never see a partial set. A name registered outside
+// remove is only replaced when its metadata sets Override; otherwise nothing
+// changes and an error is returned.
+func (r *ProviderRegistry) swap(remove []string, providers []Provider, metadata []ProviderMetadata) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	removing := make(map[string]bool, len(remove))
+	for _, name := range remove {
+		removing[strings.ToLower(name)] = true
+	}
+	for i, provider := range providers {
+		name := strings.ToLower(provider.Name())
+		if _, exists := r.providers[name]; exists && !removing[name] && !metadata[i].Override {
+			return fmt.Errorf("provider %s already registered", name)
+		}
+	}
+	for name := range removing {
+		delete(r.providers, name)
+		delete(r.metadata, name)
+	}
+	for i, provider := range providers {
+		name := strings.ToLower(provider.Name())
+		r.providers[name] = provider
+		r.metadata[name] = metadata[i]
+	}
+	return nil
+}
+
 // Get retrieves a provider by name
 func (r *ProviderRegistry) Get(name string) (Provider, bool) {
 	r.mu.RLock()
@@ -141,6 +207,32 @@ func (r *ProviderRegistry) GetMetadata(name string) (ProviderMetadata, bool) {
 	return metadata, ok
 }
 
+// Info retrieves metadata for a provider, resolving aliases first
+func (r *ProviderRegistry) Info(name string) (ProviderMetadata, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	name = strings.ToLower(name)
+	if actual, ok := r.aliases[name]; ok {
+		name = actual
+	}
+	metadata, ok := r.metadata[name]
+	return metadata, ok
+}
+
+// Canonical resolves an alias to the provider name it points at. Names without
+// an alias are returned lowercased.
+func (r *ProviderRegistry) Canonical(name string) string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	name = strings.ToLower(strings.TrimSpace(name))
+	if actual, ok := r.aliases[name]; ok {
+		return actual
+	}
+	return name
+}
+
 // Global registry functions for convenience
 func RegisterProvider(provider Provider, metadata ProviderMetadata) error {
 	return globalRegistry.Register(provider, metadata)
@@ -158,6 +250,16 @@ func ListProviders() []string {
 	return globalRegistry.List()
 }
 
+func ProviderInfo(name string) (ProviderMetadata, bool) {
+	return globalRegistry.Info(name)
+}
+
+// canonicalProviderName maps provider aliases to their canonical name so
+// routing, defaults and usage counts agree on a single key.
+func canonicalProviderName(name string) string {
+	return globalRegistry.Canonical(name)
+}
+
 // BaseProvider provides common functionality for all providers
 type BaseProvider struct {
 	name      string
@@ -185,19 +287,45 @@ func (b *BaseProvider) GetSMTPConfig() *SMTPConfig {
 	return b.smtp
 }
 
+// ValidateConfig checks the fields every provider needs: a sender, at least
+// one recipient and a subject unless a provider template supplies it.
 func (b *BaseProvider) ValidateConfig(cfg *EmailConfig) error {
 	if cfg.From == "" {
 		return errors.New("from address is required")
 	}
-	if len(cfg.To) == 0 {
+	if !cfg.hasRecipients() {
 		return errors.New("at least one recipient is required")
 	}
-	if cfg.Subject == "" {
+	if cfg.Subject == "" && providerTemplate(cfg) == nil {
 		return errors.New("subject is required")
 	}
 	return nil
 }
 
+// requireAPIKey checks that cfg carries credentials for an API-key provider:
+// api_key or api_token, basic auth credentials when http_auth is "basic", or
+// the provider's auth header set directly. http_auth "none" skips the check,
+// and so does any transport but http: over SMTP the provider takes the SMTP
+// username and password.
+func requireAPIKey(cfg *EmailConfig, provider, header string) error {
+	if cfg.Transport != "http" {
+		return nil
+	}
+	if cfg.HTTPAuth == "none" || strings.TrimSpace(cfg.APIKey) != "" || strings.TrimSpace(cfg.APIToken) != "" {
+		return nil
+	}
+	if cfg.HTTPAuth == "basic" && (cfg.Username != "" || cfg.Password != "") {
+		return nil
+	}
+	for k, v := range cfg.Headers {
+		// Profile headers carry an unfilled ${API_KEY} placeholder.
+		if strings.EqualFold(k, header) && strings.TrimSpace(v) != "" && !strings.Contains(v, "${") {
+			return nil
+		}
+	}
+	return fmt.Errorf("%s requires an API key (api_key)", provider)
+}
+
 // HTTPProvider is a base for HTTP-based providers
 type HTTPProvider struct {
 	BaseProvider
@@ -262,6 +390,17 @@ func (s *SMTPProvider) GetEndpoint(cfg *EmailConfig) string {
 	return "" // SMTP doesn't use HTTP endpoints
 }
 
+// ValidateConfig also requires an SMTP host.
+func (s *SMTPProvider) ValidateConfig(cfg *EmailConfig) error {
+	if err := s.BaseProvider.ValidateConfig(cfg); err != nil {
+		return err
+	}
+	if cfg.Host == "" && (s.smtp == nil || s.smtp.Host == "") {
+		return fmt.Errorf("%s requires an SMTP host", s.name)
+	}
+	return nil
+}
+
 // ================= SPECIFIC PROVIDER IMPLEMENTATIONS =================
 
 // SendGridProvider implements SendGrid's API
@@ -281,6 +420,14 @@ func NewSendGridProvider() *SendGridProvider {
 	}
 }
 
+// ValidateConfig also requires a SendGrid API key.
+func (s *SendGridProvider) ValidateConfig(cfg *EmailConfig) error {
+	if err := s.HTTPProvider.ValidateConfig(cfg); err != nil {
+		return err
+	}
+	return requireAPIKey(cfg, "sendgrid", "Authorization")
+}
+
 func (s *SendGridProvider) BuildPayload(cfg *EmailConfig) (interface{}, string, error) {
 	personalization := map[string]interface{}{
 		"to": addressMaps(parseAddressList(cfg.To), "email", "name"),
@@ -298,21 +445,30 @@ func (s *SendGridProvider) BuildPayload(cfg *EmailConfig) (interface{}, string,
 	fromName, fromEmail := splitAddress(cfg.From)
 	fromEntry := singleAddressMap(simpleAddress{Name: fromName, Email: fromEmail}, "email", "name")
 
-	contents := make([]map[string]string, 0, 2)
-	if cfg.TextBody != "" {
-		contents = append(contents, map[string]string{"type": "text/plain", "value": cfg.TextBody})
-	}
-	if cfg.HTMLBody != "" {
-		contents = append(contents, map[string]string{"type": "text/html", "value": cfg.HTMLBody})
-	}
-	if len(contents) == 0 {
-		contents = append(contents, map[string]string{"type": "text/plain", "value": fallbackBody(cfg.TextBody)})
-	}
-
 	payload := map[string]interface{}{
 		"personalizations": []interface{}{personalization},
 		"from":             fromEntry,
-		"content":          contents,
+	}
+
+	// Dynamic templates supply the subject and content.
+	if tpl := providerTemplate(cfg); tpl != nil {
+		payload["template_id"] = tpl.Name()
+		delete(personalization, "subject")
+		if len(tpl.Data) > 0 {
+			personalization["dynamic_template_data"] = tpl.Data
+		}
+	} else {
+		contents := make([]map[string]string, 0, 2)
+		if cfg.TextBody != "" {
+			contents = append(contents, map[string]string{"type": "text/plain", "value": cfg.TextBody})
+		}
+		if cfg.HTMLBody != "" {
+			contents = append(contents, map[string]string{"type": "text/html", "value": cfg.HTMLBody})
+		}
+		if len(contents) == 0 {
+			contents = append(contents, map[string]string{"type": "text/plain", "value": fallbackBody(cfg.TextBody)})
+		}
+		payload["content"] = contents
 	}
 
 	if reply := firstAddressEntry(cfg.ReplyTo); reply.Email != "" {
@@ -323,7 +479,44 @@ func (s *SendGridProvider) BuildPayload(cfg *EmailConfig) (interface{}, string,
 		return nil, "", err
 	}
 
-	return mergeAdditional(payload, cfg.AdditionalData, true), "application/json", nil
+	return mergeAdditional(payload, withoutTemplateKeys(cfg.AdditionalData), true), "application/json", nil
+}
+
+// BuildBatchPayload sends each message as one personalization of a single
+// mail/send request. The messages must share sender and content; recipients,
+// subject and dynamic template data vary per personalization.
+func (s *SendGridProvider) BuildBatchPayload(cfgs []*EmailConfig) (interface{}, string, error) {
+	if len(cfgs) == 0 {
+		return nil, "", errors.New("sendgrid batch requires at least one message")
+	}
+	built, contentType, err := s.BuildPayload(cfgs[0])
+	if err != nil {
+		return nil, "", err
+	}
+	payload := built.(map[string]interface{})
+	personalizations := payload["personalizations"].([]interface{})
+	for i, cfg := range cfgs[1:] {
+		if !sameBatchContent(cfgs[0], cfg) {
+			return nil, "", fmt.Errorf("sendgrid batch: message %d differs in sender or content", i+1)
+		}
+		single, _, err := s.BuildPayload(cfg)
+		if err != nil {
+			return nil, "", err
+		}
+		personalizations = append(personalizations, single.(map[string]interface{})["personalizations"].([]interface{})...)
+	}
+	payload["personalizations"] = personalizations
+	return payload, contentType, nil
+}
+
+// BatchEndpoint returns the mail/send endpoint, which also takes batches.
+func (s *SendGridProvider) BatchEndpoint(cfg *EmailConfig) string {
+	return s.GetEndpoint(cfg)
+}
+
+// MaxBatchSize is SendGrid's personalization limit per request.
+func (s *SendGridProvider) MaxBatchSize() int {
+	return 1000
 }
 
 func (s *SendGridProvider) addAttachments(payload map[string]interface{}, cfg *EmailConfig) error {
@@ -369,6 +562,14 @@ func NewResendProvider() *ResendProvider {
 	}
 }
 
+// ValidateConfig also requires a Resend API key.
+func (r *ResendProvider) ValidateConfig(cfg *EmailConfig) error {
+	if err := r.HTTPProvider.ValidateConfig(cfg); err != nil {
+		return err
+	}
+	return requireAPIKey(cfg, "resend", "Authorization")
+}
+
 func (r *ResendProvider) BuildPayload(cfg *EmailConfig) (interface{}, string, error) {
 	payload := map[string]interface{}{
 		"from":    cfg.From,
@@ -439,11 +640,61 @@ func NewPostmarkProvider() *PostmarkProvider {
 	}
 }
 
+// ValidateConfig also requires a Postmark server token.
+func (p *PostmarkProvider) ValidateConfig(cfg *EmailConfig) error {
+	if err := p.HTTPProvider.ValidateConfig(cfg); err != nil {
+		return err
+	}
+	return requireAPIKey(cfg, "postmark", "X-Postmark-Server-Token")
+}
+
+func (p *PostmarkProvider) GetEndpoint(cfg *EmailConfig) string {
+	return postmarkEndpoint(cfg, p.HTTPProvider.GetEndpoint(cfg))
+}
+
+// postmarkEndpoint switches the /email endpoint to /email/withTemplate when
+// cfg uses a Postmark template.
+func postmarkEndpoint(cfg *EmailConfig, endpoint string) string {
+	if providerTemplate(cfg) == nil {
+		return endpoint
+	}
+	trimmed := strings.TrimRight(endpoint, "/")
+	if strings.HasSuffix(trimmed, "/email") {
+		return trimmed + "/withTemplate"
+	}
+	return endpoint
+}
+
 func (p *PostmarkProvider) BuildPayload(cfg *EmailConfig) (interface{}, string, error) {
 	payload := map[string]interface{}{
-		"From":    cfg.From,
-		"To":      strings.Join(cfg.To, ","),
-		"Subject": cfg.Subject,
+		"From": cfg.From,
+		"To":   strings.Join(cfg.To, ","),
+	}
+	if tpl := providerTemplate(cfg); tpl != nil {
+		// Postmark template IDs are numeric; anything else is an alias.
+		if id, ok := tpl.numericID(); ok && tpl.Alias == "" {
+			payload["TemplateId"] = id
+		} else if tpl.Alias != "" {
+			payload["TemplateAlias"] = tpl.Alias
+		} else {
+			payload["TemplateAlias"] = tpl.ID
+		}
+		model := tpl.Data
+		if model == nil {
+			model = map[string]any{}
+		}
+		payload["TemplateModel"] = model
+	} else {
+		payload["Subject"] = cfg.Subject
+		if cfg.TextBody != "" {
+			payload["TextBody"] = cfg.TextBody
+		}
+		if cfg.HTMLBody != "" {
+			payload["HtmlBody"] = cfg.HTMLBody
+		}
+		if cfg.TextBody == "" && cfg.HTMLBody == "" {
+			payload["TextBody"] = fallbackBody(cfg.TextBody)
+		}
 	}
 
 	if len(cfg.CC) > 0 {
@@ -452,15 +703,6 @@ func (p *PostmarkProvider) BuildPayload(cfg *EmailConfig) (interface{}, string,
 	if len(cfg.BCC) > 0 {
 		payload["Bcc"] = strings.Join(cfg.BCC, ",")
 	}
-	if cfg.TextBody != "" {
-		payload["TextBody"] = cfg.TextBody
-	}
-	if cfg.HTMLBody != "" {
-		payload["HtmlBody"] = cfg.HTMLBody
-	}
-	if cfg.TextBody == "" && cfg.HTMLBody == "" {
-		payload["TextBody"] = fallbackBody(cfg.TextBody)
-	}
 	if reply := firstAddressEntry(cfg.ReplyTo); reply.Email != "" {
 		payload["ReplyTo"] = reply.Email
 	}
@@ -517,6 +759,21 @@ func NewMailgunProvider() *MailgunProvider {
 	}
 }
 
+// ValidateConfig also requires a Mailgun API key and a sending domain, taken
+// from the "domain" data field, the endpoint or the sender address.
+func (m *MailgunProvider) ValidateConfig(cfg *EmailConfig) error {
+	if err := m.HTTPProvider.ValidateConfig(cfg); err != nil {
+		return err
+	}
+	if err := requireAPIKey(cfg, "mailgun", "Authorization"); err != nil {
+		return err
+	}
+	if m.extractDomain(cfg) == "" {
+		return errors.New("mailgun requires a sending domain (set domain or use a sender address with one)")
+	}
+	return nil
+}
+
 func (m *MailgunProvider) BuildPayload(cfg *EmailConfig) (interface{}, string, error) {
 	domain := m.extractDomain(cfg)
 	if domain == "" {
@@ -545,14 +802,23 @@ func (m *MailgunProvider) BuildPayload(cfg *EmailConfig) (interface{}, string, e
 	}
 
 	form.Set("subject", cfg.Subject)
-	if cfg.TextBody != "" {
-		form.Set("text", cfg.TextBody)
-	}
-	if cfg.HTMLBody != "" {
-		form.Set("html", cfg.HTMLBody)
-	}
-	if cfg.TextBody == "" && cfg.HTMLBody == "" {
-		form.Set("text", fallbackBody(cfg.TextBody))
+	if tpl := providerTemplate(cfg); tpl != nil {
+		form.Set("template", tpl.Name())
+		vars, err := tpl.dataJSON()
+		if err != nil {
+			return nil, "", err
+		}
+		form.Set("h:X-Mailgun-Variables", vars)
+	} else {
+		if cfg.TextBody != "" {
+			form.Set("text", cfg.TextBody)
+		}
+		if cfg.HTMLBody != "" {
+			form.Set("html", cfg.HTMLBody)
+		}
+		if cfg.TextBody == "" && cfg.HTMLBody == "" {
+			form.Set("text", fallbackBody(cfg.TextBody))
+		}
 	}
 
 	return form, "application/x-www-form-urlencoded", nil
@@ -605,29 +871,46 @@ func NewAWSProvider() *AWSProvider {
 	}
 }
 
+// ValidateConfig also requires an AWS region, given or inferred from the
+// endpoint, and access credentials for SigV4 signing over http. SMTP sends
+// authenticate with SMTP credentials, and a non-SigV4 http_auth (e.g. a
+// signing proxy with "none") skips the credential check.
+func (a *AWSProvider) ValidateConfig(cfg *EmailConfig) error {
+	if err := a.HTTPProvider.ValidateConfig(cfg); err != nil {
+		return err
+	}
+	if cfg.Transport != "http" || (cfg.HTTPAuth != "" && cfg.HTTPAuth != "aws_sigv4") {
+		return nil
+	}
+	if strings.TrimSpace(cfg.AWSRegion) == "" && inferAWSRegion(a.GetEndpoint(cfg)) == "" {
+		return errors.New("aws_ses requires a region (aws_region)")
+	}
+	if strings.TrimSpace(cfg.AWSAccessKey) == "" || strings.TrimSpace(cfg.AWSSecretKey) == "" {
+		return errors.New("aws_ses requires credentials (aws_access_key and aws_secret_key)")
+	}
+	return nil
+}
+
 func (a *AWSProvider) BuildPayload(cfg *EmailConfig) (interface{}, string, error) {
-	raw, err := buildMessage(cfg)
+	content, err := sesContent(cfg)
 	if err != nil {
 		return nil, "", err
 	}
 
+	// SES wants bare addresses here; display names stay in the raw headers.
 	dest := map[string][]string{}
-	if len(cfg.To) > 0 {
-		dest["ToAddresses"] = cfg.To
+	if to := addressEmails(cfg.To); len(to) > 0 {
+		dest["ToAddresses"] = to
 	}
-	if len(cfg.CC) > 0 {
-		dest["CcAddresses"] = cfg.CC
+	if cc := addressEmails(cfg.CC); len(cc) > 0 {
+		dest["CcAddresses"] = cc
 	}
-	if len(cfg.BCC) > 0 {
-		dest["BccAddresses"] = cfg.BCC
+	if bcc := addressEmails(cfg.BCC); len(bcc) > 0 {
+		dest["BccAddresses"] = bcc
 	}
 
 	payload := map[string]interface{}{
-		"Content": map[string]interface{}{
-			"Raw": map[string]string{
-				"Data": base64.StdEncoding.EncodeToString([]byte(raw)),
-			},
-		},
+		"Content": content,
 	}
 
 	if len(dest) > 0 {
@@ -652,6 +935,191 @@ func (a *AWSProvider) BuildPayload(cfg *EmailConfig) (interface{}, string, error
 	return payload, "application/json", nil
 }
 
+// sesContent builds the SES v2 Content block: a stored template when one is
+// configured, otherwise the raw MIME message.
+func sesContent(cfg *EmailConfig) (map[string]interface{}, error) {
+	if tpl := providerTemplate(cfg); tpl != nil {
+		data, err := tpl.dataJSON()
+		if err != nil {
+			return nil, err
+		}
+		return map[string]interface{}{
+			"Template": map[string]string{"TemplateName": tpl.Name(), "TemplateData": data},
+		}, nil
+	}
+	raw, err := composeMessage(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]interface{}{
+		"Raw": map[string]string{"Data": base64.StdEncoding.EncodeToString([]byte(raw))},
+	}, nil
+}
+
+// buildSESv1Payload builds a SES v1 query API SendRawEmail request. Every
+// recipient, Bcc included, is listed in Destinations because the raw message
+// does not carry a Bcc header.
+func buildSESv1Payload(cfg *EmailConfig) (any, string, error) {
+	raw, err := composeMessage(cfg)
+	if err != nil {
+		return nil, "", err
+	}
+	form := url.Values{}
+	form.Set("Action", "SendRawEmail")
+	form.Set("Version", "2010-12-01")
+	form.Set("RawMessage.Data", base64.StdEncoding.EncodeToString([]byte(raw)))
+	if cfg.From != "" {
+		form.Set("Source", cfg.From)
+	}
+	n := 0
+	for _, list := range [][]string{cfg.To, cfg.CC, cfg.BCC} {
+		for _, addr := range parseAddressList(list) {
+			n++
+			form.Set(fmt.Sprintf("Destinations.member.%d", n), addr.Email)
+		}
+	}
+	if cfg.ConfigurationSet != "" {
+		form.Set("ConfigurationSetName", cfg.ConfigurationSet)
+	}
+	names := make([]string, 0, len(cfg.Tags))
+	for k := range cfg.Tags {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	for i, name := range names {
+		form.Set(fmt.Sprintf("Tags.member.%d.Name", i+1), name)
+		form.Set(fmt.Sprintf("Tags.member.%d.Value", i+1), cfg.Tags[name])
+	}
+	return form, "application/x-www-form-urlencoded", nil
+}
+
+// SESBulkEntry is one destination of an SES bulk templated send. Data, when
+// set, replaces the template data for that destination.
+type SESBulkEntry struct {
+	To   []string
+	Data map[string]any
+}
+
+// BuildBulkPayload builds an SES v2 outbound-bulk-emails request sending cfg's
+// template to each entry. Bulk sends require a template.
+func (a *AWSProvider) BuildBulkPayload(cfg *EmailConfig, entries []SESBulkEntry) (map[string]interface{}, error) {
+	tpl := providerTemplate(cfg)
+	if tpl == nil {
+		return nil, errors.New("ses bulk send requires a template")
+	}
+	if len(entries) == 0 {
+		return nil, errors.New("ses bulk send requires at least one destination")
+	}
+	defaultData, err := tpl.dataJSON()
+	if err != nil {
+		return nil, err
+	}
+	bulk := make([]map[string]interface{}, 0, len(entries))
+	for _, entry := range entries {
+		item := map[string]interface{}{
+			"Destination": map[string][]string{"ToAddresses": addressEmails(entry.To)},
+		}
+		if len(entry.Data) > 0 {
+			data, err := (&Template{Data: entry.Data}).dataJSON()
+			if err != nil {
+				return nil, err
+			}
+			item["ReplacementEmailContent"] = map[string]interface{}{
+				"ReplacementTemplate": map[string]string{"ReplacementTemplateData": data},
+			}
+		}
+		bulk = append(bulk, item)
+	}
+	payload := map[string]interface{}{
+		"DefaultContent": map[string]interface{}{
+			"Template": map[string]string{"TemplateName": tpl.Name(), "TemplateData": defaultData},
+		},
+		"BulkEmailEntries": bulk,
+	}
+	if cfg.From != "" {
+		payload["FromEmailAddress"] = cfg.From
+	}
+	if cfg.ConfigurationSet != "" {
+		payload["ConfigurationSetName"] = cfg.ConfigurationSet
+	}
+	return payload, nil
+}
+
+// BuildBatchPayload sends the messages as entries of one SES v2 bulk request.
+// They must share the sender and stored template; each entry keeps its own
+// recipients and template data.
+func (a *AWSProvider) BuildBatchPayload(cfgs []*EmailConfig) (interface{}, string, error) {
+	if len(cfgs) == 0 {
+		return nil, "", errors.New("ses bulk send requires at least one destination")
+	}
+	entries := make([]SESBulkEntry, 0, len(cfgs))
+	for i, cfg := range cfgs {
+		if i > 0 && !sameBatchContent(cfgs[0], cfg) {
+			return nil, "", fmt.Errorf("ses batch: message %d differs in sender or template", i)
+		}
+		entry := SESBulkEntry{To: cfg.To}
+		if tpl := providerTemplate(cfg); tpl != nil {
+			entry.Data = tpl.Data
+		}
+		entries = append(entries, entry)
+	}
+	payload, err := a.BuildBulkPayload(cfgs[0], entries)
+	if err != nil {
+		return nil, "", err
+	}
+	return payload, "application/json", nil
+}
+
+// BatchEndpoint returns the outbound-bulk-emails endpoint.
+func (a *AWSProvider) BatchEndpoint(cfg *EmailConfig) string {
+	return sesBulkEndpoint(a.GetEndpoint(cfg))
+}
+
+// MaxBatchSize is the SES v2 limit on bulk entries per request.
+func (a *AWSProvider) MaxBatchSize() int {
+	return 50
+}
+
+// sesBulkEndpoint derives the bulk endpoint from an SES v2 endpoint.
+func sesBulkEndpoint(endpoint string) string {
+	trimmed := strings.TrimRight(endpoint, "/")
+	if strings.HasSuffix(trimmed, "/outbound-emails") {
+		return strings.TrimSuffix(trimmed, "/outbound-emails") + "/outbound-bulk-emails"
+	}
+	if !strings.Contains(trimmed, "/v2/") {
+		return trimmed + "/v2/email/outbound-bulk-emails"
+	}
+	return trimmed
+}
+
+// SendSESBulk sends cfg's template to every entry in one SES v2 bulk request,
+// signed with SigV4 like single SES sends.
+func SendSESBulk(cfg *EmailConfig, entries []SESBulkEntry) error {
+	provider := NewAWSProvider()
+	payload, err := provider.BuildBulkPayload(cfg, entries)
+	if err != nil {
+		return err
+	}
+	bulkCfg := *cfg
+	bulkCfg.Transport = "http"
+	bulkCfg.Endpoint = sesBulkEndpoint(provider.GetEndpoint(cfg))
+	bulkCfg.HTTPPayload = payload
+	bulkCfg.HTTPContentType = "application/json"
+	if bulkCfg.HTTPMethod == "" {
+		bulkCfg.HTTPMethod = http.MethodPost
+	}
+	if bulkCfg.HTTPAuth == "" {
+		bulkCfg.HTTPAuth = "aws_sigv4"
+	}
+	if bulkCfg.AWSRegion == "" {
+		bulkCfg.AWSRegion = inferAWSRegion(bulkCfg.Endpoint)
+	}
+	if bulkCfg.Timeout == 0 {
+		bulkCfg.Timeout = 30 * time.Second
+	}
+	return sendHTTPRequest(&bulkCfg)
+}
+
 // ProviderFactory creates providers from configuration
 type ProviderFactory struct {
 	constructors map[string]func() Provider
@@ -730,6 +1198,6 @@ type EncodedAttachment struct {
 }
 
 func buildMIMEMessage(cfg *EmailConfig) (interface{}, string, error) {
-	msg, err := buildMessage(cfg)
+	msg, err := composeMessage(cfg)
 	return msg, "message/rfc822", err
 }
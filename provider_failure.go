@@ -0,0 +1,61 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// ProviderFailure is the last error one provider returned before the send
+// moved on from it.
+type ProviderFailure struct {
+	Provider string
+	Err      error
+}
+
+// AllProvidersFailedFunc is called when a send gives up after every provider
+// it tried failed, with the failures in the order the providers were tried.
+type AllProvidersFailedFunc func(cfg *EmailConfig, failures []ProviderFailure)
+
+var (
+	allProvidersFailedMu    sync.RWMutex
+	allProvidersFailedHooks []AllProvidersFailedFunc
+)
+
+// OnAllProvidersFailed registers fn to run whenever a send exhausts its
+// providers (or its attempt budget) without delivering, e.g. to raise an
+// alert or hand the message to another channel.
+func OnAllProvidersFailed(fn AllProvidersFailedFunc) {
+	allProvidersFailedMu.Lock()
+	defer allProvidersFailedMu.Unlock()
+	allProvidersFailedHooks = append(allProvidersFailedHooks, fn)
+}
+
+func notifyAllProvidersFailed(cfg *EmailConfig, failures []ProviderFailure) {
+	if len(failures) == 0 {
+		return
+	}
+	allProvidersFailedMu.RLock()
+	hooks := append([]AllProvidersFailedFunc(nil), allProvidersFailedHooks...)
+	allProvidersFailedMu.RUnlock()
+	for _, fn := range hooks {
+		fn(cfg, failures)
+	}
+}
+
+// providerFailuresError reports why a send failed. A single provider's error
+// is returned as is; several are joined, each prefixed with its provider, so
+// errors.Is and errors.As still see every one.
+func providerFailuresError(failures []ProviderFailure) error {
+	switch len(failures) {
+	case 0:
+		return nil
+	case 1:
+		return failures[0].Err
+	}
+	errs := make([]error, 0, len(failures))
+	for _, f := range failures {
+		errs = append(errs, fmt.Errorf("%s: %w", f.Provider, f.Err))
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,446 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestProviderRegistry_RegisterListAndInfo(t *testing.T) {
+	r := NewProviderRegistry()
+	if err := r.Register(NewBrevoProvider(), ProviderMetadata{Capacity: 300, Cost: 0.4, Reliability: 0.98}); err != nil {
+		t.Fatalf("register failed: %v", err)
+	}
+	if err := r.Register(NewMailjetProvider(), ProviderMetadata{Capacity: 200}); err != nil {
+		t.Fatalf("register failed: %v", err)
+	}
+	r.RegisterAlias("brevo", "sendinblue")
+
+	names := r.List()
+	if len(names) != 2 || names[0] != "brevo" || names[1] != "mailjet" {
+		t.Fatalf("unexpected provider list %v", names)
+	}
+	if p, ok := r.Get("sendinblue"); !ok || p.Name() != "brevo" {
+		t.Fatalf("alias sendinblue should resolve to brevo, got %v %v", p, ok)
+	}
+	meta, ok := r.Info("SendInBlue")
+	if !ok || meta.Capacity != 300 {
+		t.Fatalf("expected brevo metadata via alias, got %+v %v", meta, ok)
+	}
+	if _, ok := r.Info("unknown"); ok {
+		t.Fatalf("expected no metadata for unknown provider")
+	}
+}
+
+func TestProviderRegistry_DuplicateRequiresOverride(t *testing.T) {
+	r := NewProviderRegistry()
+	if err := r.Register(NewBrevoProvider(), ProviderMetadata{Capacity: 1}); err != nil {
+		t.Fatalf("register failed: %v", err)
+	}
+	if err := r.Register(NewBrevoProvider(), ProviderMetadata{Capacity: 2}); err == nil {
+		t.Fatalf("expected duplicate registration to fail")
+	}
+	if err := r.Register(NewBrevoProvider(), ProviderMetadata{Capacity: 3, Override: true}); err != nil {
+		t.Fatalf("override registration failed: %v", err)
+	}
+	if meta, _ := r.Info("brevo"); meta.Capacity != 3 {
+		t.Fatalf("expected overridden metadata, got %+v", meta)
+	}
+}
+
+func TestGlobalRegistry_DefaultProviders(t *testing.T) {
+	found := map[string]bool{}
+	for _, name := range ListProviders() {
+		found[name] = true
+	}
+	for _, name := range []string{"sendgrid", "aws_ses", "gmail", "mailhog"} {
+		if !found[name] {
+			t.Fatalf("expected %s in ListProviders, got %v", name, ListProviders())
+		}
+	}
+	if meta, ok := ProviderInfo("ses"); !ok || meta.Capacity != 5000 {
+		t.Fatalf("expected aws_ses metadata via ses alias, got %+v %v", meta, ok)
+	}
+}
+
+func TestApplyProviderSendDefaults_ReplyToAndFromName(t *testing.T) {
+	RegisterProviderDefault("shared_account", ProviderSetting{Host: "smtp.shared.example", Port: 587, DefaultReplyTo: "support@example.com", DefaultFromName: "Example Team"})
+	defer delete(providerDefaults, "shared_account")
+
+	cfg := &EmailConfig{Provider: "shared_account"}
+	applyProviderSendDefaults(cfg)
+	if len(cfg.ReplyTo) != 1 || cfg.ReplyTo[0] != "support@example.com" || cfg.FromName != "Example Team" {
+		t.Fatalf("expected provider defaults to fill reply-to/from-name, got %v / %q", cfg.ReplyTo, cfg.FromName)
+	}
+
+	explicit := &EmailConfig{Provider: "shared_account", ReplyTo: []string{"me@example.com"}, FromName: "Me"}
+	applyProviderSendDefaults(explicit)
+	if len(explicit.ReplyTo) != 1 || explicit.ReplyTo[0] != "me@example.com" || explicit.FromName != "Me" {
+		t.Fatalf("provider defaults must not override explicit values, got %v / %q", explicit.ReplyTo, explicit.FromName)
+	}
+}
+
+func TestMailjetProvider_SandboxAndCustomID(t *testing.T) {
+	cfg := &EmailConfig{
+		From:           "Team <team@example.com>",
+		To:             []string{"user@example.com"},
+		Subject:        "hi",
+		TextBody:       "body",
+		SandboxMode:    true,
+		AdditionalData: map[string]any{"custom_id": "order-42", "event_payload": map[string]any{"order": 42}},
+	}
+	payload, _, err := NewMailjetProvider().BuildPayload(cfg)
+	if err != nil {
+		t.Fatalf("BuildPayload: %v", err)
+	}
+	p := payload.(map[string]interface{})
+	if p["SandboxMode"] != true {
+		t.Fatalf("expected SandboxMode in payload, got %v", p)
+	}
+	msg := p["Messages"].([]interface{})[0].(map[string]interface{})
+	if msg["CustomID"] != "order-42" || msg["EventPayload"] != `{"order":42}` {
+		t.Fatalf("expected CustomID and EventPayload on the message, got %v", msg)
+	}
+
+	cfg.SandboxMode = false
+	cfg.AdditionalData = nil
+	payload, _, _ = NewMailjetProvider().BuildPayload(cfg)
+	p = payload.(map[string]interface{})
+	msg = p["Messages"].([]interface{})[0].(map[string]interface{})
+	if _, ok := p["SandboxMode"]; ok {
+		t.Fatalf("SandboxMode should be omitted when disabled")
+	}
+	if _, ok := msg["CustomID"]; ok {
+		t.Fatalf("CustomID should be omitted when not provided")
+	}
+}
+
+func TestSparkPostProvider_TransmissionOptions(t *testing.T) {
+	cfg := &EmailConfig{
+		From:        "team@example.com",
+		To:          []string{"user@example.com"},
+		Subject:     "hi",
+		TextBody:    "body",
+		CampaignID:  "spring-launch",
+		SandboxMode: true,
+		AdditionalData: map[string]any{
+			"open_tracking":     true,
+			"click_tracking":    "false",
+			"transactional":     true,
+			"substitution_data": map[string]any{"first_name": "Ada"},
+		},
+	}
+	payload, _, err := NewSparkPostProvider().BuildPayload(cfg)
+	if err != nil {
+		t.Fatalf("BuildPayload: %v", err)
+	}
+	p := payload.(map[string]interface{})
+	opts, ok := p["options"].(map[string]interface{})
+	if !ok {
+		t.Fatalf("expected options in payload, got %v", p)
+	}
+	if opts["open_tracking"] != true || opts["click_tracking"] != false || opts["transactional"] != true || opts["sandbox"] != true {
+		t.Fatalf("unexpected options %v", opts)
+	}
+	if p["campaign_id"] != "spring-launch" {
+		t.Fatalf("expected campaign_id, got %v", p["campaign_id"])
+	}
+	if subs, _ := p["substitution_data"].(map[string]any); subs["first_name"] != "Ada" {
+		t.Fatalf("expected substitution_data, got %v", p["substitution_data"])
+	}
+
+	plain, _, _ := NewSparkPostProvider().BuildPayload(&EmailConfig{From: "team@example.com", To: []string{"user@example.com"}})
+	if _, ok := plain.(map[string]interface{})["options"]; ok {
+		t.Fatalf("options should be omitted when nothing is configured")
+	}
+}
+
+func TestBrevoProvider_TemplateParams(t *testing.T) {
+	cfg := &EmailConfig{
+		From:     "Team <team@example.com>",
+		To:       []string{"user@example.com"},
+		Subject:  "ignored",
+		HTMLBody: "<p>ignored</p>",
+		TextBody: "ignored",
+		Tags:     map[string]string{"welcome": "", "campaign": "spring"},
+		Headers:  map[string]string{"X-Mailin-custom": "order-42", "api-key": "secret"},
+		AdditionalData: map[string]any{
+			"template_id": "12",
+			"params":      map[string]any{"first_name": "Ada"},
+		},
+	}
+	payload, _, err := NewBrevoProvider().BuildPayload(cfg)
+	if err != nil {
+		t.Fatalf("BuildPayload: %v", err)
+	}
+	p := payload.(map[string]any)
+	if p["templateId"] != 12 {
+		t.Fatalf("expected templateId 12, got %v", p["templateId"])
+	}
+	if params, _ := p["params"].(map[string]any); params["first_name"] != "Ada" {
+		t.Fatalf("expected params, got %v", p["params"])
+	}
+	for _, key := range []string{"subject", "htmlContent", "textContent", "template_id"} {
+		if _, ok := p[key]; ok {
+			t.Fatalf("template payload should not include %q: %v", key, p)
+		}
+	}
+	if tags, _ := p["tags"].([]string); len(tags) != 2 || tags[0] != "campaign=spring" || tags[1] != "welcome" {
+		t.Fatalf("unexpected tags %v", p["tags"])
+	}
+	if headers, _ := p["headers"].(map[string]string); len(headers) != 1 || headers["X-Mailin-custom"] != "order-42" {
+		t.Fatalf("expected headers, got %v", p["headers"])
+	}
+
+	cfg.AdditionalData = nil
+	payload, _, _ = NewBrevoProvider().BuildPayload(cfg)
+	p = payload.(map[string]any)
+	if p["subject"] != "ignored" || p["htmlContent"] == nil || p["templateId"] != nil {
+		t.Fatalf("expected inline content without a template, got %v", p)
+	}
+}
+
+func TestPostmarkProvider_Template(t *testing.T) {
+	cfg := &EmailConfig{
+		From:     "team@example.com",
+		To:       []string{"user@example.com"},
+		Subject:  "ignored",
+		HTMLBody: "<p>ignored</p>",
+		AdditionalData: map[string]any{
+			"template_alias": "welcome",
+			"template_model": map[string]any{"name": "Ada"},
+		},
+	}
+	p := NewPostmarkProvider()
+	if got := p.GetEndpoint(cfg); got != "https://api.postmarkapp.com/email/withTemplate" {
+		t.Fatalf("unexpected template endpoint %q", got)
+	}
+	payload, _, err := p.BuildPayload(cfg)
+	if err != nil {
+		t.Fatalf("BuildPayload: %v", err)
+	}
+	m := payload.(map[string]interface{})
+	if m["TemplateAlias"] != "welcome" {
+		t.Fatalf("expected TemplateAlias, got %v", m)
+	}
+	if model, _ := m["TemplateModel"].(map[string]any); model["name"] != "Ada" {
+		t.Fatalf("expected TemplateModel, got %v", m["TemplateModel"])
+	}
+	for _, key := range []string{"Subject", "HtmlBody", "TextBody"} {
+		if _, ok := m[key]; ok {
+			t.Fatalf("template payload should omit %s: %v", key, m)
+		}
+	}
+
+	byID := &EmailConfig{From: "team@example.com", To: []string{"user@example.com"}, AdditionalData: map[string]any{"template_id": float64(1234)}}
+	payload, _, _ = p.BuildPayload(byID)
+	if m := payload.(map[string]interface{}); m["TemplateId"] != 1234 {
+		t.Fatalf("expected TemplateId 1234, got %v", m)
+	}
+
+	plain := &EmailConfig{From: "team@example.com", To: []string{"user@example.com"}, Subject: "hi", TextBody: "body"}
+	if got := p.GetEndpoint(plain); got != "https://api.postmarkapp.com/email" {
+		t.Fatalf("plain sends should keep the /email endpoint, got %q", got)
+	}
+}
+
+func TestSendViaHTTP_PostmarkTemplateEndpoint(t *testing.T) {
+	var path string
+	var body map[string]any
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path = r.URL.Path
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+	cfg := &EmailConfig{
+		Provider:       "postmark",
+		Endpoint:       srv.URL + "/email",
+		APIKey:         "token",
+		From:           "team@example.com",
+		To:             []string{"user@example.com"},
+		Subject:        "ignored",
+		TextBody:       "ignored",
+		Timeout:        2 * time.Second,
+		AdditionalData: map[string]any{"template_alias": "welcome"},
+	}
+	applyHTTPProfile(cfg)
+	if err := sendViaHTTP(cfg); err != nil {
+		t.Fatalf("send: %v", err)
+	}
+	if path != "/email/withTemplate" || body["TemplateAlias"] != "welcome" || body["Subject"] != nil {
+		t.Fatalf("expected template send to /email/withTemplate, got %s %v", path, body)
+	}
+}
+
+func TestGetData_NestedPaths(t *testing.T) {
+	cfg := &EmailConfig{AdditionalData: map[string]any{
+		"user":        map[string]any{"profile": map[string]any{"id": float64(42)}, "roles": []any{"admin", "editor"}},
+		"flat.dotted": "literal",
+	}}
+	cases := map[string]any{
+		"user.profile.id": float64(42),
+		"user.roles.1":    "editor",
+		"flat.dotted":     "literal",
+	}
+	for path, want := range cases {
+		if got, ok := GetData(cfg, path); !ok || got != want {
+			t.Fatalf("GetData(%q) = %v, %v; want %v", path, got, ok, want)
+		}
+	}
+	for _, path := range []string{"user.profile.email", "user.roles.5", "user.profile.id.deeper", "missing"} {
+		if got, ok := GetData(cfg, path); ok {
+			t.Fatalf("GetData(%q) should be missing, got %v", path, got)
+		}
+	}
+
+	tr := &MappingTransformer{Mapping: JSONMapping{Custom: map[string]string{"user.profile.id": "user_id", "user.profile.email": "email"}}}
+	payload, err := tr.Transform(cfg)
+	if err != nil {
+		t.Fatalf("transform: %v", err)
+	}
+	if payload["user_id"] != float64(42) {
+		t.Fatalf("expected nested source resolved, got %v", payload)
+	}
+	if _, ok := payload["email"]; ok {
+		t.Fatalf("missing source path should be omitted, got %v", payload)
+	}
+}
+
+func TestMappingTransformer_NestedTargets(t *testing.T) {
+	cfg := &EmailConfig{
+		From:           "sender@example.com",
+		To:             []string{"user@example.com"},
+		Subject:        "Hello",
+		TextBody:       "Hi there",
+		AdditionalData: map[string]any{"user_id": "u-1", "account": map[string]any{"plan": "pro"}},
+	}
+	p := NewGenericJSONProvider("nested", "https://api.example.com/send", nil, JSONMapping{
+		From:     "message.from",
+		To:       "message.to",
+		ToArray:  true,
+		Subject:  "message.subject",
+		TextBody: "message.body.text",
+		Custom:   map[string]string{"user_id": "message.metadata.user_id", "account.plan": "message.metadata.plan"},
+	})
+	payload, _, err := p.BuildPayload(cfg)
+	if err != nil {
+		t.Fatalf("build payload: %v", err)
+	}
+	raw, _ := json.Marshal(payload)
+	want := `{"message":{"body":{"text":"Hi there"},"from":"sender@example.com","metadata":{"plan":"pro","user_id":"u-1"},"subject":"Hello","to":["user@example.com"]}}`
+	if string(raw) != want {
+		t.Fatalf("unexpected payload\n got %s\nwant %s", raw, want)
+	}
+
+	conflict := &MappingTransformer{Mapping: JSONMapping{Subject: "message", Custom: map[string]string{"user_id": "message.user_id"}}}
+	if _, err := conflict.Transform(cfg); err == nil {
+		t.Fatalf("expected an error when a path runs through a non-object value")
+	}
+}
+
+func TestLoadProvidersFromJSON_ValidatesRequiredFields(t *testing.T) {
+	data := []byte(`[
+		{"name": "relay_missing_host", "type": "smtp", "smtp": {"Port": 587}},
+		{"name": "api_missing_mapping", "type": "generic", "endpoint": "https://api.example.com/send"},
+		{"name": "valid_relay", "type": "smtp", "smtp": {"Host": "smtp.example.com", "Port": 587}}
+	]`)
+	err := LoadProvidersFromJSON(data)
+	if err == nil {
+		t.Fatal("expected validation errors")
+	}
+	for _, want := range []string{`"relay_missing_host"`, "smtp.host is required", `"api_missing_mapping"`, "mapping is required"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Fatalf("expected %q in %v", want, err)
+		}
+	}
+	if _, ok := GetProvider("valid_relay"); ok {
+		t.Fatal("no provider should be registered when any config is invalid")
+	}
+
+	_, err = LoadProviderFromConfig(ProviderConfig{Type: "http", Mapping: &JSONMapping{}})
+	if err == nil || !strings.Contains(err.Error(), "name is required") || !strings.Contains(err.Error(), "endpoint is required") || !strings.Contains(err.Error(), "mapping.to is required") {
+		t.Fatalf("expected aggregated field errors, got %v", err)
+	}
+}
+
+func TestProviderValidateConfig_MissingCredentials(t *testing.T) {
+	base := func() *EmailConfig {
+		return &EmailConfig{From: "sender@example.com", To: []string{"user@example.com"}, Subject: "Hi", Transport: "http"}
+	}
+	cases := []struct {
+		name     string
+		provider Provider
+		mutate   func(*EmailConfig)
+		want     string
+	}{
+		{"sendgrid", NewSendGridProvider(), nil, "sendgrid requires an API key"},
+		{"resend", NewResendProvider(), nil, "resend requires an API key"},
+		{"postmark", NewPostmarkProvider(), nil, "postmark requires an API key"},
+		{"brevo", NewBrevoProvider(), nil, "brevo requires an API key"},
+		{"mailjet", NewMailjetProvider(), nil, "mailjet requires an API key"},
+		{"sparkpost", NewSparkPostProvider(), nil, "sparkpost requires an API key"},
+		{"mailtrap", NewMailtrapProvider(), nil, "mailtrap requires an API key"},
+		{"mailgun key", NewMailgunProvider(), nil, "mailgun requires an API key"},
+		{"mailgun domain", NewMailgunProvider(), func(c *EmailConfig) { c.APIKey, c.From = "key", "sender" }, "mailgun requires a sending domain"},
+		{"ses region", NewAWSProvider(), func(c *EmailConfig) { c.Endpoint = "https://ses.example.com/send" }, "aws_ses requires a region"},
+		{"ses credentials", NewAWSProvider(), func(c *EmailConfig) { c.AWSRegion, c.AWSAccessKey = "eu-west-1", "AKIDEXAMPLE" }, "aws_ses requires credentials"},
+		{"smtp host", NewSMTPProvider("relay", "", 587, true, false), nil, "relay requires an SMTP host"},
+		{"generic endpoint", NewGenericJSONProvider("custom", "", nil, JSONMapping{To: "to"}), nil, "custom requires an endpoint"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg := base()
+			if tc.mutate != nil {
+				tc.mutate(cfg)
+			}
+			err := tc.provider.ValidateConfig(cfg)
+			if err == nil || !strings.Contains(err.Error(), tc.want) {
+				t.Fatalf("expected %q, got %v", tc.want, err)
+			}
+		})
+	}
+
+	cfg := base()
+	cfg.Headers = map[string]string{"authorization": "Bearer from-header"}
+	if err := NewSendGridProvider().ValidateConfig(cfg); err != nil {
+		t.Fatalf("an explicit auth header should satisfy the key check: %v", err)
+	}
+}
+
+func TestConfigForProvider_SMTPCredentialsSkipAPIChecks(t *testing.T) {
+	for _, provider := range []string{"sendgrid", "postmark", "mailgun", "aws_ses"} {
+		cfg, err := parseConfig(map[string]any{
+			"provider": provider, "transport": "smtp", "host": "smtp.example.com", "port": 587,
+			"username": "apikey", "password": "smtp-secret",
+			"from": "sender@example.com", "to": "user@example.com", "subject": "Hi",
+		})
+		if err != nil {
+			t.Fatalf("%s: parseConfig: %v", provider, err)
+		}
+		if _, err := configForProvider(cfg, provider); err != nil {
+			t.Fatalf("%s over smtp with smtp credentials should validate, got %v", provider, err)
+		}
+	}
+}
+
+func TestSendEmail_ProviderValidationFailsBeforeRequest(t *testing.T) {
+	defer withTempSendLog(t)()
+	requests := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { requests++ }))
+	defer srv.Close()
+	cfg := &EmailConfig{
+		From: "sender@example.com", To: []string{"user@example.com"}, Subject: "Hi", TextBody: "hello",
+		Provider: "sendgrid", Transport: "http", Endpoint: srv.URL, RetryCount: 2,
+	}
+	err := sendEmail(cfg, nil)
+	if err == nil || !strings.Contains(err.Error(), "sendgrid requires an API key") {
+		t.Fatalf("expected a missing API key error, got %v", err)
+	}
+	if requests != 0 {
+		t.Fatalf("no request should be sent, got %d", requests)
+	}
+}
@@ -1,8 +1,12 @@
 package main
 
 import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 )
@@ -253,3 +257,445 @@ func TestResolveProviders_NoMatchFallback(t *testing.T) {
 		}
 	}
 }
+
+func TestResolveProviders_AliasUsesCanonicalProvider(t *testing.T) {
+	RegisterAlias("sendgrid", "sg_alias")
+	defer withTempSendLog(t)()
+	// usage is recorded under the canonical name; the route refers to the alias
+	now := time.Now().UTC()
+	entries := []string{
+		`{"timestamp":"` + now.Format(time.RFC3339) + `","attempt":1,"provider":"sendgrid","success":true,"recipients":["user@gmail.com"]}`,
+		`{"timestamp":"` + now.Format(time.RFC3339) + `","attempt":1,"provider":"sg_alias","success":true,"recipients":["user@gmail.com"]}`,
+	}
+	if err := os.WriteFile(sendLogFile, []byte(strings.Join(entries, "\n")+"\n"), 0o644); err != nil {
+		t.Fatalf("cannot write test log: %v", err)
+	}
+	cfg := &EmailConfig{
+		To:       []string{"user@gmail.com"},
+		Provider: "smtp",
+		ProviderRoutes: []ProviderRoute{
+			{ToDomains: []string{"gmail.com"}, ProviderPriority: []string{"sg_alias", "smtp"}},
+		},
+	}
+	got := resolveProviders(cfg)
+	exp := []string{"smtp", "sendgrid"}
+	if len(got) != len(exp) || got[0] != exp[0] || got[1] != exp[1] {
+		t.Fatalf("expected %v got %v", exp, got)
+	}
+
+	aliased := &EmailConfig{Provider: "sg_alias"}
+	applyProviderDefaults(aliased)
+	if aliased.Host != providerDefaults["sendgrid"].Host {
+		t.Fatalf("expected sendgrid defaults via alias, got host %q", aliased.Host)
+	}
+}
+
+func TestResolveProviders_CostReliabilitySelection(t *testing.T) {
+	defer withTempSendLog(t)()
+	RegisterProvider(NewSMTPProvider("cheap_flaky", "flaky.example.com", 25, false, false), ProviderMetadata{Cost: 0.1, Reliability: 0.05, Override: true})
+	RegisterProvider(NewSMTPProvider("solid", "solid.example.com", 25, false, false), ProviderMetadata{Cost: 0.3, Reliability: 0.99, Override: true})
+	t.Cleanup(func() { globalRegistry.swap([]string{"cheap_flaky", "solid"}, nil, nil) })
+	cfg := &EmailConfig{
+		To:       []string{"user@gmail.com"},
+		Provider: "smtp",
+		ProviderRoutes: []ProviderRoute{
+			{ToDomains: []string{"gmail.com"}, ProviderPriority: []string{"cheap_flaky", "solid"}, Selection: "cost_reliability"},
+		},
+	}
+	got := resolveProviders(cfg)
+	if got[0] != "solid" {
+		t.Fatalf("expected reliable provider first, got %v", got)
+	}
+}
+
+func TestParseConfig_RouteFormsReadSameKeys(t *testing.T) {
+	route := map[string]any{
+		"to_domain":           "gmail.com",
+		"provider_priority":   []any{"sendgrid", "smtp"},
+		"selection":           "cost_reliability",
+		"recency_half_life":   "2h",
+		"provider_capacities": map[string]any{"sendgrid": 100},
+		"provider_costs":      map[string]any{"smtp": 0.5},
+	}
+	for name, routes := range map[string]any{"array": []any{route}, "object": route} {
+		cfg, err := parseConfig(map[string]any{"host": "smtp.example.com", "from": "a@example.com", "to": "b@gmail.com", "routes": routes})
+		if err != nil {
+			t.Fatalf("%s: parseConfig: %v", name, err)
+		}
+		if len(cfg.ProviderRoutes) != 1 {
+			t.Fatalf("%s: expected one route, got %d", name, len(cfg.ProviderRoutes))
+		}
+		r := cfg.ProviderRoutes[0]
+		if r.Selection != "cost_reliability" || r.RecencyHalfLife != 2*time.Hour || r.ProviderCapacities["sendgrid"] != 100 || r.ProviderCostOverrides["smtp"] != 0.5 {
+			t.Fatalf("%s: unexpected route %+v", name, r)
+		}
+	}
+}
+
+func TestSendEmail_RouteHeadersOnlyForChosenProvider(t *testing.T) {
+	defer withTempSendLog(t)()
+	srv := newStubSMTPServer(t)
+	cfg := srv.config()
+	cfg.Provider = "smtp"
+	cfg.Headers = map[string]string{"X-Campaign": "user-set"}
+	cfg.ProviderRoutes = []ProviderRoute{{
+		ToDomains: []string{"example.com"},
+		Provider:  "smtp",
+		ProviderHeaders: map[string]map[string]string{
+			"smtp":     {"X-Relay-Route": "primary", "x-campaign": "route"},
+			"sendgrid": {"X-SMTPAPI": `{"category":["news"]}`},
+		},
+	}}
+	if err := sendEmail(cfg, nil); err != nil {
+		t.Fatalf("sendEmail: %v", err)
+	}
+	msgs := srv.Messages()
+	if len(msgs) != 1 {
+		t.Fatalf("expected one message, got %d", len(msgs))
+	}
+	if !strings.Contains(msgs[0], "X-Relay-Route: primary\r\n") {
+		t.Fatalf("expected route header for the chosen provider, got %q", msgs[0])
+	}
+	if strings.Contains(msgs[0], "X-SMTPAPI") {
+		t.Fatalf("header for another provider leaked into the message")
+	}
+	if !strings.Contains(msgs[0], "X-Campaign: user-set\r\n") || strings.Contains(msgs[0], "X-Campaign: route") {
+		t.Fatalf("route header overrode an explicit header: %q", msgs[0])
+	}
+	if len(cfg.Headers) != 1 {
+		t.Fatalf("provider headers mutated the caller's config: %v", cfg.Headers)
+	}
+}
+
+func TestApplyProviderHeaders_ProviderSetting(t *testing.T) {
+	RegisterProviderDefault("test_relay", ProviderSetting{Headers: map[string]string{"X-MC-Tags": "welcome"}})
+	defer delete(providerDefaults, "test_relay")
+
+	cfg := &EmailConfig{Provider: "test_relay"}
+	applyProviderHeaders(cfg)
+	if cfg.Headers["X-MC-Tags"] != "welcome" {
+		t.Fatalf("expected provider setting header, got %v", cfg.Headers)
+	}
+	other := &EmailConfig{Provider: "smtp"}
+	applyProviderHeaders(other)
+	if _, ok := other.Headers["X-MC-Tags"]; ok {
+		t.Fatalf("provider header applied to a different provider")
+	}
+}
+
+func TestSendEmail_PerProviderTimeout(t *testing.T) {
+	defer withTempSendLog(t)()
+	var mu sync.Mutex
+	var paths []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		paths = append(paths, r.URL.Path)
+		mu.Unlock()
+		time.Sleep(200 * time.Millisecond)
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer srv.Close()
+	RegisterProviderDefault("fast_primary", ProviderSetting{Transport: "http", Endpoint: srv.URL + "/primary", Timeout: 50 * time.Millisecond})
+	RegisterProviderDefault("slow_fallback", ProviderSetting{Transport: "http", Endpoint: srv.URL + "/fallback", Timeout: 2 * time.Second})
+	defer delete(providerDefaults, "fast_primary")
+	defer delete(providerDefaults, "slow_fallback")
+
+	for name, want := range map[string]time.Duration{"fast_primary": 50 * time.Millisecond, "slow_fallback": 2 * time.Second} {
+		cfg, err := configForProvider(&EmailConfig{From: "sender@example.com", To: []string{"user@example.com"}, Timeout: 30 * time.Second}, name)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if got := getHTTPClient(&cfg).Timeout; got != want {
+			t.Fatalf("%s: expected client timeout %v, got %v", name, want, got)
+		}
+	}
+
+	cfg := &EmailConfig{
+		ProviderPriority: []string{"fast_primary", "slow_fallback"},
+		HTTPMethod:       http.MethodPost,
+		From:             "sender@example.com",
+		To:               []string{"user@example.com"},
+		Subject:          "hi",
+		TextBody:         "body",
+		RetryCount:       1,
+	}
+	if err := sendEmail(cfg, nil); err != nil {
+		t.Fatalf("expected fallback within its longer timeout to succeed, got %v", err)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(paths) != 2 || paths[0] != "/primary" || paths[1] != "/fallback" {
+		t.Fatalf("expected primary timeout then fallback, got %v", paths)
+	}
+}
+
+func TestConfigForProvider_FallbackKeepsUserTimeout(t *testing.T) {
+	RegisterProviderDefault("timed_primary", ProviderSetting{Transport: "http", Endpoint: "https://primary.example/send", Timeout: 50 * time.Millisecond})
+	RegisterProviderDefault("untimed_fallback", ProviderSetting{Transport: "http", Endpoint: "https://fallback.example/send"})
+	t.Cleanup(func() {
+		delete(providerDefaults, "timed_primary")
+		delete(providerDefaults, "untimed_fallback")
+	})
+
+	prepared := &EmailConfig{
+		Provider:         "timed_primary",
+		ProviderPriority: []string{"timed_primary", "untimed_fallback"},
+		From:             "sender@example.com",
+		To:               []string{"user@example.com"},
+		Timeout:          7 * time.Second,
+	}
+	if err := finalizeConfig(prepared); err != nil {
+		t.Fatalf("finalizeConfig: %v", err)
+	}
+	if prepared.Timeout != 7*time.Second {
+		t.Fatalf("the prepared config must keep the user's timeout, got %v", prepared.Timeout)
+	}
+	for provider, want := range map[string]time.Duration{"timed_primary": 50 * time.Millisecond, "untimed_fallback": 7 * time.Second} {
+		cfg, err := configForProvider(prepared, provider)
+		if err != nil {
+			t.Fatalf("%s: %v", provider, err)
+		}
+		if cfg.Timeout != want {
+			t.Fatalf("%s: expected timeout %v, got %v", provider, want, cfg.Timeout)
+		}
+	}
+}
+
+func TestConfigForProvider_FallbackGetsItsOwnSendDefaults(t *testing.T) {
+	RegisterProviderDefault("sg_account", ProviderSetting{Transport: "http", Endpoint: "https://sg.example/send", DefaultReplyTo: "support@sg-account.test", DefaultFromName: "SG Account", SuccessCodes: []int{http.StatusAccepted}})
+	RegisterProviderDefault("mg_account", ProviderSetting{Transport: "http", Endpoint: "https://mg.example/send", DefaultReplyTo: "help@mg-account.test"})
+	t.Cleanup(func() {
+		delete(providerDefaults, "sg_account")
+		delete(providerDefaults, "mg_account")
+	})
+
+	prepared, err := parseConfig(map[string]any{
+		"provider": "sg_account", "provider_priority": []any{"sg_account", "mg_account"},
+		"from": "sender@example.com", "to": "user@example.com", "subject": "hi",
+	})
+	if err != nil {
+		t.Fatalf("parseConfig: %v", err)
+	}
+	primary, err := configForProvider(prepared, "sg_account")
+	if err != nil {
+		t.Fatalf("sg_account: %v", err)
+	}
+	if strings.Join(primary.ReplyTo, ",") != "support@sg-account.test" || primary.FromName != "SG Account" || len(primary.SuccessCodes) != 1 {
+		t.Fatalf("expected the primary's defaults on its copy, got %v %q %v", primary.ReplyTo, primary.FromName, primary.SuccessCodes)
+	}
+	fallback, err := configForProvider(prepared, "mg_account")
+	if err != nil {
+		t.Fatalf("mg_account: %v", err)
+	}
+	if strings.Join(fallback.ReplyTo, ",") != "help@mg-account.test" || fallback.FromName != "" || len(fallback.SuccessCodes) != 0 {
+		t.Fatalf("expected only the fallback's own defaults, got %v %q %v", fallback.ReplyTo, fallback.FromName, fallback.SuccessCodes)
+	}
+}
+
+func TestSendViaHTTP_ProviderResponseCheck(t *testing.T) {
+	body := `{"errors":[{"message":"invalid recipient"}]}`
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write([]byte(body))
+	}))
+	defer srv.Close()
+	RegisterProviderDefault("errors_body", ProviderSetting{Transport: "http", Endpoint: srv.URL, ResponseCheck: JSONErrorsCheck})
+	defer delete(providerDefaults, "errors_body")
+
+	cfg := &EmailConfig{Provider: "errors_body", HTTPMethod: http.MethodPost, From: "sender@example.com", To: []string{"user@example.com"}, Subject: "hi", TextBody: "body"}
+	applyProviderDefaults(cfg)
+	err := sendViaHTTP(cfg)
+	if err == nil || !strings.Contains(err.Error(), "invalid recipient") {
+		t.Fatalf("expected 200 with errors body to fail, got %v", err)
+	}
+	body = `{"id":"abc","errors":[]}`
+	if err := sendViaHTTP(cfg); err != nil {
+		t.Fatalf("expected empty errors to succeed, got %v", err)
+	}
+}
+
+func TestSendViaHTTP_SuccessCodes(t *testing.T) {
+	status := http.StatusOK
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+	}))
+	defer srv.Close()
+	RegisterProviderDefault("accepted_only", ProviderSetting{Transport: "http", Endpoint: srv.URL, SuccessCodes: []int{http.StatusAccepted}})
+	defer delete(providerDefaults, "accepted_only")
+
+	cfg := &EmailConfig{Provider: "accepted_only", HTTPMethod: http.MethodPost, From: "sender@example.com", To: []string{"user@example.com"}, Subject: "hi", TextBody: "body"}
+	applyProviderDefaults(cfg)
+	applyProviderSendDefaults(cfg)
+	if err := sendViaHTTP(cfg); err == nil {
+		t.Fatalf("expected 200 to fail when only 202 means success")
+	}
+	status = http.StatusAccepted
+	if err := sendViaHTTP(cfg); err != nil {
+		t.Fatalf("expected 202 to succeed, got %v", err)
+	}
+
+	parsed, err := parseConfig(map[string]any{"from": "a@example.com", "to": "b@example.com", "host": "localhost", "success_codes": []any{float64(200), "202"}})
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	if len(parsed.SuccessCodes) != 2 || parsed.SuccessCodes[1] != 202 {
+		t.Fatalf("unexpected success codes %v", parsed.SuccessCodes)
+	}
+}
+
+func TestSendEmail_AllProvidersFailedHook(t *testing.T) {
+	defer withTempSendLog(t)()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "rejected by "+r.URL.Path, http.StatusBadRequest)
+	}))
+	defer srv.Close()
+	RegisterProviderDefault("first_down", ProviderSetting{Transport: "http", Endpoint: srv.URL + "/first"})
+	RegisterProviderDefault("second_down", ProviderSetting{Transport: "http", Endpoint: srv.URL + "/second"})
+	defer delete(providerDefaults, "first_down")
+	defer delete(providerDefaults, "second_down")
+
+	var got []ProviderFailure
+	OnAllProvidersFailed(func(cfg *EmailConfig, failures []ProviderFailure) {
+		got = failures
+	})
+	defer func() { allProvidersFailedHooks = nil }()
+
+	cfg := &EmailConfig{
+		ProviderPriority: []string{"first_down", "second_down"},
+		HTTPMethod:       http.MethodPost,
+		From:             "sender@example.com",
+		To:               []string{"user@example.com"},
+		Subject:          "hi",
+		TextBody:         "body",
+		RetryCount:       1,
+	}
+	if err := sendEmail(cfg, nil); err == nil {
+		t.Fatal("expected the send to fail")
+	}
+	if len(got) != 2 || got[0].Provider != "first_down" || got[1].Provider != "second_down" {
+		t.Fatalf("expected failures from both providers in order, got %+v", got)
+	}
+	if !strings.Contains(got[0].Err.Error(), "/first") || !strings.Contains(got[1].Err.Error(), "/second") {
+		t.Fatalf("expected each provider's own error, got %v / %v", got[0].Err, got[1].Err)
+	}
+}
+
+func TestSendEmail_ReportsEveryProviderError(t *testing.T) {
+	defer withTempSendLog(t)()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/auth" {
+			http.Error(w, "bad key", http.StatusUnauthorized)
+			return
+		}
+		http.Error(w, "bad request", http.StatusBadRequest)
+	}))
+	defer srv.Close()
+	RegisterProviderDefault("auth_down", ProviderSetting{Transport: "http", Endpoint: srv.URL + "/auth"})
+	RegisterProviderDefault("bad_request", ProviderSetting{Transport: "http", Endpoint: srv.URL + "/bad"})
+	defer delete(providerDefaults, "auth_down")
+	defer delete(providerDefaults, "bad_request")
+
+	cfg := &EmailConfig{
+		ProviderPriority: []string{"auth_down", "bad_request"},
+		HTTPMethod:       http.MethodPost,
+		From:             "sender@example.com",
+		To:               []string{"user@example.com"},
+		Subject:          "hi",
+		TextBody:         "body",
+		RetryCount:       1,
+	}
+	err := sendEmail(cfg, nil)
+	if err == nil {
+		t.Fatal("expected the send to fail")
+	}
+	msg := err.Error()
+	if !strings.Contains(msg, "auth_down: ") || !strings.Contains(msg, "bad_request: ") {
+		t.Fatalf("expected both providers in the error, got %q", msg)
+	}
+	if !errors.Is(err, ErrAuthFailed) {
+		t.Fatalf("expected the first provider's auth error to stay visible, got %v", err)
+	}
+}
+
+func TestResolveProviders_WarmupCapsRampByDay(t *testing.T) {
+	defer withTempSendLog(t)()
+	day1 := time.Date(2026, 3, 2, 0, 0, 0, 0, time.UTC)
+	origNow := warmupNow
+	defer func() { warmupNow = origNow }()
+	sent := func(at time.Time, n int) {
+		for i := 0; i < n; i++ {
+			appendSendLog(SendLogEntry{Timestamp: at, Provider: "warming", Success: true, Recipients: []string{"u@gmail.com"}})
+		}
+	}
+	cfg := &EmailConfig{
+		To: []string{"u@gmail.com"},
+		ProviderRoutes: []ProviderRoute{{
+			ToDomains:        []string{"gmail.com"},
+			ProviderPriority: []string{"warming", "seasoned"},
+			Warmup:           map[string]WarmupSchedule{"warming": {Start: day1.Add(9 * time.Hour), DailyCaps: []int{2, 5}}},
+		}},
+	}
+	hasWarming := func() bool {
+		for _, p := range resolveProviders(cfg) {
+			if p == "warming" {
+				return true
+			}
+		}
+		return false
+	}
+
+	warmupNow = func() time.Time { return day1.Add(15 * time.Hour) }
+	if limit, ok := cfg.ProviderRoutes[0].Warmup["warming"].CapOn(warmupNow()); !ok || limit != 2 {
+		t.Fatalf("expected a day 1 cap of 2, got %d (warming=%v)", limit, ok)
+	}
+	sent(day1.Add(10*time.Hour), 1)
+	if !hasWarming() {
+		t.Fatal("expected the warming provider below its day 1 cap")
+	}
+	sent(day1.Add(11*time.Hour), 1)
+	if hasWarming() {
+		t.Fatal("expected the warming provider skipped at its day 1 cap")
+	}
+
+	warmupNow = func() time.Time { return day1.Add(24*time.Hour + time.Hour) }
+	sent(day1.Add(24*time.Hour+30*time.Minute), 4)
+	if !hasWarming() {
+		t.Fatal("expected the day 2 cap of 5 to allow a fifth send")
+	}
+	sent(day1.Add(24*time.Hour+40*time.Minute), 1)
+	if hasWarming() {
+		t.Fatal("expected the warming provider skipped at its day 2 cap")
+	}
+
+	warmupNow = func() time.Time { return day1.Add(48*time.Hour + time.Hour) }
+	sent(day1.Add(48*time.Hour+30*time.Minute), 50)
+	if !hasWarming() {
+		t.Fatal("expected no cap once the warmup schedule is complete")
+	}
+
+	route, err := parseProviderRoute(map[string]any{
+		"to_domains": []any{"gmail.com"},
+		"warmup":     map[string]any{"Warming": map[string]any{"start": "2026-03-02", "daily_caps": []any{float64(2), float64(5)}}},
+	})
+	if err != nil {
+		t.Fatalf("parseProviderRoute: %v", err)
+	}
+	if w := route.Warmup["warming"]; !w.Start.Equal(day1) || len(w.DailyCaps) != 2 || w.DailyCaps[1] != 5 {
+		t.Fatalf("unexpected parsed warmup %+v", route.Warmup)
+	}
+}
+
+func TestParseConfig_WarmupRequiresValidStart(t *testing.T) {
+	for name, entry := range map[string]map[string]any{
+		"missing start": {"daily_caps": []any{float64(10)}},
+		"invalid start": {"start": "next monday", "daily_caps": []any{float64(10)}},
+	} {
+		_, err := parseConfig(map[string]any{
+			"host": "localhost", "from": "a@example.com", "to": "b@example.com",
+			"routes": map[string]any{"provider_priority": []any{"warming"}, "warmup": map[string]any{"warming": entry}},
+		})
+		if err == nil || !strings.Contains(err.Error(), "warmup warming") {
+			t.Fatalf("%s: expected a warmup start error, got %v", name, err)
+		}
+	}
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// providerConfigPollInterval is how often WatchProviderConfig checks its file.
+var providerConfigPollInterval = 2 * time.Second
+
+// ProviderConfigWatcher keeps the providers defined in a JSON file registered,
+// reloading them when the file changes.
+type ProviderConfigWatcher struct {
+	path string
+	stop chan struct{}
+	wg   sync.WaitGroup
+
+	mu      sync.Mutex
+	content []byte
+	failed  []byte
+	loaded  []string
+	lastErr error
+}
+
+// WatchProviderConfig registers the providers in path, in the format read by
+// LoadProvidersFromJSON, and reloads them whenever the file's content changes.
+// A reload swaps the file's providers in the registry at once: changed ones
+// are replaced and removed ones unregistered. A reload that fails to read or
+// validate keeps the previous providers and is reported by LastError. Call
+// Stop to end the watch.
+func WatchProviderConfig(path string) (*ProviderConfigWatcher, error) {
+	w := &ProviderConfigWatcher{path: path, stop: make(chan struct{})}
+	if err := w.reload(); err != nil {
+		return nil, err
+	}
+	w.wg.Add(1)
+	go w.run()
+	return w, nil
+}
+
+// Stop ends the watch. Providers already registered stay registered.
+func (w *ProviderConfigWatcher) Stop() {
+	select {
+	case <-w.stop:
+		return
+	default:
+	}
+	close(w.stop)
+	w.wg.Wait()
+}
+
+// LastError returns the error of the most recent reload, or nil if it
+// succeeded.
+func (w *ProviderConfigWatcher) LastError() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.lastErr
+}
+
+func (w *ProviderConfigWatcher) run() {
+	defer w.wg.Done()
+	ticker := time.NewTicker(providerConfigPollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-w.stop:
+			return
+		case <-ticker.C:
+			if err := w.reload(); err != nil {
+				logger().Warn("provider config reload failed, keeping previous providers", "path", w.path, "error", err)
+			}
+		}
+	}
+}
+
+// reload registers the file's providers if its content changed since the
+// last load. Content that already failed is not retried until it changes.
+func (w *ProviderConfigWatcher) reload() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	data, err := os.ReadFile(w.path)
+	if err == nil {
+		switch {
+		case w.content != nil && bytes.Equal(data, w.content):
+			w.lastErr = nil
+			return nil
+		case w.failed != nil && bytes.Equal(data, w.failed):
+			return nil
+		}
+		if err = w.swap(data); err != nil {
+			w.failed = data
+		}
+	}
+	if err != nil {
+		w.lastErr = fmt.Errorf("provider config %s: %w", w.path, err)
+		return w.lastErr
+	}
+	w.content, w.failed, w.lastErr = data, nil, nil
+	logger().Info("provider config loaded", "path", w.path, "providers", w.loaded)
+	return nil
+}
+
+// swap replaces the providers from the previous load with those in data.
+func (w *ProviderConfigWatcher) swap(data []byte) error {
+	configs, providers, err := buildProvidersFromJSON(data)
+	if err != nil {
+		return err
+	}
+	names := make([]string, len(configs))
+	metadata := make([]ProviderMetadata, len(configs))
+	for i, config := range configs {
+		names[i] = providers[i].Name()
+		metadata[i] = config.Metadata
+	}
+	if err := globalRegistry.swap(w.loaded, providers, metadata); err != nil {
+		return err
+	}
+	w.loaded = names
+	return nil
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestWatchProviderConfig_ReloadsOnChange(t *testing.T) {
+	defer func(prev time.Duration) { providerConfigPollInterval = prev }(providerConfigPollInterval)
+	providerConfigPollInterval = 10 * time.Millisecond
+	t.Cleanup(func() { globalRegistry.swap([]string{"watched_api", "watched_relay"}, nil, nil) })
+
+	path := filepath.Join(t.TempDir(), "providers.json")
+	write := func(content string) {
+		t.Helper()
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	waitFor := func(what string, cond func() bool) {
+		t.Helper()
+		deadline := time.Now().Add(2 * time.Second)
+		for !cond() {
+			if time.Now().After(deadline) {
+				t.Fatalf("timed out waiting for %s", what)
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+	}
+	endpoint := func(name string) string {
+		if p, ok := GetProvider(name); ok {
+			return p.GetEndpoint(&EmailConfig{})
+		}
+		return ""
+	}
+
+	write(`[{"name": "watched_api", "type": "generic", "endpoint": "https://v1.example.com/send", "mapping": {"To": "to"}}]`)
+	w, err := WatchProviderConfig(path)
+	if err != nil {
+		t.Fatalf("WatchProviderConfig: %v", err)
+	}
+	defer w.Stop()
+	if got := endpoint("watched_api"); got != "https://v1.example.com/send" {
+		t.Fatalf("unexpected initial endpoint %q", got)
+	}
+
+	write(`[
+		{"name": "watched_api", "type": "generic", "endpoint": "https://v2.example.com/send", "mapping": {"To": "to"}},
+		{"name": "watched_relay", "type": "smtp", "smtp": {"Host": "smtp.example.com", "Port": 587}}
+	]`)
+	waitFor("the edited provider", func() bool { return endpoint("watched_api") == "https://v2.example.com/send" })
+	if _, ok := GetProvider("watched_relay"); !ok {
+		t.Fatal("added provider should be registered")
+	}
+
+	write(`[{"name": "watched_api", "type": "generic"}]`)
+	waitFor("the reload error", func() bool { return w.LastError() != nil })
+	if got := endpoint("watched_api"); got != "https://v2.example.com/send" {
+		t.Fatalf("invalid config should keep the previous providers, got %q", got)
+	}
+
+	write(`[{"name": "watched_relay", "type": "smtp", "smtp": {"Host": "smtp.example.com", "Port": 465}}]`)
+	waitFor("the removed provider", func() bool { _, ok := GetProvider("watched_api"); return !ok })
+	if w.LastError() != nil {
+		t.Fatalf("unexpected reload error: %v", w.LastError())
+	}
+}
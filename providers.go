@@ -2,7 +2,11 @@ package main
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
+	"math"
+	"sort"
+	"strconv"
 	"strings"
 )
 
@@ -26,21 +30,44 @@ func NewBrevoProvider() *BrevoProvider {
 	}
 }
 
+// ValidateConfig also requires a Brevo API key.
+func (b *BrevoProvider) ValidateConfig(cfg *EmailConfig) error {
+	if err := b.HTTPProvider.ValidateConfig(cfg); err != nil {
+		return err
+	}
+	return requireAPIKey(cfg, "brevo", "api-key")
+}
+
 func (b *BrevoProvider) BuildPayload(cfg *EmailConfig) (interface{}, string, error) {
 	fromName, fromEmail := splitAddress(cfg.From)
 	sender := singleAddressMap(simpleAddress{Name: fromName, Email: fromEmail}, "email", "name")
 
 	payload := map[string]interface{}{
-		"sender":  sender,
-		"to":      addressMaps(parseAddressList(cfg.To), "email", "name"),
-		"subject": cfg.Subject,
+		"sender": sender,
+		"to":     addressMaps(parseAddressList(cfg.To), "email", "name"),
 	}
 
-	if cfg.HTMLBody != "" {
-		payload["htmlContent"] = cfg.HTMLBody
+	// A template switches to Brevo's stored template, which supplies the
+	// subject and content and is rendered with params.
+	if tpl := providerTemplate(cfg); tpl != nil {
+		payload["templateId"] = asInt(tpl.Name())
+		if len(tpl.Data) > 0 {
+			payload["params"] = tpl.Data
+		}
+	} else {
+		payload["subject"] = cfg.Subject
+		if cfg.HTMLBody != "" {
+			payload["htmlContent"] = cfg.HTMLBody
+		}
+		if cfg.TextBody != "" {
+			payload["textContent"] = cfg.TextBody
+		}
 	}
-	if cfg.TextBody != "" {
-		payload["textContent"] = cfg.TextBody
+	if tags := tagList(cfg.Tags); len(tags) > 0 {
+		payload["tags"] = tags
+	}
+	if headers := messageHeaders(cfg.Headers, b.headers); len(headers) > 0 {
+		payload["headers"] = headers
 	}
 
 	if len(cfg.CC) > 0 {
@@ -50,7 +77,50 @@ func (b *BrevoProvider) BuildPayload(cfg *EmailConfig) (interface{}, string, err
 		payload["bcc"] = addressMaps(parseAddressList(cfg.BCC), "email", "name")
 	}
 
-	return mergeAdditional(payload, cfg.AdditionalData, true), "application/json", nil
+	return mergeAdditional(payload, withoutTemplateKeys(cfg.AdditionalData), true), "application/json", nil
+}
+
+// withoutTemplateKeys drops the legacy template data keys from extras that a
+// builder merges into its payload, since providerTemplate already mapped them.
+func withoutTemplateKeys(extras map[string]any) map[string]any {
+	out := make(map[string]any, len(extras))
+	for k, v := range extras {
+		switch k {
+		case "template_id", "template_alias", "template_model", "template_data", "params":
+			continue
+		}
+		out[k] = v
+	}
+	return out
+}
+
+// messageHeaders returns the headers meant for the message itself, leaving
+// out the request's own auth and content headers so credentials never end up
+// in a payload.
+func messageHeaders(headers, httpHeaders map[string]string) map[string]string {
+	out := map[string]string{}
+	for k, v := range headers {
+		if strings.EqualFold(k, "Authorization") || strings.EqualFold(k, "Content-Type") || hasHeader(httpHeaders, k) {
+			continue
+		}
+		out[k] = v
+	}
+	return out
+}
+
+// tagList flattens tags for providers that take a list, as "key" for bare
+// tags and "key=value" otherwise, sorted for stable payloads.
+func tagList(tags map[string]string) []string {
+	out := make([]string, 0, len(tags))
+	for k, v := range tags {
+		if v == "" {
+			out = append(out, k)
+		} else {
+			out = append(out, k+"="+v)
+		}
+	}
+	sort.Strings(out)
+	return out
 }
 
 // MailjetProvider implementation
@@ -70,6 +140,15 @@ func NewMailjetProvider() *MailjetProvider {
 	}
 }
 
+// ValidateConfig also requires a Mailjet API key, or
+// basic auth with the API key and secret.
+func (m *MailjetProvider) ValidateConfig(cfg *EmailConfig) error {
+	if err := m.HTTPProvider.ValidateConfig(cfg); err != nil {
+		return err
+	}
+	return requireAPIKey(cfg, "mailjet", "Authorization")
+}
+
 func (m *MailjetProvider) BuildPayload(cfg *EmailConfig) (interface{}, string, error) {
 	fromName, fromEmail := splitAddress(cfg.From)
 
@@ -87,20 +166,79 @@ func (m *MailjetProvider) BuildPayload(cfg *EmailConfig) (interface{}, string, e
 		"Subject": cfg.Subject,
 	}
 
-	if cfg.TextBody != "" {
-		message["TextPart"] = cfg.TextBody
+	if tpl := providerTemplate(cfg); tpl != nil {
+		delete(message, "Subject")
+		message["TemplateID"] = asInt(tpl.Name())
+		message["TemplateLanguage"] = true
+		if len(tpl.Data) > 0 {
+			message["Variables"] = tpl.Data
+		}
+	} else {
+		if cfg.TextBody != "" {
+			message["TextPart"] = cfg.TextBody
+		}
+		if cfg.HTMLBody != "" {
+			message["HTMLPart"] = cfg.HTMLBody
+		}
 	}
-	if cfg.HTMLBody != "" {
-		message["HTMLPart"] = cfg.HTMLBody
+	// CustomID and EventPayload are echoed back in Mailjet events for
+	// reconciliation; EventPayload must be a string, so other values are JSON-encoded.
+	if id, ok := cfg.AdditionalData["custom_id"]; ok && id != nil {
+		message["CustomID"] = fmt.Sprint(id)
+	}
+	if ev, ok := cfg.AdditionalData["event_payload"]; ok && ev != nil {
+		if s, isString := ev.(string); isString {
+			message["EventPayload"] = s
+		} else {
+			encoded, err := json.Marshal(ev)
+			if err != nil {
+				return nil, "", fmt.Errorf("mailjet event_payload: %w", err)
+			}
+			message["EventPayload"] = string(encoded)
+		}
 	}
 
 	payload := map[string]interface{}{
 		"Messages": []interface{}{message},
 	}
+	if cfg.SandboxMode {
+		payload["SandboxMode"] = true
+	}
 
 	return payload, "application/json", nil
 }
 
+// BuildBatchPayload sends every message as one entry of the Messages array.
+// Mailjet messages are independent, so sender and content may differ.
+func (m *MailjetProvider) BuildBatchPayload(cfgs []*EmailConfig) (interface{}, string, error) {
+	if len(cfgs) == 0 {
+		return nil, "", errors.New("mailjet batch requires at least one message")
+	}
+	messages := make([]interface{}, 0, len(cfgs))
+	for _, cfg := range cfgs {
+		single, _, err := m.BuildPayload(cfg)
+		if err != nil {
+			return nil, "", err
+		}
+		messages = append(messages, single.(map[string]interface{})["Messages"].([]interface{})...)
+	}
+	payload := map[string]interface{}{"Messages": messages}
+	if cfgs[0].SandboxMode {
+		payload["SandboxMode"] = true
+	}
+	return payload, "application/json", nil
+}
+
+// BatchEndpoint returns the v3.1 send endpoint, which also takes batches.
+func (m *MailjetProvider) BatchEndpoint(cfg *EmailConfig) string {
+	return m.GetEndpoint(cfg)
+}
+
+// MaxBatchSize is Mailjet's limit on messages per send request.
+func (m *MailjetProvider) MaxBatchSize() int {
+	return 50
+}
+
 // SparkPostProvider implementation
 type SparkPostProvider struct {
 	*HTTPProvider
@@ -118,6 +256,14 @@ func NewSparkPostProvider() *SparkPostProvider {
 	}
 }
 
+// ValidateConfig also requires a SparkPost API key.
+func (s *SparkPostProvider) ValidateConfig(cfg *EmailConfig) error {
+	if err := s.HTTPProvider.ValidateConfig(cfg); err != nil {
+		return err
+	}
+	return requireAPIKey(cfg, "sparkpost", "Authorization")
+}
+
 func (s *SparkPostProvider) BuildPayload(cfg *EmailConfig) (interface{}, string, error) {
 	fromName, fromEmail := splitAddress(cfg.From)
 
@@ -125,12 +271,17 @@ func (s *SparkPostProvider) BuildPayload(cfg *EmailConfig) (interface{}, string,
 		"from":    map[string]string{"email": fromEmail, "name": fromName},
 		"subject": cfg.Subject,
 	}
-
-	if cfg.HTMLBody != "" {
-		content["html"] = cfg.HTMLBody
-	}
-	if cfg.TextBody != "" {
-		content["text"] = cfg.TextBody
+	tpl := providerTemplate(cfg)
+	if tpl != nil {
+		// A stored template supplies from, subject and bodies itself.
+		content = map[string]interface{}{"template_id": tpl.Name()}
+	} else {
+		if cfg.HTMLBody != "" {
+			content["html"] = cfg.HTMLBody
+		}
+		if cfg.TextBody != "" {
+			content["text"] = cfg.TextBody
+		}
 	}
 
 	recipients := make([]map[string]interface{}, 0, len(cfg.To))
@@ -145,6 +296,29 @@ func (s *SparkPostProvider) BuildPayload(cfg *EmailConfig) (interface{}, string,
 		"content":    content,
 	}
 
+	// Transmission options come from data keys of the same name; sandbox
+	// follows sandbox_mode.
+	options := map[string]interface{}{}
+	for _, key := range []string{"open_tracking", "click_tracking", "transactional"} {
+		if val, ok := cfg.AdditionalData[key]; ok {
+			options[key] = normalizeBool(val)
+		}
+	}
+	if cfg.SandboxMode {
+		options["sandbox"] = true
+	}
+	if len(options) > 0 {
+		payload["options"] = options
+	}
+	if cfg.CampaignID != "" {
+		payload["campaign_id"] = cfg.CampaignID
+	}
+	if subs, ok := cfg.AdditionalData["substitution_data"].(map[string]any); ok {
+		payload["substitution_data"] = subs
+	} else if tpl != nil && len(tpl.Data) > 0 {
+		payload["substitution_data"] = tpl.Data
+	}
+
 	return payload, "application/json", nil
 }
 
@@ -165,6 +339,14 @@ func NewMailtrapProvider() *MailtrapProvider {
 	}
 }
 
+// ValidateConfig also requires a Mailtrap API token.
+func (m *MailtrapProvider) ValidateConfig(cfg *EmailConfig) error {
+	if err := m.HTTPProvider.ValidateConfig(cfg); err != nil {
+		return err
+	}
+	return requireAPIKey(cfg, "mailtrap", "Api-Token")
+}
+
 func (m *MailtrapProvider) BuildPayload(cfg *EmailConfig) (interface{}, string, error) {
 	fromName, fromEmail := splitAddress(cfg.From)
 	sender := singleAddressMap(simpleAddress{Name: fromName, Email: fromEmail}, "email", "name")
@@ -219,46 +401,125 @@ type MappingTransformer struct {
 	Mapping JSONMapping
 }
 
+// Transform builds the payload. Payload keys may be dotted paths such as
+// "message.metadata.user_id"; intermediate objects are created as needed.
 func (m *MappingTransformer) Transform(cfg *EmailConfig) (map[string]interface{}, error) {
 	payload := make(map[string]interface{})
+	var err error
+	set := func(key string, val any) {
+		if err == nil {
+			err = setPayloadPath(payload, key, val)
+		}
+	}
 
 	// Map basic fields
 	if m.Mapping.From != "" {
-		payload[m.Mapping.From] = cfg.From
+		set(m.Mapping.From, cfg.From)
 	}
 	if m.Mapping.To != "" {
 		if m.Mapping.ToArray {
-			payload[m.Mapping.To] = cfg.To
+			set(m.Mapping.To, cfg.To)
 		} else {
-			payload[m.Mapping.To] = addressMaps(parseAddressList(cfg.To), "email", "name")
+			set(m.Mapping.To, addressMaps(parseAddressList(cfg.To), "email", "name"))
 		}
 	}
 	if m.Mapping.Subject != "" {
-		payload[m.Mapping.Subject] = cfg.Subject
+		set(m.Mapping.Subject, cfg.Subject)
 	}
 	if m.Mapping.TextBody != "" && cfg.TextBody != "" {
-		payload[m.Mapping.TextBody] = cfg.TextBody
+		set(m.Mapping.TextBody, cfg.TextBody)
 	}
 	if m.Mapping.HTMLBody != "" && cfg.HTMLBody != "" {
-		payload[m.Mapping.HTMLBody] = cfg.HTMLBody
+		set(m.Mapping.HTMLBody, cfg.HTMLBody)
 	}
 	if m.Mapping.CC != "" && len(cfg.CC) > 0 {
-		payload[m.Mapping.CC] = cfg.CC
+		set(m.Mapping.CC, cfg.CC)
 	}
 	if m.Mapping.BCC != "" && len(cfg.BCC) > 0 {
-		payload[m.Mapping.BCC] = cfg.BCC
+		set(m.Mapping.BCC, cfg.BCC)
 	}
 
-	// Apply custom mappings
-	for configKey, payloadKey := range m.Mapping.Custom {
-		if val, ok := cfg.AdditionalData[configKey]; ok {
-			payload[payloadKey] = val
+	// Apply custom mappings; config keys may be dotted paths into nested data.
+	// Sorted so a conflict between two mappings is reported the same way each run.
+	configKeys := make([]string, 0, len(m.Mapping.Custom))
+	for configKey := range m.Mapping.Custom {
+		configKeys = append(configKeys, configKey)
+	}
+	sort.Strings(configKeys)
+	for _, configKey := range configKeys {
+		if val, ok := GetData(cfg, configKey); ok {
+			set(m.Mapping.Custom[configKey], val)
 		}
 	}
+	if err != nil {
+		return nil, err
+	}
 
 	return payload, nil
 }
 
+// setPayloadPath stores val at a dotted path in payload, creating intermediate
+// objects. It fails when a path segment already holds a non-object value.
+func setPayloadPath(payload map[string]any, path string, val any) error {
+	segments := strings.Split(path, ".")
+	cur := payload
+	for i, segment := range segments[:len(segments)-1] {
+		next, ok := cur[segment]
+		if !ok {
+			child := map[string]any{}
+			cur[segment] = child
+			cur = child
+			continue
+		}
+		child, ok := next.(map[string]any)
+		if !ok {
+			return fmt.Errorf("payload mapping %q: %q is not an object", path, strings.Join(segments[:i+1], "."))
+		}
+		cur = child
+	}
+	cur[segments[len(segments)-1]] = val
+	return nil
+}
+
+// GetData returns the AdditionalData value at a dotted path such as
+// "user.profile.id", descending through nested objects and, for numeric
+// segments, arrays. A key that literally contains the dots wins over the
+// nested lookup.
+func GetData(cfg *EmailConfig, path string) (any, bool) {
+	if cfg == nil || cfg.AdditionalData == nil || path == "" {
+		return nil, false
+	}
+	if val, ok := cfg.AdditionalData[path]; ok {
+		return val, true
+	}
+	var cur any = cfg.AdditionalData
+	for _, segment := range strings.Split(path, ".") {
+		switch v := cur.(type) {
+		case map[string]any:
+			next, ok := v[segment]
+			if !ok {
+				return nil, false
+			}
+			cur = next
+		case map[string]string:
+			next, ok := v[segment]
+			if !ok {
+				return nil, false
+			}
+			cur = next
+		case []any:
+			i, err := strconv.Atoi(segment)
+			if err != nil || i < 0 || i >= len(v) {
+				return nil, false
+			}
+			cur = v[i]
+		default:
+			return nil, false
+		}
+	}
+	return cur, true
+}
+
 func NewGenericJSONProvider(name, endpoint string, headers map[string]string, mapping JSONMapping) *GenericJSONProvider {
 	return &GenericJSONProvider{
 		HTTPProvider: NewHTTPProvider(name, endpoint, headers),
@@ -266,6 +527,17 @@ func NewGenericJSONProvider(name, endpoint string, headers map[string]string, ma
 	}
 }
 
+// ValidateConfig also requires an endpoint to post to.
+func (g *GenericJSONProvider) ValidateConfig(cfg *EmailConfig) error {
+	if err := g.HTTPProvider.ValidateConfig(cfg); err != nil {
+		return err
+	}
+	if g.GetEndpoint(cfg) == "" {
+		return fmt.Errorf("%s requires an endpoint", g.name)
+	}
+	return nil
+}
+
 func (g *GenericJSONProvider) BuildPayload(cfg *EmailConfig) (interface{}, string, error) {
 	payload, err := g.transformer.Transform(cfg)
 	if err != nil {
@@ -287,13 +559,51 @@ type ProviderConfig struct {
 	Metadata ProviderMetadata  `json:"metadata"`
 }
 
-// LoadProviderFromConfig creates a provider from configuration
-func LoadProviderFromConfig(config ProviderConfig) (Provider, error) {
+// Validate checks the fields required by the config's Type and returns every
+// problem found, each naming the offending field.
+func (config ProviderConfig) Validate() error {
+	var errs []error
+	missing := func(field string) {
+		errs = append(errs, fmt.Errorf("%s is required", field))
+	}
+	if strings.TrimSpace(config.Name) == "" {
+		missing("name")
+	}
 	switch config.Type {
 	case "smtp":
 		if config.SMTP == nil {
-			return nil, fmt.Errorf("SMTP config required for SMTP provider")
+			missing("smtp")
+			break
+		}
+		if strings.TrimSpace(config.SMTP.Host) == "" {
+			missing("smtp.host")
+		}
+		if config.SMTP.Port < 0 || config.SMTP.Port > 65535 {
+			errs = append(errs, fmt.Errorf("smtp.port %d is out of range", config.SMTP.Port))
+		}
+	case "generic", "http":
+		if strings.TrimSpace(config.Endpoint) == "" {
+			missing("endpoint")
+		}
+		if config.Mapping == nil {
+			missing("mapping")
+		} else if config.Mapping.To == "" {
+			missing("mapping.to")
 		}
+	case "":
+		missing("type")
+	default:
+		errs = append(errs, fmt.Errorf("type %q is not one of smtp, http, generic", config.Type))
+	}
+	return errors.Join(errs...)
+}
+
+// LoadProviderFromConfig creates a provider from configuration
+func LoadProviderFromConfig(config ProviderConfig) (Provider, error) {
+	if err := config.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid provider config %q: %w", config.Name, err)
+	}
+	if config.Type == "smtp" {
 		return NewSMTPProvider(
 			config.Name,
 			config.SMTP.Host,
@@ -301,42 +611,60 @@ func LoadProviderFromConfig(config ProviderConfig) (Provider, error) {
 			config.SMTP.UseTLS,
 			config.SMTP.UseSSL,
 		), nil
+	}
+	return NewGenericJSONProvider(
+		config.Name,
+		config.Endpoint,
+		config.Headers,
+		*config.Mapping,
+	), nil
+}
 
-	case "generic", "http":
-		if config.Mapping == nil {
-			return nil, fmt.Errorf("mapping required for generic provider")
-		}
-		return NewGenericJSONProvider(
-			config.Name,
-			config.Endpoint,
-			config.Headers,
-			*config.Mapping,
-		), nil
+// LoadProvidersFromJSON loads multiple providers from JSON configuration.
+// Every config is validated first; if any is invalid, nothing is registered
+// and the errors for all of them are returned together.
+func LoadProvidersFromJSON(jsonData []byte) error {
+	configs, providers, err := buildProvidersFromJSON(jsonData)
+	if err != nil {
+		return err
+	}
 
-	default:
-		return nil, fmt.Errorf("unknown provider type: %s", config.Type)
+	for i, config := range configs {
+		if err := RegisterProvider(providers[i], config.Metadata); err != nil {
+			return fmt.Errorf("failed to register provider %s: %w", config.Name, err)
+		}
 	}
+
+	return nil
 }
 
-// LoadProvidersFromJSON loads multiple providers from JSON configuration
-func LoadProvidersFromJSON(jsonData []byte) error {
+// buildProvidersFromJSON parses, validates and builds the providers in
+// jsonData without registering them.
+func buildProvidersFromJSON(jsonData []byte) ([]ProviderConfig, []Provider, error) {
 	var configs []ProviderConfig
 	if err := json.Unmarshal(jsonData, &configs); err != nil {
-		return err
+		return nil, nil, err
 	}
 
-	for _, config := range configs {
-		provider, err := LoadProviderFromConfig(config)
-		if err != nil {
-			return fmt.Errorf("failed to load provider %s: %w", config.Name, err)
+	var errs []error
+	for i, config := range configs {
+		if err := config.Validate(); err != nil {
+			errs = append(errs, fmt.Errorf("provider %d (%q): %w", i, config.Name, err))
 		}
+	}
+	if len(errs) > 0 {
+		return nil, nil, errors.Join(errs...)
+	}
 
-		if err := RegisterProvider(provider, config.Metadata); err != nil {
-			return fmt.Errorf("failed to register provider %s: %w", config.Name, err)
+	providers := make([]Provider, len(configs))
+	for i, config := range configs {
+		provider, err := LoadProviderFromConfig(config)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to load provider %s: %w", config.Name, err)
 		}
+		providers[i] = provider
 	}
-
-	return nil
+	return configs, providers, nil
 }
 
 // ============= USAGE EXAMPLES =============
@@ -358,7 +686,7 @@ func ExampleRegisterCustomProvider() {
 	}
 
 	// Register aliases
-	RegisterAlias("sendinblue", "brevo")
+	RegisterAlias("brevo", "sendinblue")
 
 	fmt.Println("Provider registered successfully")
 }
@@ -497,7 +825,7 @@ func (s *CostBasedSelector) Select(cfg *EmailConfig, providers []string) (string
 		}
 
 		// Select based on cost and reliability
-		score := metadata.Cost / metadata.Reliability
+		score := costReliabilityScore(metadata)
 		if score < lowestCost {
 			lowestCost = score
 			bestProvider = name
@@ -511,6 +839,15 @@ func (s *CostBasedSelector) Select(cfg *EmailConfig, providers []string) (string
 	return bestProvider, nil
 }
 
+// costReliabilityScore ranks providers by cost per unit of reliability; lower is
+// better. Providers without a reliability score are ranked last.
+func costReliabilityScore(metadata ProviderMetadata) float64 {
+	if metadata.Reliability <= 0 {
+		return math.Inf(1)
+	}
+	return metadata.Cost / metadata.Reliability
+}
+
 // Initialize extension providers
 func InitExtensionProviders() {
 	// Register additional providers
@@ -520,5 +857,5 @@ func InitExtensionProviders() {
 	RegisterProvider(NewMailtrapProvider(), ProviderMetadata{Capacity: 100, Cost: 0.0, Reliability: 0.99})
 
 	// Register aliases
-	RegisterAlias("sendinblue", "brevo")
+	RegisterAlias("brevo", "sendinblue")
 }
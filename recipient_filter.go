@@ -0,0 +1,77 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+)
+
+// errRecipientsBlocked is returned when the allow/deny lists leave a send
+// with no recipients; scheduled jobs record it as JobResultBlocked.
+var errRecipientsBlocked = errors.New("all recipients blocked by recipient allow/deny lists")
+
+// validateRecipientPatterns checks allow/deny entries: exact addresses or
+// globs such as "*@example.com" or "*@*.example.com".
+func validateRecipientPatterns(field string, patterns []string) error {
+	for _, p := range patterns {
+		if _, err := path.Match(strings.ToLower(p), ""); err != nil {
+			return fmt.Errorf("%s: invalid pattern %q", field, p)
+		}
+	}
+	return nil
+}
+
+func matchesRecipientPattern(addr string, patterns []string) bool {
+	for _, p := range patterns {
+		if ok, _ := path.Match(strings.ToLower(strings.TrimSpace(p)), addr); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// recipientPermitted reports whether candidate passes the allowlist (when
+// one is set) and is not on the denylist, as entered or by its normalized
+// recipientKey.
+func recipientPermitted(cfg *EmailConfig, candidate string) bool {
+	_, addr := splitAddress(candidate)
+	addr = strings.ToLower(strings.TrimSpace(addr))
+	if len(cfg.RecipientAllowlist) > 0 && !matchesRecipientPattern(addr, cfg.RecipientAllowlist) {
+		return false
+	}
+	return !matchesRecipientPattern(addr, cfg.RecipientDenylist) && !matchesRecipientPattern(recipientKey(cfg, addr), cfg.RecipientDenylist)
+}
+
+// applyRecipientFilter drops recipients the allow/deny lists reject and
+// returns errRecipientsBlocked when none remain.
+func applyRecipientFilter(cfg *EmailConfig) error {
+	if len(cfg.RecipientAllowlist) == 0 && len(cfg.RecipientDenylist) == 0 {
+		return nil
+	}
+	var dropped []string
+	filter := func(list []string) []string {
+		var kept []string
+		for _, candidate := range list {
+			if recipientPermitted(cfg, candidate) {
+				kept = append(kept, candidate)
+			} else {
+				dropped = append(dropped, candidate)
+			}
+		}
+		return kept
+	}
+	cfg.To = filter(cfg.To)
+	cfg.CC = filter(cfg.CC)
+	cfg.BCC = filter(cfg.BCC)
+	if len(cfg.EnvelopeRecipients) > 0 {
+		cfg.EnvelopeRecipients = filter(cfg.EnvelopeRecipients)
+	}
+	if len(dropped) > 0 {
+		logger().Warn("recipients dropped by allow/deny lists", "dropped", dropped)
+	}
+	if len(cfg.To)+len(cfg.CC)+len(cfg.BCC) == 0 {
+		return errRecipientsBlocked
+	}
+	return nil
+}
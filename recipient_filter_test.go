@@ -0,0 +1,80 @@
+package main
+
+import (
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRecipientFilter_AllowlistOnly(t *testing.T) {
+	cfg := &EmailConfig{
+		From:               "sender@example.com",
+		To:                 []string{"Alice <alice@corp.example>", "bob@gmail.com"},
+		CC:                 []string{"carol@corp.example"},
+		BCC:                []string{"audit@vendor.example"},
+		Subject:            "hi",
+		TextBody:           "body",
+		RecipientAllowlist: []string{"*@corp.example", "audit@vendor.example"},
+	}
+	prepared, err := prepareSendConfig(cfg)
+	if err != nil {
+		t.Fatalf("prepareSendConfig: %v", err)
+	}
+	if strings.Join(prepared.To, ",") != "Alice <alice@corp.example>" {
+		t.Fatalf("expected only the allowed To recipient, got %q", prepared.To)
+	}
+	if len(prepared.CC) != 1 || len(prepared.BCC) != 1 {
+		t.Fatalf("expected allowed Cc and exact Bcc match to stay, got %q %q", prepared.CC, prepared.BCC)
+	}
+
+	cfg.To, cfg.CC, cfg.BCC = []string{"bob@gmail.com"}, nil, nil
+	if _, err := prepareSendConfig(cfg); !errors.Is(err, errRecipientsBlocked) {
+		t.Fatalf("expected errRecipientsBlocked, got %v", err)
+	}
+}
+
+func TestRecipientFilter_Denylist(t *testing.T) {
+	defer withTempSendLog(t)()
+	defer withTempJobResults(t, map[string]JobResult{})()
+	srv := newStubSMTPServer(t)
+	cfg := srv.config()
+	cfg.To = []string{"alice@example.org", "mallory@blocked.example"}
+	cfg.RecipientDenylist = []string{"*@blocked.example"}
+	if err := sendEmail(cfg, nil); err != nil {
+		t.Fatalf("sendEmail: %v", err)
+	}
+	var rcpts []string
+	for _, c := range srv.Commands() {
+		if strings.HasPrefix(c, "RCPT TO:") {
+			rcpts = append(rcpts, c)
+		}
+	}
+	if len(rcpts) != 1 || !strings.HasPrefix(rcpts[0], "RCPT TO:<alice@example.org>") {
+		t.Fatalf("expected the denied recipient to be dropped, got %q", rcpts)
+	}
+
+	// A scheduled job with nothing left to send to is recorded as blocked.
+	store := NewFileJobStore(filepath.Join(t.TempDir(), "jobs.json"))
+	s := NewScheduler(store, time.Hour)
+	blocked := srv.config()
+	blocked.To = []string{"mallory@blocked.example"}
+	blocked.RecipientDenylist = cfg.RecipientDenylist
+	job, err := s.Schedule(blocked, time.Now().Add(-time.Second), nil)
+	if err != nil {
+		t.Fatalf("schedule: %v", err)
+	}
+	s.runDue(time.Now())
+	s.wg.Wait()
+	if res, ok := getJobResult(job.ID); !ok || res != JobResultBlocked {
+		t.Fatalf("expected job result %q, got %q", JobResultBlocked, res)
+	}
+	if remaining, _ := store.ListAll(); len(remaining) != 0 {
+		t.Fatalf("expected the blocked job to be removed, got %d", len(remaining))
+	}
+
+	if _, err := parseConfig(map[string]any{"host": "smtp.example.com", "from": "a@example.com", "to": "b@example.com", "blocked_recipients": "[bad"}); err == nil {
+		t.Fatal("expected an invalid pattern to be rejected")
+	}
+}
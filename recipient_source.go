@@ -0,0 +1,135 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"net/http"
+	"net/mail"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+const maxRecipientSourceSize = 32 << 20
+
+var recipientSourceClient = &http.Client{Timeout: 30 * time.Second}
+
+// expandRecipientSource replaces a list holding a single file:// or http(s)
+// source with the addresses it contains. Any other list is returned unchanged.
+func expandRecipientSource(list []string) ([]string, error) {
+	if !isRecipientSource(list) {
+		return list, nil
+	}
+	source := strings.TrimSpace(list[0])
+	data, err := readRecipientSource(source)
+	if err != nil {
+		return nil, fmt.Errorf("load recipients from %s: %w", source, err)
+	}
+	addresses, err := parseRecipientList(data)
+	if err != nil {
+		return nil, fmt.Errorf("recipients from %s: %w", source, err)
+	}
+	if len(addresses) == 0 {
+		return nil, fmt.Errorf("recipients from %s: no addresses found", source)
+	}
+	return addresses, nil
+}
+
+// isRecipientSource reports whether list is a single file:// or http(s)
+// source rather than addresses.
+func isRecipientSource(list []string) bool {
+	if len(list) != 1 {
+		return false
+	}
+	source := strings.TrimSpace(list[0])
+	return strings.HasPrefix(strings.ToLower(source), "file://") || looksLikeURL(source)
+}
+
+func readRecipientSource(source string) ([]byte, error) {
+	if looksLikeURL(source) {
+		resp, err := recipientSourceClient.Get(source)
+		if err != nil {
+			return nil, err
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("unexpected status %s", resp.Status)
+		}
+		return io.ReadAll(io.LimitReader(resp.Body, maxRecipientSourceSize))
+	}
+	parsed, err := url.Parse(source)
+	if err != nil {
+		return nil, err
+	}
+	path := parsed.Path
+	if parsed.Host != "" {
+		// file://relative/path keeps the first segment in Host.
+		path = parsed.Host + path
+	}
+	return os.ReadFile(path)
+}
+
+// parseRecipientList reads one address per line or CSV rows. A header row with
+// an "email" column selects that column (and "name", if present); otherwise
+// every field is an address. Blank lines and lines starting with # are skipped.
+func parseRecipientList(data []byte) ([]string, error) {
+	reader := csv.NewReader(bytes.NewReader(data))
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+	reader.Comment = '#'
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	emailCol, nameCol := -1, -1
+	if len(records) > 0 {
+		for i, field := range records[0] {
+			switch strings.ToLower(strings.TrimSpace(field)) {
+			case "email", "email_address", "address":
+				emailCol = i
+			case "name", "display_name":
+				nameCol = i
+			}
+		}
+		if emailCol >= 0 {
+			records = records[1:]
+		}
+	}
+	var (
+		out     []string
+		invalid []string
+	)
+	for _, record := range records {
+		var fields []string
+		if emailCol >= 0 {
+			if emailCol >= len(record) {
+				continue
+			}
+			entry := strings.TrimSpace(record[emailCol])
+			if nameCol >= 0 && nameCol < len(record) && strings.TrimSpace(record[nameCol]) != "" && entry != "" {
+				entry = (&mail.Address{Name: strings.TrimSpace(record[nameCol]), Address: entry}).String()
+			}
+			fields = []string{entry}
+		} else {
+			fields = record
+		}
+		for _, field := range fields {
+			field = strings.TrimSpace(field)
+			if field == "" {
+				continue
+			}
+			if _, err := mail.ParseAddress(field); err != nil {
+				invalid = append(invalid, field)
+				continue
+			}
+			out = append(out, field)
+		}
+	}
+	if len(invalid) > 0 {
+		return nil, fmt.Errorf("invalid addresses: %s", strings.Join(invalid, ", "))
+	}
+	return out, nil
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseConfig_RecipientsFromFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "recipients.txt")
+	content := "# newsletter list\na@example.com\n\nB <b@example.com>\nc@example.com, d@example.com\n"
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := parseConfig(map[string]any{
+		"from": "news@example.com",
+		"to":   "file://" + path,
+		"host": "smtp.example.com",
+	})
+	if err != nil {
+		t.Fatalf("parseConfig: %v", err)
+	}
+	want := []string{"a@example.com", "B <b@example.com>", "c@example.com", "d@example.com"}
+	if strings.Join(cfg.To, "|") != strings.Join(want, "|") {
+		t.Fatalf("expected %v, got %v", want, cfg.To)
+	}
+}
+
+func TestParseConfig_RecipientsFromURL(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/list.csv":
+			w.Write([]byte("name,email,plan\nAda,ada@example.com,pro\n,bob@example.com,free\n"))
+		case "/bad.csv":
+			w.Write([]byte("ok@example.com\nnot-an-address\n"))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	cfg, err := parseConfig(map[string]any{
+		"from": "news@example.com",
+		"to":   "ops@example.com",
+		"bcc":  srv.URL + "/list.csv",
+		"host": "smtp.example.com",
+	})
+	if err != nil {
+		t.Fatalf("parseConfig: %v", err)
+	}
+	if len(cfg.BCC) != 2 || cfg.BCC[0] != `"Ada" <ada@example.com>` || cfg.BCC[1] != "bob@example.com" {
+		t.Fatalf("unexpected bcc list %q", cfg.BCC)
+	}
+	if len(cfg.To) != 1 || cfg.To[0] != "ops@example.com" {
+		t.Fatalf("inline recipients should be untouched, got %v", cfg.To)
+	}
+
+	for path, want := range map[string]string{"/bad.csv": "not-an-address", "/missing.csv": "404"} {
+		_, err := parseConfig(map[string]any{"from": "news@example.com", "to": srv.URL + path, "host": "smtp.example.com"})
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Fatalf("%s: expected error mentioning %q, got %v", path, want, err)
+		}
+	}
+}
@@ -0,0 +1,78 @@
+package main
+
+import "fmt"
+
+// Recipient policies for SMTP sends with several RCPT TO commands.
+const (
+	// recipientPolicyBestEffort delivers to the accepted recipients and reports
+	// the rejected ones in the SendResult.
+	recipientPolicyBestEffort = "best_effort"
+	// recipientPolicyAllOrNothing aborts the transaction on the first rejection.
+	recipientPolicyAllOrNothing = "all_or_nothing"
+)
+
+func validateRecipientPolicy(policy string) error {
+	switch policy {
+	case "", recipientPolicyBestEffort, recipientPolicyAllOrNothing:
+		return nil
+	default:
+		return fmt.Errorf("invalid recipient policy %q (expected best_effort or all_or_nothing)", policy)
+	}
+}
+
+// RecipientResult is the delivery outcome for one envelope recipient.
+type RecipientResult struct {
+	Address  string
+	Accepted bool
+	Err      error
+}
+
+// SendResult reports per-recipient outcomes of a send. HTTP providers do not
+// report individual recipients, so their accepted sends list every recipient.
+type SendResult struct {
+	Provider   string
+	Recipients []RecipientResult
+}
+
+// Accepted returns the recipients the message was delivered to.
+func (r *SendResult) Accepted() []string {
+	var out []string
+	for _, rr := range r.Recipients {
+		if rr.Accepted {
+			out = append(out, rr.Address)
+		}
+	}
+	return out
+}
+
+// Rejected returns the recipients that did not receive the message.
+func (r *SendResult) Rejected() []RecipientResult {
+	var out []RecipientResult
+	for _, rr := range r.Recipients {
+		if !rr.Accepted {
+			out = append(out, rr)
+		}
+	}
+	return out
+}
+
+func (r *SendResult) set(address string, err error) {
+	for i := range r.Recipients {
+		if r.Recipients[i].Address == address {
+			r.Recipients[i] = RecipientResult{Address: address, Accepted: err == nil, Err: err}
+			return
+		}
+	}
+	r.Recipients = append(r.Recipients, RecipientResult{Address: address, Accepted: err == nil, Err: err})
+}
+
+// merge folds the outcome of a later attempt into r.
+func (r *SendResult) merge(other *SendResult) {
+	if other == nil {
+		return
+	}
+	r.Provider = other.Provider
+	for _, rr := range other.Recipients {
+		r.set(rr.Address, rr.Err)
+	}
+}
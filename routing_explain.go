@@ -0,0 +1,108 @@
+package main
+
+import (
+	"math"
+)
+
+// RoutingExplanation is the decision trace behind a send's provider order:
+// where the candidates came from, which routes matched or were skipped for
+// their limits, how candidates scored and which provider would be tried first.
+type RoutingExplanation struct {
+	// Source is "provider_priority", "route" or "default".
+	Source string `json:"source"`
+	// RouteIndex is the matched route's position in provider_routes, or -1.
+	RouteIndex    int             `json:"route_index"`
+	Route         *ProviderRoute  `json:"route,omitempty"`
+	SkippedRoutes []SkippedRoute  `json:"skipped_routes,omitempty"`
+	Candidates    []string        `json:"candidates"`
+	Selection     string          `json:"selection,omitempty"`
+	Scores        []ProviderScore `json:"scores,omitempty"`
+	Order         []string        `json:"order"`
+	Provider      string          `json:"provider"`
+}
+
+// SkippedRoute is a matching route that was passed over because a send limit
+// is exhausted.
+type SkippedRoute struct {
+	Index  int    `json:"index"`
+	Reason string `json:"reason"`
+}
+
+// ExplainRouting reports how cfg would be routed without sending it. The
+// config is prepared as for a send so subject-based routes see the rendered
+// subject.
+func ExplainRouting(cfg *EmailConfig) RoutingExplanation {
+	prepared, err := prepareSendConfig(cfg)
+	if err != nil {
+		logger().Warn("explain routing: using unprepared config", "error", err)
+		prepared = cfg
+	}
+	trace := RoutingExplanation{RouteIndex: -1}
+	routeProviders(prepared, &trace)
+	return trace
+}
+
+func (t *RoutingExplanation) candidates(source string, list []string) {
+	if t == nil {
+		return
+	}
+	t.Source = source
+	t.Candidates = append([]string{}, list...)
+}
+
+func (t *RoutingExplanation) route(cfg *EmailConfig, r *ProviderRoute) {
+	if t == nil {
+		return
+	}
+	for i := range cfg.ProviderRoutes {
+		if &cfg.ProviderRoutes[i] == r {
+			t.RouteIndex = i
+		}
+	}
+	t.Route = r
+}
+
+func (t *RoutingExplanation) skip(index int, reason string) {
+	if t == nil {
+		return
+	}
+	t.SkippedRoutes = append(t.SkippedRoutes, SkippedRoute{Index: index, Reason: reason})
+}
+
+// score records the scores the candidates are ordered by for route r (nil for
+// plain usage ordering).
+func (t *RoutingExplanation) score(r *ProviderRoute, list []string) {
+	if t == nil {
+		return
+	}
+	if r == nil {
+		t.Selection = "usage"
+		t.Scores = usageScores(list, nil, 0, nil, 0, nil, nil)
+		return
+	}
+	if r.Selection == "cost_reliability" {
+		t.Selection = r.Selection
+		for _, name := range list {
+			if meta, ok := ProviderInfo(name); ok {
+				if score := costReliabilityScore(meta); !math.IsInf(score, 0) && !math.IsNaN(score) {
+					t.Scores = append(t.Scores, ProviderScore{Provider: name, Cost: meta.Cost, Score: score})
+				}
+			}
+		}
+		return
+	}
+	t.Selection = "usage"
+	t.Scores = usageScores(list, r.ToDomains, r.SelectionWindow, r.ProviderWeights, r.RecencyHalfLife, r.ProviderCapacities, r.ProviderCostOverrides)
+}
+
+// order records the final provider order and returns it unchanged.
+func (t *RoutingExplanation) order(list []string) []string {
+	if t == nil {
+		return list
+	}
+	t.Order = append([]string{}, list...)
+	if len(list) > 0 {
+		t.Provider = list[0]
+	}
+	return list
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestExplainRouting_ReportsScoresAndChosenProvider(t *testing.T) {
+	defer withTempSendLog(t)()
+	now := time.Now().UTC().Format(time.RFC3339)
+	entry := `{"timestamp":"` + now + `","attempt":1,"provider":"sendgrid","success":true,"recipients":["a@gmail.com"]}` + "\n"
+	if err := os.WriteFile(sendLogFile, []byte(entry+entry), 0o644); err != nil {
+		t.Fatalf("cannot write test log: %v", err)
+	}
+	cfg := &EmailConfig{
+		From:    "sender@example.com",
+		To:      []string{"user@gmail.com"},
+		Subject: "hi",
+		ProviderRoutes: []ProviderRoute{
+			{ToDomains: []string{"yahoo.com"}, Provider: "mailgun"},
+			{ToDomains: []string{"gmail.com"}, ProviderPriority: []string{"sendgrid", "resend"}},
+		},
+	}
+	exp := ExplainRouting(cfg)
+	if exp.Source != "route" || exp.RouteIndex != 1 {
+		t.Fatalf("expected route 1 to match, got source=%q index=%d", exp.Source, exp.RouteIndex)
+	}
+	if len(exp.Candidates) != 2 || len(exp.Scores) != 2 {
+		t.Fatalf("expected two scored candidates, got %v / %+v", exp.Candidates, exp.Scores)
+	}
+	scores := map[string]ProviderScore{}
+	for _, s := range exp.Scores {
+		scores[s.Provider] = s
+	}
+	if scores["sendgrid"].WeightedCount <= 0 || scores["sendgrid"].Score <= scores["resend"].Score {
+		t.Fatalf("expected recent sendgrid usage to raise its score, got %+v", exp.Scores)
+	}
+	if exp.Provider != "resend" || exp.Order[0] != "resend" {
+		t.Fatalf("expected resend chosen, got %q (order %v)", exp.Provider, exp.Order)
+	}
+	if got := resolveProviders(cfg); got[0] != exp.Provider {
+		t.Fatalf("explanation disagrees with resolveProviders: %v", got)
+	}
+}
+
+func TestExplainRouting_ReportsSkippedRouteLimit(t *testing.T) {
+	defer withTempSendLog(t)()
+	now := time.Now().UTC().Format(time.RFC3339)
+	entry := `{"timestamp":"` + now + `","attempt":1,"provider":"sendgrid","success":true,"recipients":["user@gmail.com"]}` + "\n"
+	if err := os.WriteFile(sendLogFile, []byte(entry), 0o644); err != nil {
+		t.Fatalf("cannot write test log: %v", err)
+	}
+	cfg := &EmailConfig{
+		To:       []string{"user@gmail.com"},
+		Provider: "smtp",
+		ProviderRoutes: []ProviderRoute{
+			{ToDomains: []string{"gmail.com"}, ProviderPriority: []string{"sendgrid"}, HourlyLimit: 1},
+		},
+	}
+	exp := ExplainRouting(cfg)
+	if len(exp.SkippedRoutes) != 1 || !strings.Contains(exp.SkippedRoutes[0].Reason, "hourly limit 1") {
+		t.Fatalf("expected the exhausted route to be reported, got %+v", exp.SkippedRoutes)
+	}
+	if exp.Source != "default" || exp.Provider != "smtp" {
+		t.Fatalf("expected fallback to smtp, got source=%q provider=%q", exp.Source, exp.Provider)
+	}
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/microcosm-cc/bluemonday"
+)
+
+// htmlSanitizer allows common formatting, links, images and tables and strips
+// scripts, <style> elements, event handlers and other active content. Inline
+// style attributes are kept for safeCSSProperties, so HTML inlined by
+// inline_css keeps its styling; bluemonday validates each property's value.
+var htmlSanitizer = func() *bluemonday.Policy {
+	p := bluemonday.UGCPolicy()
+	p.AllowStyles(safeCSSProperties...).Globally()
+	return p
+}()
+
+// safeCSSProperties are the style properties email layouts rely on. Anything
+// that can load resources (background-image, list-style-image) or escape the
+// message layout (position) is left out.
+var safeCSSProperties = []string{
+	"color", "background-color",
+	"font", "font-family", "font-size", "font-style", "font-weight",
+	"line-height", "letter-spacing", "text-align", "text-decoration", "text-transform", "text-indent",
+	"vertical-align", "white-space", "word-break",
+	"margin", "margin-top", "margin-right", "margin-bottom", "margin-left",
+	"padding", "padding-top", "padding-right", "padding-bottom", "padding-left",
+	"border", "border-top", "border-right", "border-bottom", "border-left",
+	"border-color", "border-style", "border-width", "border-radius", "border-collapse", "border-spacing",
+	"width", "height", "max-width", "min-width", "max-height", "min-height",
+	"display", "text-overflow", "overflow",
+}
+
+// sanitizeHTMLBody cleans cfg.HTMLBody when SanitizeHTML is set. It runs after
+// placeholders are applied so user data substituted into templates is covered.
+func sanitizeHTMLBody(cfg *EmailConfig) {
+	if !cfg.SanitizeHTML || cfg.HTMLBody == "" {
+		return
+	}
+	cfg.HTMLBody = htmlSanitizer.Sanitize(cfg.HTMLBody)
+}
+
+var headerBreakReplacer = strings.NewReplacer("\r\n", " ", "\r", " ", "\n", " ")
+
+// stripHeaderBreaks replaces CR and LF in a header value with spaces so the
+// value cannot end its header line and start another.
+func stripHeaderBreaks(value string) string {
+	return headerBreakReplacer.Replace(value)
+}
+
+func stripHeaderBreaksAll(values []string) []string {
+	if values == nil {
+		return nil
+	}
+	out := make([]string, len(values))
+	for i, v := range values {
+		out[i] = stripHeaderBreaks(v)
+	}
+	return out
+}
+
+// validHeaderName reports whether name is an RFC 5322 field name: printable
+// ASCII without spaces or colons.
+func validHeaderName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for i := 0; i < len(name); i++ {
+		if c := name[i]; c < 33 || c > 126 || c == ':' {
+			return false
+		}
+	}
+	return true
+}
+
+// headerSafeConfig returns a copy of cfg whose header-bound fields cannot
+// inject extra headers: CR/LF become spaces and custom headers with invalid
+// names are dropped. buildMessage uses it because placeholders substituted
+// after parsing can still carry line breaks.
+func headerSafeConfig(cfg *EmailConfig) *EmailConfig {
+	safe := *cfg
+	safe.From = stripHeaderBreaks(cfg.From)
+	safe.FromName = stripHeaderBreaks(cfg.FromName)
+	safe.Username = stripHeaderBreaks(cfg.Username)
+	safe.EnvelopeFrom = stripHeaderBreaks(cfg.EnvelopeFrom)
+	safe.Host = stripHeaderBreaks(cfg.Host)
+	safe.Subject = stripHeaderBreaks(cfg.Subject)
+	safe.HeaderTo = stripHeaderBreaks(cfg.HeaderTo)
+	safe.To = stripHeaderBreaksAll(cfg.To)
+	safe.CC = stripHeaderBreaksAll(cfg.CC)
+	safe.ReplyTo = stripHeaderBreaksAll(cfg.ReplyTo)
+	safe.ListUnsubscribe = stripHeaderBreaksAll(cfg.ListUnsubscribe)
+	safe.ConfigurationSet = stripHeaderBreaks(cfg.ConfigurationSet)
+	if cfg.Headers != nil {
+		safe.Headers = make(map[string]string, len(cfg.Headers))
+		for k, v := range cfg.Headers {
+			if !validHeaderName(k) {
+				logger().Warn("dropping header with invalid name", "header", k)
+				continue
+			}
+			safe.Headers[k] = stripHeaderBreaks(v)
+		}
+	}
+	if cfg.Tags != nil {
+		safe.Tags = make(map[string]string, len(cfg.Tags))
+		for k, v := range cfg.Tags {
+			safe.Tags[stripHeaderBreaks(k)] = stripHeaderBreaks(v)
+		}
+	}
+	return &safe
+}
+
+// validateHeaderFields rejects configured addresses and custom headers that
+// contain line breaks, which could otherwise inject headers into the message.
+func validateHeaderFields(cfg *EmailConfig) error {
+	fields := map[string][]string{
+		"from": {cfg.From, cfg.FromName}, "to": cfg.To, "cc": cfg.CC, "bcc": cfg.BCC,
+		"reply_to": cfg.ReplyTo, "header_to": {cfg.HeaderTo},
+	}
+	for field, values := range fields {
+		for _, v := range values {
+			if strings.ContainsAny(v, "\r\n") {
+				return fmt.Errorf("%s: line breaks are not allowed in %q", field, v)
+			}
+		}
+	}
+	for k, v := range cfg.Headers {
+		if !validHeaderName(k) {
+			return fmt.Errorf("headers: invalid header name %q", k)
+		}
+		if strings.ContainsAny(v, "\r\n") {
+			return fmt.Errorf("headers: line breaks are not allowed in the %s value", k)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"net/mail"
+	"strings"
+	"testing"
+)
+
+func TestPrepareSendConfig_SanitizeHTML(t *testing.T) {
+	html := `<p>Hello <strong>{{name}}</strong>, see <a href="https://example.com/offer" onclick="steal()">the offer</a>.</p>` +
+		`<script>alert(1)</script><ul><li><em>one</em></li></ul><img src="x.png" onerror="steal()">`
+	cfg := &EmailConfig{
+		HTMLBody:       html,
+		TextBody:       "Hello",
+		SanitizeHTML:   true,
+		AdditionalData: map[string]any{"name": `Ada<script>document.cookie</script>`},
+	}
+	prepared, err := prepareSendConfig(cfg)
+	if err != nil {
+		t.Fatalf("prepareSendConfig: %v", err)
+	}
+	out := prepared.HTMLBody
+	for _, banned := range []string{"<script", "alert(1)", "document.cookie", "onclick", "onerror"} {
+		if strings.Contains(out, banned) {
+			t.Fatalf("sanitized HTML still contains %q: %s", banned, out)
+		}
+	}
+	for _, kept := range []string{"<p>", "<strong>Ada</strong>", `href="https://example.com/offer"`, "<ul><li><em>one</em></li></ul>", `src="x.png"`} {
+		if !strings.Contains(out, kept) {
+			t.Fatalf("sanitized HTML lost %q: %s", kept, out)
+		}
+	}
+
+	cfg.SanitizeHTML = false
+	prepared, err = prepareSendConfig(cfg)
+	if err != nil {
+		t.Fatalf("prepareSendConfig: %v", err)
+	}
+	if !strings.Contains(prepared.HTMLBody, "<script>alert(1)</script>") {
+		t.Fatalf("expected HTML untouched when sanitize_html is off")
+	}
+}
+
+func TestBuildMessage_StripsHeaderInjection(t *testing.T) {
+	cfg := &EmailConfig{
+		From:     "sender@example.com",
+		To:       []string{"user@example.com"},
+		Subject:  "Hello\r\nBcc: attacker@evil.com",
+		TextBody: "body",
+		Headers: map[string]string{
+			"X-Campaign":              "spring\nBcc: attacker@evil.com",
+			"X-Evil\r\nBcc":           "attacker@evil.com",
+			"Reply-To: attacker@evil": "x",
+		},
+	}
+	msg, err := buildMessage(cfg)
+	if err != nil {
+		t.Fatalf("buildMessage: %v", err)
+	}
+	parsed, err := mail.ReadMessage(strings.NewReader(msg))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := parsed.Header.Get("Bcc"); got != "" {
+		t.Fatalf("a Bcc header was injected: %q", got)
+	}
+	if got := parsed.Header.Get("Subject"); got != "Hello Bcc: attacker@evil.com" {
+		t.Fatalf("expected the subject kept on one line, got %q", got)
+	}
+	if got := parsed.Header.Get("X-Campaign"); got != "spring Bcc: attacker@evil.com" {
+		t.Fatalf("expected the header value kept on one line, got %q", got)
+	}
+	if got := parsed.Header.Get("Reply-To"); got != "" {
+		t.Fatalf("a header with an invalid name was written: %q", got)
+	}
+	if cfg.Subject != "Hello\r\nBcc: attacker@evil.com" {
+		t.Fatal("buildMessage must not modify the caller's config")
+	}
+}
+
+func TestParseConfig_RejectsHeaderInjection(t *testing.T) {
+	base := func() map[string]any {
+		return map[string]any{"host": "smtp.example.com", "from": "a@example.com", "to": "b@example.com"}
+	}
+	for name, mutate := range map[string]func(map[string]any){
+		"to":          func(m map[string]any) { m["to"] = []any{"b@example.com\r\nBcc: attacker@evil.com"} },
+		"header name": func(m map[string]any) { m["headers"] = map[string]any{"X-A\nBcc": "attacker@evil.com"} },
+		"header value": func(m map[string]any) {
+			m["headers"] = map[string]any{"X-A": "ok\r\nBcc: attacker@evil.com"}
+		},
+	} {
+		raw := base()
+		mutate(raw)
+		if _, err := parseConfig(raw); err == nil {
+			t.Fatalf("%s: expected parseConfig to reject line breaks", name)
+		}
+	}
+}
+
+func TestPrepareSendConfig_InlineCSSSurvivesSanitize(t *testing.T) {
+	cfg := &EmailConfig{
+		HTMLBody: `<style>p { color: #ff0000; font-weight: bold } .note { position: fixed }</style>` +
+			`<p class="note" onclick="steal()">Hi</p><script>alert(1)</script>`,
+		TextBody:     "Hi",
+		InlineCSS:    true,
+		SanitizeHTML: true,
+	}
+	prepared, err := prepareSendConfig(cfg)
+	if err != nil {
+		t.Fatalf("prepareSendConfig: %v", err)
+	}
+	out := prepared.HTMLBody
+	for _, banned := range []string{"<script", "<style", "onclick", "position"} {
+		if strings.Contains(out, banned) {
+			t.Fatalf("sanitized HTML still contains %q: %s", banned, out)
+		}
+	}
+	if !strings.Contains(out, "color: #ff0000") || !strings.Contains(out, "font-weight: bold") {
+		t.Fatalf("expected the inlined styles to survive sanitizing: %s", out)
+	}
+}
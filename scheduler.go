@@ -3,8 +3,10 @@ package main
 import (
 	"errors"
 	"fmt"
-	"log"
+	"log/slog"
+	mrand "math/rand"
 	"os"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -17,8 +19,18 @@ type ScheduledEmail struct {
 	RunAt    time.Time      `json:"run_at"`
 	Attempts int            `json:"attempts"`
 	Meta     map[string]any `json:"meta,omitempty"`
+	// Priority orders jobs due at the same time; higher runs first.
+	Priority int `json:"priority,omitempty"`
+	// LeasedUntil marks a job as in flight. It is set before sending and
+	// cleared on failure, so a job left leased by a crash is not re-run
+	// until the lease expires.
+	LeasedUntil time.Time `json:"leased_until,omitzero"`
 }
 
+// defaultJobLease bounds how long a job stays leased when the process sending
+// it dies before recording the outcome.
+const defaultJobLease = 10 * time.Minute
+
 // Scheduler is a simple in-process scheduler with pluggable persistence.
 type Scheduler struct {
 	store    JobStore
@@ -29,6 +41,21 @@ type Scheduler struct {
 	interval time.Duration
 	// Optimizer optionally allocates providers across batch of due jobs.
 	Optimizer SchedulerOptimizer
+	// Logger receives the scheduler's logs; nil uses the package logger
+	// (see SetLogger).
+	Logger *slog.Logger
+	// Precise wakes the loop exactly at the earliest pending RunAt instead of
+	// waiting for the next poll; polling still runs as a fallback.
+	Precise bool
+	// LeaseDuration is how long a job stays leased while it sends; zero uses
+	// defaultJobLease. It should exceed the longest expected send.
+	LeaseDuration time.Duration
+
+	// wakeup is signalled by Schedule so a precise loop picks up new jobs.
+	wakeup chan struct{}
+	// now and after are the loop's clock, replaceable in tests.
+	now   func() time.Time
+	after func(time.Duration) <-chan time.Time
 }
 
 // NewScheduler creates a scheduler with the provided store and polling interval.
@@ -36,7 +63,14 @@ func NewScheduler(store JobStore, interval time.Duration) *Scheduler {
 	if interval <= 0 {
 		interval = 5 * time.Second
 	}
-	return &Scheduler{store: store, stop: make(chan struct{}), interval: interval}
+	return &Scheduler{
+		store:    store,
+		stop:     make(chan struct{}),
+		interval: interval,
+		wakeup:   make(chan struct{}, 1),
+		now:      time.Now,
+		after:    time.After,
+	}
 }
 
 // Start begins the scheduler loop. It runs until Stop() is called.
@@ -49,7 +83,10 @@ func (s *Scheduler) Start() error {
 	s.running = true
 	s.mu.Unlock()
 
-	log.Println("scheduler starting")
+	s.logger().Info("scheduler starting")
+	if n := pruneDedupStore(); n > 0 {
+		s.logger().Info("scheduler: pruned expired dedup keys", "count", n)
+	}
 	s.wg.Add(1)
 	go s.runLoop()
 	return nil
@@ -67,7 +104,11 @@ func (s *Scheduler) Stop() {
 
 	close(s.stop)
 	s.wg.Wait()
-	log.Println("scheduler stopped")
+	closeSMTPPool()
+	if err := FlushSendLog(); err != nil {
+		s.logger().Error("scheduler: cannot flush send log", "error", err)
+	}
+	s.logger().Info("scheduler stopped")
 }
 
 func (s *Scheduler) runLoop() {
@@ -75,104 +116,272 @@ func (s *Scheduler) runLoop() {
 	ticker := time.NewTicker(s.interval)
 	defer ticker.Stop()
 
+	var wake <-chan time.Time
+	if s.Precise {
+		wake = s.nextWake(s.now())
+	}
 	for {
 		select {
 		case <-s.stop:
 			return
 		case now := <-ticker.C:
-			jobs, err := s.store.ListDue(now)
-			if err != nil {
-				log.Printf("scheduler: error listing due jobs: %v", err)
-				continue
-			}
-			// Optionally run optimizer to allocate providers across batch
-			alloc := map[string]string{}
-			if s.Optimizer != nil {
-				alloc = s.Optimizer.AllocateJobs(jobs)
+			s.runDue(now)
+		case <-wake:
+			s.runDue(s.now())
+		case <-s.wakeup:
+		}
+		if s.Precise {
+			wake = s.nextWake(s.now())
+		}
+	}
+}
+
+// nextWake returns a channel that fires at the earliest RunAt after now when
+// that comes before the next poll, or nil to rely on polling.
+func (s *Scheduler) nextWake(now time.Time) <-chan time.Time {
+	jobs, err := s.store.ListAll()
+	if err != nil {
+		s.logger().Error("scheduler: cannot list jobs", "error", err)
+		return nil
+	}
+	var next time.Time
+	for _, j := range jobs {
+		if j.RunAt.After(now) && (next.IsZero() || j.RunAt.Before(next)) {
+			next = j.RunAt
+		}
+	}
+	if next.IsZero() || next.Sub(now) >= s.interval {
+		return nil
+	}
+	return s.after(next.Sub(now))
+}
+
+// runDue executes every job due at now, each in its own goroutine.
+func (s *Scheduler) runDue(now time.Time) {
+	jobs, err := s.store.ListDue(now)
+	if err != nil {
+		s.logger().Error("scheduler: cannot list due jobs", "error", err)
+		return
+	}
+	jobs = s.unleased(jobs, now)
+	// Optionally run optimizer to allocate providers across batch
+	alloc := map[string]string{}
+	if s.Optimizer != nil {
+		alloc = s.Optimizer.AllocateJobs(jobs)
+	}
+	for _, job := range jobs {
+		// execute each job in its own goroutine
+		j := job
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			s.logger().Info("scheduler: executing job", "job_id", j.ID, "run_at", j.RunAt)
+
+			// Make a local copy of the config and merge job meta into AdditionalData
+			cfgCopy := *j.Config
+			cfgCopy.AdditionalData = cloneAdditionalData(j.Config.AdditionalData)
+			if cfgCopy.AdditionalData == nil {
+				cfgCopy.AdditionalData = map[string]any{}
 			}
-			for _, job := range jobs {
-				// execute each job in its own goroutine
-				j := job
-				s.wg.Add(1)
-				go func() {
-					defer s.wg.Done()
-					log.Printf("scheduler: executing job %s (run_at=%s)", j.ID, j.RunAt)
-
-					// Make a local copy of the config and merge job meta into AdditionalData
-					cfgCopy := *j.Config
-					cfgCopy.AdditionalData = cloneAdditionalData(j.Config.AdditionalData)
-					if cfgCopy.AdditionalData == nil {
-						cfgCopy.AdditionalData = map[string]any{}
+			ctx := buildSendContext(j)
+			if ctx.RequireLastSuccess && ctx.PrevJobID != "" {
+				if res, ok := getJobResult(ctx.PrevJobID); ok {
+					if res != JobResultSuccess {
+						handleDependencyFailure(ctx, s, j, res)
+						return
 					}
-					ctx := buildSendContext(j)
-					if ctx.RequireLastSuccess && ctx.PrevJobID != "" {
-						if res, ok := getJobResult(ctx.PrevJobID); ok {
-							if res != JobResultSuccess {
-								handleDependencyFailure(ctx, s, j, res)
-								return
-							}
-						} else {
-							// Previous job hasn't completed yet, reschedule this job for later
-							log.Printf("scheduler: job %s waiting for dependency %s, rescheduling", j.ID, ctx.PrevJobID)
-							// Reschedule for 10 seconds later
-							j.RunAt = time.Now().Add(10 * time.Second)
-							if err := s.store.Update(j); err != nil {
-								log.Printf("scheduler: cannot reschedule job %s: %v", j.ID, err)
-							}
-							return
-						}
+				} else {
+					// Previous job hasn't completed yet, reschedule this job for later
+					s.logger().Info("scheduler: job waiting for dependency, rescheduling", "job_id", j.ID, "dependency", ctx.PrevJobID)
+					// Reschedule for 10 seconds later
+					j.RunAt = time.Now().Add(10 * time.Second)
+					if err := s.store.Update(j); err != nil {
+						s.logger().Error("scheduler: cannot reschedule job", "job_id", j.ID, "error", err)
 					}
+					return
+				}
+			}
 
-					for k, v := range j.Meta {
-						if strings.TrimSpace(k) == "" {
-							continue
-						}
-						cfgCopy.AdditionalData[k] = v
-					}
+			for k, v := range j.Meta {
+				if strings.TrimSpace(k) == "" {
+					continue
+				}
+				cfgCopy.AdditionalData[k] = v
+			}
 
-					// If optimizer assigned a provider for this job, apply it to the local config copy
-					if p, ok := alloc[j.ID]; ok && p != "" {
-						cfgCopy.Provider = p
-					}
+			// If optimizer assigned a provider for this job, pin the local config copy to it
+			if p, ok := alloc[j.ID]; ok && p != "" {
+				pinProvider(&cfgCopy, p)
+			}
 
-					if err := sendEmail(&cfgCopy, ctx); err != nil {
-						if errors.Is(err, errDeduplicated) {
-							log.Printf("scheduler: job %s skipped due to deduplication", j.ID)
-							recordJobResult(j.ID, JobResultSkipped)
-							if err := s.store.Delete(j.ID); err != nil && !os.IsNotExist(err) {
-								log.Printf("scheduler: cannot delete job %s: %v", j.ID, err)
-							}
-							return
-						}
-						log.Printf("scheduler: job %s failed: %v", j.ID, err)
-						// increase attempts and persist
-						j.Attempts++
-						if err := s.store.Update(j); err != nil {
-							log.Printf("scheduler: cannot update job %s: %v", j.ID, err)
-						}
-						recordJobResult(j.ID, JobResultFailed)
-						return
+			// Another scheduler sharing the store may have picked the job up
+			// since it was listed; only the run that takes the lease sends.
+			until := s.now().Add(s.leaseDuration()).UTC()
+			leased, err := s.store.Lease(j.ID, now, until)
+			if err != nil {
+				if os.IsNotExist(err) {
+					s.logger().Info("scheduler: job already handled, skipping", "job_id", j.ID)
+					return
+				}
+				s.logger().Error("scheduler: cannot lease job", "job_id", j.ID, "error", err)
+				return
+			}
+			if !leased {
+				s.logger().Info("scheduler: job is leased, skipping", "job_id", j.ID)
+				return
+			}
+			if !j.LeasedUntil.IsZero() {
+				s.logger().Warn("scheduler: re-running job whose lease expired; it may already have been delivered", "job_id", j.ID, "leased_until", j.LeasedUntil)
+			}
+			j.LeasedUntil = until
+
+			if err := sendEmail(&cfgCopy, ctx); err != nil {
+				if errors.Is(err, errDeduplicated) {
+					s.logger().Info("scheduler: job skipped due to deduplication", "job_id", j.ID)
+					recordJobResult(j.ID, JobResultSkipped)
+					if err := s.store.Delete(j.ID); err != nil && !os.IsNotExist(err) {
+						s.logger().Error("scheduler: cannot delete job", "job_id", j.ID, "error", err)
 					}
-					recordJobResult(j.ID, JobResultSuccess)
-					// success -> remove job
+					return
+				}
+				if errors.Is(err, errRecipientsBlocked) {
+					s.logger().Warn("scheduler: job blocked by recipient allow/deny lists", "job_id", j.ID)
+					recordJobResult(j.ID, JobResultBlocked)
 					if err := s.store.Delete(j.ID); err != nil && !os.IsNotExist(err) {
-						log.Printf("scheduler: cannot delete job %s: %v", j.ID, err)
+						s.logger().Error("scheduler: cannot delete job", "job_id", j.ID, "error", err)
 					}
-				}()
+					return
+				}
+				s.logger().Warn("scheduler: job failed", "job_id", j.ID, "error", err)
+				// increase attempts, release the lease and persist
+				j.Attempts++
+				j.LeasedUntil = time.Time{}
+				if err := s.store.Update(j); err != nil {
+					s.logger().Error("scheduler: cannot update job", "job_id", j.ID, "error", err)
+				}
+				recordJobResult(j.ID, JobResultFailed)
+				return
+			}
+			recordJobResult(j.ID, JobResultSuccess)
+			// success -> remove job
+			if err := s.store.Delete(j.ID); err != nil && !os.IsNotExist(err) {
+				s.logger().Error("scheduler: cannot delete job", "job_id", j.ID, "error", err)
 			}
+		}()
+	}
+}
+
+// unleased drops jobs whose lease has not expired at now: another run is
+// sending them, or a crashed one may already have delivered them.
+func (s *Scheduler) unleased(jobs []*ScheduledEmail, now time.Time) []*ScheduledEmail {
+	out := jobs[:0]
+	for _, j := range jobs {
+		if j.LeasedUntil.After(now) {
+			s.logger().Info("scheduler: job is leased, skipping", "job_id", j.ID, "leased_until", j.LeasedUntil)
+			continue
 		}
+		out = append(out, j)
 	}
+	return out
+}
+
+func (s *Scheduler) leaseDuration() time.Duration {
+	if s.LeaseDuration > 0 {
+		return s.LeaseDuration
+	}
+	return defaultJobLease
+}
+
+// pinProvider makes provider the first candidate for cfg, keeping the other
+// providers cfg routes to as fallbacks after it. The order is frozen: routes
+// and provider_priority would otherwise reorder it and undo the batch
+// allocation.
+func pinProvider(cfg *EmailConfig, provider string) {
+	cfg.pinnedProviders = normalizeProviderList(append([]string{provider}, resolveProviders(cfg)...), "")
+	cfg.Provider = provider
+}
+
+func (s *Scheduler) logger() *slog.Logger {
+	if s.Logger != nil {
+		return redactingLogger(s.Logger)
+	}
+	return logger()
 }
 
 // Schedule schedules a job to run at the given time and persists it.
+// Credentials read from file:// or cmd:// references are stored as the
+// references and resolved again when the job runs.
+// A "priority" meta value sets the job's Priority. When cfg.ScheduleJitter is
+// set, RunAt is spread uniformly within [runAt, runAt+jitter].
 func (s *Scheduler) Schedule(cfg *EmailConfig, runAt time.Time, meta map[string]any) (*ScheduledEmail, error) {
-	job := &ScheduledEmail{ID: randomBoundary("job"), Config: cfg, RunAt: runAt.UTC(), Attempts: 0, Meta: meta}
+	return s.scheduleJob(randomBoundary("job"), cfg, runAt, meta)
+}
+
+// scheduleJob schedules like Schedule under a caller-chosen job ID.
+func (s *Scheduler) scheduleJob(id string, cfg *EmailConfig, runAt time.Time, meta map[string]any) (*ScheduledEmail, error) {
+	if cfg != nil && cfg.ScheduleJitter > 0 {
+		runAt = runAt.Add(time.Duration(mrand.Int63n(int64(cfg.ScheduleJitter) + 1)))
+	}
+	job := &ScheduledEmail{ID: id, Config: cfg.withSecretRefs(), RunAt: runAt.UTC(), Attempts: 0, Meta: meta}
+	if p, ok := meta["priority"]; ok {
+		job.Priority = asInt(p)
+	}
 	if err := s.store.Add(job); err != nil {
 		return nil, err
 	}
+	s.notify()
 	return job, nil
 }
 
+// notify wakes a running loop so it can recompute its next precise wakeup.
+func (s *Scheduler) notify() {
+	if s.wakeup == nil {
+		return
+	}
+	select {
+	case s.wakeup <- struct{}{}:
+	default:
+	}
+}
+
+// ScheduleBulk schedules one job per recipient, each a copy of base with To
+// set to that recipient and base's Cc, Bcc, envelope recipients and To header
+// override cleared, so each job reaches only its own recipient. The jobs are
+// persisted in a single store write. Run times
+// are spread uniformly within [runAt, runAt+jitter]; a zero jitter falls back
+// to base.ScheduleJitter.
+func (s *Scheduler) ScheduleBulk(base *EmailConfig, recipients []string, runAt time.Time, jitter time.Duration) ([]*ScheduledEmail, error) {
+	if base == nil {
+		return nil, errors.New("schedule bulk: base config is required")
+	}
+	if jitter <= 0 {
+		jitter = base.ScheduleJitter
+	}
+	jobs := make([]*ScheduledEmail, 0, len(recipients))
+	for _, rcpt := range recipients {
+		rcpt = strings.TrimSpace(rcpt)
+		if rcpt == "" {
+			continue
+		}
+		cfg := *base
+		cfg.To = []string{rcpt}
+		cfg.CC, cfg.BCC, cfg.EnvelopeRecipients, cfg.HeaderTo = nil, nil, nil, ""
+		at := runAt
+		if jitter > 0 {
+			at = at.Add(time.Duration(mrand.Int63n(int64(jitter) + 1)))
+		}
+		jobs = append(jobs, &ScheduledEmail{ID: randomBoundary("job"), Config: cfg.withSecretRefs(), RunAt: at.UTC()})
+	}
+	if len(jobs) == 0 {
+		return nil, errors.New("schedule bulk: no recipients")
+	}
+	if err := s.store.AddMany(jobs); err != nil {
+		return nil, err
+	}
+	s.notify()
+	return jobs, nil
+}
+
 // ScheduleNow schedules a job to run as soon as possible.
 func (s *Scheduler) ScheduleNow(cfg *EmailConfig, meta map[string]any) (*ScheduledEmail, error) {
 	return s.Schedule(cfg, time.Now().UTC(), meta)
@@ -210,10 +419,10 @@ func handleDependencyFailure(ctx *SendContext, s *Scheduler, job *ScheduledEmail
 		status = JobResultSkipped
 		action = "skipping"
 	}
-	log.Printf("scheduler: %s job %s (step=%s) because dependency %s finished with %s", action, job.ID, ctx.Step, ctx.PrevJobID, prev)
+	s.logger().Info("scheduler: dependency did not succeed", "action", action, "job_id", job.ID, "step", ctx.Step, "dependency", ctx.PrevJobID, "result", prev)
 	recordJobResult(job.ID, status)
 	if err := s.store.Delete(job.ID); err != nil {
-		log.Printf("scheduler: cannot delete job %s: %v", job.ID, err)
+		s.logger().Error("scheduler: cannot delete job", "job_id", job.ID, "error", err)
 	}
 }
 
@@ -221,8 +430,13 @@ func asInt(value any) int {
 	switch v := value.(type) {
 	case int:
 		return v
+	case int64:
+		return int(v)
 	case float64:
 		return int(v)
+	case string:
+		n, _ := strconv.Atoi(strings.TrimSpace(v))
+		return n
 	default:
 		return 0
 	}
@@ -1,8 +1,15 @@
 package main
 
 import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
 	"os"
+	"path/filepath"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 )
 
 func TestGreedyBatchOptimizer_RespectsPerRouteCapacities(t *testing.T) {
@@ -75,3 +82,51 @@ func TestGreedyBatchOptimizer_PrefersLowerCostWhenTied(t *testing.T) {
 		t.Fatalf("expected smtp due to lower cost, got %s", alloc["job1"])
 	}
 }
+
+func TestScheduler_OptimizerCapacityAcrossDueBatch(t *testing.T) {
+	defer withTempSendLog(t)()
+	defer withTempJobResults(t, nil)()
+	withTempDedupStore(t, nil)
+	var mu sync.Mutex
+	hits := map[string]int{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		hits[strings.TrimPrefix(r.URL.Path, "/")]++
+		mu.Unlock()
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer srv.Close()
+	for _, name := range []string{"sendgrid", "smtp"} {
+		orig := providerDefaults[name]
+		defer func(name string) { providerDefaults[name] = orig }(name)
+		RegisterProviderDefault(name, ProviderSetting{Transport: "http", Endpoint: srv.URL + "/" + name})
+	}
+
+	store := NewFileJobStore(filepath.Join(t.TempDir(), "jobs.json"))
+	s := NewScheduler(store, time.Hour)
+	s.Optimizer = &GreedyBatchOptimizer{}
+	now := time.Now().UTC()
+	for i := 0; i < 3; i++ {
+		cfg := &EmailConfig{
+			From:     "sender@example.com",
+			To:       []string{fmt.Sprintf("user%d@gmail.com", i)},
+			Subject:  "hi",
+			TextBody: "body",
+			APIKey:   "key",
+			ProviderRoutes: []ProviderRoute{
+				{ToDomains: []string{"gmail.com"}, ProviderPriority: []string{"sendgrid", "smtp"}, ProviderCapacities: map[string]int{"sendgrid": 2}},
+			},
+		}
+		if _, err := s.Schedule(cfg, now.Add(-time.Second), nil); err != nil {
+			t.Fatalf("schedule: %v", err)
+		}
+	}
+	s.runDue(now)
+	s.wg.Wait()
+
+	mu.Lock()
+	defer mu.Unlock()
+	if hits["sendgrid"] != 2 || hits["smtp"] != 1 {
+		t.Fatalf("expected 2 sendgrid and 1 smtp sends, got %v", hits)
+	}
+}
@@ -0,0 +1,315 @@
+package main
+
+import (
+	"encoding/base64"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestScheduler_PreciseWakesAtRunAt(t *testing.T) {
+	defer withTempSendLog(t)()
+	defer withTempJobResults(t, nil)()
+	withTempDedupStore(t, nil)
+	srv := newStubSMTPServer(t)
+
+	store := NewFileJobStore(filepath.Join(t.TempDir(), "jobs.json"))
+	s := NewScheduler(store, 5*time.Second)
+	s.Precise = true
+	var mu sync.Mutex
+	clock := time.Now().UTC()
+	s.now = func() time.Time {
+		mu.Lock()
+		defer mu.Unlock()
+		return clock
+	}
+	waits := make(chan time.Duration, 4)
+	fire := make(chan time.Time)
+	s.after = func(d time.Duration) <-chan time.Time {
+		waits <- d
+		return fire
+	}
+
+	job, err := s.Schedule(srv.config(), clock.Add(time.Second), nil)
+	if err != nil {
+		t.Fatalf("schedule: %v", err)
+	}
+	if err := s.Start(); err != nil {
+		t.Fatalf("start: %v", err)
+	}
+	defer s.Stop()
+
+	select {
+	case d := <-waits:
+		if d != time.Second {
+			t.Fatalf("expected a wakeup in 1s, got %v", d)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatalf("scheduler did not arm a precise wakeup")
+	}
+	mu.Lock()
+	clock = job.RunAt
+	mu.Unlock()
+	fire <- job.RunAt
+
+	deadline := time.Now().Add(2 * time.Second)
+	for len(srv.Messages()) == 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if len(srv.Messages()) != 1 {
+		t.Fatalf("expected the job to run on the precise wakeup, before the 5s poll")
+	}
+}
+
+func TestScheduler_NextWakeDefersToPolling(t *testing.T) {
+	store := NewFileJobStore(filepath.Join(t.TempDir(), "jobs.json"))
+	s := NewScheduler(store, 5*time.Second)
+	armed := false
+	s.after = func(d time.Duration) <-chan time.Time {
+		armed = true
+		return nil
+	}
+	now := time.Now().UTC()
+	if _, err := s.Schedule(&EmailConfig{}, now.Add(time.Minute), nil); err != nil {
+		t.Fatalf("schedule: %v", err)
+	}
+	s.nextWake(now)
+	if armed {
+		t.Fatalf("jobs beyond the poll interval should wait for polling")
+	}
+	if _, err := s.Schedule(&EmailConfig{}, now.Add(2*time.Second), nil); err != nil {
+		t.Fatalf("schedule: %v", err)
+	}
+	s.nextWake(now)
+	if !armed {
+		t.Fatalf("expected a wakeup for a job due before the next poll")
+	}
+}
+
+func TestScheduler_ScheduleBulk(t *testing.T) {
+	store := NewFileJobStore(filepath.Join(t.TempDir(), "jobs.json"))
+	s := NewScheduler(store, time.Minute)
+	base := &EmailConfig{From: "news@example.com", To: []string{"placeholder@example.com"}, Subject: "Launch"}
+	recipients := make([]string, 100)
+	for i := range recipients {
+		recipients[i] = fmt.Sprintf("user%d@example.com", i)
+	}
+	runAt := time.Now().UTC().Add(time.Hour).Truncate(time.Second)
+	jitter := 30 * time.Minute
+	jobs, err := s.ScheduleBulk(base, append(recipients, " "), runAt, jitter)
+	if err != nil {
+		t.Fatalf("schedule bulk: %v", err)
+	}
+	stored, err := store.ListAll()
+	if err != nil {
+		t.Fatalf("list: %v", err)
+	}
+	if len(jobs) != 100 || len(stored) != 100 {
+		t.Fatalf("expected 100 jobs, got %d returned and %d stored", len(jobs), len(stored))
+	}
+	seen := map[string]bool{}
+	distinct := map[time.Time]bool{}
+	for _, j := range stored {
+		if len(j.Config.To) != 1 || j.Config.Subject != "Launch" {
+			t.Fatalf("unexpected job config %+v", j.Config)
+		}
+		seen[j.Config.To[0]] = true
+		if j.RunAt.Before(runAt) || j.RunAt.After(runAt.Add(jitter)) {
+			t.Fatalf("run time %v outside [%v, %v]", j.RunAt, runAt, runAt.Add(jitter))
+		}
+		distinct[j.RunAt] = true
+	}
+	if len(seen) != 100 {
+		t.Fatalf("expected one job per recipient, got %d distinct recipients", len(seen))
+	}
+	if len(distinct) < 90 {
+		t.Fatalf("expected run times to be spread, got %d distinct of 100", len(distinct))
+	}
+	if base.To[0] != "placeholder@example.com" {
+		t.Fatalf("base config was mutated: %v", base.To)
+	}
+
+	withLists := *base
+	withLists.CC = []string{"cc@example.com"}
+	withLists.BCC = []string{"bcc@example.com"}
+	withLists.EnvelopeRecipients = []string{"everyone@example.com"}
+	withLists.HeaderTo = "Everyone <everyone@example.com>"
+	jobs, err = s.ScheduleBulk(&withLists, []string{"solo@example.com"}, runAt, 0)
+	if err != nil {
+		t.Fatalf("schedule bulk: %v", err)
+	}
+	if c := jobs[0].Config; len(c.CC) != 0 || len(c.BCC) != 0 || len(c.EnvelopeRecipients) != 0 || c.HeaderTo != "" {
+		t.Fatalf("expected only the job's own recipient, got cc=%v bcc=%v envelope=%v header_to=%q", c.CC, c.BCC, c.EnvelopeRecipients, c.HeaderTo)
+	}
+	if _, err := s.ScheduleBulk(base, nil, runAt, 0); err == nil {
+		t.Fatalf("expected an error for an empty recipient list")
+	}
+}
+
+func TestScheduler_LeasedJobSurvivesRestart(t *testing.T) {
+	defer withTempSendLog(t)()
+	defer withTempJobResults(t, nil)()
+	withTempDedupStore(t, nil)
+	srv := newStubSMTPServer(t)
+
+	path := filepath.Join(t.TempDir(), "jobs.json")
+	before := NewScheduler(NewFileJobStore(path), time.Hour)
+	now := time.Now().UTC()
+	inFlight, err := before.Schedule(srv.config(), now.Add(-time.Minute), nil)
+	if err != nil {
+		t.Fatalf("schedule: %v", err)
+	}
+	expired, err := before.Schedule(srv.config(), now.Add(-time.Minute), nil)
+	if err != nil {
+		t.Fatalf("schedule: %v", err)
+	}
+	// Simulate a crash mid-send: both jobs were leased, one lease has lapsed.
+	inFlight.LeasedUntil = now.Add(5 * time.Minute)
+	expired.LeasedUntil = now.Add(-time.Second)
+	for _, j := range []*ScheduledEmail{inFlight, expired} {
+		if err := before.store.Update(j); err != nil {
+			t.Fatalf("update: %v", err)
+		}
+	}
+
+	after := NewScheduler(NewFileJobStore(path), time.Hour)
+	after.runDue(now)
+	after.wg.Wait()
+
+	if got := len(srv.Messages()); got != 1 {
+		t.Fatalf("expected only the job with the expired lease to send, got %d messages", got)
+	}
+	jobs, err := after.store.ListAll()
+	if err != nil {
+		t.Fatalf("list: %v", err)
+	}
+	if len(jobs) != 1 || jobs[0].ID != inFlight.ID {
+		t.Fatalf("expected only the leased job to remain, got %+v", jobs)
+	}
+	if !jobs[0].LeasedUntil.Equal(inFlight.LeasedUntil) {
+		t.Fatalf("lease changed: %v", jobs[0].LeasedUntil)
+	}
+
+	after.runDue(inFlight.LeasedUntil.Add(time.Second))
+	after.wg.Wait()
+	if got := len(srv.Messages()); got != 2 {
+		t.Fatalf("expected the job to run once its lease expired, got %d messages", got)
+	}
+	if jobs, _ := after.store.ListAll(); len(jobs) != 0 {
+		t.Fatalf("expected no jobs left, got %d", len(jobs))
+	}
+}
+
+func TestScheduler_SharedStoreSendsEachJobOnce(t *testing.T) {
+	defer withTempSendLog(t)()
+	defer withTempJobResults(t, nil)()
+	withTempDedupStore(t, nil)
+	srv := newStubSMTPServer(t)
+
+	store := NewFileJobStore(filepath.Join(t.TempDir(), "jobs.json"))
+	a := NewScheduler(store, time.Hour)
+	b := NewScheduler(store, time.Hour)
+	now := time.Now().UTC()
+	const jobs = 5
+	for i := 0; i < jobs; i++ {
+		if _, err := a.Schedule(srv.config(), now.Add(-time.Minute), nil); err != nil {
+			t.Fatalf("schedule: %v", err)
+		}
+	}
+
+	var wg sync.WaitGroup
+	for _, s := range []*Scheduler{a, b} {
+		wg.Add(1)
+		go func(s *Scheduler) {
+			defer wg.Done()
+			s.runDue(now)
+		}(s)
+	}
+	wg.Wait()
+	a.wg.Wait()
+	b.wg.Wait()
+
+	if got := len(srv.Messages()); got != jobs {
+		t.Fatalf("expected each job to send exactly once, got %d messages for %d jobs", got, jobs)
+	}
+	if left, _ := store.ListAll(); len(left) != 0 {
+		t.Fatalf("expected no jobs left, got %d", len(left))
+	}
+}
+
+func TestPinProvider_KeepsFallbacks(t *testing.T) {
+	cfg := &EmailConfig{Provider: "smtp", ProviderPriority: []string{"sendgrid", "mailgun", "postmark"}}
+	pinProvider(cfg, "mailgun")
+	got := resolveProviders(cfg)
+	if len(got) != 4 || got[0] != "mailgun" {
+		t.Fatalf("expected the assigned provider first and every fallback kept, got %v", got)
+	}
+	seen := map[string]bool{}
+	for _, p := range got {
+		seen[p] = true
+	}
+	for _, p := range []string{"sendgrid", "postmark", "smtp"} {
+		if !seen[p] {
+			t.Fatalf("fallback %s dropped: %v", p, got)
+		}
+	}
+	if again := resolveProviders(cfg); fmt.Sprint(again) != fmt.Sprint(got) {
+		t.Fatalf("pinned order must not be reordered: %v then %v", got, again)
+	}
+}
+
+func TestScheduler_StoresSecretReferences(t *testing.T) {
+	defer withTempSendLog(t)()
+	defer withTempJobResults(t, nil)()
+	withTempDedupStore(t, nil)
+	srv := newStubSMTPServer(t, "AUTH PLAIN LOGIN")
+	srv.reply("AUTH", "235 ok")
+
+	secretPath := filepath.Join(t.TempDir(), "smtp-pass")
+	if err := os.WriteFile(secretPath, []byte("s3cret-pass\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	cfg := srv.config()
+	cfg.Username = "sender"
+	cfg.Password = "file://" + secretPath
+	if err := resolveSecrets(cfg); err != nil {
+		t.Fatalf("resolveSecrets: %v", err)
+	}
+
+	storePath := filepath.Join(t.TempDir(), "jobs.json")
+	s := NewScheduler(NewFileJobStore(storePath), time.Minute)
+	now := time.Now().UTC()
+	if _, err := s.Schedule(cfg, now, nil); err != nil {
+		t.Fatalf("schedule: %v", err)
+	}
+	if cfg.Password != "s3cret-pass" {
+		t.Fatalf("scheduling should not change the caller's config, got %q", cfg.Password)
+	}
+	raw, err := os.ReadFile(storePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(raw), "s3cret-pass") {
+		t.Fatalf("job store holds the resolved secret: %s", raw)
+	}
+	if !strings.Contains(string(raw), "file://"+secretPath) {
+		t.Fatalf("job store should keep the secret reference: %s", raw)
+	}
+
+	s.runDue(now.Add(time.Second))
+	s.wg.Wait()
+	want := base64.StdEncoding.EncodeToString([]byte("\x00sender\x00s3cret-pass"))
+	found := false
+	for _, cmd := range srv.Commands() {
+		if strings.HasPrefix(cmd, "AUTH") && strings.Contains(cmd, want) {
+			found = true
+		}
+	}
+	if !found {
+		t.Fatalf("expected the job to authenticate with the resolved secret, got %v", srv.Commands())
+	}
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// Secret references accepted in credential fields instead of literal values.
+const (
+	secretFilePrefix = "file://"
+	secretCmdPrefix  = "cmd://"
+)
+
+// secretCommandTimeout bounds how long a cmd:// secret command may run.
+var secretCommandTimeout = 10 * time.Second
+
+// resolveSecretRef returns the secret a file:// or cmd:// reference points at,
+// with surrounding whitespace trimmed; other values are returned unchanged.
+// Commands are split on spaces and run without a shell. Errors name the
+// reference but never include the secret or the command's output.
+func resolveSecretRef(value string) (string, error) {
+	switch {
+	case strings.HasPrefix(value, secretFilePrefix):
+		data, err := os.ReadFile(strings.TrimPrefix(value, secretFilePrefix))
+		if err != nil {
+			return "", err
+		}
+		return strings.TrimSpace(string(data)), nil
+	case strings.HasPrefix(value, secretCmdPrefix):
+		args := strings.Fields(strings.TrimPrefix(value, secretCmdPrefix))
+		if len(args) == 0 {
+			return "", errors.New("empty command")
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), secretCommandTimeout)
+		defer cancel()
+		out, err := exec.CommandContext(ctx, args[0], args[1:]...).Output()
+		if err != nil {
+			return "", fmt.Errorf("%s: %w", args[0], err)
+		}
+		return strings.TrimSpace(string(out)), nil
+	}
+	return value, nil
+}
+
+// resolveSecrets replaces file:// and cmd:// references in the credential
+// fields with the secrets they point at, remembering the references so the
+// config can be persisted without the secrets.
+func resolveSecrets(cfg *EmailConfig) error {
+	for _, f := range secretFields(cfg) {
+		ref := strings.TrimSpace(*f.value)
+		if !isSecretRef(ref) {
+			continue
+		}
+		secret, err := resolveSecretRef(ref)
+		if err != nil {
+			return fmt.Errorf("%s: cannot resolve %s: %w", f.name, ref, err)
+		}
+		logger().Debug("secret resolved", "field", f.name, "source", ref, "value", maskPlaceholderValue(f.name, secret))
+		*f.value = secret
+		refs := make(map[string]string, len(cfg.secretRefs)+1)
+		for k, v := range cfg.secretRefs {
+			refs[k] = v
+		}
+		refs[f.name] = ref
+		cfg.secretRefs = refs
+	}
+	return nil
+}
+
+// withSecretRefs returns cfg with each resolved secret replaced by the
+// reference it was read from, for storing jobs: the secrets are resolved
+// again when the job is sent. cfg itself is returned when nothing was
+// resolved.
+func (cfg *EmailConfig) withSecretRefs() *EmailConfig {
+	if cfg == nil || len(cfg.secretRefs) == 0 {
+		return cfg
+	}
+	stored := *cfg
+	for _, f := range secretFields(&stored) {
+		if ref, ok := cfg.secretRefs[f.name]; ok {
+			*f.value = ref
+		}
+	}
+	stored.secretRefs = nil
+	return &stored
+}
+
+type secretField struct {
+	name  string
+	value *string
+}
+
+// secretFields lists the credential fields that accept secret references.
+func secretFields(cfg *EmailConfig) []secretField {
+	return []secretField{
+		{"api_key", &cfg.APIKey},
+		{"password", &cfg.Password},
+		{"aws_access_key", &cfg.AWSAccessKey},
+		{"aws_secret_key", &cfg.AWSSecretKey},
+		{"aws_session_token", &cfg.AWSSessionToken},
+	}
+}
+
+func isSecretRef(value string) bool {
+	return strings.HasPrefix(value, secretFilePrefix) || strings.HasPrefix(value, secretCmdPrefix)
+}
+
+// rejectSecretRefs fails when a credential field holds a secret reference.
+// Render-only configs use it instead of resolveSecrets.
+func rejectSecretRefs(cfg *EmailConfig) error {
+	for _, f := range secretFields(cfg) {
+		if isSecretRef(strings.TrimSpace(*f.value)) {
+			return fmt.Errorf("%s: secret references are not resolved in a preview", f.name)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseConfig_ResolvesSecretReferences(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sendgrid")
+	if err := os.WriteFile(path, []byte("SG.secret-key\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := parseConfig(map[string]any{
+		"provider": "sendgrid",
+		"from":     "a@example.com",
+		"to":       "b@example.com",
+		"api_key":  "file://" + path,
+		"password": "cmd://echo smtp-pass",
+	})
+	if err != nil {
+		t.Fatalf("parseConfig: %v", err)
+	}
+	if cfg.APIKey != "SG.secret-key" {
+		t.Fatalf("expected the key read from the file, got %q", cfg.APIKey)
+	}
+	if cfg.Password != "smtp-pass" {
+		t.Fatalf("expected the password from the command output, got %q", cfg.Password)
+	}
+
+	_, err = parseConfig(map[string]any{
+		"provider": "sendgrid",
+		"from":     "a@example.com",
+		"to":       "b@example.com",
+		"api_key":  "file://" + filepath.Join(t.TempDir(), "missing"),
+	})
+	if err == nil || !strings.Contains(err.Error(), "api_key") {
+		t.Fatalf("expected an error naming api_key for a missing secret file, got %v", err)
+	}
+}
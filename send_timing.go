@@ -0,0 +1,98 @@
+package main
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/http/httptrace"
+	"sync"
+	"time"
+)
+
+// AttemptTiming records when a send attempt ran and, for HTTP sends, how long
+// each connection phase took. Phases are zero when a pooled connection was
+// reused; an attempt split into several requests sums them.
+type AttemptTiming struct {
+	Provider  string    `json:"provider"`
+	Transport string    `json:"transport"`
+	Attempt   int       `json:"attempt"`
+	Start     time.Time `json:"start"`
+	End       time.Time `json:"end"`
+	// DNS, Connect and TLS are the lookup, TCP connect and handshake times.
+	DNS     time.Duration `json:"dns,omitempty"`
+	Connect time.Duration `json:"connect,omitempty"`
+	TLS     time.Duration `json:"tls,omitempty"`
+	// FirstByte is the time from sending the request to the first response byte.
+	FirstByte  time.Duration `json:"first_byte,omitempty"`
+	Requests   int           `json:"requests,omitempty"`
+	ConnReused bool          `json:"conn_reused,omitempty"`
+}
+
+// Duration is the attempt's total time.
+func (t AttemptTiming) Duration() time.Duration {
+	return t.End.Sub(t.Start)
+}
+
+// startAttemptTiming begins timing an attempt through cfg's provider.
+func startAttemptTiming(cfg *EmailConfig, attempt int) *AttemptTiming {
+	return &AttemptTiming{
+		Provider:  cfg.ProviderOrHost(),
+		Transport: cfg.Transport,
+		Attempt:   attempt,
+		Start:     time.Now(),
+	}
+}
+
+// recordTiming stores a finished attempt on the context.
+func (c *SendContext) recordTiming(t *AttemptTiming) {
+	if c == nil || t == nil {
+		return
+	}
+	c.Provider = t.Provider
+	c.Attempts = append(c.Attempts, *t)
+}
+
+// LastAttempt returns the timing of the most recent send attempt.
+func (c *SendContext) LastAttempt() (AttemptTiming, bool) {
+	if c == nil || len(c.Attempts) == 0 {
+		return AttemptTiming{}, false
+	}
+	return c.Attempts[len(c.Attempts)-1], true
+}
+
+// traceRequest returns req with an httptrace that adds the request's DNS,
+// connect, TLS and first-byte times to t.
+func traceRequest(req *http.Request, t *AttemptTiming) *http.Request {
+	var (
+		mu                            sync.Mutex
+		dnsStart, connStart, tlsStart time.Time
+	)
+	sent := time.Now()
+	since := func(start *time.Time, into *time.Duration) {
+		mu.Lock()
+		defer mu.Unlock()
+		if !start.IsZero() {
+			*into += time.Since(*start)
+		}
+	}
+	mark := func(into *time.Time) {
+		mu.Lock()
+		*into = time.Now()
+		mu.Unlock()
+	}
+	trace := &httptrace.ClientTrace{
+		DNSStart:          func(httptrace.DNSStartInfo) { mark(&dnsStart) },
+		DNSDone:           func(httptrace.DNSDoneInfo) { since(&dnsStart, &t.DNS) },
+		ConnectStart:      func(string, string) { mark(&connStart) },
+		ConnectDone:       func(string, string, error) { since(&connStart, &t.Connect) },
+		TLSHandshakeStart: func() { mark(&tlsStart) },
+		TLSHandshakeDone:  func(tls.ConnectionState, error) { since(&tlsStart, &t.TLS) },
+		GotConn: func(info httptrace.GotConnInfo) {
+			mu.Lock()
+			t.ConnReused = info.Reused
+			mu.Unlock()
+		},
+		GotFirstResponseByte: func() { since(&sent, &t.FirstByte) },
+	}
+	t.Requests++
+	return req.WithContext(httptrace.WithClientTrace(req.Context(), trace))
+}
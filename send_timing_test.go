@@ -0,0 +1,60 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSendEmail_RecordsAttemptTiming(t *testing.T) {
+	defer withTempSendLog(t)()
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(5 * time.Millisecond)
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer srv.Close()
+	RegisterProviderDefault("timed_api", ProviderSetting{Transport: "http", Endpoint: srv.URL})
+	defer delete(providerDefaults, "timed_api")
+
+	cfg := &EmailConfig{
+		Provider:      "timed_api",
+		HTTPMethod:    http.MethodPost,
+		SkipTLSVerify: true,
+		From:          "sender@example.com",
+		To:            []string{"user@example.com"},
+		Subject:       "hi",
+		TextBody:      "body",
+		RetryCount:    1,
+	}
+	ctx := &SendContext{JobID: "job-timing"}
+	if err := sendEmail(cfg, ctx); err != nil {
+		t.Fatalf("sendEmail: %v", err)
+	}
+
+	timing, ok := ctx.LastAttempt()
+	if !ok || len(ctx.Attempts) != 1 || ctx.Provider != "timed_api" {
+		t.Fatalf("expected one timed attempt through timed_api, got %+v", ctx)
+	}
+	if timing.Start.IsZero() || !timing.End.After(timing.Start) || timing.Duration() < 5*time.Millisecond {
+		t.Fatalf("unexpected start/end: %+v", timing)
+	}
+	if timing.Connect <= 0 || timing.TLS <= 0 || timing.FirstByte < 5*time.Millisecond || timing.Requests != 1 {
+		t.Fatalf("expected connect, TLS and first-byte phases, got %+v", timing)
+	}
+
+	data, err := os.ReadFile(sendLogFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var entry SendLogEntry
+	if err := json.Unmarshal([]byte(strings.TrimSpace(string(data))), &entry); err != nil {
+		t.Fatalf("decode send log: %v", err)
+	}
+	if entry.JobID != "job-timing" || entry.Timing == nil || entry.Timing.TLS != timing.TLS || !entry.Timing.End.Equal(timing.End) {
+		t.Fatalf("expected the timing in the send log entry, got %+v", entry)
+	}
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// IdentityVerifier reports whether a provider accepts from as a verified
+// sender identity, usually by asking the provider's API.
+type IdentityVerifier interface {
+	SenderVerified(cfg *EmailConfig, from string) (bool, error)
+}
+
+// IdentityVerifierFunc adapts a function to IdentityVerifier.
+type IdentityVerifierFunc func(cfg *EmailConfig, from string) (bool, error)
+
+func (f IdentityVerifierFunc) SenderVerified(cfg *EmailConfig, from string) (bool, error) {
+	return f(cfg, from)
+}
+
+// senderVerificationTTL is how long a provider's answer for a sender is
+// reused before asking again.
+var senderVerificationTTL = 10 * time.Minute
+
+type senderVerification struct {
+	verified bool
+	expires  time.Time
+}
+
+var (
+	identityVerifierMu sync.Mutex
+	identityVerifiers  = map[string]IdentityVerifier{"aws_ses": sesIdentityVerifier{}}
+	senderVerified     = map[string]senderVerification{}
+)
+
+// RegisterIdentityVerifier sets the verifier used for provider's sender
+// preflight, replacing any earlier one, and clears cached answers for it.
+func RegisterIdentityVerifier(provider string, v IdentityVerifier) {
+	identityVerifierMu.Lock()
+	defer identityVerifierMu.Unlock()
+	identityVerifiers[provider] = v
+	for key := range senderVerified {
+		if strings.HasPrefix(key, provider+"|") {
+			delete(senderVerified, key)
+		}
+	}
+}
+
+// senderVerificationKey is the cache key for from on provider. It includes a
+// digest of the account credentials, since another account on the same
+// provider may have verified different senders.
+func senderVerificationKey(cfg *EmailConfig, provider, from string) string {
+	account := sha256Hex([]byte(strings.Join([]string{cfg.Endpoint, cfg.AWSRegion, cfg.AWSAccessKey, cfg.APIKey, cfg.APIToken, cfg.Username}, "\x00")))
+	return provider + "|" + account[:16] + "|" + from
+}
+
+// preflightSender fails when VerifySender is set and provider does not accept
+// cfg.From: it is checked against the provider's verified_senders entry when
+// there is one, otherwise against the provider's registered verifier, whose
+// answer is cached per account. A rejected sender is a PermanentError; a
+// verifier that cannot answer (a timeout, a 5xx) returns its error as is, so
+// the send can be retried.
+func preflightSender(cfg *EmailConfig, provider string) error {
+	if !cfg.VerifySender {
+		return nil
+	}
+	_, from := splitAddress(cfg.From)
+	from = strings.ToLower(strings.TrimSpace(from))
+	if list, ok := cfg.VerifiedSenders[provider]; ok {
+		domain := extractDomain(from)
+		for _, identity := range list {
+			identity = strings.ToLower(strings.TrimSpace(identity))
+			if identity == from || identity == domain {
+				return nil
+			}
+		}
+		return &PermanentError{Err: fmt.Errorf("from %s is not a verified sender for %s (verified_senders)", from, provider)}
+	}
+	key := senderVerificationKey(cfg, provider, from)
+	identityVerifierMu.Lock()
+	verifier := identityVerifiers[provider]
+	cached, hit := senderVerified[key]
+	identityVerifierMu.Unlock()
+	if verifier == nil {
+		return nil
+	}
+	verified := cached.verified
+	if !hit || time.Now().After(cached.expires) {
+		var err error
+		if verified, err = verifier.SenderVerified(cfg, from); err != nil {
+			return fmt.Errorf("verify sender %s with %s: %w", from, provider, err)
+		}
+		identityVerifierMu.Lock()
+		senderVerified[key] = senderVerification{verified: verified, expires: time.Now().Add(senderVerificationTTL)}
+		identityVerifierMu.Unlock()
+	}
+	if !verified {
+		return &PermanentError{Err: fmt.Errorf("from %s is not a verified sender identity for %s", from, provider)}
+	}
+	return nil
+}
+
+// sesIdentityVerifier asks the SES v2 API whether the sender address, or
+// failing that its domain, is verified for sending.
+type sesIdentityVerifier struct{}
+
+func (sesIdentityVerifier) SenderVerified(cfg *EmailConfig, from string) (bool, error) {
+	base := "https://email." + strings.TrimSpace(cfg.AWSRegion) + ".amazonaws.com"
+	if parsed, err := url.Parse(cfg.Endpoint); err == nil && parsed.Host != "" {
+		base = parsed.Scheme + "://" + parsed.Host
+	}
+	for _, identity := range []string{from, extractDomain(from)} {
+		if identity == "" {
+			continue
+		}
+		req, err := http.NewRequest(http.MethodGet, base+"/v2/email/identities/"+url.PathEscape(identity), nil)
+		if err != nil {
+			return false, err
+		}
+		if err := signAWSv4(req, nil, cfg); err != nil {
+			return false, err
+		}
+		resp, err := getHTTPClient(cfg).Do(req)
+		if err != nil {
+			return false, &ConnectionError{Err: err}
+		}
+		var body struct {
+			VerifiedForSendingStatus bool
+		}
+		status := resp.StatusCode
+		if status == http.StatusOK {
+			err = json.NewDecoder(resp.Body).Decode(&body)
+		}
+		resp.Body.Close()
+		switch {
+		case status == http.StatusNotFound:
+			continue
+		case status != http.StatusOK:
+			return false, classifyHTTPStatus(resp, fmt.Errorf("get identity %s: %s", identity, http.StatusText(status)))
+		case err != nil:
+			return false, err
+		case body.VerifiedForSendingStatus:
+			return true, nil
+		}
+	}
+	return false, nil
+}
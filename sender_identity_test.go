@@ -0,0 +1,108 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+func TestPreflightSender_RejectsUnverifiedFrom(t *testing.T) {
+	defer withTempSendLog(t)()
+	var sends atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sends.Add(1)
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer srv.Close()
+	RegisterProviderDefault("identity_http", ProviderSetting{Transport: "http", Endpoint: srv.URL})
+	defer delete(providerDefaults, "identity_http")
+
+	var checks atomic.Int32
+	RegisterIdentityVerifier("identity_http", IdentityVerifierFunc(func(cfg *EmailConfig, from string) (bool, error) {
+		checks.Add(1)
+		return from == "verified@example.com", nil
+	}))
+	defer func() {
+		identityVerifierMu.Lock()
+		delete(identityVerifiers, "identity_http")
+		identityVerifierMu.Unlock()
+	}()
+
+	newCfg := func(from string) *EmailConfig {
+		return &EmailConfig{
+			Provider:     "identity_http",
+			HTTPMethod:   http.MethodPost,
+			From:         from,
+			To:           []string{"user@example.com"},
+			Subject:      "hi",
+			TextBody:     "body",
+			RetryCount:   1,
+			VerifySender: true,
+		}
+	}
+	for i := 0; i < 2; i++ {
+		err := sendEmail(newCfg("Unverified <nobody@example.com>"), nil)
+		if err == nil || !strings.Contains(err.Error(), "not a verified sender") {
+			t.Fatalf("expected the unverified sender to be rejected, got %v", err)
+		}
+	}
+	if n := sends.Load(); n != 0 {
+		t.Fatalf("expected no send attempt for an unverified sender, got %d", n)
+	}
+	if n := checks.Load(); n != 1 {
+		t.Fatalf("expected the verifier answer to be cached, got %d checks", n)
+	}
+
+	if err := sendEmail(newCfg("verified@example.com"), nil); err != nil {
+		t.Fatalf("expected a verified sender to send, got %v", err)
+	}
+	allowed := newCfg("nobody@example.com")
+	allowed.VerifiedSenders = map[string][]string{"identity_http": {"example.com"}}
+	if err := sendEmail(allowed, nil); err != nil {
+		t.Fatalf("expected verified_senders to accept the domain, got %v", err)
+	}
+	if n := sends.Load(); n != 2 {
+		t.Fatalf("expected 2 sends, got %d", n)
+	}
+}
+
+func TestPreflightSender_TransientErrorsAndAccounts(t *testing.T) {
+	var checks atomic.Int32
+	outage := errors.New("identity API unavailable")
+	var failing atomic.Bool
+	RegisterIdentityVerifier("identity_accounts", IdentityVerifierFunc(func(cfg *EmailConfig, from string) (bool, error) {
+		checks.Add(1)
+		if failing.Load() {
+			return false, outage
+		}
+		return cfg.APIKey == "account-a", nil
+	}))
+	defer func() {
+		identityVerifierMu.Lock()
+		delete(identityVerifiers, "identity_accounts")
+		identityVerifierMu.Unlock()
+	}()
+	cfg := func(key string) *EmailConfig {
+		return &EmailConfig{From: "news@example.com", APIKey: key, VerifySender: true}
+	}
+
+	failing.Store(true)
+	err := preflightSender(cfg("account-a"), "identity_accounts")
+	if !errors.Is(err, outage) || errors.Is(err, ErrPermanent) {
+		t.Fatalf("expected a retryable verifier error, got %v", err)
+	}
+	failing.Store(false)
+	if err := preflightSender(cfg("account-a"), "identity_accounts"); err != nil {
+		t.Fatalf("expected account-a to be verified once the verifier recovers, got %v", err)
+	}
+	err = preflightSender(cfg("account-b"), "identity_accounts")
+	if !errors.Is(err, ErrPermanent) {
+		t.Fatalf("expected account-b to get its own answer and be rejected, got %v", err)
+	}
+	if n := checks.Load(); n != 3 {
+		t.Fatalf("expected each account to be checked separately, got %d checks", n)
+	}
+}
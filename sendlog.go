@@ -2,9 +2,10 @@ package main
 
 import (
 	"bufio"
+	"bytes"
 	"encoding/json"
+	"fmt"
 	"io"
-	"log"
 	"math"
 	"os"
 	"strings"
@@ -35,6 +36,8 @@ type SendLogEntry struct {
 	Success    bool      `json:"success"`
 	Error      string    `json:"error,omitempty"`
 	Recipients []string  `json:"recipients,omitempty"`
+	// Timing is the attempt's start/end and connection phase timing.
+	Timing *AttemptTiming `json:"timing,omitempty"`
 }
 
 var (
@@ -52,33 +55,157 @@ func recordSendAttempt(ctx *SendContext, cfg *EmailConfig, attempt int, err erro
 		Success:    err == nil,
 		Recipients: append([]string(nil), cfg.To...),
 	}
+	if cfg.timing != nil {
+		timing := *cfg.timing
+		entry.Timing = &timing
+	}
 	if ctx != nil {
 		entry.JobID = ctx.JobID
 		entry.Step = ctx.Step
 	}
 	if err != nil {
-		entry.Error = err.Error()
+		// Errors can echo request URLs or headers carrying credentials.
+		entry.Error = redactSecrets(err.Error())
 	}
 	appendSendLog(entry)
 }
 
 func appendSendLog(entry SendLogEntry) {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		logger().Error("sendlog: cannot marshal entry", "error", err)
+		return
+	}
 	sendLogMu.Lock()
 	defer sendLogMu.Unlock()
+	if sendLogBuffer != nil {
+		sendLogBuffer.pending = append(sendLogBuffer.pending, data)
+		if len(sendLogBuffer.pending) < sendLogMaxPending {
+			return
+		}
+		if err := flushSendLogLocked(); err != nil {
+			logger().Error("sendlog: cannot flush buffered entries", "error", err)
+		}
+		return
+	}
+	if err := writeSendLogLocked([][]byte{data}); err != nil {
+		logger().Error("sendlog: cannot write entry", "error", err)
+	}
+}
+
+// writeSendLogLocked appends lines to the send log in one write; the caller
+// holds sendLogMu.
+func writeSendLogLocked(lines [][]byte) error {
 	f, err := os.OpenFile(sendLogFile, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
 	if err != nil {
-		log.Printf("sendlog: cannot open log file: %v", err)
+		return fmt.Errorf("cannot open log file: %w", err)
+	}
+	var buf bytes.Buffer
+	for _, line := range lines {
+		buf.Write(line)
+		buf.WriteByte('\n')
+	}
+	if _, err := f.Write(buf.Bytes()); err != nil {
+		f.Close()
+		return fmt.Errorf("cannot write entries: %w", err)
+	}
+	return f.Close()
+}
+
+// sendLogMaxPending is how many buffered entries force a flush before the
+// next interval.
+const sendLogMaxPending = 512
+
+// sendLogMaxRetained bounds the entries kept in memory while flushes fail;
+// the oldest beyond it are dropped and the flush error says how many.
+const sendLogMaxRetained = 16 * sendLogMaxPending
+
+// sendLogWriter batches send log entries while buffering is enabled.
+type sendLogWriter struct {
+	pending [][]byte
+	stop    chan struct{}
+	done    chan struct{}
+}
+
+// sendLogBuffer is non-nil while EnableBufferedSendLog is in effect.
+var sendLogBuffer *sendLogWriter
+
+// EnableBufferedSendLog makes send log writes asynchronous: entries are kept
+// in memory and appended to the file every interval, when sendLogMaxPending
+// accumulate, or on FlushSendLog. Readers of the send log flush first, so
+// routing limits still see every entry. Writes are synchronous by default.
+func EnableBufferedSendLog(interval time.Duration) {
+	if interval <= 0 {
+		interval = time.Second
+	}
+	sendLogMu.Lock()
+	defer sendLogMu.Unlock()
+	if sendLogBuffer != nil {
 		return
 	}
-	defer f.Close()
-	data, err := json.Marshal(entry)
+	w := &sendLogWriter{stop: make(chan struct{}), done: make(chan struct{})}
+	sendLogBuffer = w
+	go func() {
+		defer close(w.done)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-w.stop:
+				return
+			case <-ticker.C:
+				if err := FlushSendLog(); err != nil {
+					logger().Error("sendlog: cannot flush buffered entries", "error", err)
+				}
+			}
+		}
+	}()
+}
+
+// DisableBufferedSendLog flushes buffered entries and returns to writing each
+// entry as it is recorded.
+func DisableBufferedSendLog() error {
+	sendLogMu.Lock()
+	w := sendLogBuffer
+	if w == nil {
+		sendLogMu.Unlock()
+		return nil
+	}
+	err := flushSendLogLocked()
 	if err != nil {
-		log.Printf("sendlog: cannot marshal entry: %v", err)
-		return
+		err = fmt.Errorf("%w; %d buffered entries lost", err, len(w.pending))
+	}
+	sendLogBuffer = nil
+	sendLogMu.Unlock()
+	close(w.stop)
+	<-w.done
+	return err
+}
+
+// FlushSendLog writes any buffered send log entries to the file. Call it
+// before shutdown when buffering is enabled; it is a no-op otherwise.
+func FlushSendLog() error {
+	sendLogMu.Lock()
+	defer sendLogMu.Unlock()
+	return flushSendLogLocked()
+}
+
+func flushSendLogLocked() error {
+	if sendLogBuffer == nil || len(sendLogBuffer.pending) == 0 {
+		return nil
 	}
-	if _, err := f.Write(append(data, '\n')); err != nil {
-		log.Printf("sendlog: cannot write entry: %v", err)
+	lines := sendLogBuffer.pending
+	if err := writeSendLogLocked(lines); err != nil {
+		// Keep the entries for the next flush.
+		if dropped := len(lines) - sendLogMaxRetained; dropped > 0 {
+			lines = lines[dropped:]
+			err = fmt.Errorf("%w; dropped %d oldest buffered entries", err, dropped)
+		}
+		sendLogBuffer.pending = lines
+		return err
 	}
+	sendLogBuffer.pending = nil
+	return nil
 }
 
 func recordJobResult(jobID string, result JobResult) {
@@ -118,13 +245,13 @@ func loadJobResultsLocked() {
 			jobResultsInit = true
 			return
 		}
-		log.Printf("sendlog: cannot read results: %v", err)
+		logger().Error("sendlog: cannot read results", "error", err)
 		jobResultCache = map[string]JobResult{}
 		jobResultsInit = true
 		return
 	}
 	if err := json.Unmarshal(data, &jobResultCache); err != nil {
-		log.Printf("sendlog: cannot decode results: %v", err)
+		logger().Error("sendlog: cannot decode results", "error", err)
 		jobResultCache = map[string]JobResult{}
 	}
 	jobResultsInit = true
@@ -133,12 +260,26 @@ func loadJobResultsLocked() {
 func writeJobResultsLocked() {
 	data, err := json.MarshalIndent(jobResultCache, "", "  ")
 	if err != nil {
-		log.Printf("sendlog: cannot encode results: %v", err)
+		logger().Error("sendlog: cannot encode results", "error", err)
 		return
 	}
 	if err := os.WriteFile(jobResultDBFile, data, 0o644); err != nil {
-		log.Printf("sendlog: cannot write results: %v", err)
+		logger().Error("sendlog: cannot write results", "error", err)
+	}
+}
+
+// jobResultCounts returns how many jobs ended in each result.
+func jobResultCounts() map[JobResult]int {
+	jobResultMu.Lock()
+	defer jobResultMu.Unlock()
+	if !jobResultsInit {
+		loadJobResultsLocked()
 	}
+	counts := map[JobResult]int{}
+	for _, res := range jobResultCache {
+		counts[res]++
+	}
+	return counts
 }
 
 // countSuccessesFromReader scans a JSONL stream and counts successful sends matching providers
@@ -149,7 +290,7 @@ func countSuccessesFromReader(r io.Reader, providers []string, since time.Time,
 	count := 0
 	provSet := map[string]bool{}
 	for _, p := range providers {
-		provSet[strings.ToLower(strings.TrimSpace(p))] = true
+		provSet[canonicalProviderName(p)] = true
 	}
 	for scanner.Scan() {
 		var e SendLogEntry
@@ -163,7 +304,7 @@ func countSuccessesFromReader(r io.Reader, providers []string, since time.Time,
 			continue
 		}
 		if len(providers) > 0 {
-			if _, ok := provSet[strings.ToLower(strings.TrimSpace(e.Provider))]; !ok {
+			if _, ok := provSet[canonicalProviderName(e.Provider)]; !ok {
 				continue
 			}
 		}
@@ -197,6 +338,9 @@ func countSuccessesFromReader(r io.Reader, providers []string, since time.Time,
 
 // countSuccessesSince reads the persistent send log and counts successes matching criteria.
 func countSuccessesSince(providers []string, since time.Time, toDomains []string) (int, error) {
+	if err := FlushSendLog(); err != nil {
+		return 0, err
+	}
 	f, err := os.Open(sendLogFile)
 	if err != nil {
 		if os.IsNotExist(err) {
@@ -216,7 +360,7 @@ func weightedUsageFromReader(r io.Reader, providers []string, since time.Time, t
 	scores := map[string]float64{}
 	provSet := map[string]bool{}
 	for _, p := range providers {
-		provSet[strings.ToLower(strings.TrimSpace(p))] = true
+		provSet[canonicalProviderName(p)] = true
 	}
 	if halfLife <= 0 {
 		// default half-life is 6 hours
@@ -234,7 +378,7 @@ func weightedUsageFromReader(r io.Reader, providers []string, since time.Time, t
 		if e.Timestamp.Before(since) {
 			continue
 		}
-		prov := strings.ToLower(strings.TrimSpace(e.Provider))
+		prov := canonicalProviderName(e.Provider)
 		if len(providers) > 0 {
 			if _, ok := provSet[prov]; !ok {
 				continue
@@ -274,6 +418,9 @@ func weightedUsageFromReader(r io.Reader, providers []string, since time.Time, t
 
 // weightedUsageSince reads the persistent send log and computes recency-weighted usage scores.
 func weightedUsageSince(providers []string, since time.Time, toDomains []string, halfLife time.Duration) (map[string]float64, error) {
+	if err := FlushSendLog(); err != nil {
+		return nil, err
+	}
 	f, err := os.Open(sendLogFile)
 	if err != nil {
 		if os.IsNotExist(err) {
@@ -2,6 +2,7 @@ package main
 
 import (
 	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 	"time"
@@ -67,3 +68,84 @@ func TestSendEmail_DryRun(t *testing.T) {
 		t.Fatalf("expected no error for dry-run, got %v", err)
 	}
 }
+
+func TestBufferedSendLog_FlushPersistsEntries(t *testing.T) {
+	defer withTempSendLog(t)()
+	EnableBufferedSendLog(time.Hour)
+	defer DisableBufferedSendLog()
+
+	for i := 0; i < 3; i++ {
+		appendSendLog(SendLogEntry{Timestamp: time.Now().UTC(), Provider: "sendgrid", Success: true})
+	}
+	if data, _ := os.ReadFile(sendLogFile); len(data) != 0 {
+		t.Fatalf("expected entries to stay buffered until a flush, got %q", data)
+	}
+	if err := FlushSendLog(); err != nil {
+		t.Fatalf("flush: %v", err)
+	}
+	data, err := os.ReadFile(sendLogFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lines := strings.Count(string(data), "\n"); lines != 3 {
+		t.Fatalf("expected 3 flushed entries, got %d", lines)
+	}
+
+	// Readers flush first, so buffered entries still count toward limits.
+	appendSendLog(SendLogEntry{Timestamp: time.Now().UTC(), Provider: "sendgrid", Success: true})
+	if n, err := countSuccessesSince([]string{"sendgrid"}, time.Now().Add(-time.Minute), nil); err != nil || n != 4 {
+		t.Fatalf("expected 4 successes including the buffered one, got %d (%v)", n, err)
+	}
+}
+
+func TestBufferedSendLog_FailedFlushKeepsEntries(t *testing.T) {
+	defer withTempSendLog(t)()
+	EnableBufferedSendLog(time.Hour)
+	defer DisableBufferedSendLog()
+
+	path := sendLogFile
+	sendLogFile = filepath.Join(t.TempDir(), "missing", "send_log.jsonl")
+	for i := 0; i < 2; i++ {
+		appendSendLog(SendLogEntry{Timestamp: time.Now().UTC(), Provider: "sendgrid", Success: true})
+	}
+	if err := FlushSendLog(); err == nil {
+		t.Fatalf("expected the flush to an unwritable path to fail")
+	}
+	sendLogFile = path
+	if err := FlushSendLog(); err != nil {
+		t.Fatalf("flush: %v", err)
+	}
+	data, err := os.ReadFile(sendLogFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lines := strings.Count(string(data), "\n"); lines != 2 {
+		t.Fatalf("expected the entries kept after the failed flush, got %d lines", lines)
+	}
+}
+
+func BenchmarkAppendSendLog(b *testing.B) {
+	for _, buffered := range []bool{false, true} {
+		name := "sync"
+		if buffered {
+			name = "buffered"
+		}
+		b.Run(name, func(b *testing.B) {
+			orig := sendLogFile
+			sendLogFile = filepath.Join(b.TempDir(), "send_log.jsonl")
+			defer func() { sendLogFile = orig }()
+			if buffered {
+				EnableBufferedSendLog(time.Second)
+				defer DisableBufferedSendLog()
+			}
+			entry := SendLogEntry{Timestamp: time.Now().UTC(), Provider: "sendgrid", Success: true, Recipients: []string{"user@example.com"}}
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				appendSendLog(entry)
+			}
+			if err := FlushSendLog(); err != nil {
+				b.Fatal(err)
+			}
+		})
+	}
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBuildSESv1Payload_FormEncoding(t *testing.T) {
+	cfg := &EmailConfig{
+		From:             "team@example.com",
+		To:               []string{"Ada <ada@example.com>"},
+		BCC:              []string{"audit@example.com"},
+		Subject:          "hi",
+		TextBody:         "body",
+		ConfigurationSet: "marketing",
+		Tags:             map[string]string{"campaign": "spring"},
+	}
+	payload, contentType, err := buildSESv1Payload(cfg)
+	if err != nil {
+		t.Fatalf("buildSESv1Payload: %v", err)
+	}
+	form := payload.(url.Values)
+	if contentType != "application/x-www-form-urlencoded" || form.Get("Action") != "SendRawEmail" || form.Get("Version") != "2010-12-01" {
+		t.Fatalf("unexpected request %s %v", contentType, form)
+	}
+	if form.Get("Destinations.member.1") != "ada@example.com" || form.Get("Destinations.member.2") != "audit@example.com" {
+		t.Fatalf("expected all recipients as destinations, got %v", form)
+	}
+	if form.Get("ConfigurationSetName") != "marketing" || form.Get("Tags.member.1.Name") != "campaign" || form.Get("Tags.member.1.Value") != "spring" {
+		t.Fatalf("unexpected configuration set or tags %v", form)
+	}
+	raw, err := base64.StdEncoding.DecodeString(form.Get("RawMessage.Data"))
+	if err != nil || !strings.Contains(string(raw), "Subject: hi") || strings.Contains(string(raw), "audit@example.com") {
+		t.Fatalf("unexpected raw message %q (%v)", raw, err)
+	}
+}
+
+func TestAWSProvider_DestinationUsesBareAddresses(t *testing.T) {
+	cfg := &EmailConfig{
+		From:     "team@example.com",
+		To:       []string{`"A B" <a@b.com>`},
+		CC:       []string{"Carol <carol@example.com>"},
+		Subject:  "hi",
+		TextBody: "body",
+	}
+	payload, _, err := NewAWSProvider().BuildPayload(cfg)
+	if err != nil {
+		t.Fatalf("BuildPayload: %v", err)
+	}
+	p := payload.(map[string]interface{})
+	dest := p["Destination"].(map[string][]string)
+	if len(dest["ToAddresses"]) != 1 || dest["ToAddresses"][0] != "a@b.com" || dest["CcAddresses"][0] != "carol@example.com" {
+		t.Fatalf("expected bare destination addresses, got %v", dest)
+	}
+	raw, err := base64.StdEncoding.DecodeString(p["Content"].(map[string]interface{})["Raw"].(map[string]string)["Data"])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(raw), `To: "A B" <a@b.com>`) {
+		t.Fatalf("raw To header should keep the display name: %q", raw)
+	}
+}
+
+func TestSendViaHTTP_SESv1SignsFormRequest(t *testing.T) {
+	var auth, action, contentType string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth, contentType = r.Header.Get("Authorization"), r.Header.Get("Content-Type")
+		_ = r.ParseForm()
+		action = r.PostForm.Get("Action")
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+	cfg := &EmailConfig{
+		Provider:     "sesv1",
+		Endpoint:     srv.URL + "/",
+		AWSRegion:    "eu-west-1",
+		AWSAccessKey: "AKIDEXAMPLE",
+		AWSSecretKey: "secret",
+		From:         "team@example.com",
+		To:           []string{"user@example.com"},
+		Subject:      "hi",
+		TextBody:     "body",
+		Timeout:      2 * time.Second,
+	}
+	applyHTTPProfile(cfg)
+	if err := sendViaHTTP(cfg); err != nil {
+		t.Fatalf("send: %v", err)
+	}
+	if action != "SendRawEmail" || contentType != "application/x-www-form-urlencoded" {
+		t.Fatalf("expected a form-encoded SendRawEmail request, got %q %q", action, contentType)
+	}
+	if !strings.HasPrefix(auth, "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/") || !strings.Contains(auth, "/eu-west-1/ses/aws4_request") {
+		t.Fatalf("expected a SigV4 signature for ses, got %q", auth)
+	}
+}
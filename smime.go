@@ -0,0 +1,499 @@
+package main
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// SMIMEConfig signs and/or encrypts the message with S/MIME (RFC 8551). Each
+// value is PEM data or the path of a PEM file. Signing is on when SignCert
+// and SignKey are set; encryption is on when EncryptCerts lists recipient
+// certificates. With both, the signed message is encrypted.
+type SMIMEConfig struct {
+	SignCert     string   `json:"sign_cert,omitempty"`
+	SignKey      string   `json:"sign_key,omitempty"`
+	EncryptCerts []string `json:"encrypt_certs,omitempty"`
+}
+
+var (
+	oidData              = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 1}
+	oidSignedData        = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 2}
+	oidEnvelopedData     = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 3}
+	oidAttrContentType   = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 3}
+	oidAttrMessageDigest = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 4}
+	oidAttrSigningTime   = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 5}
+	oidSHA256            = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 1}
+	oidRSAEncryption     = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 1}
+	oidECDSAWithSHA256   = asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 2}
+	oidAES256CBC         = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 42}
+)
+
+type contentInfo struct {
+	ContentType asn1.ObjectIdentifier
+	Content     asn1.RawValue // [0] EXPLICIT, wrapped by marshalContentInfo
+}
+
+type signedData struct {
+	Version          int
+	DigestAlgorithms []pkix.AlgorithmIdentifier `asn1:"set"`
+	EncapContentInfo encapContentInfo
+	Certificates     asn1.RawValue
+	SignerInfos      []signerInfo `asn1:"set"`
+}
+
+type encapContentInfo struct {
+	ContentType asn1.ObjectIdentifier
+}
+
+type issuerAndSerial struct {
+	Issuer       asn1.RawValue
+	SerialNumber *big.Int
+}
+
+type signerInfo struct {
+	Version            int
+	Sid                issuerAndSerial
+	DigestAlgorithm    pkix.AlgorithmIdentifier
+	SignedAttrs        asn1.RawValue
+	SignatureAlgorithm pkix.AlgorithmIdentifier
+	Signature          []byte
+}
+
+type cmsAttribute struct {
+	Type   asn1.ObjectIdentifier
+	Values []asn1.RawValue `asn1:"set"`
+}
+
+type envelopedData struct {
+	Version              int
+	RecipientInfos       []keyTransRecipientInfo `asn1:"set"`
+	EncryptedContentInfo encryptedContentInfo
+}
+
+type keyTransRecipientInfo struct {
+	Version                int
+	Rid                    issuerAndSerial
+	KeyEncryptionAlgorithm pkix.AlgorithmIdentifier
+	EncryptedKey           []byte
+}
+
+type encryptedContentInfo struct {
+	ContentType                asn1.ObjectIdentifier
+	ContentEncryptionAlgorithm pkix.AlgorithmIdentifier
+	EncryptedContent           []byte `asn1:"tag:0"`
+}
+
+// composeMessage builds the MIME message and applies S/MIME when configured.
+func composeMessage(cfg *EmailConfig) (string, error) {
+	msg, err := buildMessage(cfg)
+	if err != nil || cfg.SMIME == nil {
+		return msg, err
+	}
+	return applySMIME(cfg.SMIME, msg)
+}
+
+// carriesRawMIME reports whether cfg delivers the message composed by
+// composeMessage, the only form S/MIME can protect. SMTP does; over HTTP only
+// the SES v1 raw payload does, and JSON or form APIs would carry the bodies
+// in the clear.
+func carriesRawMIME(cfg *EmailConfig) bool {
+	if cfg.Transport != "http" {
+		return true
+	}
+	if cfg.HTTPPayload != nil {
+		return false
+	}
+	if _, ok := httpPayloadBuilders[cfg.PayloadFormat]; ok {
+		return cfg.PayloadFormat == "sesv1"
+	}
+	return cfg.Provider == "sesv1"
+}
+
+// applySMIME signs and/or encrypts msg. The top-level headers stay in the
+// clear; the Content-* headers and body form the protected entity.
+func applySMIME(sc *SMIMEConfig, msg string) (string, error) {
+	signer, err := sc.loadSigner()
+	if err != nil {
+		return "", err
+	}
+	recipients, err := sc.loadRecipients()
+	if err != nil {
+		return "", err
+	}
+	headers, entity := splitMIMEEntity(msg)
+	if signer != nil {
+		if entity, err = signer.sign(entity); err != nil {
+			return "", err
+		}
+	}
+	if len(recipients) > 0 {
+		if entity, err = encryptEntity(entity, recipients); err != nil {
+			return "", err
+		}
+	}
+	return headers + entity, nil
+}
+
+// parseSMIMEValue reads the smime config object: sign_cert/certificate,
+// sign_key/private_key and encrypt_certs/recipient_certs (a string or list).
+func parseSMIMEValue(val any) (*SMIMEConfig, error) {
+	v, ok := val.(map[string]any)
+	if !ok {
+		if val == nil {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("smime: expected an object, got %T", val)
+	}
+	sc := &SMIMEConfig{
+		SignCert: firstString(v, "sign_cert", "certificate", "cert"),
+		SignKey:  firstString(v, "sign_key", "private_key", "key"),
+	}
+	for _, key := range []string{"encrypt_certs", "recipient_certs", "encrypt_cert"} {
+		switch certs := v[key].(type) {
+		case string:
+			sc.EncryptCerts = append(sc.EncryptCerts, certs)
+		case []any:
+			for _, c := range certs {
+				if s, ok := c.(string); ok && strings.TrimSpace(s) != "" {
+					sc.EncryptCerts = append(sc.EncryptCerts, s)
+				}
+			}
+		}
+	}
+	if sc.SignCert == "" && sc.SignKey == "" && len(sc.EncryptCerts) == 0 {
+		return nil, nil
+	}
+	return sc, nil
+}
+
+// validate loads the configured certificates and keys so bad S/MIME settings
+// fail at config time rather than on send.
+func (sc *SMIMEConfig) validate() error {
+	if (sc.SignCert == "") != (sc.SignKey == "") {
+		return errors.New("smime: sign_cert and sign_key must be set together")
+	}
+	if sc.SignCert == "" && len(sc.EncryptCerts) == 0 {
+		return errors.New("smime: set sign_cert/sign_key or encrypt_certs")
+	}
+	if _, err := sc.loadSigner(); err != nil {
+		return err
+	}
+	_, err := sc.loadRecipients()
+	return err
+}
+
+// splitMIMEEntity separates the message header block into the top-level
+// headers and the MIME entity: Content-* headers plus the body.
+func splitMIMEEntity(msg string) (headers, entity string) {
+	head, body, found := strings.Cut(msg, "\r\n\r\n")
+	if !found {
+		return msg, ""
+	}
+	var top, content strings.Builder
+	inContent := false
+	for _, line := range strings.Split(head, "\r\n") {
+		if line == "" {
+			continue
+		}
+		if line[0] != ' ' && line[0] != '\t' {
+			inContent = strings.HasPrefix(strings.ToLower(line), "content-")
+		}
+		if inContent {
+			content.WriteString(line + "\r\n")
+		} else {
+			top.WriteString(line + "\r\n")
+		}
+	}
+	return top.String(), content.String() + "\r\n" + body
+}
+
+type smimeSigner struct {
+	cert *x509.Certificate
+	key  crypto.Signer
+}
+
+func (sc *SMIMEConfig) loadSigner() (*smimeSigner, error) {
+	if sc.SignCert == "" || sc.SignKey == "" {
+		return nil, nil
+	}
+	certs, err := loadPEMCertificates(sc.SignCert)
+	if err != nil {
+		return nil, fmt.Errorf("smime: sign_cert: %w", err)
+	}
+	key, err := loadPEMPrivateKey(sc.SignKey)
+	if err != nil {
+		return nil, fmt.Errorf("smime: sign_key: %w", err)
+	}
+	switch key.Public().(type) {
+	case *rsa.PublicKey, *ecdsa.PublicKey:
+	default:
+		return nil, fmt.Errorf("smime: unsupported signing key type %T", key)
+	}
+	return &smimeSigner{cert: certs[0], key: key}, nil
+}
+
+func (sc *SMIMEConfig) loadRecipients() ([]*x509.Certificate, error) {
+	var out []*x509.Certificate
+	for _, src := range sc.EncryptCerts {
+		certs, err := loadPEMCertificates(src)
+		if err != nil {
+			return nil, fmt.Errorf("smime: encrypt_certs: %w", err)
+		}
+		for _, c := range certs {
+			if _, ok := c.PublicKey.(*rsa.PublicKey); !ok {
+				return nil, fmt.Errorf("smime: recipient %q: only RSA certificates can be encrypted to", c.Subject.CommonName)
+			}
+		}
+		out = append(out, certs...)
+	}
+	return out, nil
+}
+
+// sign wraps entity in multipart/signed with a detached SignedData over the
+// entity's exact bytes.
+func (s *smimeSigner) sign(entity string) (string, error) {
+	sig, err := s.signedData([]byte(entity))
+	if err != nil {
+		return "", err
+	}
+	boundary := randomBoundary("signed")
+	var out strings.Builder
+	out.WriteString(fmt.Sprintf("Content-Type: multipart/signed; protocol=\"application/pkcs7-signature\"; micalg=sha-256; boundary=%s\r\n\r\n", boundary))
+	out.WriteString(fmt.Sprintf("--%s\r\n", boundary))
+	out.WriteString(entity)
+	out.WriteString(fmt.Sprintf("\r\n--%s\r\n", boundary))
+	out.WriteString("Content-Type: application/pkcs7-signature; name=smime.p7s\r\n")
+	out.WriteString("Content-Transfer-Encoding: base64\r\n")
+	out.WriteString("Content-Disposition: attachment; filename=smime.p7s\r\n\r\n")
+	out.WriteString(wrapBase64(sig))
+	out.WriteString(fmt.Sprintf("--%s--\r\n", boundary))
+	return out.String(), nil
+}
+
+func (s *smimeSigner) signedData(content []byte) ([]byte, error) {
+	digest := sha256.Sum256(content)
+	attrs, err := signedAttributes(digest[:], time.Now())
+	if err != nil {
+		return nil, err
+	}
+	// The signature covers the attributes encoded as a SET, not as the
+	// [0] IMPLICIT field they are stored in.
+	attrSet, err := asn1.Marshal(asn1.RawValue{Tag: asn1.TagSet, IsCompound: true, Bytes: attrs})
+	if err != nil {
+		return nil, err
+	}
+	attrDigest := sha256.Sum256(attrSet)
+	signature, err := s.key.Sign(rand.Reader, attrDigest[:], crypto.SHA256)
+	if err != nil {
+		return nil, fmt.Errorf("smime: sign: %w", err)
+	}
+	sigAlg := pkix.AlgorithmIdentifier{Algorithm: oidRSAEncryption, Parameters: asn1.NullRawValue}
+	if _, ok := s.key.Public().(*ecdsa.PublicKey); ok {
+		sigAlg = pkix.AlgorithmIdentifier{Algorithm: oidECDSAWithSHA256}
+	}
+	sd := signedData{
+		Version:          1,
+		DigestAlgorithms: []pkix.AlgorithmIdentifier{{Algorithm: oidSHA256}},
+		EncapContentInfo: encapContentInfo{ContentType: oidData},
+		Certificates:     asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: s.cert.Raw},
+		SignerInfos: []signerInfo{{
+			Version:            1,
+			Sid:                issuerAndSerial{Issuer: asn1.RawValue{FullBytes: s.cert.RawIssuer}, SerialNumber: s.cert.SerialNumber},
+			DigestAlgorithm:    pkix.AlgorithmIdentifier{Algorithm: oidSHA256},
+			SignedAttrs:        asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: attrs},
+			SignatureAlgorithm: sigAlg,
+			Signature:          signature,
+		}},
+	}
+	return marshalContentInfo(oidSignedData, sd)
+}
+
+// signedAttributes returns the content-type, message-digest and signing-time
+// attributes concatenated in DER SET OF order.
+func signedAttributes(digest []byte, now time.Time) ([]byte, error) {
+	values := []struct {
+		oid asn1.ObjectIdentifier
+		val any
+	}{
+		{oidAttrContentType, oidData},
+		{oidAttrMessageDigest, digest},
+		{oidAttrSigningTime, now.UTC()},
+	}
+	encoded := make([][]byte, 0, len(values))
+	for _, v := range values {
+		val, err := asn1.Marshal(v.val)
+		if err != nil {
+			return nil, err
+		}
+		attr, err := asn1.Marshal(cmsAttribute{Type: v.oid, Values: []asn1.RawValue{{FullBytes: val}}})
+		if err != nil {
+			return nil, err
+		}
+		encoded = append(encoded, attr)
+	}
+	sort.Slice(encoded, func(i, j int) bool { return bytes.Compare(encoded[i], encoded[j]) < 0 })
+	return bytes.Join(encoded, nil), nil
+}
+
+// encryptEntity encrypts entity with AES-256-CBC under a random key, which is
+// wrapped for each recipient with RSA PKCS#1 v1.5, and returns it as an
+// application/pkcs7-mime enveloped-data entity.
+func encryptEntity(entity string, recipients []*x509.Certificate) (string, error) {
+	key := make([]byte, 32)
+	iv := make([]byte, aes.BlockSize)
+	if _, err := rand.Read(key); err != nil {
+		return "", err
+	}
+	if _, err := rand.Read(iv); err != nil {
+		return "", err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return "", err
+	}
+	plain := []byte(entity)
+	pad := aes.BlockSize - len(plain)%aes.BlockSize
+	plain = append(plain, bytes.Repeat([]byte{byte(pad)}, pad)...)
+	ciphertext := make([]byte, len(plain))
+	cipher.NewCBCEncrypter(block, iv).CryptBlocks(ciphertext, plain)
+
+	ivParam, err := asn1.Marshal(iv)
+	if err != nil {
+		return "", err
+	}
+	ed := envelopedData{
+		EncryptedContentInfo: encryptedContentInfo{
+			ContentType:                oidData,
+			ContentEncryptionAlgorithm: pkix.AlgorithmIdentifier{Algorithm: oidAES256CBC, Parameters: asn1.RawValue{FullBytes: ivParam}},
+			EncryptedContent:           ciphertext,
+		},
+	}
+	for _, cert := range recipients {
+		wrapped, err := rsa.EncryptPKCS1v15(rand.Reader, cert.PublicKey.(*rsa.PublicKey), key)
+		if err != nil {
+			return "", fmt.Errorf("smime: encrypt key: %w", err)
+		}
+		ed.RecipientInfos = append(ed.RecipientInfos, keyTransRecipientInfo{
+			Rid:                    issuerAndSerial{Issuer: asn1.RawValue{FullBytes: cert.RawIssuer}, SerialNumber: cert.SerialNumber},
+			KeyEncryptionAlgorithm: pkix.AlgorithmIdentifier{Algorithm: oidRSAEncryption, Parameters: asn1.NullRawValue},
+			EncryptedKey:           wrapped,
+		})
+	}
+	der, err := marshalContentInfo(oidEnvelopedData, ed)
+	if err != nil {
+		return "", err
+	}
+	var out strings.Builder
+	out.WriteString("Content-Type: application/pkcs7-mime; smime-type=enveloped-data; name=smime.p7m\r\n")
+	out.WriteString("Content-Transfer-Encoding: base64\r\n")
+	out.WriteString("Content-Disposition: attachment; filename=smime.p7m\r\n\r\n")
+	out.WriteString(wrapBase64(der))
+	return out.String(), nil
+}
+
+func marshalContentInfo(oid asn1.ObjectIdentifier, content any) ([]byte, error) {
+	inner, err := asn1.Marshal(content)
+	if err != nil {
+		return nil, fmt.Errorf("smime: encode: %w", err)
+	}
+	return asn1.Marshal(contentInfo{
+		ContentType: oid,
+		Content:     asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: inner},
+	})
+}
+
+// wrapBase64 encodes data as base64 in CRLF-terminated 76-character lines.
+func wrapBase64(data []byte) string {
+	encoded := base64.StdEncoding.EncodeToString(data)
+	var sb strings.Builder
+	for i := 0; i < len(encoded); i += 76 {
+		end := min(i+76, len(encoded))
+		sb.WriteString(encoded[i:end])
+		sb.WriteString("\r\n")
+	}
+	return sb.String()
+}
+
+// readPEM returns src when it holds PEM data, otherwise the contents of the
+// file it names.
+func readPEM(src string) ([]byte, error) {
+	if strings.Contains(src, "-----BEGIN") {
+		return []byte(src), nil
+	}
+	return os.ReadFile(src)
+}
+
+func loadPEMCertificates(src string) ([]*x509.Certificate, error) {
+	data, err := readPEM(src)
+	if err != nil {
+		return nil, err
+	}
+	var certs []*x509.Certificate
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		certs = append(certs, cert)
+	}
+	if len(certs) == 0 {
+		return nil, errors.New("no PEM certificate found")
+	}
+	return certs, nil
+}
+
+func loadPEMPrivateKey(src string) (crypto.Signer, error) {
+	data, err := readPEM(src)
+	if err != nil {
+		return nil, err
+	}
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			return nil, errors.New("no PEM private key found")
+		}
+		switch block.Type {
+		case "RSA PRIVATE KEY":
+			return x509.ParsePKCS1PrivateKey(block.Bytes)
+		case "EC PRIVATE KEY":
+			return x509.ParseECPrivateKey(block.Bytes)
+		case "PRIVATE KEY":
+			key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+			if err != nil {
+				return nil, err
+			}
+			signer, ok := key.(crypto.Signer)
+			if !ok {
+				return nil, fmt.Errorf("unsupported private key type %T", key)
+			}
+			return signer, nil
+		}
+	}
+}
@@ -0,0 +1,249 @@
+package main
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"mime"
+	"mime/multipart"
+	"net/mail"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newTestSMIMECert returns a self-signed certificate, its key and both as PEM.
+func newTestSMIMECert(t *testing.T, name string) (*x509.Certificate, *rsa.PrivateKey, string, string) {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:   big.NewInt(time.Now().UnixNano()),
+		Subject:        pkix.Name{CommonName: name},
+		EmailAddresses: []string{name},
+		NotBefore:      time.Now().Add(-time.Hour),
+		NotAfter:       time.Now().Add(time.Hour),
+		KeyUsage:       x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+		ExtKeyUsage:    []x509.ExtKeyUsage{x509.ExtKeyUsageEmailProtection},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("create certificate: %v", err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("parse certificate: %v", err)
+	}
+	certPEM := string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}))
+	keyPEM := string(pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)}))
+	return cert, key, certPEM, keyPEM
+}
+
+func smimeTestConfig(sc *SMIMEConfig) *EmailConfig {
+	return &EmailConfig{
+		Host:     "mail.example.com",
+		From:     "sender@example.com",
+		To:       []string{"user@example.com"},
+		Subject:  "Quarterly statement",
+		TextBody: "Your statement is ready.",
+		SMIME:    sc,
+	}
+}
+
+func TestComposeMessage_SMIMESigned(t *testing.T) {
+	cert, _, certPEM, keyPEM := newTestSMIMECert(t, "sender@example.com")
+	keyFile := filepath.Join(t.TempDir(), "sign.key")
+	if err := os.WriteFile(keyFile, []byte(keyPEM), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	msg, err := composeMessage(smimeTestConfig(&SMIMEConfig{SignCert: certPEM, SignKey: keyFile}))
+	if err != nil {
+		t.Fatalf("composeMessage: %v", err)
+	}
+	parsed, err := mail.ReadMessage(strings.NewReader(msg))
+	if err != nil {
+		t.Fatalf("read message: %v", err)
+	}
+	if parsed.Header.Get("Subject") != "Quarterly statement" {
+		t.Fatalf("top-level headers should stay in the clear: %q", msg)
+	}
+	mediaType, params, err := mime.ParseMediaType(parsed.Header.Get("Content-Type"))
+	if err != nil || mediaType != "multipart/signed" || params["protocol"] != "application/pkcs7-signature" || params["micalg"] != "sha-256" {
+		t.Fatalf("unexpected Content-Type %q", parsed.Header.Get("Content-Type"))
+	}
+	body, _ := io.ReadAll(parsed.Body)
+	delimiter := "--" + params["boundary"] + "\r\n"
+	signedPart, _, _ := strings.Cut(strings.TrimPrefix(string(body), delimiter), "\r\n"+delimiter)
+	if !strings.HasPrefix(signedPart, "Content-Type: text/plain") || !strings.Contains(signedPart, "Your statement is ready.") {
+		t.Fatalf("unexpected signed part %q", signedPart)
+	}
+
+	reader := multipart.NewReader(bytes.NewReader(body), params["boundary"])
+	if _, err := reader.NextPart(); err != nil {
+		t.Fatal(err)
+	}
+	sigPart, err := reader.NextPart()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ct := sigPart.Header.Get("Content-Type"); !strings.HasPrefix(ct, "application/pkcs7-signature") {
+		t.Fatalf("unexpected signature part type %q", ct)
+	}
+	encoded, _ := io.ReadAll(sigPart)
+	der, err := base64.StdEncoding.DecodeString(strings.Join(strings.Fields(string(encoded)), ""))
+	if err != nil {
+		t.Fatalf("decode signature: %v", err)
+	}
+
+	var ci struct {
+		ContentType asn1.ObjectIdentifier
+		Content     asn1.RawValue `asn1:"explicit,tag:0"`
+	}
+	if _, err := asn1.Unmarshal(der, &ci); err != nil || !ci.ContentType.Equal(oidSignedData) {
+		t.Fatalf("signature is not SignedData: %v %v", ci.ContentType, err)
+	}
+	var sd struct {
+		Version          int
+		DigestAlgorithms asn1.RawValue
+		EncapContentInfo asn1.RawValue
+		Certificates     asn1.RawValue `asn1:"optional,tag:0"`
+		SignerInfos      []struct {
+			Version            int
+			Sid                asn1.RawValue
+			DigestAlgorithm    pkix.AlgorithmIdentifier
+			SignedAttrs        asn1.RawValue
+			SignatureAlgorithm pkix.AlgorithmIdentifier
+			Signature          []byte
+		} `asn1:"set"`
+	}
+	if _, err := asn1.Unmarshal(ci.Content.Bytes, &sd); err != nil {
+		t.Fatalf("decode SignedData: %v", err)
+	}
+	if !bytes.Equal(sd.Certificates.Bytes, cert.Raw) || len(sd.SignerInfos) != 1 {
+		t.Fatalf("expected the signing certificate and one signer")
+	}
+	si := sd.SignerInfos[0]
+
+	var digest []byte
+	for rest := si.SignedAttrs.Bytes; len(rest) > 0; {
+		var attr cmsAttribute
+		if rest, err = asn1.Unmarshal(rest, &attr); err != nil {
+			t.Fatalf("decode attribute: %v", err)
+		}
+		if attr.Type.Equal(oidAttrMessageDigest) {
+			if _, err := asn1.Unmarshal(attr.Values[0].FullBytes, &digest); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	want := sha256.Sum256([]byte(signedPart))
+	if !bytes.Equal(digest, want[:]) {
+		t.Fatalf("message digest %x does not match the signed part hash %x", digest, want)
+	}
+
+	attrSet := append([]byte{}, si.SignedAttrs.FullBytes...)
+	attrSet[0] = 0x31 // verify over the attributes as a SET
+	attrDigest := sha256.Sum256(attrSet)
+	if err := rsa.VerifyPKCS1v15(cert.PublicKey.(*rsa.PublicKey), crypto.SHA256, attrDigest[:], si.Signature); err != nil {
+		t.Fatalf("signature does not verify: %v", err)
+	}
+}
+
+func TestComposeMessage_SMIMEEncrypted(t *testing.T) {
+	_, key, certPEM, _ := newTestSMIMECert(t, "user@example.com")
+	msg, err := composeMessage(smimeTestConfig(&SMIMEConfig{EncryptCerts: []string{certPEM}}))
+	if err != nil {
+		t.Fatalf("composeMessage: %v", err)
+	}
+	if strings.Contains(msg, "Your statement is ready.") {
+		t.Fatal("body should not appear in the clear")
+	}
+	parsed, err := mail.ReadMessage(strings.NewReader(msg))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ct := parsed.Header.Get("Content-Type"); !strings.HasPrefix(ct, "application/pkcs7-mime; smime-type=enveloped-data") {
+		t.Fatalf("unexpected Content-Type %q", ct)
+	}
+	encoded, _ := io.ReadAll(parsed.Body)
+	der, err := base64.StdEncoding.DecodeString(strings.Join(strings.Fields(string(encoded)), ""))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ci struct {
+		ContentType asn1.ObjectIdentifier
+		Content     asn1.RawValue `asn1:"explicit,tag:0"`
+	}
+	if _, err := asn1.Unmarshal(der, &ci); err != nil || !ci.ContentType.Equal(oidEnvelopedData) {
+		t.Fatalf("payload is not EnvelopedData: %v", err)
+	}
+	var ed envelopedData
+	if _, err := asn1.Unmarshal(ci.Content.Bytes, &ed); err != nil {
+		t.Fatalf("decode EnvelopedData: %v", err)
+	}
+	cek, err := rsa.DecryptPKCS1v15(rand.Reader, key, ed.RecipientInfos[0].EncryptedKey)
+	if err != nil {
+		t.Fatalf("unwrap key: %v", err)
+	}
+	var iv []byte
+	if _, err := asn1.Unmarshal(ed.EncryptedContentInfo.ContentEncryptionAlgorithm.Parameters.FullBytes, &iv); err != nil {
+		t.Fatal(err)
+	}
+	block, err := aes.NewCipher(cek)
+	if err != nil {
+		t.Fatal(err)
+	}
+	plain := make([]byte, len(ed.EncryptedContentInfo.EncryptedContent))
+	cipher.NewCBCDecrypter(block, iv).CryptBlocks(plain, ed.EncryptedContentInfo.EncryptedContent)
+	plain = plain[:len(plain)-int(plain[len(plain)-1])]
+	if !strings.HasPrefix(string(plain), "Content-Type: text/plain") || !strings.Contains(string(plain), "Your statement is ready.") {
+		t.Fatalf("unexpected decrypted entity %q", plain)
+	}
+}
+
+func TestParseConfig_SMIMEValidation(t *testing.T) {
+	_, _, certPEM, _ := newTestSMIMECert(t, "sender@example.com")
+	_, err := parseConfig(map[string]any{
+		"host": "localhost", "from": "a@example.com", "to": "b@example.com",
+		"smime": map[string]any{"sign_cert": certPEM},
+	})
+	if err == nil || !strings.Contains(err.Error(), "sign_key") {
+		t.Fatalf("expected a missing sign_key error, got %v", err)
+	}
+}
+
+func TestParseConfig_SMIMERequiresRawMIME(t *testing.T) {
+	_, _, certPEM, _ := newTestSMIMECert(t, "rcpt@example.com")
+	smime := map[string]any{"encrypt_certs": []any{certPEM}}
+	_, err := parseConfig(map[string]any{
+		"provider": "sendgrid", "transport": "http", "api_key": "key",
+		"from": "a@example.com", "to": "b@example.com", "smime": smime,
+	})
+	if err == nil || !strings.Contains(err.Error(), "smime requires smtp") {
+		t.Fatalf("expected smime over a JSON API to be rejected, got %v", err)
+	}
+	for name, raw := range map[string]map[string]any{
+		"smtp":  {"host": "localhost"},
+		"sesv1": {"provider": "sesv1", "aws_access_key": "AKID", "aws_secret_key": "secret"},
+	} {
+		raw["from"], raw["to"], raw["smime"] = "a@example.com", "b@example.com", smime
+		if _, err := parseConfig(raw); err != nil {
+			t.Fatalf("%s: expected smime to be accepted, got %v", name, err)
+		}
+	}
+}
@@ -0,0 +1,280 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/smtp"
+	"net/textproto"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// errMessageTooLarge is returned when the built message exceeds the size
+// limit advertised by the SMTP server's SIZE extension.
+var errMessageTooLarge = errors.New("message exceeds server limit")
+
+// DSNConfig holds RFC 3461 delivery status notification parameters. They are
+// only sent when the SMTP server advertises the DSN extension.
+type DSNConfig struct {
+	// Notify lists the conditions to report: SUCCESS, FAILURE, DELAY or NEVER.
+	Notify []string
+	// Return selects how much of the message is returned: FULL or HDRS.
+	Return string
+	// EnvID is an envelope identifier echoed back in notifications.
+	EnvID string
+}
+
+func (d DSNConfig) enabled() bool {
+	return len(d.Notify) > 0 || d.Return != "" || d.EnvID != ""
+}
+
+func (d DSNConfig) validate() error {
+	never := false
+	for _, n := range d.Notify {
+		switch n {
+		case "SUCCESS", "FAILURE", "DELAY":
+		case "NEVER":
+			never = true
+		default:
+			return fmt.Errorf("invalid dsn notify value %q", n)
+		}
+	}
+	if never && len(d.Notify) > 1 {
+		return errors.New("dsn notify NEVER cannot be combined with other values")
+	}
+	switch d.Return {
+	case "", "FULL", "HDRS":
+	default:
+		return fmt.Errorf("invalid dsn return value %q", d.Return)
+	}
+	return nil
+}
+
+// mailParams returns the MAIL FROM parameters for the DSN extension.
+func (d DSNConfig) mailParams() []string {
+	var params []string
+	if d.Return != "" {
+		params = append(params, "RET="+d.Return)
+	}
+	if d.EnvID != "" {
+		params = append(params, "ENVID="+xtextEncode(d.EnvID))
+	}
+	return params
+}
+
+// rcptParams returns the RCPT TO parameters for the DSN extension.
+func (d DSNConfig) rcptParams() []string {
+	if len(d.Notify) == 0 {
+		return nil
+	}
+	return []string{"NOTIFY=" + strings.Join(d.Notify, ",")}
+}
+
+func normalizeDSNNotify(values []string) []string {
+	out := make([]string, 0, len(values))
+	for _, v := range values {
+		if s := strings.ToUpper(strings.TrimSpace(v)); s != "" {
+			out = append(out, s)
+		}
+	}
+	if len(out) == 0 {
+		return nil
+	}
+	return out
+}
+
+// xtextEncode encodes a value using the RFC 3461 xtext encoding.
+func xtextEncode(value string) string {
+	var b strings.Builder
+	for i := 0; i < len(value); i++ {
+		c := value[i]
+		if c < '!' || c > '~' || c == '+' || c == '=' {
+			fmt.Fprintf(&b, "+%02X", c)
+			continue
+		}
+		b.WriteByte(c)
+	}
+	return b.String()
+}
+
+// smtpSizeParams checks the message size against the server's advertised SIZE
+// limit (RFC 1870) and returns the SIZE parameter for MAIL FROM when the
+// extension is supported. A limit of zero means the server declares no maximum.
+func smtpSizeParams(client *smtp.Client, size int) ([]string, error) {
+	ok, param := client.Extension("SIZE")
+	if !ok {
+		return nil, nil
+	}
+	if limit, err := strconv.Atoi(strings.TrimSpace(param)); err == nil && limit > 0 && size > limit {
+		return nil, fmt.Errorf("%w: %d bytes > %d bytes", errMessageTooLarge, size, limit)
+	}
+	return []string{"SIZE=" + strconv.Itoa(size)}, nil
+}
+
+// smtpCmd sends a raw command on the client connection and reads the reply,
+// mirroring what net/smtp does internally for its own commands.
+func smtpCmd(client *smtp.Client, expectCode int, format string, args ...any) (int, string, error) {
+	id, err := client.Text.Cmd(format, args...)
+	if err != nil {
+		return 0, "", err
+	}
+	client.Text.StartResponse(id)
+	defer client.Text.EndResponse(id)
+	return client.Text.ReadResponse(expectCode)
+}
+
+// smtpBodyParams returns the BODY parameter for MAIL FROM (RFC 6152) when the
+// server advertises 8BITMIME: 8BITMIME when msg has 8-bit content or declares
+// an 8bit transfer encoding, 7BIT otherwise. bodyType "7bit" or "8bitmime"
+// overrides the detection.
+func smtpBodyParams(client *smtp.Client, bodyType, msg string) []string {
+	if ok, _ := client.Extension("8BITMIME"); !ok {
+		if bodyType != "7bit" && messageIs8bit(msg) {
+			logger().Warn("smtp: 8-bit message sent to a server without 8BITMIME")
+		}
+		return nil
+	}
+	switch bodyType {
+	case "7bit":
+		return []string{"BODY=7BIT"}
+	case "8bitmime":
+		return []string{"BODY=8BITMIME"}
+	}
+	if messageIs8bit(msg) {
+		return []string{"BODY=8BITMIME"}
+	}
+	return []string{"BODY=7BIT"}
+}
+
+// eightBitCTE matches a Content-Transfer-Encoding: 8bit header line.
+var eightBitCTE = regexp.MustCompile(`(?im)^content-transfer-encoding:[ \t]*8bit[ \t]*\r?$`)
+
+// messageIs8bit reports whether msg contains non-ASCII bytes or a part whose
+// Content-Transfer-Encoding is 8bit.
+func messageIs8bit(msg string) bool {
+	for i := 0; i < len(msg); i++ {
+		if msg[i] > 127 {
+			return true
+		}
+	}
+	return eightBitCTE.MatchString(msg)
+}
+
+// smtpMail issues MAIL FROM with optional ESMTP parameters. Without parameters
+// it defers to net/smtp, which adds SMTPUTF8 when advertised.
+func smtpMail(client *smtp.Client, from string, params []string) error {
+	if len(params) == 0 {
+		return client.Mail(from)
+	}
+	if strings.ContainsAny(from, "\r\n") {
+		return errors.New("smtp: A line must not contain CR or LF")
+	}
+	_, _, err := smtpCmd(client, 250, "%s", smtpMailLine(client, from, params))
+	return err
+}
+
+// smtpMailLine formats MAIL FROM with SMTPUTF8 (when advertised) and params.
+func smtpMailLine(client *smtp.Client, from string, params []string) string {
+	var extra []string
+	if ok, _ := client.Extension("SMTPUTF8"); ok {
+		extra = append(extra, "SMTPUTF8")
+	}
+	extra = append(extra, params...)
+	if len(extra) == 0 {
+		return fmt.Sprintf("MAIL FROM:<%s>", from)
+	}
+	return fmt.Sprintf("MAIL FROM:<%s> %s", from, strings.Join(extra, " "))
+}
+
+// smtpRcpt issues RCPT TO with optional ESMTP parameters.
+func smtpRcpt(client *smtp.Client, to string, params []string) error {
+	if len(params) == 0 {
+		return client.Rcpt(to)
+	}
+	if strings.ContainsAny(to, "\r\n") {
+		return errors.New("smtp: A line must not contain CR or LF")
+	}
+	_, _, err := smtpCmd(client, 25, "RCPT TO:<%s> %s", to, strings.Join(params, " "))
+	return err
+}
+
+// smtpPipelined issues MAIL FROM, every RCPT TO and DATA as one batch (RFC 2920
+// PIPELINING) before reading any reply, then reads the replies in order.
+// A nil map means MAIL FROM failed and err holds its error. Otherwise the map
+// holds the rejected recipients, and either the DATA writer or the DATA error
+// is returned.
+func smtpPipelined(client *smtp.Client, from string, mailParams []string, recipients []string, rcptParams []string) (map[string]error, io.WriteCloser, error) {
+	if strings.ContainsAny(from, "\r\n") {
+		return nil, nil, errors.New("smtp: A line must not contain CR or LF")
+	}
+	for _, to := range recipients {
+		if strings.ContainsAny(to, "\r\n") {
+			return nil, nil, errors.New("smtp: A line must not contain CR or LF")
+		}
+	}
+	rcptSuffix := ""
+	if len(rcptParams) > 0 {
+		rcptSuffix = " " + strings.Join(rcptParams, " ")
+	}
+
+	text := client.Text
+	commands := make([]string, 0, len(recipients)+2)
+	commands = append(commands, smtpMailLine(client, from, mailParams))
+	for _, to := range recipients {
+		commands = append(commands, fmt.Sprintf("RCPT TO:<%s>%s", to, rcptSuffix))
+	}
+	commands = append(commands, "DATA")
+	ids := make([]uint, 0, len(commands))
+	for _, cmd := range commands {
+		id, err := text.Cmd("%s", cmd)
+		if err != nil {
+			return nil, nil, err
+		}
+		ids = append(ids, id)
+	}
+
+	read := func(id uint, code int) error {
+		text.StartResponse(id)
+		defer text.EndResponse(id)
+		_, _, err := text.ReadResponse(code)
+		return err
+	}
+	mailErr := read(ids[0], 250)
+	rcptErrs := map[string]error{}
+	for i, to := range recipients {
+		if err := read(ids[i+1], 25); err != nil {
+			rcptErrs[to] = err
+		}
+	}
+	dataErr := read(ids[len(ids)-1], 354)
+	if dataErr == nil && (mailErr != nil || len(rcptErrs) == len(recipients)) {
+		// The server accepted DATA without a valid transaction; end it empty.
+		w := &pipelinedData{WriteCloser: text.DotWriter(), text: text}
+		w.Close()
+		dataErr = errors.New("smtp: no recipients accepted")
+	}
+	if mailErr != nil {
+		return nil, nil, mailErr
+	}
+	if dataErr != nil {
+		return rcptErrs, nil, dataErr
+	}
+	return rcptErrs, &pipelinedData{WriteCloser: text.DotWriter(), text: text}, nil
+}
+
+// pipelinedData writes the message body after a pipelined DATA and reads the
+// final reply on Close, like the writer returned by smtp.Client.Data.
+type pipelinedData struct {
+	io.WriteCloser
+	text *textproto.Conn
+}
+
+func (d *pipelinedData) Close() error {
+	if err := d.WriteCloser.Close(); err != nil {
+		return err
+	}
+	_, _, err := d.text.ReadResponse(250)
+	return err
+}
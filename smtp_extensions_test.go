@@ -0,0 +1,167 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestSendViaSMTP_DSNParameters(t *testing.T) {
+	srv := newStubSMTPServer(t, "DSN")
+	cfg := srv.config()
+	cfg.DSN = DSNConfig{Notify: []string{"SUCCESS", "FAILURE"}, Return: "HDRS", EnvID: "campaign 42"}
+	if err := sendViaSMTP(cfg); err != nil {
+		t.Fatalf("sendViaSMTP returned error: %v", err)
+	}
+	var mail, rcpt string
+	for _, c := range srv.Commands() {
+		if strings.HasPrefix(c, "MAIL FROM:") {
+			mail = c
+		}
+		if strings.HasPrefix(c, "RCPT TO:") {
+			rcpt = c
+		}
+	}
+	if !strings.Contains(mail, "RET=HDRS") || !strings.Contains(mail, "ENVID=campaign+2042") {
+		t.Fatalf("expected DSN parameters on MAIL FROM, got %q", mail)
+	}
+	if !strings.HasSuffix(rcpt, "NOTIFY=SUCCESS,FAILURE") {
+		t.Fatalf("expected NOTIFY on RCPT TO, got %q", rcpt)
+	}
+}
+
+func TestSendViaSMTP_DSNSkippedWhenUnsupported(t *testing.T) {
+	srv := newStubSMTPServer(t)
+	cfg := srv.config()
+	cfg.DSN = DSNConfig{Notify: []string{"FAILURE"}}
+	if err := sendViaSMTP(cfg); err != nil {
+		t.Fatalf("sendViaSMTP returned error: %v", err)
+	}
+	for _, c := range srv.Commands() {
+		if strings.Contains(c, "NOTIFY=") || strings.Contains(c, "RET=") {
+			t.Fatalf("DSN parameters sent to a server without DSN: %q", c)
+		}
+	}
+}
+
+func TestDSNConfigValidate(t *testing.T) {
+	if err := (DSNConfig{Notify: []string{"NEVER", "FAILURE"}}).validate(); err == nil {
+		t.Fatalf("expected NEVER combined with FAILURE to be rejected")
+	}
+	if err := (DSNConfig{Return: "BODY"}).validate(); err == nil {
+		t.Fatalf("expected invalid RET value to be rejected")
+	}
+}
+
+func TestSendViaSMTP_SizeLimitFailsFast(t *testing.T) {
+	srv := newStubSMTPServer(t, "SIZE 64")
+	cfg := srv.config()
+	cfg.TextBody = strings.Repeat("x", 256)
+	err := sendViaSMTP(cfg)
+	if !errors.Is(err, errMessageTooLarge) {
+		t.Fatalf("expected errMessageTooLarge, got %v", err)
+	}
+	for _, c := range srv.Commands() {
+		if strings.HasPrefix(c, "MAIL FROM:") || c == "DATA" {
+			t.Fatalf("expected no mail transaction after size check, got %q", c)
+		}
+	}
+}
+
+func TestSendViaSMTP_SizeParameterOnMailFrom(t *testing.T) {
+	srv := newStubSMTPServer(t, "SIZE 1048576")
+	cfg := srv.config()
+	if err := sendViaSMTP(cfg); err != nil {
+		t.Fatalf("sendViaSMTP returned error: %v", err)
+	}
+	for _, c := range srv.Commands() {
+		if strings.HasPrefix(c, "MAIL FROM:") {
+			if !strings.Contains(c, " SIZE=") {
+				t.Fatalf("expected SIZE parameter on MAIL FROM, got %q", c)
+			}
+			return
+		}
+	}
+	t.Fatalf("no MAIL FROM command recorded")
+}
+
+func TestSendViaSMTP_Pipelining(t *testing.T) {
+	srv := newStubSMTPServer(t, "PIPELINING")
+	srv.holdUntilData()
+	srv.reply("RCPT TO:<c@example.com>", "550 no such user")
+	cfg := srv.config()
+	cfg.To = []string{"a@example.com", "b@example.com", "c@example.com"}
+
+	result, err := sendViaSMTPResult(cfg)
+	if err != nil {
+		t.Fatalf("pipelined send failed: %v", err)
+	}
+	if srv.Stalled() {
+		t.Fatalf("client waited for replies instead of pipelining the batch")
+	}
+	if len(srv.Messages()) != 1 {
+		t.Fatalf("expected one delivered message, got %d", len(srv.Messages()))
+	}
+	if got := strings.Join(result.Accepted(), ","); got != "a@example.com,b@example.com" {
+		t.Fatalf("unexpected accepted recipients %q", got)
+	}
+	if rejected := result.Rejected(); len(rejected) != 1 || rejected[0].Address != "c@example.com" {
+		t.Fatalf("expected c@example.com rejected, got %+v", rejected)
+	}
+}
+
+func TestSendViaSMTP_SequentialWithoutPipelining(t *testing.T) {
+	srv := newStubSMTPServer(t)
+	srv.holdUntilData()
+	cfg := srv.config()
+	if err := sendViaSMTP(cfg); err != nil {
+		t.Fatalf("sequential send failed: %v", err)
+	}
+	if !srv.Stalled() {
+		t.Fatalf("expected the client to wait for each reply without PIPELINING")
+	}
+}
+
+func TestSendViaSMTP_BodyParameterMatchesContent(t *testing.T) {
+	cases := []struct {
+		name, body, encoding, bodyType, want string
+	}{
+		{"ascii", "hello", "", "", "BODY=7BIT"},
+		{"8bit utf-8", "héllo wörld", "8bit", "", "BODY=8BITMIME"},
+		{"quoted-printable utf-8", "héllo wörld", "quoted-printable", "", "BODY=7BIT"},
+		{"forced", "hello", "", "8bitmime", "BODY=8BITMIME"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			srv := newStubSMTPServer(t, "8BITMIME")
+			cfg := srv.config()
+			cfg.TextBody = tc.body
+			cfg.BodyEncoding = tc.encoding
+			cfg.SMTPBodyType = tc.bodyType
+			if err := sendViaSMTP(cfg); err != nil {
+				t.Fatalf("sendViaSMTP returned error: %v", err)
+			}
+			var mail string
+			for _, c := range srv.Commands() {
+				if strings.HasPrefix(c, "MAIL FROM:") {
+					mail = c
+				}
+			}
+			if !strings.Contains(mail, tc.want) || strings.Count(mail, "BODY=") != 1 {
+				t.Fatalf("expected %s on MAIL FROM, got %q", tc.want, mail)
+			}
+		})
+	}
+}
+
+func TestSendViaSMTP_NoBodyParameterWithout8BITMIME(t *testing.T) {
+	srv := newStubSMTPServer(t)
+	if err := sendViaSMTP(srv.config()); err != nil {
+		t.Fatalf("sendViaSMTP returned error: %v", err)
+	}
+	for _, c := range srv.Commands() {
+		if strings.Contains(c, "BODY=") {
+			t.Fatalf("BODY sent to a server without 8BITMIME: %q", c)
+		}
+	}
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"fmt"
+	"net/smtp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// pooledSMTPConn is an SMTP connection kept open between sends. The EHLO
+// capabilities are cached by the client for the lifetime of the connection,
+// so SIZE/DSN checks on a reused connection cost no extra round-trips. A new
+// connection negotiates (and caches) them again.
+type pooledSMTPConn struct {
+	client    *smtp.Client
+	authed    bool
+	idleSince time.Time
+}
+
+var (
+	smtpPoolMu sync.Mutex
+	smtpPool   = map[string][]*pooledSMTPConn{}
+	// smtpPoolMaxIdle drops pooled connections idle for longer, as servers
+	// usually close them after a few minutes.
+	smtpPoolMaxIdle = 2 * time.Minute
+)
+
+// smtpPoolKey groups connections that can serve cfg. Credentials and the TLS
+// policy are part of the key (hashed, so the password is not kept in the
+// map), so an authenticated connection is never reused under other
+// credentials or a weaker TLS check.
+func smtpPoolKey(cfg *EmailConfig) string {
+	secret := sha256Hex([]byte(strings.Join([]string{cfg.Username, cfg.Password, cfg.APIToken, cfg.SMTPAuth}, "\x00")))
+	return fmt.Sprintf("%s:%d|user=%s|auth=%s|tls=%t|ssl=%t|insecure=%t|pins=%s|src=%s",
+		cfg.Host, cfg.Port, cfg.Username, secret[:16], cfg.UseTLS, cfg.UseSSL, cfg.SkipTLSVerify, strings.Join(cfg.PinnedSHA256, ","), cfg.SourceIP)
+}
+
+// acquireSMTPConn returns an idle pooled connection for cfg or dials a new one.
+// Idle connections past smtpPoolMaxIdle or failing a NOOP probe are closed,
+// so a connection the server dropped does not use up a send attempt.
+func acquireSMTPConn(cfg *EmailConfig) (*pooledSMTPConn, error) {
+	if cfg.SMTPPoolSize > 0 {
+		key := smtpPoolKey(cfg)
+		for {
+			smtpPoolMu.Lock()
+			idle := smtpPool[key]
+			if len(idle) == 0 {
+				smtpPoolMu.Unlock()
+				break
+			}
+			pc := idle[len(idle)-1]
+			smtpPool[key] = idle[:len(idle)-1]
+			smtpPoolMu.Unlock()
+			if time.Since(pc.idleSince) > smtpPoolMaxIdle {
+				pc.client.Close()
+				continue
+			}
+			if err := pc.client.Noop(); err != nil {
+				logger().Debug("smtp pool: dropping stale connection", "host", cfg.Host, "error", err)
+				pc.client.Close()
+				continue
+			}
+			return pc, nil
+		}
+	}
+	client, err := openSMTPClient(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return &pooledSMTPConn{client: client}, nil
+}
+
+// releaseSMTPConn returns a connection whose transaction finished cleanly to
+// the pool, or closes it when pooling is off, the pool is full or reuse is unsafe.
+func releaseSMTPConn(cfg *EmailConfig, pc *pooledSMTPConn, reusable bool) {
+	if !reusable || cfg.SMTPPoolSize <= 0 {
+		pc.client.Quit()
+		return
+	}
+	if err := pc.client.Reset(); err != nil {
+		pc.client.Close()
+		return
+	}
+	key := smtpPoolKey(cfg)
+	pc.idleSince = time.Now()
+	smtpPoolMu.Lock()
+	if len(smtpPool[key]) < cfg.SMTPPoolSize {
+		smtpPool[key] = append(smtpPool[key], pc)
+		smtpPoolMu.Unlock()
+		return
+	}
+	smtpPoolMu.Unlock()
+	pc.client.Quit()
+}
+
+// closeSMTPPool closes every idle pooled connection.
+func closeSMTPPool() {
+	smtpPoolMu.Lock()
+	defer smtpPoolMu.Unlock()
+	for key, idle := range smtpPool {
+		for _, pc := range idle {
+			pc.client.Quit()
+		}
+		delete(smtpPool, key)
+	}
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func countCommands(srv *stubSMTPServer, verb string) int {
+	n := 0
+	for _, c := range srv.Commands() {
+		if strings.HasPrefix(c, verb) {
+			n++
+		}
+	}
+	return n
+}
+
+func TestSendViaSMTP_PooledConnectionReusesEHLO(t *testing.T) {
+	defer closeSMTPPool()
+	srv := newStubSMTPServer(t, "SIZE 1048576", "AUTH PLAIN")
+	srv.reply("AUTH", "235 authenticated")
+	cfg := srv.config()
+	cfg.Username, cfg.Password = "user", "secret"
+	cfg.SMTPPoolSize = 1
+
+	for i := 0; i < 3; i++ {
+		if err := sendViaSMTP(cfg); err != nil {
+			t.Fatalf("send %d failed: %v", i+1, err)
+		}
+	}
+	if got := len(srv.Messages()); got != 3 {
+		t.Fatalf("expected 3 messages, got %d", got)
+	}
+	if got := countCommands(srv, "EHLO"); got != 1 {
+		t.Fatalf("expected a single EHLO on the pooled connection, got %d", got)
+	}
+	if got := countCommands(srv, "AUTH"); got != 1 {
+		t.Fatalf("expected a single AUTH on the pooled connection, got %d", got)
+	}
+
+	// A fresh connection negotiates capabilities again.
+	closeSMTPPool()
+	if err := sendViaSMTP(cfg); err != nil {
+		t.Fatalf("send after pool reset failed: %v", err)
+	}
+	if got := countCommands(srv, "EHLO"); got != 2 {
+		t.Fatalf("expected EHLO on reconnect, got %d", got)
+	}
+}
+
+func TestAcquireSMTPConn_DropsStaleAndMismatchedConnections(t *testing.T) {
+	defer closeSMTPPool()
+	srv := newStubSMTPServer(t, "AUTH PLAIN")
+	srv.reply("AUTH", "235 authenticated")
+	cfg := srv.config()
+	cfg.Username, cfg.Password = "user", "secret"
+	cfg.SMTPPoolSize = 1
+
+	if err := sendViaSMTP(cfg); err != nil {
+		t.Fatalf("first send: %v", err)
+	}
+	// The server dropped the idle connection: the NOOP probe fails and the
+	// send redials instead of failing.
+	srv.reply("NOOP", "421 closing connection")
+	if err := sendViaSMTP(cfg); err != nil {
+		t.Fatalf("send after a failed probe: %v", err)
+	}
+	if got := countCommands(srv, "EHLO"); got != 2 {
+		t.Fatalf("expected a redial after the failed NOOP, got %d EHLO", got)
+	}
+	srv.reply("NOOP", "250 ok")
+
+	// Other credentials must not reuse the authenticated connection.
+	other := *cfg
+	other.Password = "rotated"
+	if err := sendViaSMTP(&other); err != nil {
+		t.Fatalf("send with other credentials: %v", err)
+	}
+	if got := countCommands(srv, "AUTH"); got != 3 {
+		t.Fatalf("expected a new AUTH for other credentials, got %d", got)
+	}
+	insecure := *cfg
+	insecure.SkipTLSVerify = true
+	if smtpPoolKey(&insecure) == smtpPoolKey(cfg) || strings.Contains(smtpPoolKey(cfg), "secret") {
+		t.Fatalf("unexpected pool key %q", smtpPoolKey(cfg))
+	}
+
+	orig := smtpPoolMaxIdle
+	smtpPoolMaxIdle = 0
+	defer func() { smtpPoolMaxIdle = orig }()
+	if err := sendViaSMTP(cfg); err != nil {
+		t.Fatalf("send after idle timeout: %v", err)
+	}
+	if got := countCommands(srv, "EHLO"); got != 4 {
+		t.Fatalf("expected an idle connection past the limit to be redialed, got %d EHLO", got)
+	}
+}
@@ -0,0 +1,206 @@
+package main
+
+import (
+	"bufio"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// stubSMTPServer is a minimal in-process SMTP server used by tests to inspect
+// the commands issued by sendViaSMTP. It advertises the given EHLO extensions
+// and accepts every command unless a reply override is configured.
+type stubSMTPServer struct {
+	ln         net.Listener
+	extensions []string
+
+	mu       sync.Mutex
+	commands []string
+	messages []string
+	replies  map[string]string
+
+	// holdReplies queues MAIL/RCPT replies until DATA arrives, as a server
+	// reading a pipelined batch would. stalled records that the client waited
+	// for a reply before sending the rest of the batch.
+	holdReplies bool
+	stalled     bool
+}
+
+func newStubSMTPServer(t *testing.T, extensions ...string) *stubSMTPServer {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("cannot start stub smtp server: %v", err)
+	}
+	s := &stubSMTPServer{ln: ln, extensions: extensions, replies: map[string]string{}}
+	go s.serve()
+	t.Cleanup(func() { ln.Close() })
+	return s
+}
+
+// reply overrides the response sent for commands starting with prefix
+// (e.g. "RCPT TO:<bad@example.com>" or "DATA").
+func (s *stubSMTPServer) reply(prefix, response string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.replies[strings.ToUpper(prefix)] = response
+}
+
+// config returns an EmailConfig pointed at the stub server.
+func (s *stubSMTPServer) config() *EmailConfig {
+	host, portStr, _ := net.SplitHostPort(s.ln.Addr().String())
+	port, _ := strconv.Atoi(portStr)
+	return &EmailConfig{
+		From:         "sender@example.com",
+		EnvelopeFrom: "sender@example.com",
+		To:           []string{"user@example.com"},
+		Subject:      "stub",
+		TextBody:     "hello",
+		Transport:    "smtp",
+		Host:         host,
+		Port:         port,
+		Timeout:      2 * time.Second,
+	}
+}
+
+// holdUntilData makes the server queue MAIL/RCPT replies until DATA.
+func (s *stubSMTPServer) holdUntilData() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.holdReplies = true
+}
+
+// Stalled reports whether held replies had to be flushed because the client
+// stopped sending before DATA, i.e. it did not pipeline.
+func (s *stubSMTPServer) Stalled() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.stalled
+}
+
+func (s *stubSMTPServer) Commands() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.commands...)
+}
+
+func (s *stubSMTPServer) Messages() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.messages...)
+}
+
+func (s *stubSMTPServer) serve() {
+	for {
+		conn, err := s.ln.Accept()
+		if err != nil {
+			return
+		}
+		go s.handle(conn)
+	}
+}
+
+func (s *stubSMTPServer) handle(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	w := bufio.NewWriter(conn)
+	write := func(line string) {
+		w.WriteString(line + "\r\n")
+		w.Flush()
+	}
+	write("220 stub ESMTP")
+	var held []string
+	flushHeld := func() {
+		for _, h := range held {
+			write(h)
+		}
+		held = nil
+	}
+	for {
+		if len(held) > 0 {
+			conn.SetReadDeadline(time.Now().Add(300 * time.Millisecond))
+		}
+		line, err := r.ReadString('\n')
+		if ne, ok := err.(net.Error); ok && ne.Timeout() {
+			s.mu.Lock()
+			s.stalled = true
+			s.mu.Unlock()
+			conn.SetReadDeadline(time.Time{})
+			flushHeld()
+			continue
+		}
+		if err != nil {
+			return
+		}
+		conn.SetReadDeadline(time.Time{})
+		line = strings.TrimRight(line, "\r\n")
+		s.mu.Lock()
+		s.commands = append(s.commands, line)
+		override := ""
+		for prefix, resp := range s.replies {
+			if strings.HasPrefix(strings.ToUpper(line), prefix) {
+				override = resp
+				break
+			}
+		}
+		hold := s.holdReplies
+		s.mu.Unlock()
+		verb := strings.ToUpper(strings.SplitN(line, " ", 2)[0])
+		if hold && (verb == "MAIL" || verb == "RCPT") {
+			if override == "" {
+				override = "250 ok"
+			}
+			held = append(held, override)
+			continue
+		}
+		flushHeld()
+		if override != "" && verb != "DATA" {
+			write(override)
+			continue
+		}
+		switch verb {
+		case "EHLO":
+			if len(s.extensions) == 0 {
+				write("250 stub")
+				continue
+			}
+			write("250-stub")
+			for i, ext := range s.extensions {
+				if i == len(s.extensions)-1 {
+					write("250 " + ext)
+				} else {
+					write("250-" + ext)
+				}
+			}
+		case "DATA":
+			write("354 go ahead")
+			var body strings.Builder
+			for {
+				dataLine, err := r.ReadString('\n')
+				if err != nil {
+					return
+				}
+				if dataLine == ".\r\n" {
+					break
+				}
+				body.WriteString(dataLine)
+			}
+			s.mu.Lock()
+			s.messages = append(s.messages, body.String())
+			s.mu.Unlock()
+			if override != "" {
+				write(override)
+			} else {
+				write("250 queued")
+			}
+		case "QUIT":
+			write("221 bye")
+			return
+		default:
+			write("250 ok")
+		}
+	}
+}
@@ -12,14 +12,21 @@ import (
 // JobStore defines persistence operations required by the scheduler.
 type JobStore interface {
 	Add(job *ScheduledEmail) error
+	// AddMany persists several jobs in one write.
+	AddMany(jobs []*ScheduledEmail) error
 	Update(job *ScheduledEmail) error
 	Delete(id string) error
 	ListDue(before time.Time) ([]*ScheduledEmail, error)
 	ListAll() ([]*ScheduledEmail, error)
+	// Lease sets the job's LeasedUntil to until unless another run holds a
+	// lease that is still live at now. It reports whether the lease was
+	// taken; the check and the write happen atomically.
+	Lease(id string, now, until time.Time) (bool, error)
 }
 
 // FileJobStore is a simple JSON-file-backed store for scheduled jobs.
-// It uses coarse-grained locking so it's safe for single-process use.
+// It uses coarse-grained locking: every read-modify-write holds the lock
+// for its whole duration, so it's safe for single-process use.
 type FileJobStore struct {
 	path string
 	mu   sync.Mutex
@@ -29,9 +36,8 @@ func NewFileJobStore(path string) *FileJobStore {
 	return &FileJobStore{path: path}
 }
 
+// loadAll and persistAll must be called with s.mu held.
 func (s *FileJobStore) loadAll() ([]*ScheduledEmail, error) {
-	s.mu.Lock()
-	defer s.mu.Unlock()
 	if _, err := os.Stat(s.path); os.IsNotExist(err) {
 		return []*ScheduledEmail{}, nil
 	}
@@ -47,8 +53,6 @@ func (s *FileJobStore) loadAll() ([]*ScheduledEmail, error) {
 }
 
 func (s *FileJobStore) persistAll(jobs []*ScheduledEmail) error {
-	s.mu.Lock()
-	defer s.mu.Unlock()
 	b, err := json.MarshalIndent(jobs, "", "  ")
 	if err != nil {
 		return err
@@ -57,16 +61,24 @@ func (s *FileJobStore) persistAll(jobs []*ScheduledEmail) error {
 }
 
 func (s *FileJobStore) Add(job *ScheduledEmail) error {
+	return s.AddMany([]*ScheduledEmail{job})
+}
+
+func (s *FileJobStore) AddMany(newJobs []*ScheduledEmail) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
 	jobs, err := s.loadAll()
 	if err != nil {
 		return err
 	}
-	jobs = append(jobs, job)
-	sort.Slice(jobs, func(i, j int) bool { return jobs[i].RunAt.Before(jobs[j].RunAt) })
+	jobs = append(jobs, newJobs...)
+	sortJobs(jobs)
 	return s.persistAll(jobs)
 }
 
 func (s *FileJobStore) Update(job *ScheduledEmail) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
 	jobs, err := s.loadAll()
 	if err != nil {
 		return err
@@ -81,6 +93,8 @@ func (s *FileJobStore) Update(job *ScheduledEmail) error {
 }
 
 func (s *FileJobStore) Delete(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
 	jobs, err := s.loadAll()
 	if err != nil {
 		return err
@@ -95,6 +109,8 @@ func (s *FileJobStore) Delete(id string) error {
 }
 
 func (s *FileJobStore) ListDue(before time.Time) ([]*ScheduledEmail, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
 	jobs, err := s.loadAll()
 	if err != nil {
 		return nil, err
@@ -106,10 +122,46 @@ func (s *FileJobStore) ListDue(before time.Time) ([]*ScheduledEmail, error) {
 			due = append(due, j)
 		}
 	}
-	sort.Slice(due, func(i, j int) bool { return due[i].RunAt.Before(due[j].RunAt) })
+	sortJobs(due)
 	return due, nil
 }
 
+// sortJobs orders jobs by RunAt, then higher Priority first, then ID.
+func sortJobs(jobs []*ScheduledEmail) {
+	sort.Slice(jobs, func(i, j int) bool {
+		a, b := jobs[i], jobs[j]
+		if !a.RunAt.Equal(b.RunAt) {
+			return a.RunAt.Before(b.RunAt)
+		}
+		if a.Priority != b.Priority {
+			return a.Priority > b.Priority
+		}
+		return a.ID < b.ID
+	})
+}
+
 func (s *FileJobStore) ListAll() ([]*ScheduledEmail, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
 	return s.loadAll()
 }
+
+func (s *FileJobStore) Lease(id string, now, until time.Time) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	jobs, err := s.loadAll()
+	if err != nil {
+		return false, err
+	}
+	for _, j := range jobs {
+		if j.ID != id {
+			continue
+		}
+		if j.LeasedUntil.After(now) {
+			return false, nil
+		}
+		j.LeasedUntil = until.UTC()
+		return true, s.persistAll(jobs)
+	}
+	return false, os.ErrNotExist
+}
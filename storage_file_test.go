@@ -0,0 +1,79 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestFileJobStore_ListDueOrdersByPriority(t *testing.T) {
+	store := NewFileJobStore(filepath.Join(t.TempDir(), "jobs.json"))
+	runAt := time.Now().UTC().Add(-time.Minute).Truncate(time.Second)
+	jobs := []*ScheduledEmail{
+		{ID: "job-b", Config: &EmailConfig{}, RunAt: runAt},
+		{ID: "job-urgent", Config: &EmailConfig{}, RunAt: runAt, Priority: 10},
+		{ID: "job-a", Config: &EmailConfig{}, RunAt: runAt},
+		{ID: "job-early", Config: &EmailConfig{}, RunAt: runAt.Add(-time.Minute)},
+	}
+	for _, j := range jobs {
+		if err := store.Add(j); err != nil {
+			t.Fatalf("add %s: %v", j.ID, err)
+		}
+	}
+	due, err := store.ListDue(time.Now())
+	if err != nil {
+		t.Fatalf("ListDue: %v", err)
+	}
+	want := []string{"job-early", "job-urgent", "job-a", "job-b"}
+	if len(due) != len(want) {
+		t.Fatalf("expected %d due jobs, got %d", len(want), len(due))
+	}
+	for i, id := range want {
+		if due[i].ID != id {
+			t.Fatalf("position %d: expected %s, got %s", i, id, due[i].ID)
+		}
+	}
+	if due[1].Priority != 10 {
+		t.Fatalf("expected priority to survive persistence, got %d", due[1].Priority)
+	}
+}
+
+func TestScheduler_ScheduleSpreadsRunAtWithJitter(t *testing.T) {
+	store := NewFileJobStore(filepath.Join(t.TempDir(), "jobs.json"))
+	s := NewScheduler(store, time.Minute)
+	runAt := time.Now().UTC().Add(time.Hour).Truncate(time.Second)
+	jitter := 10 * time.Minute
+	cfg := &EmailConfig{ScheduleJitter: jitter}
+	distinct := map[time.Time]bool{}
+	var minAt, maxAt time.Time
+	for i := 0; i < 50; i++ {
+		job, err := s.Schedule(cfg, runAt, nil)
+		if err != nil {
+			t.Fatalf("schedule: %v", err)
+		}
+		if job.RunAt.Before(runAt) || job.RunAt.After(runAt.Add(jitter)) {
+			t.Fatalf("run time %v outside [%v, %v]", job.RunAt, runAt, runAt.Add(jitter))
+		}
+		if minAt.IsZero() || job.RunAt.Before(minAt) {
+			minAt = job.RunAt
+		}
+		if job.RunAt.After(maxAt) {
+			maxAt = job.RunAt
+		}
+		distinct[job.RunAt] = true
+	}
+	if len(distinct) < 40 {
+		t.Fatalf("expected jittered run times to differ, got %d distinct of 50", len(distinct))
+	}
+	if maxAt.Sub(minAt) < jitter/2 {
+		t.Fatalf("expected run times to spread across the window, got span %v", maxAt.Sub(minAt))
+	}
+
+	plain, err := s.Schedule(&EmailConfig{}, runAt, nil)
+	if err != nil {
+		t.Fatalf("schedule: %v", err)
+	}
+	if !plain.RunAt.Equal(runAt) {
+		t.Fatalf("expected unjittered run time %v, got %v", runAt, plain.RunAt)
+	}
+}
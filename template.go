@@ -0,0 +1,119 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Template selects a template stored at the provider. ID and Alias identify
+// it (each builder uses the form its provider supports) and Data holds the
+// template variables. SMTP sends have no stored templates; Data is available
+// to placeholders so the subject and bodies render locally instead.
+type Template struct {
+	ID    string         `json:"id,omitempty"`
+	Alias string         `json:"alias,omitempty"`
+	Data  map[string]any `json:"data,omitempty"`
+}
+
+// Name returns the template's identifier, preferring ID over Alias.
+func (t *Template) Name() string {
+	if t.ID != "" {
+		return t.ID
+	}
+	return t.Alias
+}
+
+// numericID returns ID as a number for providers that key templates by
+// integer, and false when ID is not numeric.
+func (t *Template) numericID() (int, bool) {
+	n, err := strconv.Atoi(strings.TrimSpace(t.ID))
+	return n, err == nil
+}
+
+// dataJSON encodes Data for providers that take template variables as a
+// JSON string.
+func (t *Template) dataJSON() (string, error) {
+	if len(t.Data) == 0 {
+		return "{}", nil
+	}
+	b, err := json.Marshal(t.Data)
+	if err != nil {
+		return "", fmt.Errorf("template data: %w", err)
+	}
+	return string(b), nil
+}
+
+// parseTemplateValue reads the template config: a string ID, or an object
+// with id/template_id, alias/name and data/model/params.
+func parseTemplateValue(val any) *Template {
+	switch v := val.(type) {
+	case nil:
+		return nil
+	case string, float64, int:
+		if id := templateIdentifier(v); id != "" {
+			return &Template{ID: id}
+		}
+		return nil
+	case map[string]any:
+		t := &Template{}
+		for _, key := range []string{"id", "template_id"} {
+			if t.ID = templateIdentifier(v[key]); t.ID != "" {
+				break
+			}
+		}
+		for _, key := range []string{"alias", "name", "template_alias"} {
+			if t.Alias = templateIdentifier(v[key]); t.Alias != "" {
+				break
+			}
+		}
+		for _, key := range []string{"data", "model", "params", "variables"} {
+			if data, ok := v[key].(map[string]any); ok {
+				t.Data = data
+				break
+			}
+		}
+		if t.Name() == "" && t.Data == nil {
+			return nil
+		}
+		return t
+	}
+	return nil
+}
+
+// providerTemplate returns the stored template to send with, from the
+// template setting or the legacy template_id/template_alias data keys.
+func providerTemplate(cfg *EmailConfig) *Template {
+	if cfg.Template != nil && cfg.Template.Name() != "" {
+		return cfg.Template
+	}
+	t := &Template{
+		ID:    templateIdentifier(cfg.AdditionalData["template_id"]),
+		Alias: templateIdentifier(cfg.AdditionalData["template_alias"]),
+	}
+	if t.Name() == "" {
+		return nil
+	}
+	for _, key := range []string{"template_model", "template_data", "params"} {
+		if data, ok := cfg.AdditionalData[key].(map[string]any); ok {
+			t.Data = data
+			break
+		}
+	}
+	return t
+}
+
+// templateIdentifier formats a template ID or alias; JSON numbers become
+// their integer form.
+func templateIdentifier(val any) string {
+	switch v := val.(type) {
+	case string:
+		return strings.TrimSpace(v)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case int:
+		return strconv.Itoa(v)
+	}
+	return ""
+}
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var (
+	blockOpenPattern       = regexp.MustCompile(`\{\{\s*#(each|if)\s+([a-zA-Z0-9_.-]+)\s*\}\}`)
+	eachOpenPattern        = regexp.MustCompile(`\{\{\s*#each\s+([a-zA-Z0-9_.-]+)\s*\}\}`)
+	eachClosePattern       = regexp.MustCompile(`\{\{\s*/each\s*\}\}`)
+	ifOpenPattern          = regexp.MustCompile(`\{\{\s*#if\s+([a-zA-Z0-9_.-]+)\s*\}\}`)
+	ifClosePattern         = regexp.MustCompile(`\{\{\s*/if\s*\}\}`)
+	elsePattern            = regexp.MustCompile(`\{\{\s*else\s*\}\}`)
+	itemPlaceholderPattern = regexp.MustCompile(`\{\{\s*(\.[a-zA-Z0-9_.-]*|@index|@number)\s*\}\}`)
+)
+
+// expandBlocks renders {{#each key}}...{{/each}} and
+// {{#if key}}...{{else}}...{{/if}} blocks.
+//
+// Inside an each block, {{.field}} reads from the current item, {{.}} is the
+// item itself and {{@index}}/{{@number}} are its zero- and one-based
+// positions. A key starting with "." reads from the enclosing item. An if
+// block keeps its first branch when the key is truthy (normalizeBool, or a
+// non-empty array/map); missing keys are false. Unterminated blocks are left
+// untouched.
+func (r *placeholderResolver) expandBlocks(input string, scope any, hasScope bool) string {
+	var b strings.Builder
+	for {
+		loc := blockOpenPattern.FindStringSubmatchIndex(input)
+		if loc == nil {
+			break
+		}
+		kind := input[loc[2]:loc[3]]
+		key := input[loc[4]:loc[5]]
+		openPattern, closePattern := eachOpenPattern, eachClosePattern
+		if kind == "if" {
+			openPattern, closePattern = ifOpenPattern, ifClosePattern
+		}
+		bodyEnd, closeEnd, ok := findBlockClose(input, loc[1], openPattern, closePattern)
+		if !ok {
+			break
+		}
+		b.WriteString(input[:loc[0]])
+		body := input[loc[1]:bodyEnd]
+		value, found := r.blockValue(key, scope, hasScope)
+		if kind == "if" {
+			thenPart, elsePart := splitElse(body)
+			if templateTruthy(value) {
+				b.WriteString(r.expandBlocks(thenPart, scope, hasScope))
+			} else {
+				b.WriteString(r.expandBlocks(elsePart, scope, hasScope))
+			}
+		} else {
+			items, isList := blockItems(value)
+			if (!found || !isList) && !strings.HasPrefix(key, ".") {
+				r.markMissing(key)
+			}
+			for i, item := range items {
+				rendered := r.expandBlocks(body, item, true)
+				b.WriteString(renderItemPlaceholders(rendered, item, i))
+			}
+		}
+		input = input[closeEnd:]
+	}
+	b.WriteString(input)
+	return b.String()
+}
+
+// findBlockClose returns the bounds of the close tag matching a block whose
+// body starts at pos, skipping nested blocks of the same kind.
+func findBlockClose(input string, pos int, openPattern, closePattern *regexp.Regexp) (int, int, bool) {
+	depth := 1
+	for pos < len(input) {
+		rest := input[pos:]
+		closeLoc := closePattern.FindStringIndex(rest)
+		if closeLoc == nil {
+			return 0, 0, false
+		}
+		if openLoc := openPattern.FindStringIndex(rest); openLoc != nil && openLoc[0] < closeLoc[0] {
+			depth++
+			pos += openLoc[1]
+			continue
+		}
+		depth--
+		if depth == 0 {
+			return pos + closeLoc[0], pos + closeLoc[1], true
+		}
+		pos += closeLoc[1]
+	}
+	return 0, 0, false
+}
+
+// splitElse splits an if body at its own {{else}}, ignoring those of nested ifs.
+func splitElse(body string) (string, string) {
+	depth := 0
+	pos := 0
+	for pos < len(body) {
+		rest := body[pos:]
+		next, nextEnd, tag := -1, -1, -1
+		for i, pattern := range []*regexp.Regexp{ifOpenPattern, ifClosePattern, elsePattern} {
+			if loc := pattern.FindStringIndex(rest); loc != nil && (next == -1 || loc[0] < next) {
+				next, nextEnd, tag = loc[0], loc[1], i
+			}
+		}
+		switch tag {
+		case -1:
+			return body, ""
+		case 0:
+			depth++
+		case 1:
+			depth--
+		case 2:
+			if depth == 0 {
+				return body[:pos+next], body[pos+nextEnd:]
+			}
+		}
+		pos += nextEnd
+	}
+	return body, ""
+}
+
+func (r *placeholderResolver) blockValue(key string, scope any, hasScope bool) (any, bool) {
+	if strings.HasPrefix(key, ".") && hasScope {
+		return lookupDataPath(scope, key[1:])
+	}
+	path := key
+	if lower := strings.ToLower(path); strings.HasPrefix(lower, "data.") {
+		path = path[len("data."):]
+	}
+	return lookupDataPath(r.data, path)
+}
+
+func blockItems(value any) ([]any, bool) {
+	rv := reflect.ValueOf(value)
+	if !rv.IsValid() || (rv.Kind() != reflect.Slice && rv.Kind() != reflect.Array) {
+		return nil, false
+	}
+	items := make([]any, rv.Len())
+	for i := range items {
+		items[i] = rv.Index(i).Interface()
+	}
+	return items, true
+}
+
+func templateTruthy(value any) bool {
+	rv := reflect.ValueOf(value)
+	if rv.IsValid() && (rv.Kind() == reflect.Slice || rv.Kind() == reflect.Array || rv.Kind() == reflect.Map) {
+		return rv.Len() > 0
+	}
+	return normalizeBool(value)
+}
+
+// lookupDataPath walks dotted keys through nested maps, matching keys the same
+// way flattened placeholders do. An empty path returns value itself.
+func lookupDataPath(value any, path string) (any, bool) {
+	if path == "" {
+		return value, value != nil
+	}
+	for _, part := range strings.Split(path, ".") {
+		want := normalizePlaceholderKey(part)
+		m, ok := value.(map[string]any)
+		if !ok || want == "" {
+			return nil, false
+		}
+		found := false
+		for k, v := range m {
+			if normalizePlaceholderKey(k) == want {
+				value, found = v, true
+				break
+			}
+		}
+		if !found {
+			return nil, false
+		}
+	}
+	return value, true
+}
+
+func renderItemPlaceholders(input string, item any, index int) string {
+	return itemPlaceholderPattern.ReplaceAllStringFunc(input, func(match string) string {
+		key := itemPlaceholderPattern.FindStringSubmatch(match)[1]
+		switch key {
+		case "@index":
+			return strconv.Itoa(index)
+		case "@number":
+			return strconv.Itoa(index + 1)
+		}
+		value, ok := lookupDataPath(item, key[1:])
+		if !ok {
+			return ""
+		}
+		return strings.TrimSpace(fmt.Sprint(value))
+	})
+}
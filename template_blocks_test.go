@@ -0,0 +1,88 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestApplyPlaceholders_EachRendersLineItems(t *testing.T) {
+	var data map[string]any
+	if err := json.Unmarshal([]byte(`{
+		"customer": "Ada",
+		"order": {"items": [
+			{"name": "Widget", "qty": 2, "price": "9.50"},
+			{"name": "Gadget", "qty": 1, "price": "24.00", "tags": ["new", "sale"]}
+		]}
+	}`), &data); err != nil {
+		t.Fatal(err)
+	}
+	cfg := &EmailConfig{
+		HTMLBody:       "<p>Hi {{customer}}</p><table>{{#each order.items}}<tr><td>{{@number}}</td><td>{{.name}}</td><td>{{ .qty }}</td><td>{{.price}}</td><td>{{#each .tags}}[{{.}}]{{/each}}</td></tr>{{/each}}</table>",
+		TextBody:       "{{#each data.order.items}}- {{.name}} x{{.qty}} ({{customer}})\n{{/each}}",
+		AdditionalData: data,
+	}
+	if err := applyPlaceholders(cfg, placeholderModePostFinalize); err != nil {
+		t.Fatalf("applyPlaceholders: %v", err)
+	}
+	wantHTML := "<p>Hi Ada</p><table>" +
+		"<tr><td>1</td><td>Widget</td><td>2</td><td>9.50</td><td></td></tr>" +
+		"<tr><td>2</td><td>Gadget</td><td>1</td><td>24.00</td><td>[new][sale]</td></tr>" +
+		"</table>"
+	if cfg.HTMLBody != wantHTML {
+		t.Fatalf("unexpected html\nwant %s\ngot  %s", wantHTML, cfg.HTMLBody)
+	}
+	wantText := "- Widget x2 (Ada)\n- Gadget x1 (Ada)\n"
+	if cfg.TextBody != wantText {
+		t.Fatalf("unexpected text\nwant %q\ngot  %q", wantText, cfg.TextBody)
+	}
+}
+
+func TestApplyPlaceholders_EachMissingAndEmptyArrays(t *testing.T) {
+	cfg := &EmailConfig{
+		TextBody:       "start{{#each items}}x{{/each}}end",
+		AdditionalData: map[string]any{"items": []any{}},
+	}
+	if err := applyPlaceholders(cfg, placeholderModePostFinalize); err != nil {
+		t.Fatalf("applyPlaceholders: %v", err)
+	}
+	if cfg.TextBody != "startend" {
+		t.Fatalf("expected empty array to render nothing, got %q", cfg.TextBody)
+	}
+
+	cfg = &EmailConfig{TextBody: "{{#each lines}}{{.}}{{/each}}"}
+	err := applyPlaceholders(cfg, placeholderModePostFinalize)
+	if err == nil || !strings.Contains(err.Error(), "lines") {
+		t.Fatalf("expected unknown placeholder error for lines, got %v", err)
+	}
+}
+
+func TestApplyPlaceholders_IfBlocks(t *testing.T) {
+	cases := []struct {
+		name string
+		body string
+		data map[string]any
+		want string
+	}{
+		{"if true", "Hi{{#if premium}}, premium member{{/if}}!", map[string]any{"premium": true}, "Hi, premium member!"},
+		{"if false", "Hi{{#if premium}}, premium member{{/if}}!", map[string]any{"premium": "no"}, "Hi!"},
+		{"if missing", "Hi{{#if premium}}, premium member{{/if}}!", map[string]any{}, "Hi!"},
+		{"else", "{{#if premium}}Thanks {{name}}{{else}}Upgrade, {{name}}{{/if}}", map[string]any{"premium": 0.0, "name": "Ada"}, "Upgrade, Ada"},
+		{"nested else", "{{#if a}}{{#if b}}ab{{else}}a{{/if}}{{else}}none{{/if}}", map[string]any{"a": "yes", "b": false}, "a"},
+		{"item field", "{{#each items}}{{.name}}{{#if .sale}} (sale){{/if}};{{/each}}", map[string]any{
+			"items": []any{map[string]any{"name": "Widget", "sale": true}, map[string]any{"name": "Gadget"}},
+		}, "Widget (sale);Gadget;"},
+		{"non-empty list", "{{#if items}}has items{{else}}empty{{/if}}", map[string]any{"items": []any{}}, "empty"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg := &EmailConfig{TextBody: tc.body, AdditionalData: tc.data}
+			if err := applyPlaceholders(cfg, placeholderModePostFinalize); err != nil {
+				t.Fatalf("applyPlaceholders: %v", err)
+			}
+			if cfg.TextBody != tc.want {
+				t.Fatalf("want %q, got %q", tc.want, cfg.TextBody)
+			}
+		})
+	}
+}
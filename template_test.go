@@ -0,0 +1,185 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func templatedConfig() *EmailConfig {
+	return &EmailConfig{
+		From:     "team@example.com",
+		To:       []string{"user@example.com"},
+		Subject:  "Welcome",
+		Endpoint: "https://api.mailgun.net/v3/mg.example.com/messages",
+		Template: &Template{ID: "42", Data: map[string]any{"first_name": "Ada"}},
+	}
+}
+
+func TestProviderBuilders_MapTemplate(t *testing.T) {
+	cases := []struct {
+		name     string
+		provider Provider
+		check    func(t *testing.T, payload any)
+	}{
+		{"sendgrid", NewSendGridProvider(), func(t *testing.T, payload any) {
+			p := payload.(map[string]interface{})
+			pers := p["personalizations"].([]interface{})[0].(map[string]interface{})
+			if p["template_id"] != "42" || pers["dynamic_template_data"].(map[string]any)["first_name"] != "Ada" || p["content"] != nil {
+				t.Fatalf("unexpected SendGrid payload %v", p)
+			}
+		}},
+		{"ses", NewAWSProvider(), func(t *testing.T, payload any) {
+			content := payload.(map[string]interface{})["Content"].(map[string]interface{})
+			tpl, ok := content["Template"].(map[string]string)
+			if !ok || tpl["TemplateName"] != "42" || tpl["TemplateData"] != `{"first_name":"Ada"}` || content["Raw"] != nil {
+				t.Fatalf("unexpected SES content %v", content)
+			}
+		}},
+		{"postmark", NewPostmarkProvider(), func(t *testing.T, payload any) {
+			p := payload.(map[string]interface{})
+			if p["TemplateId"] != 42 || p["TemplateModel"].(map[string]any)["first_name"] != "Ada" || p["Subject"] != nil {
+				t.Fatalf("unexpected Postmark payload %v", p)
+			}
+		}},
+		{"brevo", NewBrevoProvider(), func(t *testing.T, payload any) {
+			p := payload.(map[string]interface{})
+			if p["templateId"] != 42 || p["params"].(map[string]any)["first_name"] != "Ada" || p["htmlContent"] != nil {
+				t.Fatalf("unexpected Brevo payload %v", p)
+			}
+		}},
+		{"mailjet", NewMailjetProvider(), func(t *testing.T, payload any) {
+			msg := payload.(map[string]interface{})["Messages"].([]interface{})[0].(map[string]interface{})
+			if msg["TemplateID"] != 42 || msg["TemplateLanguage"] != true || msg["Variables"].(map[string]any)["first_name"] != "Ada" {
+				t.Fatalf("unexpected Mailjet message %v", msg)
+			}
+		}},
+		{"sparkpost", NewSparkPostProvider(), func(t *testing.T, payload any) {
+			p := payload.(map[string]interface{})
+			if p["content"].(map[string]interface{})["template_id"] != "42" || p["substitution_data"].(map[string]any)["first_name"] != "Ada" {
+				t.Fatalf("unexpected SparkPost payload %v", p)
+			}
+		}},
+		{"mailgun", NewMailgunProvider(), func(t *testing.T, payload any) {
+			form := payload.(url.Values)
+			if form.Get("template") != "42" || form.Get("h:X-Mailgun-Variables") != `{"first_name":"Ada"}` || form.Get("html") != "" {
+				t.Fatalf("unexpected Mailgun form %v", form)
+			}
+		}},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg := templatedConfig()
+			cfg.APIKey, cfg.AWSRegion, cfg.AWSAccessKey, cfg.AWSSecretKey = "key", "us-east-1", "AKIDEXAMPLE", "secret"
+			if err := tc.provider.ValidateConfig(cfg); err != nil {
+				t.Fatalf("ValidateConfig: %v", err)
+			}
+			payload, _, err := tc.provider.BuildPayload(cfg)
+			if err != nil {
+				t.Fatalf("BuildPayload: %v", err)
+			}
+			tc.check(t, payload)
+		})
+	}
+}
+
+func TestParseConfig_Template(t *testing.T) {
+	var raw map[string]any
+	if err := json.Unmarshal([]byte(`{
+		"from": "team@example.com",
+		"to": ["user@example.com"],
+		"subject": "Hi {{first_name}}",
+		"text_body": "Welcome, {{first_name}}!",
+		"host": "localhost",
+		"template": {"alias": "welcome", "data": {"first_name": "Ada"}}
+	}`), &raw); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := parseConfig(raw)
+	if err != nil {
+		t.Fatalf("parseConfig: %v", err)
+	}
+	if cfg.Template == nil || cfg.Template.Alias != "welcome" || cfg.Template.Data["first_name"] != "Ada" {
+		t.Fatalf("unexpected template %+v", cfg.Template)
+	}
+	if _, ok := cfg.AdditionalData["template"]; ok {
+		t.Fatalf("template should not remain in additional data")
+	}
+
+	// SMTP has no stored templates, so the data renders locally.
+	prepared, err := prepareSendConfig(cfg)
+	if err != nil {
+		t.Fatalf("prepareSendConfig: %v", err)
+	}
+	if prepared.Subject != "Hi Ada" || !strings.Contains(prepared.TextBody, "Welcome, Ada!") {
+		t.Fatalf("expected template data rendered locally, got %q / %q", prepared.Subject, prepared.TextBody)
+	}
+}
+
+func TestAWSProvider_BulkTemplatedPayload(t *testing.T) {
+	cfg := templatedConfig()
+	cfg.ConfigurationSet = "marketing"
+	payload, err := NewAWSProvider().BuildBulkPayload(cfg, []SESBulkEntry{
+		{To: []string{"a@example.com"}, Data: map[string]any{"first_name": "Ann"}},
+		{To: []string{"b@example.com"}},
+	})
+	if err != nil {
+		t.Fatalf("BuildBulkPayload: %v", err)
+	}
+	tpl := payload["DefaultContent"].(map[string]interface{})["Template"].(map[string]string)
+	if tpl["TemplateName"] != "42" || tpl["TemplateData"] != `{"first_name":"Ada"}` {
+		t.Fatalf("unexpected default template %v", tpl)
+	}
+	entries := payload["BulkEmailEntries"].([]map[string]interface{})
+	if len(entries) != 2 {
+		t.Fatalf("expected 2 bulk entries, got %d", len(entries))
+	}
+	if dest := entries[0]["Destination"].(map[string][]string); dest["ToAddresses"][0] != "a@example.com" {
+		t.Fatalf("unexpected destination %v", dest)
+	}
+	replacement := entries[0]["ReplacementEmailContent"].(map[string]interface{})["ReplacementTemplate"].(map[string]string)
+	if replacement["ReplacementTemplateData"] != `{"first_name":"Ann"}` {
+		t.Fatalf("unexpected replacement data %v", replacement)
+	}
+	if _, ok := entries[1]["ReplacementEmailContent"]; ok {
+		t.Fatalf("entries without data should use the default template data")
+	}
+	if payload["FromEmailAddress"] != "team@example.com" || payload["ConfigurationSetName"] != "marketing" {
+		t.Fatalf("unexpected sender fields %v", payload)
+	}
+
+	cfg.Template = nil
+	if _, err := NewAWSProvider().BuildBulkPayload(cfg, []SESBulkEntry{{To: []string{"a@example.com"}}}); err == nil {
+		t.Fatalf("expected bulk send without a template to fail")
+	}
+}
+
+func TestSendSESBulk_SignsBulkRequest(t *testing.T) {
+	var path, auth string
+	var body map[string]any
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path, auth = r.URL.Path, r.Header.Get("Authorization")
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+	cfg := templatedConfig()
+	cfg.Endpoint = srv.URL + "/v2/email/outbound-emails"
+	cfg.AWSRegion = "us-east-1"
+	cfg.AWSAccessKey, cfg.AWSSecretKey = "AKIDEXAMPLE", "secret"
+	if err := SendSESBulk(cfg, []SESBulkEntry{{To: []string{"a@example.com"}}}); err != nil {
+		t.Fatalf("SendSESBulk: %v", err)
+	}
+	if path != "/v2/email/outbound-bulk-emails" {
+		t.Fatalf("expected the bulk endpoint, got %s", path)
+	}
+	if !strings.HasPrefix(auth, "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/") {
+		t.Fatalf("expected a SigV4 signature, got %q", auth)
+	}
+	if _, ok := body["BulkEmailEntries"]; !ok {
+		t.Fatalf("expected a bulk payload, got %v", body)
+	}
+}
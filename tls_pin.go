@@ -0,0 +1,89 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// decodePin parses a SHA-256 pin given as hex (colons allowed) or base64,
+// optionally prefixed with "sha256/".
+func decodePin(pin string) ([]byte, error) {
+	value := strings.TrimSpace(pin)
+	value = strings.TrimPrefix(strings.TrimPrefix(value, "sha256/"), "sha256:")
+	if sum, err := hex.DecodeString(strings.ReplaceAll(value, ":", "")); err == nil && len(sum) == sha256.Size {
+		return sum, nil
+	}
+	if sum, err := base64.StdEncoding.DecodeString(value); err == nil && len(sum) == sha256.Size {
+		return sum, nil
+	}
+	return nil, fmt.Errorf("pinned_sha256: %q is not a hex or base64 SHA-256 digest", pin)
+}
+
+func validatePins(pins []string) error {
+	for _, pin := range pins {
+		if _, err := decodePin(pin); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkPinsNeedTLS rejects pinned_sha256 on a connection that never makes a
+// TLS handshake, where the pins would silently be ignored: SMTP without
+// use_tls or use_ssl, or a plain http:// endpoint.
+func checkPinsNeedTLS(cfg *EmailConfig) error {
+	if len(cfg.PinnedSHA256) == 0 {
+		return nil
+	}
+	if cfg.Transport == "http" {
+		if strings.HasPrefix(strings.ToLower(cfg.Endpoint), "http://") {
+			return fmt.Errorf("pinned_sha256 requires an https endpoint, got %s", cfg.Endpoint)
+		}
+		return nil
+	}
+	if !cfg.UseTLS && !cfg.UseSSL {
+		return errors.New("pinned_sha256 requires use_tls or use_ssl; a plaintext smtp connection has no certificate to check")
+	}
+	return nil
+}
+
+// verifyPins returns a tls.Config VerifyConnection callback that accepts the
+// connection only when some certificate in the server's chain has a pinned
+// SHA-256 digest, of either its public key (SPKI) or the whole certificate.
+func verifyPins(pins []string) func(tls.ConnectionState) error {
+	var sums [][]byte
+	for _, pin := range pins {
+		if sum, err := decodePin(pin); err == nil {
+			sums = append(sums, sum)
+		}
+	}
+	return func(cs tls.ConnectionState) error {
+		for _, cert := range cs.PeerCertificates {
+			spki := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+			whole := sha256.Sum256(cert.Raw)
+			for _, sum := range sums {
+				if bytes.Equal(sum, spki[:]) || bytes.Equal(sum, whole[:]) {
+					return nil
+				}
+			}
+		}
+		return errors.New("tls: server certificate does not match any pinned SHA-256")
+	}
+}
+
+// clientTLSConfig is the TLS configuration for connections to the server
+// named serverName (empty lets the HTTP transport fill it in), with
+// certificate pinning applied when cfg sets PinnedSHA256.
+func clientTLSConfig(cfg *EmailConfig, serverName string) *tls.Config {
+	tlsConfig := &tls.Config{ServerName: serverName, InsecureSkipVerify: cfg.SkipTLSVerify}
+	if len(cfg.PinnedSHA256) > 0 {
+		tlsConfig.VerifyConnection = verifyPins(cfg.PinnedSHA256)
+	}
+	return tlsConfig
+}
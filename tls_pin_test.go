@@ -0,0 +1,111 @@
+package main
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/hex"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPinnedSHA256(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+	spki := sha256.Sum256(srv.Certificate().RawSubjectPublicKeyInfo)
+	good := "sha256/" + base64.StdEncoding.EncodeToString(spki[:])
+	other := sha256.Sum256([]byte("some other key"))
+	bad := hex.EncodeToString(other[:])
+
+	// An SMTPS listener presenting the same certificate as srv.
+	ln, err := tls.Listen("tcp", "127.0.0.1:0", srv.TLS)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				if err := conn.(*tls.Conn).Handshake(); err != nil {
+					return
+				}
+				conn.Write([]byte("220 stub ESMTP\r\n"))
+				conn.SetReadDeadline(time.Now().Add(time.Second))
+				conn.Read(make([]byte, 512))
+			}()
+		}
+	}()
+	host, _, _ := net.SplitHostPort(ln.Addr().String())
+
+	for _, tc := range []struct {
+		pin  string
+		ok   bool
+		name string
+	}{{good, true, "matching"}, {bad, false, "mismatched"}} {
+		cfg := &EmailConfig{Host: host, SkipTLSVerify: true, Timeout: 2 * time.Second, PinnedSHA256: []string{tc.pin}}
+
+		client, err := dialTLSClient(cfg, ln.Addr().String())
+		if tc.ok && err != nil {
+			t.Fatalf("%s pin: smtp dial failed: %v", tc.name, err)
+		}
+		if !tc.ok && (err == nil || !strings.Contains(err.Error(), "pinned")) {
+			t.Fatalf("%s pin: expected the smtp dial to fail, got %v", tc.name, err)
+		}
+		if client != nil {
+			client.Close()
+		}
+
+		cfg.Endpoint = srv.URL
+		resp, err := getHTTPClient(cfg).Get(srv.URL)
+		if tc.ok && err != nil {
+			t.Fatalf("%s pin: https request failed: %v", tc.name, err)
+		}
+		if !tc.ok && (err == nil || !strings.Contains(err.Error(), "pinned")) {
+			t.Fatalf("%s pin: expected the https request to fail, got %v", tc.name, err)
+		}
+		if resp != nil {
+			resp.Body.Close()
+		}
+	}
+
+	if _, err := parseConfig(map[string]any{"host": "smtp.example.com", "from": "a@example.com", "to": "b@example.com", "tls_pins": "not-a-digest"}); err == nil {
+		t.Fatal("expected an invalid pin to be rejected")
+	}
+}
+
+func TestParseConfig_PinsRequireTLS(t *testing.T) {
+	pin := strings.Repeat("ab", sha256.Size)
+	base := func(extra map[string]any) map[string]any {
+		raw := map[string]any{"from": "a@example.com", "to": "b@example.com", "pinned_sha256": pin}
+		for k, v := range extra {
+			raw[k] = v
+		}
+		return raw
+	}
+	for name, extra := range map[string]map[string]any{
+		"plaintext smtp": {"host": "smtp.example.com", "port": 25},
+		"http endpoint":  {"transport": "http", "endpoint": "http://api.example.com/send"},
+	} {
+		if _, err := parseConfig(base(extra)); err == nil || !strings.Contains(err.Error(), "pinned_sha256 requires") {
+			t.Fatalf("%s: expected pins without TLS to be rejected, got %v", name, err)
+		}
+	}
+	for name, extra := range map[string]map[string]any{
+		"starttls":       {"host": "smtp.example.com", "use_tls": true},
+		"implicit tls":   {"host": "smtp.example.com", "use_ssl": true},
+		"https endpoint": {"transport": "http", "endpoint": "https://api.example.com/send"},
+	} {
+		if _, err := parseConfig(base(extra)); err != nil {
+			t.Fatalf("%s: expected pins to be accepted, got %v", name, err)
+		}
+	}
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/smtp"
+	"net/textproto"
+	"net/url"
+	"strings"
+)
+
+var (
+	// ErrAuthFailed reports that the server or provider rejected the credentials.
+	ErrAuthFailed = errors.New("authentication failed")
+	// ErrUnreachable reports that the server or provider could not be reached.
+	ErrUnreachable = errors.New("provider unreachable")
+)
+
+// credentialCheckPaths maps providers to a cheap authenticated GET endpoint,
+// resolved against the host of the configured send endpoint.
+var credentialCheckPaths = map[string]string{
+	"sendgrid":  "/v3/scopes",
+	"brevo":     "/v3/account",
+	"mailgun":   "/v3/domains",
+	"postmark":  "/server",
+	"sparkpost": "/api/v1/account",
+	"resend":    "/domains",
+	"aws_ses":   "/v2/email/account",
+}
+
+// VerifyCredentials checks that cfg's credentials are accepted without sending
+// a message. SMTP configs connect, negotiate TLS and authenticate; HTTP configs
+// call a read-only endpoint of the provider. Failures are an *AuthError or a
+// *ConnectionError (matching ErrAuthFailed / ErrUnreachable) so callers can
+// tell bad credentials from connectivity issues.
+func VerifyCredentials(cfg *EmailConfig) error {
+	if cfg.Transport == "smtp" {
+		return verifySMTPCredentials(cfg)
+	}
+	return verifyHTTPCredentials(cfg)
+}
+
+func verifySMTPCredentials(cfg *EmailConfig) error {
+	client, err := openSMTPClient(cfg)
+	if err != nil {
+		return &ConnectionError{Err: err}
+	}
+	defer client.Close()
+	// NOOP forces the EHLO exchange even when no AUTH is configured.
+	if err := client.Noop(); err != nil {
+		return &ConnectionError{Err: err}
+	}
+	if err := authenticateSMTP(client, cfg); err != nil {
+		var protoErr *textproto.Error
+		if errors.As(err, &protoErr) {
+			return &AuthError{Err: err}
+		}
+		return &ConnectionError{Err: err}
+	}
+	return client.Quit()
+}
+
+func verifyHTTPCredentials(cfg *EmailConfig) error {
+	checkURL, err := credentialCheckURL(cfg)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodGet, checkURL, nil)
+	if err != nil {
+		return err
+	}
+	for k, v := range cfg.Headers {
+		if strings.EqualFold(k, "Content-Type") {
+			continue
+		}
+		req.Header.Set(k, v)
+	}
+	req.Header.Set("Accept", "application/json")
+	applyAuthHeaders(req, cfg, nil)
+
+	resp, err := getHTTPClient(cfg).Do(req)
+	if err != nil {
+		return &ConnectionError{Err: err}
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 500 {
+		return &ConnectionError{Err: fmt.Errorf("credential check failed: %s", resp.Status)}
+	}
+	if resp.StatusCode >= 300 {
+		return classifyHTTPStatus(resp, fmt.Errorf("credential check failed: %s", resp.Status))
+	}
+	return nil
+}
+
+func credentialCheckURL(cfg *EmailConfig) (string, error) {
+	path, ok := credentialCheckPaths[canonicalProviderName(cfg.Provider)]
+	if !ok {
+		return "", fmt.Errorf("no credential check available for provider %q", cfg.Provider)
+	}
+	parsed, err := url.Parse(cfg.Endpoint)
+	if err != nil || parsed.Host == "" {
+		return "", fmt.Errorf("invalid endpoint %q", cfg.Endpoint)
+	}
+	return (&url.URL{Scheme: parsed.Scheme, Host: parsed.Host, Path: path}).String(), nil
+}
+
+// openSMTPClient dials the configured server and upgrades the connection with
+// STARTTLS when requested.
+func openSMTPClient(cfg *EmailConfig) (*smtp.Client, error) {
+	addr := fmt.Sprintf("%s:%d", cfg.Host, cfg.Port)
+	var client *smtp.Client
+	var err error
+	if cfg.UseSSL {
+		client, err = dialTLSClient(cfg, addr)
+	} else {
+		client, err = dialPlainClient(cfg, addr)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if cfg.UseTLS && !cfg.UseSSL {
+		tlsConfig := clientTLSConfig(cfg, cfg.Host)
+		if err := client.StartTLS(tlsConfig); err != nil {
+			client.Close()
+			return nil, err
+		}
+	}
+	return client, nil
+}
+
+// authenticateSMTP runs SMTP AUTH when credentials are configured.
+func authenticateSMTP(client *smtp.Client, cfg *EmailConfig) error {
+	if cfg.Username == "" || cfg.Password == "" {
+		return nil
+	}
+	auth, err := buildSMTPAuth(cfg)
+	if err != nil || auth == nil {
+		return err
+	}
+	return client.Auth(auth)
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestVerifyCredentials_SMTP(t *testing.T) {
+	srv := newStubSMTPServer(t, "AUTH PLAIN")
+	srv.reply("AUTH", "235 authenticated")
+	cfg := srv.config()
+	cfg.Username, cfg.Password = "user", "secret"
+	if err := VerifyCredentials(cfg); err != nil {
+		t.Fatalf("expected credentials to verify, got %v", err)
+	}
+	for _, c := range srv.Commands() {
+		if strings.HasPrefix(c, "MAIL FROM:") || c == "DATA" {
+			t.Fatalf("verification must not start a mail transaction, got %q", c)
+		}
+	}
+
+	failing := newStubSMTPServer(t, "AUTH PLAIN")
+	failing.reply("AUTH", "535 authentication credentials invalid")
+	cfg = failing.config()
+	cfg.Username, cfg.Password = "user", "wrong"
+	if err := VerifyCredentials(cfg); !errors.Is(err, ErrAuthFailed) {
+		t.Fatalf("expected ErrAuthFailed, got %v", err)
+	}
+}
+
+func TestVerifyCredentials_SMTPUnreachable(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	addr := ln.Addr().(*net.TCPAddr)
+	ln.Close()
+	cfg := &EmailConfig{Transport: "smtp", Host: "127.0.0.1", Port: addr.Port, Timeout: time.Second}
+	if err := VerifyCredentials(cfg); !errors.Is(err, ErrUnreachable) {
+		t.Fatalf("expected ErrUnreachable, got %v", err)
+	}
+}
+
+func TestVerifyCredentials_HTTP(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet || r.URL.Path != "/v3/scopes" {
+			t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+		}
+		if r.Header.Get("Authorization") != "Bearer good-key" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+
+	cfg := &EmailConfig{
+		Provider:       "sendgrid",
+		Transport:      "http",
+		Endpoint:       srv.URL + "/v3/mail/send",
+		HTTPAuth:       "bearer",
+		HTTPAuthPrefix: "Bearer",
+		APIKey:         "good-key",
+		Timeout:        2 * time.Second,
+	}
+	if err := VerifyCredentials(cfg); err != nil {
+		t.Fatalf("expected key to verify, got %v", err)
+	}
+	cfg.APIKey = "bad-key"
+	if err := VerifyCredentials(cfg); !errors.Is(err, ErrAuthFailed) {
+		t.Fatalf("expected ErrAuthFailed, got %v", err)
+	}
+}
+
+func TestVerifyCredentials_SES(t *testing.T) {
+	var path, auth string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path, auth = r.URL.Path, r.Header.Get("Authorization")
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+
+	for _, provider := range []string{"aws_ses", "ses"} {
+		cfg := &EmailConfig{
+			Provider:     provider,
+			Transport:    "http",
+			Endpoint:     srv.URL + "/v2/email/outbound-emails",
+			HTTPAuth:     "aws_sigv4",
+			AWSRegion:    "us-east-1",
+			AWSAccessKey: "AKIDEXAMPLE",
+			AWSSecretKey: "secret",
+			Timeout:      2 * time.Second,
+		}
+		if err := VerifyCredentials(cfg); err != nil {
+			t.Fatalf("%s: expected the SES credential check to run, got %v", provider, err)
+		}
+		if path != "/v2/email/account" || !strings.HasPrefix(auth, "AWS4-HMAC-SHA256") {
+			t.Fatalf("%s: expected a signed GET of the account endpoint, got %q with %q", provider, path, auth)
+		}
+	}
+}
+
+func TestValidateAddress(t *testing.T) {
+	verdicts := map[string][2]string{
+		"good@example.com":  {"Valid", "deliverable"},
+		"bad@example.com":   {"Invalid", "undeliverable"},
+		"maybe@example.com": {"Risky", "catch_all"},
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v3/validations/email":
+			if r.Method != http.MethodPost || r.Header.Get("Authorization") != "Bearer sg-key" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			var req struct{ Email string }
+			_ = json.NewDecoder(r.Body).Decode(&req)
+			_ = json.NewEncoder(w).Encode(map[string]any{"result": map[string]any{"email": req.Email, "verdict": verdicts[req.Email][0], "score": 0.5}})
+		case "/v4/address/validate":
+			addr := r.URL.Query().Get("address")
+			_ = json.NewEncoder(w).Encode(map[string]any{"address": addr, "result": verdicts[addr][1], "risk": "high", "reason": []string{"mailbox_does_not_exist"}})
+		default:
+			t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+		}
+	}))
+	defer srv.Close()
+
+	sendgrid := &EmailConfig{Provider: "sendgrid", Endpoint: srv.URL + "/v3/mail/send", HTTPAuth: "bearer", HTTPAuthPrefix: "Bearer", APIKey: "sg-key", Timeout: 2 * time.Second}
+	mailgun := &EmailConfig{Provider: "mailgun", Endpoint: srv.URL + "/v3/example.com/messages", HTTPAuth: "none", Timeout: 2 * time.Second}
+	for _, cfg := range []*EmailConfig{sendgrid, mailgun} {
+		for addr, want := range map[string]string{"good@example.com": "valid", "bad@example.com": "invalid", "maybe@example.com": "risky"} {
+			res, err := ValidateAddress(cfg, addr)
+			if err != nil {
+				t.Fatalf("%s %s: %v", cfg.Provider, addr, err)
+			}
+			if res.Verdict != want || res.Deliverable != (want == "valid") || res.Address != addr {
+				t.Fatalf("%s %s: expected %s, got %+v", cfg.Provider, addr, want, res)
+			}
+		}
+	}
+	if res, _ := ValidateAddress(mailgun, "bad@example.com"); res.Risk != "high" || len(res.Reasons) != 1 {
+		t.Fatalf("expected mailgun risk and reasons, got %+v", res)
+	}
+
+	sendgrid.APIKey = "wrong"
+	if _, err := ValidateAddress(sendgrid, "good@example.com"); !errors.Is(err, ErrAuthFailed) {
+		t.Fatalf("expected ErrAuthFailed, got %v", err)
+	}
+	if _, err := ValidateAddress(&EmailConfig{Provider: "postmark", Endpoint: srv.URL}, "good@example.com"); err == nil {
+		t.Fatal("expected an error for a provider without address validation")
+	}
+}
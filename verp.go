@@ -0,0 +1,106 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/mail"
+	"net/smtp"
+	"regexp"
+	"strings"
+)
+
+// verpTokenPattern matches the recipient tokens of an EnvelopeFromTemplate.
+var verpTokenPattern = regexp.MustCompile(`\{\{\s*(recipient(?:_local|_domain|_hash)?)\s*\}\}`)
+
+// verpEnvelopeFrom renders tpl for recipient. {{recipient}} becomes
+// "local=domain", {{recipient_local}} and {{recipient_domain}} the address
+// parts, and {{recipient_hash}} a short hash of the address.
+func verpEnvelopeFrom(tpl, recipient string) (string, error) {
+	_, addr := splitAddress(recipient)
+	local, domain, ok := strings.Cut(addr, "@")
+	if !ok || local == "" || domain == "" {
+		return "", fmt.Errorf("envelope_from_template: invalid recipient %q", recipient)
+	}
+	rendered := verpTokenPattern.ReplaceAllStringFunc(tpl, func(token string) string {
+		switch verpTokenPattern.FindStringSubmatch(token)[1] {
+		case "recipient_local":
+			return local
+		case "recipient_domain":
+			return domain
+		case "recipient_hash":
+			sum := sha256.Sum256([]byte(strings.ToLower(addr)))
+			return hex.EncodeToString(sum[:6])
+		default:
+			return local + "=" + domain
+		}
+	})
+	if strings.Contains(rendered, "{{") {
+		return "", fmt.Errorf("envelope_from_template: unknown token in %q", tpl)
+	}
+	parsed, err := mail.ParseAddress(rendered)
+	if err != nil || parsed.Name != "" {
+		return "", fmt.Errorf("envelope_from_template: %q is not a valid address for %s", rendered, recipient)
+	}
+	return parsed.Address, nil
+}
+
+// validateEnvelopeFromTemplate checks the template renders for a sample
+// recipient. Per-recipient transactions cannot be rolled back together, so
+// the all_or_nothing recipient policy is rejected.
+func validateEnvelopeFromTemplate(cfg *EmailConfig) error {
+	if cfg.EnvelopeFromTemplate == "" {
+		return nil
+	}
+	if cfg.RecipientPolicy == recipientPolicyAllOrNothing {
+		return errors.New("envelope_from_template cannot be combined with recipient_policy all_or_nothing")
+	}
+	_, err := verpEnvelopeFrom(cfg.EnvelopeFromTemplate, "user@example.com")
+	return err
+}
+
+// sendSMTPPerRecipient sends one transaction per recipient so each gets its
+// own envelope sender from EnvelopeFromTemplate (VERP). Failures leave the
+// other recipients' transactions unaffected; temporary ones are returned as
+// remaining in a PartialDeliveryError.
+func sendSMTPPerRecipient(client *smtp.Client, cfg *EmailConfig, msg string, recipients []string, mailParams, rcptParams []string, result *SendResult) (bool, error) {
+	var committed, remaining []string
+	var errs error
+	for i, recipient := range recipients {
+		from, err := verpEnvelopeFrom(cfg.EnvelopeFromTemplate, recipient)
+		if err != nil {
+			rejectErr := &RecipientError{Address: recipient, Err: &PermanentError{Err: err}}
+			result.set(recipient, rejectErr)
+			errs = errors.Join(errs, rejectErr)
+			continue
+		}
+		clean, err := smtpTransaction(client, cfg, from, []string{recipient}, msg, mailParams, rcptParams, false, result)
+		if err == nil {
+			committed = append(committed, recipient)
+			continue
+		}
+		errs = errors.Join(errs, err)
+		var partial *PartialDeliveryError
+		if errors.As(err, &partial) {
+			committed = append(committed, partial.Committed...)
+		} else if !errors.Is(err, ErrPermanent) {
+			remaining = append(remaining, recipient)
+		}
+		if !clean && client.Reset() != nil {
+			// The connection is gone; the rest can be retried elsewhere.
+			for _, rest := range recipients[i+1:] {
+				result.set(rest, &ConnectionError{Err: err})
+			}
+			remaining = append(remaining, recipients[i+1:]...)
+			return false, &PartialDeliveryError{Committed: committed, Remaining: remaining, Err: errs}
+		}
+	}
+	if errs == nil {
+		return true, nil
+	}
+	if len(committed) == 0 && len(remaining) == 0 {
+		return true, errs
+	}
+	return true, &PartialDeliveryError{Committed: committed, Remaining: remaining, Err: errs}
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSendViaSMTP_VERPEnvelopeSenders(t *testing.T) {
+	srv := newStubSMTPServer(t, "PIPELINING")
+	cfg := srv.config()
+	cfg.To = []string{"alice@example.org", "bob@example.net"}
+	cfg.EnvelopeFromTemplate = "bounces+{{recipient}}@example.com"
+	if err := sendViaSMTP(cfg); err != nil {
+		t.Fatalf("sendViaSMTP returned error: %v", err)
+	}
+	var senders []string
+	for _, c := range srv.Commands() {
+		if strings.HasPrefix(c, "MAIL FROM:") {
+			senders = append(senders, c)
+		}
+	}
+	if len(senders) != 2 {
+		t.Fatalf("expected one transaction per recipient, got %q", senders)
+	}
+	if !strings.HasPrefix(senders[0], "MAIL FROM:<bounces+alice=example.org@example.com>") ||
+		!strings.HasPrefix(senders[1], "MAIL FROM:<bounces+bob=example.net@example.com>") {
+		t.Fatalf("unexpected envelope senders %q", senders)
+	}
+	if got := len(srv.Messages()); got != 2 {
+		t.Fatalf("expected 2 messages, got %d", got)
+	}
+}
+
+func TestVERPEnvelopeFrom(t *testing.T) {
+	got, err := verpEnvelopeFrom("b-{{recipient_hash}}@{{ recipient_domain }}", "Alice <alice@example.org>")
+	if err != nil || !strings.HasPrefix(got, "b-") || !strings.HasSuffix(got, "@example.org") {
+		t.Fatalf("unexpected rendering %q, %v", got, err)
+	}
+	if _, err := verpEnvelopeFrom("{{recipient_name}}@example.com", "alice@example.org"); err == nil {
+		t.Fatal("expected an unknown token error")
+	}
+	_, err = parseConfig(map[string]any{
+		"host": "localhost", "from": "a@example.com", "to": "b@example.com",
+		"verp": "bounces+{{recipient}}@example.com", "recipient_policy": "all_or_nothing",
+	})
+	if err == nil || !strings.Contains(err.Error(), "all_or_nothing") {
+		t.Fatal("expected all_or_nothing to be rejected with a template")
+	}
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// WarmupSchedule ramps a provider's sending volume while its IP or domain
+// builds reputation. DailyCaps[0] is the number of successful sends allowed
+// on the day Start falls on, DailyCaps[1] the next day, and so on; once the
+// list runs out the warmup is complete and the provider is no longer capped.
+type WarmupSchedule struct {
+	Start     time.Time `json:"start"`
+	DailyCaps []int     `json:"daily_caps"`
+}
+
+// warmupNow is the clock warmup allowances are computed against.
+var warmupNow = time.Now
+
+// CapOn returns the send allowance for the UTC day containing now and whether
+// the provider is still warming up. Days before Start use the first cap.
+func (w WarmupSchedule) CapOn(now time.Time) (int, bool) {
+	if len(w.DailyCaps) == 0 {
+		return 0, false
+	}
+	day := int(utcDay(now).Sub(utcDay(w.Start)) / (24 * time.Hour))
+	if day < 0 {
+		day = 0
+	}
+	if day >= len(w.DailyCaps) {
+		return 0, false
+	}
+	return w.DailyCaps[day], true
+}
+
+func utcDay(t time.Time) time.Time {
+	return t.UTC().Truncate(24 * time.Hour)
+}
+
+// warmupLimitReason describes why provider has used up today's warmup
+// allowance on route r, or returns "" when it may still send.
+func warmupLimitReason(r *ProviderRoute, provider string) string {
+	schedule, ok := r.Warmup[canonicalProviderName(provider)]
+	if !ok {
+		return ""
+	}
+	now := warmupNow()
+	limit, warming := schedule.CapOn(now)
+	if !warming {
+		return ""
+	}
+	sent, err := countSuccessesSince([]string{provider}, utcDay(now), nil)
+	if err != nil || sent < limit {
+		return ""
+	}
+	return fmt.Sprintf("%s warmup cap %d reached for today (%d sent)", provider, limit, sent)
+}
+
+// filterWarmup drops providers that reached today's warmup allowance on r.
+func filterWarmup(r *ProviderRoute, list []string) []string {
+	if len(r.Warmup) == 0 {
+		return list
+	}
+	var kept []string
+	for _, p := range list {
+		if reason := warmupLimitReason(r, p); reason != "" {
+			logger().Info("provider skipped: warmup cap", "provider", p, "reason", reason)
+			continue
+		}
+		kept = append(kept, p)
+	}
+	return kept
+}
+
+// parseWarmupSchedules reads a route's "warmup" object, keyed by provider,
+// whose entries give a start date ("2006-01-02" or RFC 3339) and daily caps.
+// A missing or unparseable start is an error: left at the zero time, the
+// schedule would count as long finished and leave the provider uncapped.
+func parseWarmupSchedules(val any) (map[string]WarmupSchedule, error) {
+	out := map[string]WarmupSchedule{}
+	for prov, raw := range normalizeObject(val) {
+		entry := normalizeObject(raw)
+		var schedule WarmupSchedule
+		start, _ := entry["start"].(string)
+		start = strings.TrimSpace(start)
+		if start == "" {
+			return nil, fmt.Errorf("warmup %s: start is required", prov)
+		}
+		if t, err := time.Parse("2006-01-02", start); err == nil {
+			schedule.Start = t
+		} else if t, err := time.Parse(time.RFC3339, start); err == nil {
+			schedule.Start = t
+		} else {
+			return nil, fmt.Errorf("warmup %s: invalid start %q (use 2006-01-02 or RFC 3339)", prov, start)
+		}
+		if caps, ok := entry["daily_caps"].([]any); ok {
+			for _, c := range caps {
+				schedule.DailyCaps = append(schedule.DailyCaps, toInt(c))
+			}
+		}
+		out[canonicalProviderName(prov)] = schedule
+	}
+	return out, nil
+}
@@ -2,7 +2,6 @@ package main
 
 import (
 	"fmt"
-	"log"
 	"strings"
 	"time"
 )
@@ -60,7 +59,7 @@ func ScheduleWelcomeWorkflow(s *Scheduler, base *EmailConfig) error {
 			return err
 		}
 		lastJobID = job.ID
-		log.Printf("workflow: scheduled %s at %s (job=%s)", sdef.meta["step"], job.RunAt, job.ID)
+		s.logger().Info("workflow: scheduled step", "step", sdef.meta["step"], "run_at", job.RunAt, "job_id", job.ID)
 	}
 	return nil
 }
@@ -79,11 +78,24 @@ func ScheduleWelcomeWorkflow(s *Scheduler, base *EmailConfig) error {
 //	  "retry_delay_seconds": 2,
 //	  "max_retry_delay_seconds": 10
 //	}
+//
+// When base.WorkflowID is set, steps get IDs derived from it and the workflow
+// id is stored in each job's Meta. Scheduling the same workflow again skips
+// steps that are still pending or have already run, so a rerun (e.g. on
+// redeploy) does not send twice.
 func ScheduleGenericWorkflow(s *Scheduler, base *EmailConfig, def any) error {
 	arr, ok := def.([]any)
 	if !ok {
 		return fmt.Errorf("workflow definition must be an array of steps")
 	}
+	workflowID := strings.TrimSpace(base.WorkflowID)
+	var existing map[string]bool
+	if workflowID != "" {
+		var err error
+		if existing, err = workflowJobIDs(s, workflowID); err != nil {
+			return err
+		}
+	}
 	now := time.Now()
 	var lastJobID string
 	for i, raw := range arr {
@@ -91,107 +103,203 @@ func ScheduleGenericWorkflow(s *Scheduler, base *EmailConfig, def any) error {
 		if !ok {
 			return fmt.Errorf("workflow step %d must be an object", i)
 		}
-		// compute runAt
-		runAt := now
-		if v, ok := stepMap["run_at"].(string); ok && v != "" {
-			if t, err := time.Parse(time.RFC3339, v); err == nil {
-				runAt = t
+		cfgCopy, runAt, meta := buildWorkflowStep(base, stepMap, i, now, lastJobID)
+		var job *ScheduledEmail
+		var err error
+		if workflowID == "" {
+			job, err = s.Schedule(cfgCopy, runAt, meta)
+		} else {
+			id := workflowJobID(workflowID, i)
+			if _, done := getJobResult(id); done || existing[id] {
+				lastJobID = id
+				s.logger().Info("workflow: step already scheduled, skipping", "workflow_id", workflowID, "step_index", i, "job_id", id)
+				continue
 			}
-		} else if v, ok := stepMap["delay_seconds"].(float64); ok {
-			runAt = now.Add(time.Duration(v) * time.Second)
+			meta["workflow_id"] = workflowID
+			job, err = s.scheduleJob(id, cfgCopy, runAt, meta)
+		}
+		if err != nil {
+			return err
 		}
+		lastJobID = job.ID
+		s.logger().Info("workflow: scheduled step", "meta", meta, "run_at", job.RunAt, "job_id", job.ID)
+	}
+	return nil
+}
 
-		// Create a copy of the base config for this step
-		cfgCopy := *base
-		cfgCopy.AdditionalData = cloneAdditionalData(base.AdditionalData)
+// workflowJobID is the deterministic job ID of a workflow step, so a rerun
+// finds steps it scheduled before, even ones that already ran.
+func workflowJobID(workflowID string, step int) string {
+	return fmt.Sprintf("wf-%s-%d", workflowID, step)
+}
 
-		// Apply step-specific overrides BEFORE template parsing
-		// This ensures that step-specific subjects, bodies, etc. are available during placeholder resolution
-		if subj, ok := stepMap["subject"].(string); ok && subj != "" {
-			cfgCopy.Subject = subj
-		}
-		if body, ok := stepMap["body"].(string); ok {
-			cfgCopy.Body = body
-			cfgCopy.TextBody = body
-		}
-		if html, ok := stepMap["html_body"].(string); ok {
-			cfgCopy.HTMLBody = html
-		}
-		if toArr, ok := stepMap["to"].([]any); ok && len(toArr) > 0 {
-			var tos []string
-			for _, e := range toArr {
-				if s, ok := e.(string); ok && s != "" {
-					tos = append(tos, s)
-				}
-			}
-			if len(tos) > 0 {
-				cfgCopy.To = tos
-			}
-		}
-		if pp, ok := stepMap["provider_priority"].([]any); ok && len(pp) > 0 {
-			var pri []string
-			for _, e := range pp {
-				if s, ok := e.(string); ok && s != "" {
-					pri = append(pri, s)
-				}
-			}
-			if len(pri) > 0 {
-				cfgCopy.ProviderPriority = pri
-			}
-		}
-		if rc, ok := stepMap["retry_count"].(float64); ok {
-			cfgCopy.RetryCount = int(rc)
-		}
-		if rd, ok := stepMap["retry_delay_seconds"].(float64); ok {
-			cfgCopy.RetryDelay = time.Duration(rd) * time.Second
-		}
-		if mrd, ok := stepMap["max_retry_delay_seconds"].(float64); ok {
-			cfgCopy.MaxRetryDelay = time.Duration(mrd) * time.Second
+// workflowJobIDs returns the IDs of pending jobs tagged with workflowID.
+func workflowJobIDs(s *Scheduler, workflowID string) (map[string]bool, error) {
+	jobs, err := s.store.ListAll()
+	if err != nil {
+		return nil, err
+	}
+	ids := map[string]bool{}
+	for _, job := range jobs {
+		if id, _ := job.Meta["workflow_id"].(string); id == workflowID {
+			ids[job.ID] = true
 		}
+	}
+	return ids, nil
+}
 
-		// Create metadata for this step
-		meta := map[string]any{"step_index": i}
-		if lastJobID != "" {
-			meta["prev_job_id"] = lastJobID
-		}
-		if name, ok := stepMap["name"].(string); ok && name != "" {
-			meta["name"] = name
-			meta["step"] = name
+// StepPreview is the rendered form of one workflow step.
+type StepPreview struct {
+	Index    int       `json:"index"`
+	Step     string    `json:"step"`
+	RunAt    time.Time `json:"run_at"`
+	To       []string  `json:"to"`
+	Subject  string    `json:"subject"`
+	TextBody string    `json:"text_body,omitempty"`
+	HTMLBody string    `json:"html_body,omitempty"`
+}
+
+// PreviewWorkflow renders every step of def the way ScheduleGenericWorkflow
+// would schedule it, using base.AdditionalData as sample data. Nothing is
+// scheduled or sent.
+func PreviewWorkflow(base *EmailConfig, def any) ([]StepPreview, error) {
+	arr, ok := def.([]any)
+	if !ok {
+		return nil, fmt.Errorf("workflow definition must be an array of steps")
+	}
+	now := time.Now()
+	previews := make([]StepPreview, 0, len(arr))
+	for i, raw := range arr {
+		stepMap, ok := raw.(map[string]any)
+		if !ok {
+			return nil, fmt.Errorf("workflow step %d must be an object", i)
 		}
-		if stepLabel, ok := stepMap["step"].(string); ok && stepLabel != "" {
-			meta["step"] = stepLabel
+		cfgCopy, runAt, meta := buildWorkflowStep(base, stepMap, i, now, "")
+		rendered, err := prepareSendConfig(cfgCopy)
+		if err != nil {
+			return nil, fmt.Errorf("workflow step %d: %w", i, err)
 		}
-		requireLast := false
-		if rawReq, ok := stepMap["require_last_success"]; ok {
-			requireLast = normalizeBool(rawReq)
-		} else if lastJobID != "" {
-			// Default to requiring last success for subsequent steps
-			requireLast = true
+		previews = append(previews, StepPreview{
+			Index:    i,
+			Step:     fmt.Sprint(meta["step"]),
+			RunAt:    runAt.UTC(),
+			To:       rendered.To,
+			Subject:  rendered.Subject,
+			TextBody: rendered.TextBody,
+			HTMLBody: rendered.HTMLBody,
+		})
+	}
+	return previews, nil
+}
+
+// buildWorkflowStep applies a step's overrides to a copy of base and returns
+// it with the step's run time and job metadata.
+func buildWorkflowStep(base *EmailConfig, stepMap map[string]any, i int, now time.Time, lastJobID string) (*EmailConfig, time.Time, map[string]any) {
+	// compute runAt
+	runAt := now
+	if v, ok := stepMap["run_at"].(string); ok && v != "" {
+		if t, err := time.Parse(time.RFC3339, v); err == nil {
+			runAt = t
 		}
-		if requireLast {
-			meta["require_last_success"] = true
-			skipAhead := false
-			if rawSkip, ok := stepMap["skip_ahead"]; ok {
-				skipAhead = normalizeBool(rawSkip)
+	} else if v, ok := stepMap["delay_seconds"].(float64); ok {
+		runAt = now.Add(time.Duration(v) * time.Second)
+	}
+
+	// Create a copy of the base config for this step
+	cfgCopy := *base
+	cfgCopy.AdditionalData = cloneAdditionalData(base.AdditionalData)
+
+	// Apply step-specific overrides BEFORE template parsing
+	// This ensures that step-specific subjects, bodies, etc. are available during placeholder resolution
+	// Raw copies are updated too so prepareSendConfig renders the step's content, not the base's.
+	if subj, ok := stepMap["subject"].(string); ok && subj != "" {
+		cfgCopy.Subject = subj
+		cfgCopy.RawSubject = subj
+	}
+	if body, ok := stepMap["body"].(string); ok {
+		cfgCopy.Body = body
+		cfgCopy.TextBody = body
+		cfgCopy.RawBody = body
+		cfgCopy.RawTextBody = body
+	}
+	if html, ok := stepMap["html_body"].(string); ok {
+		cfgCopy.HTMLBody = html
+		cfgCopy.RawHTMLBody = html
+	}
+	if toArr, ok := stepMap["to"].([]any); ok && len(toArr) > 0 {
+		var tos []string
+		for _, e := range toArr {
+			if s, ok := e.(string); ok && s != "" {
+				tos = append(tos, s)
 			}
-			meta["skip_ahead"] = skipAhead
 		}
-		if _, ok := meta["step"].(string); !ok || strings.TrimSpace(fmt.Sprint(meta["step"])) == "" {
-			meta["step"] = fmt.Sprintf("step-%d", i)
+		if len(tos) > 0 {
+			cfgCopy.To = tos
 		}
-		// Add step metadata to AdditionalData so it's available at execution time
-		if cfgCopy.AdditionalData == nil {
-			cfgCopy.AdditionalData = map[string]any{}
+	}
+	if pp, ok := stepMap["provider_priority"].([]any); ok && len(pp) > 0 {
+		var pri []string
+		for _, e := range pp {
+			if s, ok := e.(string); ok && s != "" {
+				pri = append(pri, s)
+			}
 		}
-		for k, v := range meta {
-			cfgCopy.AdditionalData[k] = v
+		if len(pri) > 0 {
+			cfgCopy.ProviderPriority = pri
 		}
-		job, err := s.Schedule(&cfgCopy, runAt, meta)
-		if err != nil {
-			return err
+	}
+	if rc, ok := stepMap["retry_count"].(float64); ok {
+		cfgCopy.RetryCount = int(rc)
+	}
+	if rd, ok := stepMap["retry_delay_seconds"].(float64); ok {
+		cfgCopy.RetryDelay = time.Duration(rd) * time.Second
+	}
+	if mrd, ok := stepMap["max_retry_delay_seconds"].(float64); ok {
+		cfgCopy.MaxRetryDelay = time.Duration(mrd) * time.Second
+	}
+	if jit, ok := stepMap["jitter_seconds"].(float64); ok {
+		cfgCopy.ScheduleJitter = time.Duration(jit) * time.Second
+	}
+
+	// Create metadata for this step
+	meta := map[string]any{"step_index": i}
+	if lastJobID != "" {
+		meta["prev_job_id"] = lastJobID
+	}
+	if name, ok := stepMap["name"].(string); ok && name != "" {
+		meta["name"] = name
+		meta["step"] = name
+	}
+	if stepLabel, ok := stepMap["step"].(string); ok && stepLabel != "" {
+		meta["step"] = stepLabel
+	}
+	if p, ok := stepMap["priority"]; ok {
+		meta["priority"] = p
+	}
+	requireLast := false
+	if rawReq, ok := stepMap["require_last_success"]; ok {
+		requireLast = normalizeBool(rawReq)
+	} else if lastJobID != "" {
+		// Default to requiring last success for subsequent steps
+		requireLast = true
+	}
+	if requireLast {
+		meta["require_last_success"] = true
+		skipAhead := false
+		if rawSkip, ok := stepMap["skip_ahead"]; ok {
+			skipAhead = normalizeBool(rawSkip)
 		}
-		lastJobID = job.ID
-		log.Printf("workflow: scheduled step %v at %s (job=%s)", meta, job.RunAt, job.ID)
+		meta["skip_ahead"] = skipAhead
 	}
-	return nil
+	if _, ok := meta["step"].(string); !ok || strings.TrimSpace(fmt.Sprint(meta["step"])) == "" {
+		meta["step"] = fmt.Sprintf("step-%d", i)
+	}
+	// Add step metadata to AdditionalData so it's available at execution time
+	if cfgCopy.AdditionalData == nil {
+		cfgCopy.AdditionalData = map[string]any{}
+	}
+	for k, v := range meta {
+		cfgCopy.AdditionalData[k] = v
+	}
+	return &cfgCopy, runAt, meta
 }
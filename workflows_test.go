@@ -0,0 +1,81 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestPreviewWorkflow_RendersEachStep(t *testing.T) {
+	base := &EmailConfig{
+		From:           "team@example.com",
+		To:             []string{"ada@example.com"},
+		Subject:        "Base subject",
+		RawSubject:     "Base subject",
+		TextBody:       "Base body",
+		RawTextBody:    "Base body",
+		AdditionalData: map[string]any{"first_name": "Ada", "premium": true},
+	}
+	def := []any{
+		map[string]any{"name": "welcome", "subject": "Welcome, {{first_name}}!", "body": "Hi {{first_name}}, this is the {{step}} step."},
+		map[string]any{"name": "tips", "delay_seconds": 3600.0, "subject": "Tips for {{first_name}}", "body": "{{#if premium}}Premium tips{{else}}Basic tips{{/if}}"},
+		map[string]any{"name": "reminder", "delay_seconds": 604800.0, "to": []any{"ops@example.com"}},
+	}
+	before := time.Now()
+	previews, err := PreviewWorkflow(base, def)
+	if err != nil {
+		t.Fatalf("PreviewWorkflow: %v", err)
+	}
+	if len(previews) != 3 {
+		t.Fatalf("expected 3 previews, got %d", len(previews))
+	}
+	wantSubjects := []string{"Welcome, Ada!", "Tips for Ada", "Base subject"}
+	for i, want := range wantSubjects {
+		if previews[i].Subject != want {
+			t.Fatalf("step %d: expected subject %q, got %q", i, want, previews[i].Subject)
+		}
+	}
+	if previews[0].Step != "welcome" || previews[0].TextBody != "Hi Ada, this is the welcome step." {
+		t.Fatalf("unexpected first step %+v", previews[0])
+	}
+	if previews[1].TextBody != "Premium tips" {
+		t.Fatalf("unexpected second body %q", previews[1].TextBody)
+	}
+	if previews[2].To[0] != "ops@example.com" || previews[2].RunAt.Before(before.Add(7*24*time.Hour)) {
+		t.Fatalf("unexpected third step %+v", previews[2])
+	}
+	if base.Subject != "Base subject" || len(base.AdditionalData) != 2 {
+		t.Fatalf("preview mutated the base config")
+	}
+}
+
+func TestScheduleGenericWorkflow_IdempotentByWorkflowID(t *testing.T) {
+	defer withTempJobResults(t, map[string]JobResult{})()
+	s := NewScheduler(NewFileJobStore(filepath.Join(t.TempDir(), "jobs.json")), time.Hour)
+	base := &EmailConfig{From: "team@example.com", To: []string{"ada@example.com"}, Subject: "Hi", WorkflowID: "onboarding-ada"}
+	def := []any{
+		map[string]any{"name": "welcome"},
+		map[string]any{"name": "tips", "delay_seconds": 3600.0},
+	}
+	if err := ScheduleGenericWorkflow(s, base, def); err != nil {
+		t.Fatalf("first schedule: %v", err)
+	}
+	// The first step has already run when the workflow is scheduled again.
+	if err := s.store.Delete(workflowJobID("onboarding-ada", 0)); err != nil {
+		t.Fatal(err)
+	}
+	recordJobResult(workflowJobID("onboarding-ada", 0), JobResultSuccess)
+	if err := ScheduleGenericWorkflow(s, base, def); err != nil {
+		t.Fatalf("second schedule: %v", err)
+	}
+	jobs, err := s.store.ListAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(jobs) != 1 || jobs[0].ID != workflowJobID("onboarding-ada", 1) || jobs[0].Meta["workflow_id"] != "onboarding-ada" {
+		t.Fatalf("expected only the pending tips step, got %+v", jobs)
+	}
+	if jobs[0].Meta["prev_job_id"] != workflowJobID("onboarding-ada", 0) {
+		t.Fatalf("expected the step to depend on the first step, got %v", jobs[0].Meta["prev_job_id"])
+	}
+}